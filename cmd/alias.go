@@ -0,0 +1,126 @@
+// Package cmd provides CLI commands for Rocklist
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/Ardakilic/rocklist/internal/service"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var aliasCmd = &cobra.Command{
+	Use:   "alias",
+	Short: "List the artist aliases used for matching",
+	Long: `List the artist aliases used to find local songs for external tracks.
+
+Songs are looked up under every name of an artist: tracks credited to an
+alias find the songs tagged with the artist or any of its other aliases.
+"The" inversion ("Beatles, The"), featured artists ("Jay-Z feat. Alicia
+Keys"), "&" and "and", accents and case are matched without an alias.
+Aliases are shared by all devices.
+
+Examples:
+  rocklist alias
+  rocklist alias add "Prince" "The Artist Formerly Known as Prince"
+  rocklist alias remove "The Artist Formerly Known as Prince"`,
+	Run: func(cmd *cobra.Command, args []string) {
+		runAliasList()
+	},
+}
+
+var aliasAddCmd = &cobra.Command{
+	Use:   "add <artist> <alias>",
+	Short: "Make alias another name of an artist",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		runAliasAdd(args[0], args[1])
+	},
+}
+
+var aliasRemoveCmd = &cobra.Command{
+	Use:   "remove <alias>",
+	Short: "Remove an artist alias",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runAliasRemove(args[0])
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(aliasCmd)
+	aliasCmd.AddCommand(aliasAddCmd)
+	aliasCmd.AddCommand(aliasRemoveCmd)
+}
+
+// openAliasService opens the service for the alias commands, exiting on failure
+func openAliasService() *service.AppService {
+	svc, err := service.NewAppService(viper.GetString("db_path"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to initialize service: %v\n", err)
+		osExit(1)
+		return nil
+	}
+	return svc
+}
+
+func runAliasList() {
+	ctx := context.Background()
+
+	svc := openAliasService()
+	if svc == nil {
+		return
+	}
+	defer func() { _ = svc.Close() }()
+
+	aliases, err := svc.GetArtistAliases(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to read aliases: %v\n", err)
+		osExit(1)
+		return
+	}
+	if len(aliases) == 0 {
+		fmt.Println("No artist aliases")
+		return
+	}
+	for _, alias := range aliases {
+		fmt.Printf("%s = %s\n", alias.Alias, alias.Artist)
+	}
+}
+
+func runAliasAdd(artist, alias string) {
+	ctx := context.Background()
+
+	svc := openAliasService()
+	if svc == nil {
+		return
+	}
+	defer func() { _ = svc.Close() }()
+
+	saved, err := svc.AddArtistAlias(ctx, artist, alias)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to add alias: %v\n", err)
+		osExit(1)
+		return
+	}
+	fmt.Printf("%s = %s\n", saved.Alias, saved.Artist)
+}
+
+func runAliasRemove(alias string) {
+	ctx := context.Background()
+
+	svc := openAliasService()
+	if svc == nil {
+		return
+	}
+	defer func() { _ = svc.Close() }()
+
+	if err := svc.RemoveArtistAlias(ctx, alias); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to remove alias: %v\n", err)
+		osExit(1)
+		return
+	}
+	fmt.Printf("Removed %s\n", alias)
+}
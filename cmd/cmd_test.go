@@ -4,8 +4,12 @@ import (
 	"context"
 	"embed"
 	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/Ardakilic/rocklist/internal/models"
+	"github.com/Ardakilic/rocklist/internal/rockbox/tcbuilder"
+	"github.com/Ardakilic/rocklist/internal/service"
 	"github.com/spf13/viper"
 )
 
@@ -125,7 +129,8 @@ func TestGenerateCmd_Long(t *testing.T) {
 
 func TestGenerateCmd_Flags(t *testing.T) {
 	// Test that flags are defined
-	flags := []string{"source", "type", "artist", "tag", "limit"}
+	flags := []string{"source", "type", "artist", "tag", "limit", "use-composer", "composer", "comment", "grouping",
+		"title-weight", "artist-weight", "album-weight", "duration-weight", "match-threshold", "duration-tolerance"}
 	for _, flag := range flags {
 		f := generateCmd.Flags().Lookup(flag)
 		if f == nil {
@@ -134,15 +139,60 @@ func TestGenerateCmd_Flags(t *testing.T) {
 	}
 }
 
+func TestRunParse_FromMissingSource(t *testing.T) {
+	originalExit := osExit
+	defer func() { osExit = originalExit }()
+
+	mock := &mockExitCapture{}
+	osExit = mock.exit
+
+	viper.Reset()
+	viper.Set("db_path", t.TempDir()+"/test.db")
+	viper.Set("device", "backup")
+
+	// No --rockbox-path is needed with --from
+	runParse(false, t.TempDir()+"/missing.zip")
+
+	if !mock.called || mock.exitCode != 1 {
+		t.Errorf("runParse() exit = %v/%d, want 1 for a missing source", mock.called, mock.exitCode)
+	}
+}
+
+func TestRunParse_FromNeedsDevice(t *testing.T) {
+	originalExit := osExit
+	defer func() { osExit = originalExit }()
+
+	mock := &mockExitCapture{}
+	osExit = mock.exit
+
+	tmpDir := t.TempDir()
+	backup := filepath.Join(tmpDir, "backup")
+	if err := tcbuilder.New([]*models.Song{{Path: "/Music/a.mp3", Title: "A"}}).Write(backup); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	viper.Reset()
+	viper.Set("db_path", filepath.Join(tmpDir, "test.db"))
+
+	runParse(false, backup)
+
+	if !mock.called || mock.exitCode != 1 {
+		t.Errorf("runParse() exit = %v/%d, want 1 without --device", mock.called, mock.exitCode)
+	}
+}
+
 func TestParseCmd_Flags(t *testing.T) {
 	f := parseCmd.Flags().Lookup("use-prefetched")
 	if f == nil {
 		t.Error("parseCmd should have flag 'use-prefetched'")
 	}
+	if parseCmd.Flags().Lookup("from") == nil {
+		t.Error("parseCmd should have flag 'from'")
+	}
 }
 
 func TestRootCmd_PersistentFlags(t *testing.T) {
-	flags := []string{"config", "rockbox-path", "db-path"}
+	flags := []string{"config", "rockbox-path", "db-path", "device"}
 	for _, flag := range flags {
 		f := rootCmd.PersistentFlags().Lookup(flag)
 		if f == nil {
@@ -242,10 +292,11 @@ func TestRunParse_NoRockboxPath(t *testing.T) {
 	mock := &mockExitCapture{}
 	osExit = mock.exit
 
-	// Clear viper config
+	// Clear viper config; a fresh database has no saved path to fall back to
 	viper.Reset()
+	viper.Set("db_path", t.TempDir()+"/test.db")
 
-	runParse(false)
+	runParse(false, "")
 
 	if !mock.called {
 		t.Error("runParse() should call osExit when rockbox-path is not set")
@@ -262,7 +313,7 @@ func TestRunGenerate_TagPlaylistNoTag(t *testing.T) {
 	mock := &mockExitCapture{}
 	osExit = mock.exit
 
-	runGenerate("lastfm", "tag", "", "", 50)
+	runGenerate(&models.PlaylistRequest{DataSource: models.DataSourceLastFM, Type: models.PlaylistTypeTag, Limit: 50}, false)
 
 	if !mock.called {
 		t.Error("runGenerate() should call osExit when tag is empty for tag playlist")
@@ -279,7 +330,7 @@ func TestRunGenerate_TopSongsNoArtist(t *testing.T) {
 	mock := &mockExitCapture{}
 	osExit = mock.exit
 
-	runGenerate("lastfm", "top_songs", "", "", 50)
+	runGenerate(&models.PlaylistRequest{DataSource: models.DataSourceLastFM, Type: models.PlaylistTypeTopSongs, Limit: 50}, false)
 
 	if !mock.called {
 		t.Error("runGenerate() should call osExit when artist is empty for top_songs")
@@ -296,7 +347,7 @@ func TestRunGenerate_MixedSongsNoArtist(t *testing.T) {
 	mock := &mockExitCapture{}
 	osExit = mock.exit
 
-	runGenerate("lastfm", "mixed_songs", "", "", 50)
+	runGenerate(&models.PlaylistRequest{DataSource: models.DataSourceLastFM, Type: models.PlaylistTypeMixedSongs, Limit: 50}, false)
 
 	if !mock.called {
 		t.Error("runGenerate() should call osExit when artist is empty for mixed_songs")
@@ -310,7 +361,7 @@ func TestRunGenerate_SimilarNoArtist(t *testing.T) {
 	mock := &mockExitCapture{}
 	osExit = mock.exit
 
-	runGenerate("lastfm", "similar", "", "", 50)
+	runGenerate(&models.PlaylistRequest{DataSource: models.DataSourceLastFM, Type: models.PlaylistTypeSimilar, Limit: 50}, false)
 
 	if !mock.called {
 		t.Error("runGenerate() should call osExit when artist is empty for similar")
@@ -326,8 +377,9 @@ func TestRunGenerate_NoRockboxPath(t *testing.T) {
 
 	// Clear viper and set valid inputs but no rockbox path
 	viper.Reset()
+	viper.Set("db_path", t.TempDir()+"/test.db")
 
-	runGenerate("lastfm", "tag", "", "rock", 50)
+	runGenerate(&models.PlaylistRequest{DataSource: models.DataSourceLastFM, Type: models.PlaylistTypeTag, Tag: "rock", Limit: 50}, false)
 
 	if !mock.called {
 		t.Error("runGenerate() should call osExit when rockbox-path is not set")
@@ -386,6 +438,7 @@ func TestParseCmd_Run(t *testing.T) {
 	osExit = mock.exit
 
 	viper.Reset()
+	viper.Set("db_path", t.TempDir()+"/test.db")
 	// Execute parse command - will fail due to missing rockbox-path
 	parseCmd.Run(parseCmd, []string{})
 
@@ -418,3 +471,355 @@ func TestOsExitVariable(t *testing.T) {
 		t.Error("osExit should not be nil")
 	}
 }
+
+func TestPushStatsCmd_Use(t *testing.T) {
+	if pushStatsCmd.Use != "push-stats" {
+		t.Errorf("pushStatsCmd.Use = %v, want push-stats", pushStatsCmd.Use)
+	}
+}
+
+func TestPushStatsCmd_Flags(t *testing.T) {
+	if pushStatsCmd.Flags().Lookup("dry-run") == nil {
+		t.Error("pushStatsCmd should have flag \"dry-run\"")
+	}
+}
+
+func TestRunPushStats_NoRockboxPath(t *testing.T) {
+	originalExit := osExit
+	defer func() { osExit = originalExit }()
+
+	mock := &mockExitCapture{}
+	osExit = mock.exit
+
+	viper.Reset()
+	viper.Set("db_path", filepath.Join(t.TempDir(), "test.db"))
+
+	runPushStats(true)
+
+	if !mock.called {
+		t.Error("runPushStats() should call osExit when rockbox-path is not set")
+	}
+	if mock.exitCode != 1 {
+		t.Errorf("runPushStats() exitCode = %d, want 1", mock.exitCode)
+	}
+}
+
+func TestInspectCmd_Use(t *testing.T) {
+	if inspectCmd.Use != "inspect" {
+		t.Errorf("inspectCmd.Use = %v, want inspect", inspectCmd.Use)
+	}
+}
+
+func TestRunInspect_NoRockboxPath(t *testing.T) {
+	originalExit := osExit
+	defer func() { osExit = originalExit }()
+
+	mock := &mockExitCapture{}
+	osExit = mock.exit
+
+	viper.Reset()
+
+	runInspect()
+
+	if !mock.called || mock.exitCode != 1 {
+		t.Errorf("runInspect() exit = %v/%d, want 1 when rockbox-path is not set", mock.called, mock.exitCode)
+	}
+}
+
+func TestDevicesCmd_Use(t *testing.T) {
+	if devicesCmd.Use != "devices" {
+		t.Errorf("devicesCmd.Use = %v, want devices", devicesCmd.Use)
+	}
+}
+
+func TestRunDevices(t *testing.T) {
+	originalExit := osExit
+	defer func() { osExit = originalExit }()
+
+	mock := &mockExitCapture{}
+	osExit = mock.exit
+
+	viper.Reset()
+	viper.Set("db_path", t.TempDir()+"/test.db")
+
+	runDevices()
+
+	if mock.called {
+		t.Errorf("runDevices() exit = %d, want no exit", mock.exitCode)
+	}
+}
+
+func TestWatchCmd_Flags(t *testing.T) {
+	for _, name := range []string{"interval", "list", "remove"} {
+		if watchCmd.Flags().Lookup(name) == nil {
+			t.Errorf("watchCmd should have flag %q", name)
+		}
+	}
+	if generateCmd.Flags().Lookup("watch") == nil {
+		t.Error("generateCmd should have flag \"watch\"")
+	}
+}
+
+func TestRunWatch_List(t *testing.T) {
+	originalExit := osExit
+	defer func() { osExit = originalExit }()
+
+	mock := &mockExitCapture{}
+	osExit = mock.exit
+
+	viper.Reset()
+	viper.Set("db_path", t.TempDir()+"/test.db")
+
+	runWatch(0, true, 0)
+	if mock.called {
+		t.Errorf("runWatch() exit = %d, want no exit", mock.exitCode)
+	}
+
+	runWatch(0, false, 1)
+	if !mock.called || mock.exitCode != 1 {
+		t.Errorf("runWatch() exit = %v/%d, want 1 when removing a missing playlist", mock.called, mock.exitCode)
+	}
+}
+
+func TestRunWatch_NoRockboxPath(t *testing.T) {
+	originalExit := osExit
+	defer func() { osExit = originalExit }()
+
+	mock := &mockExitCapture{}
+	osExit = mock.exit
+
+	viper.Reset()
+	viper.Set("db_path", t.TempDir()+"/test.db")
+
+	runWatch(0, false, 0)
+	if !mock.called || mock.exitCode != 1 {
+		t.Errorf("runWatch() exit = %v/%d, want 1 when rockbox-path is not set", mock.called, mock.exitCode)
+	}
+}
+
+func TestDebugCmd_Hidden(t *testing.T) {
+	if !debugCmd.Hidden {
+		t.Error("debugCmd should be hidden")
+	}
+	if makeFixtureCmd.Flags().Lookup("keep-names") == nil {
+		t.Error("makeFixtureCmd should have flag \"keep-names\"")
+	}
+}
+
+func TestRunParse_TagCache(t *testing.T) {
+	originalExit := osExit
+	defer func() { osExit = originalExit }()
+
+	mock := &mockExitCapture{}
+	osExit = mock.exit
+
+	tmpDir := t.TempDir()
+	device := filepath.Join(tmpDir, "device")
+	songs := []*models.Song{
+		{Path: "/Music/Artist/01 - One.mp3", Title: "One", Artist: "Artist"},
+		{Path: "/Music/Artist/02 - Two.mp3", Title: "Two", Artist: "Artist"},
+	}
+	if err := tcbuilder.New(songs).Write(device); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	viper.Reset()
+	viper.Set("db_path", filepath.Join(tmpDir, "test.db"))
+	viper.Set("rockbox_path", device)
+
+	runParse(false, "")
+	if mock.called {
+		t.Fatalf("runParse() exited with %d", mock.exitCode)
+	}
+
+	// Write an anonymised copy and parse it as a backup
+	fixture := filepath.Join(tmpDir, "fixture")
+	runMakeFixture(fixture, false)
+	if mock.called {
+		t.Fatalf("runMakeFixture() exited with %d", mock.exitCode)
+	}
+	viper.Set("device", "fixture")
+	runParse(false, fixture)
+	if mock.called {
+		t.Fatalf("runParse() of the fixture exited with %d", mock.exitCode)
+	}
+
+	// Parsing the backup leaves the player selected
+	svc, err := service.NewAppService(filepath.Join(tmpDir, "test.db"))
+	if err != nil {
+		t.Fatalf("NewAppService() error = %v", err)
+	}
+	defer func() { _ = svc.Close() }()
+	if device := svc.ActiveDevice(); device.Name != models.DefaultDeviceName {
+		t.Errorf("ActiveDevice() = %q, want %q", device.Name, models.DefaultDeviceName)
+	}
+}
+
+func TestRunParse_Device(t *testing.T) {
+	originalExit := osExit
+	defer func() { osExit = originalExit }()
+
+	mock := &mockExitCapture{}
+	osExit = mock.exit
+
+	tmpDir := t.TempDir()
+	device := filepath.Join(tmpDir, "FUZE")
+	songs := []*models.Song{{Path: "/Music/a.mp3", Title: "A", Artist: "Artist"}}
+	if err := tcbuilder.New(songs).Write(device); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	dbPath := filepath.Join(tmpDir, "test.db")
+	viper.Reset()
+	viper.Set("db_path", dbPath)
+	viper.Set("device", "fuze")
+	viper.Set("rockbox_path", device)
+
+	runParse(false, "")
+	if mock.called {
+		t.Fatalf("runParse() exited with %d", mock.exitCode)
+	}
+
+	// The device remembers its path
+	viper.Set("rockbox_path", "")
+	runParse(false, "")
+	if mock.called {
+		t.Fatalf("runParse() without --rockbox-path exited with %d", mock.exitCode)
+	}
+
+	svc, err := service.NewAppService(dbPath)
+	if err != nil {
+		t.Fatalf("NewAppService() error = %v", err)
+	}
+	defer func() { _ = svc.Close() }()
+	ctx := context.Background()
+
+	if device := svc.ActiveDevice(); device.Name != "fuze" {
+		t.Errorf("ActiveDevice() = %q, want fuze", device.Name)
+	}
+	if count, _ := svc.GetSongCount(ctx); count != 1 {
+		t.Errorf("fuze songs = %d, want 1", count)
+	}
+	if _, err := svc.SelectDevice(ctx, models.DefaultDeviceName); err != nil {
+		t.Fatalf("SelectDevice() error = %v", err)
+	}
+	if count, _ := svc.GetSongCount(ctx); count != 0 {
+		t.Errorf("default songs = %d, want 0", count)
+	}
+}
+
+func TestImportPlaysCmd_Flags(t *testing.T) {
+	if importPlaysCmd.Use != "import-plays" {
+		t.Errorf("importPlaysCmd.Use = %v, want import-plays", importPlaysCmd.Use)
+	}
+	if importPlaysCmd.Flags().Lookup("file") == nil {
+		t.Error("importPlaysCmd should have flag 'file'")
+	}
+}
+
+func TestRunImportPlays(t *testing.T) {
+	originalExit := osExit
+	defer func() { osExit = originalExit }()
+
+	mock := &mockExitCapture{}
+	osExit = mock.exit
+
+	tmpDir := t.TempDir()
+	viper.Reset()
+	viper.Set("db_path", filepath.Join(tmpDir, "test.db"))
+
+	runImportPlays("")
+	if !mock.called || mock.exitCode != 1 {
+		t.Fatalf("runImportPlays() exit = %v/%d, want 1 without a device", mock.called, mock.exitCode)
+	}
+
+	mock.called = false
+	log := filepath.Join(tmpDir, ".scrobbler.log")
+	_ = os.WriteFile(log, []byte("#AUDIOSCROBBLER/1.1\n#TZ/UNKNOWN\nMetallica\tMaster of Puppets\tBattery\t1\t312\tL\t1700000000\t\n"), 0644)
+	runImportPlays(log)
+	if mock.called {
+		t.Errorf("runImportPlays() exited with %d", mock.exitCode)
+	}
+}
+
+func TestAliasCmd_Subcommands(t *testing.T) {
+	for _, name := range []string{"add", "remove"} {
+		if cmd, _, err := aliasCmd.Find([]string{name}); err != nil || cmd.Name() != name {
+			t.Errorf("aliasCmd should have subcommand %q", name)
+		}
+	}
+}
+
+func TestRunAlias(t *testing.T) {
+	originalExit := osExit
+	defer func() { osExit = originalExit }()
+
+	mock := &mockExitCapture{}
+	osExit = mock.exit
+
+	viper.Reset()
+	viper.Set("db_path", filepath.Join(t.TempDir(), "test.db"))
+
+	runAliasAdd("Prince", "TAFKAP")
+	runAliasList()
+	runAliasRemove("TAFKAP")
+	if mock.called {
+		t.Fatalf("alias commands exited with %d", mock.exitCode)
+	}
+
+	runAliasRemove("TAFKAP")
+	if !mock.called || mock.exitCode != 1 {
+		t.Errorf("runAliasRemove() exit = %v/%d, want 1 for an unknown alias", mock.called, mock.exitCode)
+	}
+
+	mock.called = false
+	runAliasAdd("The Beatles", "Beatles, The")
+	if !mock.called || mock.exitCode != 1 {
+		t.Errorf("runAliasAdd() exit = %v/%d, want 1 for a name that already matches", mock.called, mock.exitCode)
+	}
+}
+
+func TestRunMakeFixture_NoRockboxPath(t *testing.T) {
+	originalExit := osExit
+	defer func() { osExit = originalExit }()
+
+	mock := &mockExitCapture{}
+	osExit = mock.exit
+
+	viper.Reset()
+
+	runMakeFixture(t.TempDir(), false)
+
+	if !mock.called || mock.exitCode != 1 {
+		t.Errorf("runMakeFixture() exit = %v/%d, want 1 when rockbox-path is not set", mock.called, mock.exitCode)
+	}
+}
+
+func TestEnrichCmd_Flags(t *testing.T) {
+	if enrichCmd.Use != "enrich" {
+		t.Errorf("enrichCmd.Use = %v, want enrich", enrichCmd.Use)
+	}
+	flag := enrichCmd.Flags().Lookup("source")
+	if flag == nil {
+		t.Fatal("enrichCmd should have flag 'source'")
+	}
+	if flag.DefValue != "musicbrainz" {
+		t.Errorf("source default = %v, want musicbrainz", flag.DefValue)
+	}
+}
+
+func TestRunEnrich(t *testing.T) {
+	originalExit := osExit
+	defer func() { osExit = originalExit }()
+
+	mock := &mockExitCapture{}
+	osExit = mock.exit
+
+	viper.Reset()
+	viper.Set("db_path", filepath.Join(t.TempDir(), "test.db"))
+
+	runEnrich(models.DataSourceMusicBrainz)
+	if !mock.called || mock.exitCode != 1 {
+		t.Errorf("runEnrich() exit = %v/%d, want 1 without songs", mock.called, mock.exitCode)
+	}
+}
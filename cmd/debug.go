@@ -0,0 +1,84 @@
+// Package cmd provides CLI commands for Rocklist
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/Ardakilic/rocklist/internal/service"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var debugCmd = &cobra.Command{
+	Use:    "debug",
+	Short:  "Tools for reporting problems",
+	Hidden: true,
+}
+
+var makeFixtureCmd = &cobra.Command{
+	Use:   "make-fixture <output-dir>",
+	Short: "Write an anonymised copy of the device database",
+	Long: `Parse the Rockbox database and write the songs as a new database under
+<output-dir>/.rockbox, to attach to a bug report.
+
+Artists, albums, titles, folders and file names are replaced by placeholders
+such as "Artist 3"; numbers, play statistics and the shape of the library
+are kept. Use --keep-names to write the real names.
+
+Example:
+  rocklist debug make-fixture --rockbox-path /Volumes/IPOD ./ipod-fixture`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		keepNames, _ := cmd.Flags().GetBool("keep-names")
+		runMakeFixture(args[0], keepNames)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(debugCmd)
+	debugCmd.AddCommand(makeFixtureCmd)
+	makeFixtureCmd.Flags().Bool("keep-names", false, "Keep the real names instead of placeholders")
+}
+
+func runMakeFixture(output string, keepNames bool) {
+	ctx := context.Background()
+
+	rockboxPath := viper.GetString("rockbox_path")
+	if rockboxPath == "" {
+		fmt.Fprintln(os.Stderr, "Error: --rockbox-path is required")
+		osExit(1)
+		return
+	}
+
+	dbPath := viper.GetString("db_path")
+	svc, err := service.NewAppService(dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to initialize service: %v\n", err)
+		osExit(1)
+		return
+	}
+	defer func() { _ = svc.Close() }()
+
+	if err := selectDevice(ctx, svc); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to select device: %v\n", err)
+		osExit(1)
+		return
+	}
+
+	if err := svc.SetRockboxPath(rockboxPath); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to set Rockbox path: %v\n", err)
+		osExit(1)
+		return
+	}
+
+	count, err := svc.MakeFixture(ctx, output, keepNames)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to make fixture: %v\n", err)
+		osExit(1)
+		return
+	}
+
+	fmt.Printf("Wrote %d songs to %s\n", count, output)
+}
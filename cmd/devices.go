@@ -0,0 +1,92 @@
+// Package cmd provides CLI commands for Rocklist
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/Ardakilic/rocklist/internal/service"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var devicesCmd = &cobra.Command{
+	Use:   "devices",
+	Short: "List the devices and the mounted Rockbox players",
+	Long: `List the devices Rocklist keeps a library for, then look for mounted players
+with a Rockbox database.
+
+Each device has its own songs, playlists and parse history. The device in use
+is marked with *; select another with --device on any command.
+
+The mount points in /proc/mounts and the folders under /media and /run/media
+are checked for a .rockbox/database_idx.tcd. The target and Rockbox version
+are read from .rockbox/rockbox-info.txt. Use a listed path as --rockbox-path.
+
+Example:
+  rocklist devices`,
+	Run: func(cmd *cobra.Command, args []string) {
+		runDevices()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(devicesCmd)
+}
+
+func runDevices() {
+	ctx := context.Background()
+
+	dbPath := viper.GetString("db_path")
+	svc, err := service.NewAppService(dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to initialize service: %v\n", err)
+		osExit(1)
+		return
+	}
+	defer func() { _ = svc.Close() }()
+
+	known, err := svc.GetDevices(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to read devices: %v\n", err)
+		osExit(1)
+		return
+	}
+	active := svc.ActiveDevice()
+	fmt.Println("Devices:")
+	for _, device := range known {
+		marker := " "
+		if device.ID == active.ID {
+			marker = "*"
+		}
+		lastParsed := "never parsed"
+		if device.LastParsedAt != nil {
+			lastParsed = "last parsed " + device.LastParsedAt.Format("2006-01-02 15:04")
+		}
+		fmt.Printf("%s %s: %s, %s\n", marker, device.Name, orUnknown(device.Path), lastParsed)
+	}
+	fmt.Println()
+
+	devices := svc.FindDevices()
+	if len(devices) == 0 {
+		fmt.Println("No Rockbox devices found")
+		return
+	}
+
+	fmt.Printf("Found %d Rockbox device(s):\n", len(devices))
+	for _, device := range devices {
+		fmt.Printf("  %s\n", device.Path)
+		if device.Target != "" || device.Version != "" {
+			fmt.Printf("    target: %s, version: %s\n", orUnknown(device.Target), orUnknown(device.Version))
+		}
+	}
+}
+
+// orUnknown returns s, or "unknown" when it is empty
+func orUnknown(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+	return s
+}
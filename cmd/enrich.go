@@ -0,0 +1,125 @@
+// Package cmd provides CLI commands for Rocklist
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/Ardakilic/rocklist/internal/models"
+	"github.com/Ardakilic/rocklist/internal/service"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var enrichCmd = &cobra.Command{
+	Use:   "enrich",
+	Short: "Match the library against a data source ahead of playlist generation",
+	Long: `Search a data source for every song that has no ID there yet, and store the
+ID of each confident match with the song.
+
+Playlist generation finds songs with a stored ID directly instead of fuzzy
+matching their names, so enriching the library once makes later playlists
+faster and more accurate. Searches are spaced to respect the rate limits of
+the source, so a large library takes a while; MusicBrainz allows about one
+search a second.
+
+The job can be stopped with Ctrl+C and resumes where it stopped when run
+again. Last.fm and Spotify use the credentials saved by 'rocklist generate'.
+
+Supported sources:
+  - musicbrainz: MusicBrainz (default, needs no credentials)
+  - lastfm: Last.fm
+  - spotify: Spotify
+
+Examples:
+  rocklist enrich
+  rocklist enrich --source lastfm --device ipod-classic`,
+	Run: func(cmd *cobra.Command, args []string) {
+		source, _ := cmd.Flags().GetString("source")
+		runEnrich(models.DataSource(source))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(enrichCmd)
+	enrichCmd.Flags().StringP("source", "s", "musicbrainz", "Data source (musicbrainz, lastfm, spotify)")
+}
+
+func runEnrich(source models.DataSource) {
+	ctx := context.Background()
+
+	dbPath := viper.GetString("db_path")
+	svc, err := service.NewAppService(dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to initialize service: %v\n", err)
+		osExit(1)
+		return
+	}
+	defer func() { _ = svc.Close() }()
+
+	if err := selectDevice(ctx, svc); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to select device: %v\n", err)
+		osExit(1)
+		return
+	}
+
+	// MusicBrainz needs no credentials, so it is enabled on first use
+	config := svc.GetConfig()
+	if source == models.DataSourceMusicBrainz && !config.MusicBrainz.Enabled {
+		config.MusicBrainz.Enabled = true
+		if err := svc.SaveConfig(ctx, config); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Failed to save config: %v\n", err)
+		}
+	}
+
+	// Check song count
+	count, _ := svc.GetSongCount(ctx)
+	if count == 0 {
+		fmt.Fprintln(os.Stderr, "Error: No songs in database. Run 'rocklist parse' first.")
+		osExit(1)
+		return
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	fmt.Printf("Found %d songs in database\n", count)
+	fmt.Printf("Matching songs against %s (Ctrl+C to stop)...\n", source.DisplayName())
+
+	status, err := svc.EnrichLibrary(ctx, source)
+	switch {
+	case errors.Is(err, models.ErrDataSourceDisabled):
+		fmt.Fprintf(os.Stderr, "Error: %s is not configured. Save its credentials with 'rocklist generate --source %s' first.\n", source.DisplayName(), source)
+		osExit(1)
+		return
+	case errors.Is(err, models.ErrOperationCancelled):
+		printEnrichStatus(status)
+		fmt.Println("Stopped. Run 'rocklist enrich' again to resume.")
+		return
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "Error: Failed to enrich library: %v\n", err)
+		if status != nil {
+			printEnrichStatus(status)
+			fmt.Println("Run 'rocklist enrich' again to resume.")
+		}
+		osExit(1)
+		return
+	}
+
+	fmt.Printf("\nEnrichment completed!\n")
+	printEnrichStatus(status)
+}
+
+// printEnrichStatus prints the counts of an enrichment job
+func printEnrichStatus(status *models.EnrichStatus) {
+	fmt.Printf("  Searched: %d/%d\n", status.ProcessedSongs, status.TotalSongs)
+	fmt.Printf("  Matched: %d\n", status.MatchedSongs)
+	fmt.Printf("  Unmatched: %d\n", status.UnmatchedSongs)
+	if status.ErrorCount > 0 {
+		fmt.Printf("  Errors: %d (last: %s)\n", status.ErrorCount, status.LastError)
+	}
+}
@@ -28,18 +28,60 @@ Available playlist types:
   - similar: Songs from similar artists
   - tag: Songs matching a genre/tag
 
+Tracks are matched to local songs by title, artist, album and duration.
+The --*-weight flags set how much each counts relative to the others, and
+--match-threshold the lowest score (0-1) accepted; raise it for fewer wrong
+matches, lower it to match more songs. A threshold of 0 accepts the best
+candidate for every track, and a --duration-tolerance of 0 only fully
+matches equal durations.
+
 Examples:
   rocklist generate --source lastfm --type top_songs --artist "Metallica"
   rocklist generate --source spotify --type tag --tag "death metal" --limit 100
-  rocklist generate --source musicbrainz --type similar --artist "Iron Maiden"`,
+  rocklist generate --source musicbrainz --type similar --artist "Iron Maiden"
+  rocklist generate --source lastfm --type top_songs --artist "Hans Zimmer" --use-composer --grouping "Interstellar"
+  rocklist generate --source lastfm --type top_songs --artist "Metallica" --watch
+  rocklist generate --source spotify --type top_songs --artist "Metallica" --duration-weight 0.5 --match-threshold 0.7`,
 	Run: func(cmd *cobra.Command, args []string) {
 		source, _ := cmd.Flags().GetString("source")
 		playlistType, _ := cmd.Flags().GetString("type")
 		artist, _ := cmd.Flags().GetString("artist")
 		tag, _ := cmd.Flags().GetString("tag")
 		limit, _ := cmd.Flags().GetInt("limit")
-
-		runGenerate(source, playlistType, artist, tag, limit)
+		useComposer, _ := cmd.Flags().GetBool("use-composer")
+		composer, _ := cmd.Flags().GetString("composer")
+		comment, _ := cmd.Flags().GetString("comment")
+		grouping, _ := cmd.Flags().GetString("grouping")
+		watch, _ := cmd.Flags().GetBool("watch")
+		titleWeight, _ := cmd.Flags().GetFloat64("title-weight")
+		artistWeight, _ := cmd.Flags().GetFloat64("artist-weight")
+		albumWeight, _ := cmd.Flags().GetFloat64("album-weight")
+		durationWeight, _ := cmd.Flags().GetFloat64("duration-weight")
+		threshold, _ := cmd.Flags().GetFloat64("match-threshold")
+		durationTolerance, _ := cmd.Flags().GetInt("duration-tolerance")
+
+		req := &models.PlaylistRequest{
+			DataSource:  models.DataSource(source),
+			Type:        models.PlaylistType(playlistType),
+			Artist:      artist,
+			Tag:         tag,
+			Limit:       limit,
+			UseComposer: useComposer,
+			Composer:    composer,
+			Comment:     comment,
+			Grouping:    grouping,
+			Match: models.MatchWeights{
+				Title:                titleWeight,
+				Artist:               artistWeight,
+				Album:                albumWeight,
+				Duration:             durationWeight,
+				Threshold:            threshold,
+				ThresholdSet:         cmd.Flags().Changed("match-threshold"),
+				DurationTolerance:    durationTolerance,
+				DurationToleranceSet: cmd.Flags().Changed("duration-tolerance"),
+			},
+		}
+		runGenerate(req, watch)
 	},
 }
 
@@ -51,6 +93,20 @@ func init() {
 	generateCmd.Flags().StringP("artist", "a", "", "Artist name (required for artist-based playlists)")
 	generateCmd.Flags().String("tag", "", "Tag/genre name (required for tag playlists)")
 	generateCmd.Flags().IntP("limit", "l", 50, "Maximum number of songs to include")
+	generateCmd.Flags().Bool("use-composer", false, "Also match the artist against the composer field")
+	generateCmd.Flags().String("composer", "", "Only include songs whose composer contains this value")
+	generateCmd.Flags().String("comment", "", "Only include songs whose comment contains this value")
+	generateCmd.Flags().String("grouping", "", "Only include songs whose grouping contains this value")
+	generateCmd.Flags().Bool("watch", false, "Also regenerate this playlist whenever 'rocklist watch' sees the device")
+
+	// Match scoring; weights of zero and flags not given use the defaults
+	defaults := service.DefaultMatchWeights
+	generateCmd.Flags().Float64("title-weight", 0, fmt.Sprintf("Weight of title similarity (default %g when no weight is set)", defaults.Title))
+	generateCmd.Flags().Float64("artist-weight", 0, fmt.Sprintf("Weight of artist similarity (default %g when no weight is set)", defaults.Artist))
+	generateCmd.Flags().Float64("album-weight", 0, fmt.Sprintf("Weight of album similarity (default %g when no weight is set)", defaults.Album))
+	generateCmd.Flags().Float64("duration-weight", 0, fmt.Sprintf("Weight of duration closeness (default %g when no weight is set)", defaults.Duration))
+	generateCmd.Flags().Float64("match-threshold", 0, fmt.Sprintf("Lowest match score from 0 to 1 accepted (default %g)", defaults.Threshold))
+	generateCmd.Flags().Int("duration-tolerance", 0, fmt.Sprintf("Seconds durations may differ and still fully match (default %d)", defaults.DurationTolerance))
 
 	// API credentials
 	generateCmd.Flags().String("lastfm-api-key", "", "Last.fm API key")
@@ -66,16 +122,18 @@ func init() {
 	_ = viper.BindPFlag("musicbrainz_user_agent", generateCmd.Flags().Lookup("musicbrainz-user-agent"))
 }
 
-func runGenerate(source, playlistType, artist, tag string, limit int) {
+func runGenerate(req *models.PlaylistRequest, watch bool) {
 	ctx := context.Background()
+	source := string(req.DataSource)
+	playlistType := string(req.Type)
 
 	// Validate inputs
-	if playlistType == "tag" && tag == "" {
+	if playlistType == "tag" && req.Tag == "" {
 		fmt.Fprintln(os.Stderr, "Error: --tag is required for tag playlists")
 		osExit(1)
 		return
 	}
-	if (playlistType == "top_songs" || playlistType == "mixed_songs" || playlistType == "similar") && artist == "" {
+	if (playlistType == "top_songs" || playlistType == "mixed_songs" || playlistType == "similar") && req.Artist == "" {
 		fmt.Fprintln(os.Stderr, "Error: --artist is required for this playlist type")
 		osExit(1)
 		return
@@ -90,15 +148,27 @@ func runGenerate(source, playlistType, artist, tag string, limit int) {
 	}
 	defer func() { _ = svc.Close() }()
 
-	// Set Rockbox path
-	rockboxPath := viper.GetString("rockbox_path")
-	if rockboxPath == "" {
+	if err := selectDevice(ctx, svc); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to select device: %v\n", err)
+		osExit(1)
+		return
+	}
+
+	// Set Rockbox path; without --rockbox-path the device's saved path is used
+	if rockboxPath := viper.GetString("rockbox_path"); rockboxPath != "" {
+		if err := svc.SetRockboxPath(rockboxPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Failed to set Rockbox path: %v\n", err)
+			osExit(1)
+			return
+		}
+	}
+	if svc.GetConfig().RockboxPath == "" {
 		fmt.Fprintln(os.Stderr, "Error: --rockbox-path is required")
 		osExit(1)
 		return
 	}
-	if err := svc.SetRockboxPath(rockboxPath); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: Failed to set Rockbox path: %v\n", err)
+	if err := setVolumes(ctx, svc); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to set volumes: %v\n", err)
 		osExit(1)
 		return
 	}
@@ -136,14 +206,6 @@ func runGenerate(source, playlistType, artist, tag string, limit int) {
 	fmt.Printf("Found %d songs in database\n", count)
 	fmt.Printf("Generating %s playlist from %s...\n", playlistType, source)
 
-	req := &models.PlaylistRequest{
-		DataSource: models.DataSource(source),
-		Type:       models.PlaylistType(playlistType),
-		Artist:     artist,
-		Tag:        tag,
-		Limit:      limit,
-	}
-
 	playlist, err := svc.GeneratePlaylist(ctx, req)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: Failed to generate playlist: %v\n", err)
@@ -157,4 +219,13 @@ func runGenerate(source, playlistType, artist, tag string, limit int) {
 	if playlist.FilePath != "" {
 		fmt.Printf("  Exported to: %s\n", playlist.FilePath)
 	}
+
+	if watch {
+		if err := svc.AddWatchPlaylist(ctx, req); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Failed to save watch playlist: %v\n", err)
+			osExit(1)
+			return
+		}
+		fmt.Println("  Regenerated by 'rocklist watch'")
+	}
 }
@@ -40,7 +40,8 @@ func (a *App) startup(ctx context.Context) {
 	}
 	a.service = svc
 
-	// Set Rockbox path if provided
+	// Select the device and set the Rockbox path if provided
+	_ = selectDevice(ctx, a.service)
 	if path := viper.GetString("rockbox_path"); path != "" {
 		_ = a.service.SetRockboxPath(path)
 	}
@@ -75,6 +76,28 @@ func (a *App) SetRockboxPath(path string) error {
 	return a.service.SetRockboxPath(path)
 }
 
+// SetVolume sets the host folder of an extra player volume such as
+// microSD1; an empty folder removes the volume
+func (a *App) SetVolume(name, dir string) error {
+	return a.service.SetVolumes(a.ctx, map[string]string{name: dir})
+}
+
+// FindDevices returns the mounted Rockbox devices
+func (a *App) FindDevices() interface{} {
+	return a.service.FindDevices()
+}
+
+// GetDevices returns the devices Rocklist keeps a library for
+func (a *App) GetDevices() interface{} {
+	devices, _ := a.service.GetDevices(a.ctx)
+	return devices
+}
+
+// SelectDevice switches to the library of the named device, adding it when new
+func (a *App) SelectDevice(name string) (interface{}, error) {
+	return a.service.SelectDevice(a.ctx, name)
+}
+
 // SelectDirectory opens a directory picker dialog and returns the selected path
 func (a *App) SelectDirectory() (string, error) {
 	return runtime.OpenDirectoryDialog(a.ctx, runtime.OpenDialogOptions{
@@ -108,8 +131,8 @@ func (a *App) SetMusicBrainzCredentials(userAgent string, enabled bool) error {
 	return a.service.SaveConfig(a.ctx, config)
 }
 
-// ParseDatabase parses the Rockbox database
-func (a *App) ParseDatabase(usePrefetched bool) error {
+// ParseDatabase parses the Rockbox database and returns the sync result
+func (a *App) ParseDatabase(usePrefetched bool) (interface{}, error) {
 	return a.service.ParseRockboxDatabase(a.ctx, usePrefetched)
 }
 
@@ -118,12 +141,44 @@ func (a *App) GetParseStatus() interface{} {
 	return a.service.GetParseStatus()
 }
 
+// InspectDatabase parses the device without saving and returns the parse
+// status with its diagnostics
+func (a *App) InspectDatabase() (interface{}, error) {
+	return a.service.InspectDatabase(a.ctx)
+}
+
+// ImportPlays imports the device's .scrobbler.log into the play history
+func (a *App) ImportPlays() (interface{}, error) {
+	return a.service.ImportPlays(a.ctx, "")
+}
+
+// EnrichLibrary matches the library against a data source, resuming a
+// stopped job
+func (a *App) EnrichLibrary(source string) (interface{}, error) {
+	return a.service.EnrichLibrary(a.ctx, models.DataSource(source))
+}
+
+// GetEnrichStatus returns the status of the running or last enrichment job
+func (a *App) GetEnrichStatus() interface{} {
+	return a.service.GetEnrichStatus()
+}
+
+// CancelEnrich stops the running enrichment job
+func (a *App) CancelEnrich() {
+	a.service.CancelEnrich()
+}
+
 // GetLastParsedAt returns the last parsed timestamp
 func (a *App) GetLastParsedAt() interface{} {
 	t, _ := a.service.GetLastParsedAt(a.ctx)
 	return t
 }
 
+// PushStats writes changed ratings and play counts to the device changelog
+func (a *App) PushStats(dryRun bool) (interface{}, error) {
+	return a.service.PushStats(a.ctx, dryRun)
+}
+
 // GeneratePlaylist generates a playlist
 // useAlbumArtist: when true, prioritizes album artist field for matching (with fallback to artist if empty)
 func (a *App) GeneratePlaylist(dataSource, playlistType, artist, tag string, limit int, useAlbumArtist bool) (interface{}, error) {
@@ -162,6 +217,28 @@ func (a *App) GetAllPlaylists() interface{} {
 	return playlists
 }
 
+// GetPlaylistEntries returns the entries of a playlist, flagging songs no longer on the device
+func (a *App) GetPlaylistEntries(id uint) interface{} {
+	entries, _ := a.service.GetPlaylistEntries(a.ctx, id)
+	return entries
+}
+
+// GetArtistAliases returns the user's artist aliases
+func (a *App) GetArtistAliases() interface{} {
+	aliases, _ := a.service.GetArtistAliases(a.ctx)
+	return aliases
+}
+
+// AddArtistAlias makes alias another name of artist for matching
+func (a *App) AddArtistAlias(artist, alias string) (interface{}, error) {
+	return a.service.AddArtistAlias(a.ctx, artist, alias)
+}
+
+// RemoveArtistAlias removes an artist alias
+func (a *App) RemoveArtistAlias(alias string) error {
+	return a.service.RemoveArtistAlias(a.ctx, alias)
+}
+
 // DeletePlaylist deletes a playlist
 func (a *App) DeletePlaylist(id uint) error {
 	return a.service.DeletePlaylist(a.ctx, id)
@@ -0,0 +1,91 @@
+// Package cmd provides CLI commands for Rocklist
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/Ardakilic/rocklist/internal/service"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var importPlaysCmd = &cobra.Command{
+	Use:   "import-plays",
+	Short: "Import the plays logged by the Last.fm scrobbler plugin",
+	Long: `Import the .scrobbler.log written by Rockbox's Last.fm scrobbler plugin into
+the play history of the device.
+
+Each play listened to adds one to the play count of its song and updates its
+last played time. Songs are matched by file path when the log has one, then
+by artist and title. A re-parse adds the imported plays to the counts read
+from the device again, and push-stats does not write them back. Plays of
+songs not in the library yet are counted once a parse adds them. Plays
+already imported are recognised by their time, so the log can be imported
+again as it grows. Skipped tracks are kept in the history without being
+counted.
+
+The log is read from the root of the device unless --file is given.
+
+Examples:
+  rocklist import-plays --rockbox-path /Volumes/IPOD
+  rocklist import-plays --file ~/backup/.scrobbler.log`,
+	Run: func(cmd *cobra.Command, args []string) {
+		file, _ := cmd.Flags().GetString("file")
+		runImportPlays(file)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(importPlaysCmd)
+	importPlaysCmd.Flags().String("file", "", "Scrobbler log to import instead of the device's")
+}
+
+func runImportPlays(file string) {
+	ctx := context.Background()
+
+	dbPath := viper.GetString("db_path")
+	svc, err := service.NewAppService(dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to initialize service: %v\n", err)
+		osExit(1)
+		return
+	}
+	defer func() { _ = svc.Close() }()
+
+	if err := selectDevice(ctx, svc); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to select device: %v\n", err)
+		osExit(1)
+		return
+	}
+
+	// Without --rockbox-path the device's saved path is used
+	if rockboxPath := viper.GetString("rockbox_path"); rockboxPath != "" {
+		if err := svc.SetRockboxPath(rockboxPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Failed to set Rockbox path: %v\n", err)
+			osExit(1)
+			return
+		}
+	}
+	if file == "" && svc.GetConfig().RockboxPath == "" {
+		fmt.Fprintln(os.Stderr, "Error: --rockbox-path or --file is required")
+		osExit(1)
+		return
+	}
+
+	result, err := svc.ImportPlays(ctx, file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to import plays: %v\n", err)
+		osExit(1)
+		return
+	}
+
+	fmt.Printf("Imported %d plays (%d already imported)\n", result.Imported, result.Duplicates)
+	fmt.Printf("  Counted: %d\n", result.Counted)
+	fmt.Printf("  Skipped tracks: %d\n", result.Skipped)
+	fmt.Printf("  Unmatched: %d\n", result.Unmatched)
+	if result.Invalid > 0 {
+		fmt.Printf("  Unreadable lines: %d\n", result.Invalid)
+	}
+}
@@ -0,0 +1,97 @@
+// Package cmd provides CLI commands for Rocklist
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/Ardakilic/rocklist/internal/service"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var inspectCmd = &cobra.Command{
+	Use:   "inspect",
+	Short: "Check the Rockbox database for damaged records",
+	Long: `Read the Rockbox database without saving anything and report its health.
+
+Damaged records in the TagCache files are skipped during a parse. This command
+lists every skipped record with its file, byte offset, entry index and the
+reason, which explains songs missing after a parse.
+
+Example:
+  rocklist inspect --rockbox-path /Volumes/IPOD`,
+	Run: func(cmd *cobra.Command, args []string) {
+		runInspect()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(inspectCmd)
+}
+
+func runInspect() {
+	ctx := context.Background()
+
+	rockboxPath := viper.GetString("rockbox_path")
+	if rockboxPath == "" {
+		fmt.Fprintln(os.Stderr, "Error: --rockbox-path is required")
+		osExit(1)
+		return
+	}
+
+	dbPath := viper.GetString("db_path")
+	svc, err := service.NewAppService(dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to initialize service: %v\n", err)
+		osExit(1)
+		return
+	}
+	defer func() { _ = svc.Close() }()
+
+	if err := selectDevice(ctx, svc); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to select device: %v\n", err)
+		osExit(1)
+		return
+	}
+
+	if err := svc.SetRockboxPath(rockboxPath); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to set Rockbox path: %v\n", err)
+		osExit(1)
+		return
+	}
+	if err := setVolumes(ctx, svc); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to set volumes: %v\n", err)
+		osExit(1)
+		return
+	}
+
+	status, err := svc.InspectDatabase(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to read database: %v\n", err)
+		osExit(1)
+		return
+	}
+
+	fmt.Printf("Source: %s\n", status.Source)
+	if status.TagCacheVersion != 0 {
+		fmt.Printf("TagCache version: 0x%02x\n", status.TagCacheVersion)
+	}
+	fmt.Printf("Songs: %d\n", status.TotalSongs)
+	fmt.Printf("Serial: %d, commit ID: %d, dirty: %v\n", status.Serial, status.CommitID, status.DatabaseDirty)
+	fmt.Printf("Deleted entries: %d\n", status.DeletedEntries)
+
+	if len(status.Diagnostics) == 0 {
+		fmt.Println("No damaged records found")
+		return
+	}
+
+	fmt.Printf("Damaged records (%d):\n", status.ErrorCount)
+	for _, d := range status.Diagnostics {
+		fmt.Printf("  %s\n", d)
+	}
+	if more := status.ErrorCount - len(status.Diagnostics); more > 0 {
+		fmt.Printf("  ... and %d more\n", more)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/Ardakilic/rocklist/internal/models"
 	"github.com/Ardakilic/rocklist/internal/service"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -19,20 +20,35 @@ var parseCmd = &cobra.Command{
 This command reads the TagCache files from the Rockbox device and extracts
 metadata for all songs. The information is stored locally for playlist generation.
 
+A backup of the device can be parsed with --from instead: a folder, a zip
+archive or a FAT disk image (such as one taken with dd) holding the .rockbox
+folder, which may be nested up to two levels deep. A backup needs --device:
+songs missing from the backup are removed from that device's library, so
+name a new device to keep the backup apart from the player. Parsing a
+backup does not change the selected device.
+
+Each device keeps its own library: with --device the songs are parsed into
+the named device's library, and without --rockbox-path its saved path is used.
+
 Example:
-  rocklist parse --rockbox-path /Volumes/IPOD`,
+  rocklist parse --rockbox-path /Volumes/IPOD
+  rocklist parse --device fuze --rockbox-path /media/user/FUZE
+  rocklist parse --from ipod-backup.zip --device ipod-backup
+  rocklist parse --from ipod.img --device ipod-backup`,
 	Run: func(cmd *cobra.Command, args []string) {
 		usePrefetched, _ := cmd.Flags().GetBool("use-prefetched")
-		runParse(usePrefetched)
+		from, _ := cmd.Flags().GetString("from")
+		runParse(usePrefetched, from)
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(parseCmd)
 	parseCmd.Flags().Bool("use-prefetched", false, "Use previously fetched data instead of parsing")
+	parseCmd.Flags().String("from", "", "Parse a device backup (folder, zip archive or FAT disk image)")
 }
 
-func runParse(usePrefetched bool) {
+func runParse(usePrefetched bool, from string) {
 	ctx := context.Background()
 
 	dbPath := viper.GetString("db_path")
@@ -44,27 +60,80 @@ func runParse(usePrefetched bool) {
 	}
 	defer func() { _ = svc.Close() }()
 
-	rockboxPath := viper.GetString("rockbox_path")
+	// A backup is parsed into the named device without selecting it
+	if from != "" {
+		device := viper.GetString("device")
+		if device == "" {
+			fmt.Fprintln(os.Stderr, "Error: --device is required with --from; name a new device to keep the backup apart from the player")
+			osExit(1)
+			return
+		}
+
+		fmt.Printf("Parsing Rockbox database from: %s\n", from)
+		result, err := svc.ParseFrom(ctx, from, device)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Failed to parse database: %v\n", err)
+			osExit(1)
+			return
+		}
+		// The backup's device is not the active one, so its songs are
+		// counted from the sync
+		printParseResult(svc, result, int64(result.Added+result.Changed+result.Unchanged))
+		return
+	}
+
+	if err := selectDevice(ctx, svc); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to select device: %v\n", err)
+		osExit(1)
+		return
+	}
+
+	// Without --rockbox-path the device's saved path is parsed
+	if rockboxPath := viper.GetString("rockbox_path"); rockboxPath != "" {
+		if err := svc.SetRockboxPath(rockboxPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Failed to set Rockbox path: %v\n", err)
+			osExit(1)
+			return
+		}
+	}
+	rockboxPath := svc.GetConfig().RockboxPath
 	if rockboxPath == "" {
 		fmt.Fprintln(os.Stderr, "Error: --rockbox-path is required")
 		osExit(1)
 		return
 	}
-
-	if err := svc.SetRockboxPath(rockboxPath); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: Failed to set Rockbox path: %v\n", err)
+	if err := setVolumes(ctx, svc); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to set volumes: %v\n", err)
 		osExit(1)
 		return
 	}
 
 	fmt.Printf("Parsing Rockbox database from: %s\n", rockboxPath)
 
-	if err := svc.ParseRockboxDatabase(ctx, usePrefetched); err != nil {
+	result, err := svc.ParseRockboxDatabase(ctx, usePrefetched)
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: Failed to parse database: %v\n", err)
 		osExit(1)
 		return
 	}
 
 	count, _ := svc.GetSongCount(ctx)
-	fmt.Printf("Successfully parsed %d songs\n", count)
+	printParseResult(svc, result, count)
+}
+
+// printParseResult prints the outcome of a parse that left count songs in the library
+func printParseResult(svc *service.AppService, result *models.SyncResult, count int64) {
+	if result.Skipped {
+		fmt.Printf("Database unchanged since the last parse, %d songs\n", count)
+		return
+	}
+	fmt.Printf("Successfully parsed %d songs (%d added, %d removed, %d changed)\n",
+		count, result.Added, result.Removed, result.Changed)
+	if version := svc.GetParseStatus().TagCacheVersion; version != 0 {
+		fmt.Printf("TagCache version 0x%02x\n", version)
+	}
+	if result.MissingPlaylistEntries > 0 {
+		fmt.Printf("Warning: %d playlist entries point at removed songs and are flagged as missing\n",
+			result.MissingPlaylistEntries)
+	}
 }
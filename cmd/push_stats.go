@@ -0,0 +1,110 @@
+// Package cmd provides CLI commands for Rocklist
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/Ardakilic/rocklist/internal/service"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var pushStatsCmd = &cobra.Command{
+	Use:   "push-stats",
+	Short: "Write ratings and play counts back to the Rockbox device",
+	Long: `Write ratings, play counts and last played times back to the Rockbox device.
+
+The statistics stored in Rocklist are compared with the device and every
+difference is written to .rockbox/database_changelog.txt. Rockbox imports
+the file on its next database initialisation (Settings > General Settings >
+Database > Initialize Now). The changes are merged into an existing
+changelog, which is kept as database_changelog.txt.bak.
+
+Statistics are only written to the mounted device, never to a backup. Songs
+whose statistics changed on the device since its database was last built are
+skipped, since Rockbox would ignore them; initialize the database on the
+device and parse it again to push them.
+
+Without --rockbox-path the device's saved path is used.
+
+Example:
+  rocklist push-stats --rockbox-path /Volumes/IPOD --dry-run
+  rocklist push-stats --device ipod-classic`,
+	Run: func(cmd *cobra.Command, args []string) {
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		runPushStats(dryRun)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(pushStatsCmd)
+	pushStatsCmd.Flags().Bool("dry-run", false, "Show the changes without writing the changelog")
+}
+
+func runPushStats(dryRun bool) {
+	ctx := context.Background()
+
+	dbPath := viper.GetString("db_path")
+	svc, err := service.NewAppService(dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to initialize service: %v\n", err)
+		osExit(1)
+		return
+	}
+	defer func() { _ = svc.Close() }()
+
+	if err := selectDevice(ctx, svc); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to select device: %v\n", err)
+		osExit(1)
+		return
+	}
+
+	// Without --rockbox-path the device's saved path is used
+	if rockboxPath := viper.GetString("rockbox_path"); rockboxPath != "" {
+		if err := svc.SetRockboxPath(rockboxPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Failed to set Rockbox path: %v\n", err)
+			osExit(1)
+			return
+		}
+	}
+	if svc.GetConfig().RockboxPath == "" {
+		fmt.Fprintln(os.Stderr, "Error: --rockbox-path is required")
+		osExit(1)
+		return
+	}
+
+	changes, err := svc.PushStats(ctx, dryRun)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to push statistics: %v\n", err)
+		osExit(1)
+		return
+	}
+
+	skipped := 0
+	for _, change := range changes {
+		if change.Skipped {
+			skipped++
+			fmt.Printf("%s (skipped, changed on the device)\n", change.Path)
+		} else {
+			fmt.Println(change.Path)
+		}
+		for _, field := range change.Changes {
+			fmt.Printf("  %s: %s -> %s\n", field.Field, field.Old, field.New)
+		}
+	}
+	pushed := len(changes) - skipped
+
+	switch {
+	case pushed == 0 && skipped == 0:
+		fmt.Println("Device statistics are up to date")
+	case dryRun:
+		fmt.Printf("%d songs would be updated (dry run, nothing written)\n", pushed)
+	case pushed > 0:
+		fmt.Printf("Wrote %d changes, initialize the database on the device to import them\n", pushed)
+	}
+	if skipped > 0 {
+		fmt.Printf("Skipped %d songs changed on the device; initialize its database and parse it again to push them\n", skipped)
+	}
+}
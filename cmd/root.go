@@ -2,10 +2,12 @@
 package cmd
 
 import (
+	"context"
 	"embed"
 	"fmt"
 	"os"
 
+	"github.com/Ardakilic/rocklist/internal/service"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -59,10 +61,35 @@ func init() {
 
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.rocklist/config.yaml)")
 	rootCmd.PersistentFlags().String("rockbox-path", "", "Path to Rockbox device root")
+	rootCmd.PersistentFlags().String("device", "", "Name of the device whose library to use; a new name adds a device")
 	rootCmd.PersistentFlags().String("db-path", "", "Path to database file")
+	rootCmd.PersistentFlags().StringToString("volume", nil, "Mount point of an extra player volume, e.g. microSD1=/media/SDCARD (repeatable)")
 
 	_ = viper.BindPFlag("rockbox_path", rootCmd.PersistentFlags().Lookup("rockbox-path"))
+	_ = viper.BindPFlag("device", rootCmd.PersistentFlags().Lookup("device"))
 	_ = viper.BindPFlag("db_path", rootCmd.PersistentFlags().Lookup("db-path"))
+	_ = viper.BindPFlag("volumes", rootCmd.PersistentFlags().Lookup("volume"))
+}
+
+// selectDevice switches to the --device library; without the flag the
+// device used last stays selected
+func selectDevice(ctx context.Context, svc *service.AppService) error {
+	name := viper.GetString("device")
+	if name == "" {
+		return nil
+	}
+	_, err := svc.SelectDevice(ctx, name)
+	return err
+}
+
+// setVolumes saves the --volume mount points; without the flag the saved
+// ones are used
+func setVolumes(ctx context.Context, svc *service.AppService) error {
+	volumes := viper.GetStringMapString("volumes")
+	if len(volumes) == 0 {
+		return nil
+	}
+	return svc.SetVolumes(ctx, volumes)
 }
 
 // initConfig reads in config file and ENV variables if set.
@@ -0,0 +1,152 @@
+// Package cmd provides CLI commands for Rocklist
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Ardakilic/rocklist/internal/service"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Sync the device and its playlists whenever it is plugged in",
+	Long: `Wait for a Rockbox device to be mounted, then bring everything up to date.
+
+Every known device is watched at its saved path. Each time one appears, it
+becomes the selected device, its database is re-parsed if it changed since
+the last parse, and every watch playlist of the device is regenerated and
+exported to it. A summary is logged after each sync. Stop watching with
+Ctrl+C.
+
+Playlists are added to the watch list of the selected device with
+'rocklist generate --watch', and use the API credentials saved by earlier
+commands. Every device keeps its own watch list.
+
+Examples:
+  rocklist watch --rockbox-path /media/user/IPOD
+  rocklist watch --list
+  rocklist watch --remove 2`,
+	Run: func(cmd *cobra.Command, args []string) {
+		interval, _ := cmd.Flags().GetDuration("interval")
+		list, _ := cmd.Flags().GetBool("list")
+		remove, _ := cmd.Flags().GetInt("remove")
+		runWatch(interval, list, remove)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(watchCmd)
+	watchCmd.Flags().Duration("interval", service.DefaultWatchInterval, "How often to check for the device")
+	watchCmd.Flags().Bool("list", false, "List the watch playlists and exit")
+	watchCmd.Flags().Int("remove", 0, "Remove the watch playlist with this number and exit")
+}
+
+func runWatch(interval time.Duration, list bool, remove int) {
+	ctx := context.Background()
+
+	dbPath := viper.GetString("db_path")
+	svc, err := service.NewAppService(dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to initialize service: %v\n", err)
+		osExit(1)
+		return
+	}
+	defer func() { _ = svc.Close() }()
+
+	if err := selectDevice(ctx, svc); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to select device: %v\n", err)
+		osExit(1)
+		return
+	}
+
+	if remove > 0 {
+		if err := svc.RemoveWatchPlaylist(ctx, remove-1); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Failed to remove watch playlist: %v\n", err)
+			osExit(1)
+			return
+		}
+		fmt.Printf("Removed watch playlist %d\n", remove)
+		return
+	}
+	if list {
+		printWatchPlaylists(ctx, svc)
+		return
+	}
+
+	// --rockbox-path sets the path of the selected device; the others are
+	// watched at their saved paths
+	if rockboxPath := viper.GetString("rockbox_path"); rockboxPath != "" {
+		if err := svc.SetRockboxPath(rockboxPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Failed to set Rockbox path: %v\n", err)
+			osExit(1)
+			return
+		}
+	}
+	devices, err := svc.GetDevices(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to read devices: %v\n", err)
+		osExit(1)
+		return
+	}
+	var watched []string
+	for _, device := range devices {
+		if device.Path != "" {
+			watched = append(watched, fmt.Sprintf("%s at %s", device.Name, device.Path))
+		}
+	}
+	if len(watched) == 0 {
+		fmt.Fprintln(os.Stderr, "Error: --rockbox-path is required")
+		osExit(1)
+		return
+	}
+	if err := setVolumes(ctx, svc); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to set volumes: %v\n", err)
+		osExit(1)
+		return
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	fmt.Printf("Watching for %s (Ctrl+C to stop)\n", strings.Join(watched, ", "))
+	watcher := service.NewWatcher(svc, interval, func(summary *service.WatchSummary, err error) {
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Sync failed: %v\n", err)
+			return
+		}
+		for _, failure := range summary.Failures {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", failure)
+		}
+	})
+	watcher.Run(ctx)
+}
+
+// printWatchPlaylists lists the watch playlists with the numbers --remove takes
+func printWatchPlaylists(ctx context.Context, svc *service.AppService) {
+	requests, err := svc.GetWatchPlaylists(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to read watch playlists: %v\n", err)
+		osExit(1)
+		return
+	}
+	if len(requests) == 0 {
+		fmt.Println("No watch playlists. Add one with 'rocklist generate --watch'.")
+		return
+	}
+
+	for i, req := range requests {
+		target := req.Artist
+		if req.Tag != "" {
+			target = req.Tag
+		}
+		fmt.Printf("%d. %s: %s from %s, %d songs\n", i+1, req.Type.DisplayName(), target, req.DataSource.DisplayName(), req.Limit)
+	}
+}
@@ -16,23 +16,35 @@ declare global {
           GetAppInfo: () => Promise<Record<string, string>>
           GetConfig: () => Promise<AppConfig>
           SetRockboxPath: (path: string) => Promise<void>
+          SetVolume: (name: string, dir: string) => Promise<void>
           SetLastFMCredentials: (apiKey: string, apiSecret: string, enabled: boolean) => Promise<void>
           SetSpotifyCredentials: (clientId: string, clientSecret: string, enabled: boolean) => Promise<void>
           SetMusicBrainzCredentials: (userAgent: string, enabled: boolean) => Promise<void>
-          ParseDatabase: (usePrefetched: boolean) => Promise<void>
+          ParseDatabase: (usePrefetched: boolean) => Promise<SyncResult>
           GetParseStatus: () => Promise<ParseStatus>
+          InspectDatabase: () => Promise<ParseStatus>
           GetLastParsedAt: () => Promise<string | null>
+          ImportPlays: () => Promise<PlayImportResult>
+          EnrichLibrary: (source: string) => Promise<EnrichStatus>
+          GetEnrichStatus: () => Promise<EnrichStatus>
+          CancelEnrich: () => Promise<void>
           GeneratePlaylist: (dataSource: string, playlistType: string, artist: string, tag: string, limit: number, useAlbumArtist: boolean) => Promise<Playlist>
           GetSongCount: () => Promise<number>
           GetUniqueArtists: () => Promise<string[]>
           GetUniqueGenres: () => Promise<string[]>
           GetAllPlaylists: () => Promise<Playlist[]>
+          GetArtistAliases: () => Promise<ArtistAlias[] | null>
+          AddArtistAlias: (artist: string, alias: string) => Promise<ArtistAlias>
+          RemoveArtistAlias: (alias: string) => Promise<void>
           DeletePlaylist: (id: number) => Promise<void>
           WipeData: () => Promise<void>
           GetLogs: () => Promise<LogEntry[]>
           ClearLogs: () => void
           GetEnabledSources: () => Promise<string[]>
           SelectDirectory: () => Promise<string>
+          FindDevices: () => Promise<DeviceInfo[] | null>
+          GetDevices: () => Promise<Device[] | null>
+          SelectDevice: (name: string) => Promise<Device>
         }
       }
     }
@@ -56,6 +68,23 @@ export interface AppConfig {
     enabled: boolean
     user_agent: string
   }
+  volumes?: Record<string, string>
+}
+
+export interface DeviceInfo {
+  path: string
+  name: string
+  target?: string
+  version?: string
+}
+
+export interface Device {
+  ID: number
+  name: string
+  path: string
+  target?: string
+  version?: string
+  last_parsed_at?: string | null
 }
 
 export interface ParseStatus {
@@ -66,6 +95,53 @@ export interface ParseStatus {
   processed_songs: number
   error_count: number
   last_error: string | null
+  diagnostics?: ParseDiagnostic[]
+  tagcache_version?: number
+}
+
+export interface ParseDiagnostic {
+  file: string
+  offset: number
+  entry: number
+  reason: string
+}
+
+export interface SyncResult {
+  added: number
+  removed: number
+  changed: number
+  unchanged: number
+  skipped: boolean
+  missing_playlist_entries: number
+}
+
+export interface PlayImportResult {
+  imported: number
+  duplicates: number
+  counted: number
+  skipped: number
+  unmatched: number
+  invalid: number
+}
+
+export interface EnrichStatus {
+  in_progress: boolean
+  source?: string
+  started_at?: string | null
+  completed_at?: string | null
+  total_songs: number
+  processed_songs: number
+  matched_songs: number
+  unmatched_songs: number
+  resumed?: boolean
+  error_count: number
+  last_error?: string
+}
+
+export interface ArtistAlias {
+  ID: number
+  artist: string
+  alias: string
 }
 
 export interface Playlist {
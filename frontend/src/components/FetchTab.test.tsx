@@ -153,4 +153,51 @@ describe('FetchTab component', () => {
     
     expect(screen.getByText(/path where the .rockbox folder is located/i)).toBeInTheDocument()
   })
+
+  it('fills in the path of a detected device', async () => {
+    vi.mocked(window.go.cmd.App.FindDevices).mockResolvedValue([
+      { path: '/media/user/IPOD', name: 'IPOD', target: 'ipodvideo', version: '3.15' },
+    ])
+    render(<FetchTab />)
+
+    fireEvent.click(screen.getByRole('button', { name: /detect devices/i }))
+
+    await waitFor(() => {
+      expect(screen.getByDisplayValue('/media/user/IPOD')).toBeInTheDocument()
+      expect(screen.getByText('(ipodvideo)')).toBeInTheDocument()
+    })
+  })
+  it('starts enrichment with an enabled source', async () => {
+    render(<FetchTab />)
+
+    const button = await screen.findByRole('button', { name: /match with musicbrainz/i })
+    await waitFor(() => expect(button).not.toBeDisabled())
+    fireEvent.click(button)
+
+    await waitFor(() => {
+      expect(window.go.cmd.App.EnrichLibrary).toHaveBeenCalledWith('musicbrainz')
+    })
+  })
+
+  it('shows enrichment progress and stops the job', async () => {
+    vi.mocked(window.go.cmd.App.GetEnrichStatus).mockResolvedValue({
+      in_progress: true,
+      source: 'lastfm',
+      started_at: '2024-01-01T00:00:00Z',
+      total_songs: 200,
+      processed_songs: 50,
+      matched_songs: 40,
+      unmatched_songs: 10,
+      error_count: 0,
+    })
+    render(<FetchTab />)
+
+    await waitFor(() => {
+      expect(screen.getByText('50/200')).toBeInTheDocument()
+      expect(screen.getByText(/40 matched/)).toBeInTheDocument()
+    })
+
+    fireEvent.click(screen.getByRole('button', { name: /stop/i }))
+    expect(window.go.cmd.App.CancelEnrich).toHaveBeenCalled()
+  })
 })
@@ -3,8 +3,14 @@ import { Button } from './ui/button'
 import { Input } from './ui/input'
 import { Label } from './ui/label'
 import { Checkbox } from './ui/checkbox'
-import { FolderOpen, Play, Loader2 } from 'lucide-react'
-import type { LogEntry, ParseStatus } from '../App'
+import { FolderOpen, Play, Loader2, Usb, Square } from 'lucide-react'
+import type { DeviceInfo, EnrichStatus, LogEntry, ParseStatus } from '../App'
+
+const SOURCE_LABELS: Record<string, string> = {
+  lastfm: 'Last.fm',
+  spotify: 'Spotify',
+  musicbrainz: 'MusicBrainz',
+}
 
 export function FetchTab() {
   const [rockboxPath, setRockboxPath] = useState('')
@@ -14,10 +20,16 @@ export function FetchTab() {
   const [_parseStatus, _setParseStatus] = useState<ParseStatus | null>(null)
   const [lastParsedAt, setLastParsedAt] = useState<string | null>(null)
   const [songCount, setSongCount] = useState(0)
+  const [devices, setDevices] = useState<DeviceInfo[] | null>(null)
+  const [enabledSources, setEnabledSources] = useState<string[]>([])
+  const [enrichStatus, setEnrichStatus] = useState<EnrichStatus | null>(null)
 
   useEffect(() => {
     loadInitialData()
-    const interval = setInterval(refreshLogs, 2000)
+    const interval = setInterval(() => {
+      refreshLogs()
+      refreshEnrichStatus()
+    }, 2000)
     return () => clearInterval(interval)
   }, [])
 
@@ -28,6 +40,11 @@ export function FetchTab() {
       const config = await window.go.cmd.App.GetConfig()
       if (config?.rockbox_path) {
         setRockboxPath(config.rockbox_path)
+      } else {
+        const found = await detectDevices()
+        if (found.length > 0) {
+          setRockboxPath(found[0].path)
+        }
       }
       
       const lastParsed = await window.go.cmd.App.GetLastParsedAt()
@@ -35,6 +52,10 @@ export function FetchTab() {
       
       const count = await window.go.cmd.App.GetSongCount()
       setSongCount(count)
+
+      const sources = await window.go.cmd.App.GetEnabledSources()
+      setEnabledSources(sources || [])
+      await refreshEnrichStatus()
     } catch (error) {
       console.error('Failed to load initial data:', error)
     }
@@ -50,6 +71,35 @@ export function FetchTab() {
     }
   }
 
+  const refreshEnrichStatus = async () => {
+    if (!window.go?.cmd?.App) return
+    try {
+      const status = await window.go.cmd.App.GetEnrichStatus()
+      setEnrichStatus(status)
+    } catch (error) {
+      console.error('Failed to refresh enrichment status:', error)
+    }
+  }
+
+  const detectDevices = async (): Promise<DeviceInfo[]> => {
+    if (!window.go?.cmd?.App) return []
+    try {
+      const found = (await window.go.cmd.App.FindDevices()) ?? []
+      setDevices(found)
+      return found
+    } catch (error) {
+      console.error('Failed to detect devices:', error)
+      return []
+    }
+  }
+
+  const handleDetectDevices = async () => {
+    const found = await detectDevices()
+    if (found.length === 1) {
+      setRockboxPath(found[0].path)
+    }
+  }
+
   const handleBrowseFolder = async () => {
     if (!window.go?.cmd?.App) return
     
@@ -85,6 +135,29 @@ export function FetchTab() {
     }
   }
 
+  const handleEnrich = async (source: string) => {
+    if (!window.go?.cmd?.App) return
+
+    setEnrichStatus({
+      in_progress: true,
+      source,
+      total_songs: 0,
+      processed_songs: 0,
+      matched_songs: 0,
+      unmatched_songs: 0,
+      error_count: 0,
+    })
+    try {
+      // Resolves when the job finishes or is stopped
+      await window.go.cmd.App.EnrichLibrary(source)
+    } catch (error) {
+      console.error('Enrichment stopped:', error)
+    } finally {
+      await refreshEnrichStatus()
+      await refreshLogs()
+    }
+  }
+
   const formatDate = (dateStr: string | null) => {
     if (!dateStr) return 'Never'
     try {
@@ -110,6 +183,9 @@ export function FetchTab() {
                 onChange={(e) => setRockboxPath(e.target.value)}
                 className="flex-1"
               />
+              <Button variant="outline" size="icon" onClick={handleDetectDevices} aria-label="Detect devices">
+                <Usb className="h-4 w-4" />
+              </Button>
               <Button variant="outline" size="icon" onClick={handleBrowseFolder}>
                 <FolderOpen className="h-4 w-4" />
               </Button>
@@ -117,6 +193,27 @@ export function FetchTab() {
             <p className="text-sm text-muted-foreground">
               Path where the .rockbox folder is located
             </p>
+            {devices !== null && (
+              devices.length === 0 ? (
+                <p className="text-sm text-muted-foreground">No mounted Rockbox devices found</p>
+              ) : (
+                <div className="flex flex-wrap gap-2">
+                  {devices.map((device) => (
+                    <Button
+                      key={device.path}
+                      variant={device.path === rockboxPath ? 'secondary' : 'outline'}
+                      size="sm"
+                      onClick={() => setRockboxPath(device.path)}
+                    >
+                      {device.name}
+                      {device.target && (
+                        <span className="ml-1 text-muted-foreground">({device.target})</span>
+                      )}
+                    </Button>
+                  ))}
+                </div>
+              )
+            )}
           </div>
 
           <div className="flex items-center space-x-2">
@@ -155,6 +252,60 @@ export function FetchTab() {
         </div>
       </div>
 
+      {/* Enrich Section */}
+      <div className="rounded-lg border bg-card p-6">
+        <h2 className="text-lg font-semibold mb-4">Enrich Library</h2>
+
+        <div className="space-y-4">
+          <p className="text-sm text-muted-foreground">
+            Match every song against a data source once, so playlists find them by ID.
+            A stopped job resumes where it left off.
+          </p>
+
+          <div className="flex flex-wrap items-center gap-2">
+            {enabledSources.length === 0 ? (
+              <p className="text-sm text-muted-foreground">Enable a data source in Settings first</p>
+            ) : (
+              enabledSources.map((source) => (
+                <Button
+                  key={source}
+                  variant="outline"
+                  onClick={() => handleEnrich(source)}
+                  disabled={enrichStatus?.in_progress || songCount === 0}
+                >
+                  Match with {SOURCE_LABELS[source] ?? source}
+                </Button>
+              ))
+            )}
+            {enrichStatus?.in_progress && (
+              <Button variant="ghost" onClick={() => window.go?.cmd?.App?.CancelEnrich()}>
+                <Square className="mr-2 h-4 w-4" />
+                Stop
+              </Button>
+            )}
+          </div>
+
+          {enrichStatus?.started_at && (
+            <div className="text-sm text-muted-foreground">
+              {enrichStatus.in_progress && <Loader2 className="mr-2 inline h-4 w-4 animate-spin" />}
+              <span className="font-medium">
+                {enrichStatus.processed_songs}/{enrichStatus.total_songs}
+              </span>{' '}
+              songs searched on {SOURCE_LABELS[enrichStatus.source ?? ''] ?? enrichStatus.source}
+              <span className="ml-2">
+                • {enrichStatus.matched_songs} matched • {enrichStatus.unmatched_songs} unmatched
+              </span>
+              {enrichStatus.error_count > 0 && (
+                <span className="ml-2">• {enrichStatus.error_count} errors</span>
+              )}
+              {!enrichStatus.in_progress && enrichStatus.last_error && (
+                <p className="mt-1 text-destructive">Last error: {enrichStatus.last_error}</p>
+              )}
+            </div>
+          )}
+        </div>
+      </div>
+
       {/* Logs Section */}
       <div className="rounded-lg border bg-card p-6">
         <div className="flex items-center justify-between mb-4">
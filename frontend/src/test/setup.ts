@@ -19,6 +19,7 @@ const mockApp = {
     musicbrainz: { enabled: true, user_agent: 'Rocklist/1.0' },
   }),
   SetRockboxPath: vi.fn().mockResolvedValue(undefined),
+  SetVolume: vi.fn().mockResolvedValue(undefined),
   SetLastFMCredentials: vi.fn().mockResolvedValue(undefined),
   SetSpotifyCredentials: vi.fn().mockResolvedValue(undefined),
   SetMusicBrainzCredentials: vi.fn().mockResolvedValue(undefined),
@@ -44,6 +45,16 @@ const mockApp = {
   GetLogs: vi.fn().mockResolvedValue([]),
   ClearLogs: vi.fn(),
   GetEnabledSources: vi.fn().mockResolvedValue(['lastfm', 'musicbrainz']),
+  FindDevices: vi.fn().mockResolvedValue([]),
+  ImportPlays: vi.fn().mockResolvedValue({ imported: 0, duplicates: 0, counted: 0, skipped: 0, unmatched: 0, invalid: 0 }),
+  EnrichLibrary: vi.fn().mockResolvedValue({ in_progress: false, total_songs: 0, processed_songs: 0, matched_songs: 0, unmatched_songs: 0, error_count: 0 }),
+  GetEnrichStatus: vi.fn().mockResolvedValue({ in_progress: false, total_songs: 0, processed_songs: 0, matched_songs: 0, unmatched_songs: 0, error_count: 0 }),
+  CancelEnrich: vi.fn().mockResolvedValue(undefined),
+  GetDevices: vi.fn().mockResolvedValue([{ ID: 1, name: 'default', path: '/media/rockbox' }]),
+  SelectDevice: vi.fn().mockResolvedValue({ ID: 1, name: 'default', path: '/media/rockbox' }),
+  GetArtistAliases: vi.fn().mockResolvedValue([]),
+  AddArtistAlias: vi.fn().mockResolvedValue({ ID: 1, artist: 'Prince', alias: 'TAFKAP' }),
+  RemoveArtistAlias: vi.fn().mockResolvedValue(undefined),
 }
 
 Object.defineProperty(window, 'go', {
@@ -95,6 +106,14 @@ beforeEach(() => {
   mockApp.GetAllPlaylists.mockResolvedValue([])
   mockApp.GetEnabledSources.mockResolvedValue(['lastfm', 'musicbrainz'])
   mockApp.GetLogs.mockResolvedValue([])
+  mockApp.FindDevices.mockResolvedValue([])
+  mockApp.ImportPlays.mockResolvedValue({ imported: 0, duplicates: 0, counted: 0, skipped: 0, unmatched: 0, invalid: 0 })
+  mockApp.EnrichLibrary.mockResolvedValue({ in_progress: false, total_songs: 0, processed_songs: 0, matched_songs: 0, unmatched_songs: 0, error_count: 0 })
+  mockApp.GetEnrichStatus.mockResolvedValue({ in_progress: false, total_songs: 0, processed_songs: 0, matched_songs: 0, unmatched_songs: 0, error_count: 0 })
+  mockApp.GetDevices.mockResolvedValue([{ ID: 1, name: 'default', path: '/media/rockbox' }])
+  mockApp.SelectDevice.mockResolvedValue({ ID: 1, name: 'default', path: '/media/rockbox' })
+  mockApp.GetArtistAliases.mockResolvedValue([])
+  mockApp.AddArtistAlias.mockResolvedValue({ ID: 1, artist: 'Prince', alias: 'TAFKAP' })
   mockApp.GetParseStatus.mockResolvedValue({
     in_progress: false,
     total_songs: 100,
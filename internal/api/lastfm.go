@@ -11,6 +11,7 @@ import (
 	"strings"
 
 	"github.com/Ardakilic/rocklist/internal/models"
+	"github.com/Ardakilic/rocklist/internal/normalize"
 )
 
 const (
@@ -446,7 +447,9 @@ func calculateConfidence(inputArtist, matchArtist, inputTitle, matchTitle string
 	return (artistSimilarity + titleSimilarity) / 2
 }
 
-// stringSimilarity calculates a simple similarity score between two strings
+// stringSimilarity calculates a simple similarity score between two strings.
+// Both are normalized first, so case, accents, punctuation and script do not
+// count as differences.
 func stringSimilarity(a, b string) float64 {
 	if a == b {
 		return 1.0
@@ -455,29 +458,35 @@ func stringSimilarity(a, b string) float64 {
 		return 0.0
 	}
 
+	a, b = normalize.Text(a), normalize.Text(b)
+	if a == b {
+		return 1.0
+	}
+	ra, rb := []rune(a), []rune(b)
+
 	// Simple containment check
 	if strings.Contains(a, b) || strings.Contains(b, a) {
-		shorter := len(a)
-		if len(b) < shorter {
-			shorter = len(b)
+		shorter := len(ra)
+		if len(rb) < shorter {
+			shorter = len(rb)
 		}
-		longer := len(a)
-		if len(b) > longer {
-			longer = len(b)
+		longer := len(ra)
+		if len(rb) > longer {
+			longer = len(rb)
 		}
 		return float64(shorter) / float64(longer)
 	}
 
 	// Levenshtein-like ratio
 	matches := 0
-	for i := 0; i < len(a) && i < len(b); i++ {
-		if a[i] == b[i] {
+	for i := 0; i < len(ra) && i < len(rb); i++ {
+		if ra[i] == rb[i] {
 			matches++
 		}
 	}
-	maxLen := len(a)
-	if len(b) > maxLen {
-		maxLen = len(b)
+	maxLen := len(ra)
+	if len(rb) > maxLen {
+		maxLen = len(rb)
 	}
 	return float64(matches) / float64(maxLen)
 }
@@ -245,6 +245,10 @@ func TestStringSimilarity_EdgeCases(t *testing.T) {
 		{"partial prefix", "metal", "metallica", 0.4, 0.6},
 		{"completely different", "abc", "xyz", 0.0, 0.5},
 		{"one contains other", "song name", "song", 0.4, 0.6},
+		{"diacritics", "motörhead", "motorhead", 1.0, 1.0},
+		{"ampersand", "simon & garfunkel", "simon and garfunkel", 1.0, 1.0},
+		{"cyrillic", "земфира", "zemfira", 1.0, 1.0},
+		{"multibyte prefix", "björk", "björk live", 0.4, 0.6},
 	}
 
 	for _, tt := range tests {
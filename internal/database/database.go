@@ -65,14 +65,29 @@ func New(cfg *Config) (*Database, error) {
 	return &Database{db: db}, nil
 }
 
+// legacyRockboxIDIndex made RockboxIDs unique across all songs before songs
+// belonged to a device; they are now unique per device
+const legacyRockboxIDIndex = "idx_songs_rockbox_id"
+
 // Migrate runs database migrations
 func (d *Database) Migrate() error {
-	return d.db.AutoMigrate(
+	if err := d.db.AutoMigrate(
+		&models.Device{},
 		&models.Song{},
 		&models.Playlist{},
 		&models.PlaylistSong{},
 		&models.Config{},
-	)
+		&models.PlayEvent{},
+		&models.ArtistAlias{},
+	); err != nil {
+		return err
+	}
+
+	migrator := d.db.Migrator()
+	if migrator.HasIndex(&models.Song{}, legacyRockboxIDIndex) {
+		return migrator.DropIndex(&models.Song{}, legacyRockboxIDIndex)
+	}
+	return nil
 }
 
 // DB returns the underlying GORM database
@@ -108,12 +123,30 @@ func (d *Database) WipeData() error {
 		return fmt.Errorf("failed to delete songs: %w", err)
 	}
 
+	// Imported plays were counted on the deleted songs, so they can be imported again
+	if err := tx.Exec("DELETE FROM play_events").Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to delete play history: %w", err)
+	}
+
 	// Remove last parsed timestamp
 	if err := tx.Where("key = ?", "last_parsed_at").Delete(&models.Config{}).Error; err != nil {
 		tx.Rollback()
 		return fmt.Errorf("failed to delete last parsed config: %w", err)
 	}
-	
+
+	// Forget the parse history of every device
+	if err := tx.Exec("UPDATE devices SET last_parsed_at = NULL, tag_cache_serial = NULL, tag_cache_commit_id = NULL").Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to reset device parse history: %w", err)
+	}
+
+	// Enrichment progress points at song IDs that are gone
+	if err := tx.Exec("DELETE FROM configs WHERE key LIKE ?", "enrich_cursor_%").Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to delete enrichment progress: %w", err)
+	}
+
 	return tx.Commit().Error
 }
 
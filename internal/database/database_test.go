@@ -3,6 +3,7 @@ package database
 import (
 	"testing"
 
+	"github.com/Ardakilic/rocklist/internal/models"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 )
@@ -61,6 +62,41 @@ func TestDatabase_Migrate(t *testing.T) {
 	}
 }
 
+func TestDatabase_Migrate_LegacyRockboxIDIndex(t *testing.T) {
+	db, err := New(&Config{InMemory: true, LogLevel: logger.Silent})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	// A database created before devices had RockboxIDs unique across all songs
+	if err := db.DB().Exec("CREATE UNIQUE INDEX idx_songs_rockbox_id ON songs(rockbox_id)").Error; err != nil {
+		t.Fatalf("creating the legacy index: %v", err)
+	}
+
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	if db.DB().Migrator().HasIndex(&models.Song{}, "idx_songs_rockbox_id") {
+		t.Error("Migrate() should drop the legacy RockboxID index")
+	}
+
+	// Two devices may hold a song with the same RockboxID, one device may not
+	songs := []*models.Song{
+		{DeviceID: 1, RockboxID: "7", Path: "/a.mp3"},
+		{DeviceID: 2, RockboxID: "7", Path: "/a.mp3"},
+	}
+	if err := db.DB().Create(songs).Error; err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if err := db.DB().Create(&models.Song{DeviceID: 1, RockboxID: "7", Path: "/b.mp3"}).Error; err == nil {
+		t.Error("Create() should reject a RockboxID used twice on one device")
+	}
+}
+
 func TestDatabase_WipeData(t *testing.T) {
 	cfg := &Config{
 		InMemory: true,
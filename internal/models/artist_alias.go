@@ -0,0 +1,21 @@
+// Package models contains all domain models for Rocklist
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// ArtistAlias is another name of an artist, added by the user. Songs tagged
+// with any name of an artist are candidates for tracks credited to another,
+// e.g. "Prince" and "The Artist Formerly Known as Prince". Aliases are
+// shared by all devices.
+type ArtistAlias struct {
+	gorm.Model
+	Artist string `gorm:"index;not null" json:"artist"`
+	Alias  string `gorm:"uniqueIndex;not null" json:"alias"`
+}
+
+// TableName returns the table name for ArtistAlias
+func (ArtistAlias) TableName() string {
+	return "artist_aliases"
+}
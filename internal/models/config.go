@@ -2,6 +2,7 @@
 package models
 
 import (
+	"fmt"
 	"time"
 
 	"gorm.io/gorm"
@@ -28,6 +29,9 @@ type AppConfig struct {
 	MusicBrainz        MusicBrainzConfig `json:"musicbrainz"`
 	EnabledSources     []DataSource     `json:"enabled_sources"`
 	DefaultPlaylistDir string           `json:"default_playlist_dir"`
+	// Volumes maps the extra volumes of the player, such as microSD1, to
+	// the host folder they are mounted at
+	Volumes            map[string]string `json:"volumes,omitempty"`
 }
 
 // LastFMConfig holds Last.fm API configuration
@@ -75,6 +79,13 @@ func (ac *AppConfig) GetEnabledSources() []DataSource {
 	return enabled
 }
 
+// Sources a parse can read songs from
+const (
+	ParseSourceTagCache   = "tagcache"
+	ParseSourceChangelog  = "changelog"
+	ParseSourceFilesystem = "filesystem"
+)
+
 // ParseStatus represents the status of a Rockbox database parse operation
 type ParseStatus struct {
 	InProgress    bool       `json:"in_progress"`
@@ -84,6 +95,52 @@ type ParseStatus struct {
 	ProcessedSongs int       `json:"processed_songs"`
 	ErrorCount    int        `json:"error_count"`
 	LastError     string     `json:"last_error,omitempty"`
+	// Source is where the songs were read from, see the ParseSource constants
+	Source   string `json:"source,omitempty"`
+	// TagCacheVersion is the version byte of the TagCache magic, 0 when not read from the TagCache
+	TagCacheVersion int `json:"tagcache_version,omitempty"`
+	Serial   int32  `json:"serial"`    // TagCache master header serial
+	CommitID int32  `json:"commit_id"` // TagCache master header commit ID
+	// TagCache index flag counters
+	DatabaseDirty         bool `json:"database_dirty"`
+	DeletedEntries        int  `json:"deleted_entries"`
+	DirCacheEntries       int  `json:"dircache_entries"`
+	DirtyNumEntries       int  `json:"dirty_num_entries"`
+	GeneratedTrackNumbers int  `json:"generated_track_numbers"`
+	ResurrectedEntries    int  `json:"resurrected_entries"`
+	// Diagnostics lists the records that were skipped or could not be read
+	Diagnostics []ParseDiagnostic `json:"diagnostics,omitempty"`
+}
+
+// ParseDiagnostic describes a problem found while reading a device database
+type ParseDiagnostic struct {
+	File   string `json:"file"`   // file name relative to the .rockbox folder
+	Offset int64  `json:"offset"` // byte offset of the record, -1 if unknown
+	Entry  int    `json:"entry"`  // index of the record in its file, -1 if unknown
+	Reason string `json:"reason"`
+}
+
+// String formats the diagnostic as file:offset: entry N: reason
+func (d ParseDiagnostic) String() string {
+	s := d.File
+	if d.Offset >= 0 {
+		s += fmt.Sprintf(":%d", d.Offset)
+	}
+	if d.Entry >= 0 {
+		s += fmt.Sprintf(": entry %d", d.Entry)
+	}
+	return s + ": " + d.Reason
+}
+
+// SyncResult summarises how a parse changed the stored songs
+type SyncResult struct {
+	Added     int  `json:"added"`
+	Removed   int  `json:"removed"`
+	Changed   int  `json:"changed"`
+	Unchanged int  `json:"unchanged"`
+	Skipped   bool `json:"skipped"` // the device database did not change since the last parse
+	// MissingPlaylistEntries counts playlist entries whose song was removed by this parse
+	MissingPlaylistEntries int `json:"missing_playlist_entries"`
 }
 
 // Progress returns the progress percentage (0-100)
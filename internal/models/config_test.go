@@ -104,3 +104,30 @@ func TestParseStatus_Progress(t *testing.T) {
 		})
 	}
 }
+
+func TestParseDiagnostic_String(t *testing.T) {
+	tests := []struct {
+		name string
+		d    ParseDiagnostic
+		want string
+	}{
+		{
+			name: "record",
+			d:    ParseDiagnostic{File: "database_3.tcd", Offset: 1024, Entry: 12, Reason: "tag length 900 runs past the end of the file"},
+			want: "database_3.tcd:1024: entry 12: tag length 900 runs past the end of the file",
+		},
+		{
+			name: "whole file",
+			d:    ParseDiagnostic{File: "database_2.tcd", Offset: -1, Entry: -1, Reason: "tag file not readable"},
+			want: "database_2.tcd: tag file not readable",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.d.String(); got != tt.want {
+				t.Errorf("ParseDiagnostic.String() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
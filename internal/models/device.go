@@ -0,0 +1,52 @@
+// Package models contains all domain models for Rocklist
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DefaultDeviceName names the device created for a library parsed before
+// devices existed
+const DefaultDeviceName = "default"
+
+// Device is a Rockbox player with its own library. Songs and playlists
+// belong to one device, and each device keeps its own parse history.
+type Device struct {
+	gorm.Model
+	Name    string `gorm:"uniqueIndex;not null" json:"name"`
+	Path    string `json:"path"`
+	Target  string `json:"target,omitempty"`  // from .rockbox/rockbox-info.txt
+	Version string `json:"version,omitempty"` // Rockbox version
+	// Parse history
+	LastParsedAt *time.Time `json:"last_parsed_at,omitempty"`
+	// TagCache serial and commit ID of the last parse, nil when unknown
+	TagCacheSerial   *int32 `json:"tagcache_serial,omitempty"`
+	TagCacheCommitID *int32 `json:"tagcache_commit_id,omitempty"`
+}
+
+// TableName returns the table name for Device
+func (Device) TableName() string {
+	return "devices"
+}
+
+// TagCacheVersion returns the serial and commit ID of the last parsed
+// TagCache; ok is false when none was recorded
+func (d *Device) TagCacheVersion() (serial, commitID int32, ok bool) {
+	if d.TagCacheSerial == nil || d.TagCacheCommitID == nil {
+		return 0, 0, false
+	}
+	return *d.TagCacheSerial, *d.TagCacheCommitID, true
+}
+
+// SetTagCacheVersion records the serial and commit ID of a parsed TagCache
+func (d *Device) SetTagCacheVersion(serial, commitID int32) {
+	d.TagCacheSerial, d.TagCacheCommitID = &serial, &commitID
+}
+
+// ClearTagCacheVersion forgets the recorded TagCache version, so the next
+// parse is a full one
+func (d *Device) ClearTagCacheVersion() {
+	d.TagCacheSerial, d.TagCacheCommitID = nil, nil
+}
@@ -0,0 +1,33 @@
+// Package models contains all domain models for Rocklist
+package models
+
+import (
+	"time"
+)
+
+// EnrichStatus represents the status of a library enrichment job, which
+// searches a data source for each song not matched there yet
+type EnrichStatus struct {
+	InProgress  bool       `json:"in_progress"`
+	Source      DataSource `json:"source,omitempty"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	// TotalSongs is the number of songs left to search when the job started
+	TotalSongs     int `json:"total_songs"`
+	ProcessedSongs int `json:"processed_songs"`
+	MatchedSongs   int `json:"matched_songs"`
+	// UnmatchedSongs were searched without a confident match
+	UnmatchedSongs int `json:"unmatched_songs"`
+	// Resumed is set when the job continued an interrupted one
+	Resumed    bool   `json:"resumed,omitempty"`
+	ErrorCount int    `json:"error_count"`
+	LastError  string `json:"last_error,omitempty"`
+}
+
+// Progress returns the progress percentage (0-100)
+func (es *EnrichStatus) Progress() float64 {
+	if es.TotalSongs == 0 {
+		return 0
+	}
+	return float64(es.ProcessedSongs) / float64(es.TotalSongs) * 100
+}
@@ -0,0 +1,23 @@
+package models
+
+import "testing"
+
+func TestEnrichStatus_Progress(t *testing.T) {
+	tests := []struct {
+		name   string
+		status EnrichStatus
+		want   float64
+	}{
+		{"zero total", EnrichStatus{}, 0},
+		{"quarter processed", EnrichStatus{TotalSongs: 200, ProcessedSongs: 50}, 25},
+		{"fully processed", EnrichStatus{TotalSongs: 10, ProcessedSongs: 10}, 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.status.Progress(); got != tt.want {
+				t.Errorf("EnrichStatus.Progress() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
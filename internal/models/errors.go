@@ -10,13 +10,19 @@ var (
 	ErrSongNotFound           = errors.New("song not found")
 	ErrPlaylistNotFound       = errors.New("playlist not found")
 	ErrConfigNotFound         = errors.New("config not found")
+	ErrDeviceNotFound         = errors.New("device not found")
+	ErrAliasNotFound          = errors.New("artist alias not found")
 
 	// Rockbox errors
 	ErrRockboxPathNotSet      = errors.New("rockbox path not set")
 	ErrRockboxPathInvalid     = errors.New("rockbox path is invalid")
 	ErrRockboxDatabaseNotFound = errors.New("rockbox database not found")
+	ErrUnsupportedTagCacheVersion = errors.New("unsupported TagCache version")
+	ErrDeviceNotMounted       = errors.New("device is not mounted")
+	ErrVolumeNotMapped        = errors.New("volume is not mapped to a folder")
 	ErrParseInProgress        = errors.New("parse operation already in progress")
 	ErrNoPreFetchedData       = errors.New("no pre-fetched data available")
+	ErrInvalidScrobblerLog    = errors.New("invalid scrobbler log")
 
 	// API errors
 	ErrAPINotConfigured       = errors.New("API not configured")
@@ -30,12 +36,14 @@ var (
 	ErrInvalidPlaylistType    = errors.New("invalid playlist type")
 	ErrInvalidDataSource      = errors.New("invalid data source")
 	ErrTagRequired            = errors.New("tag is required for tag playlist")
+	ErrInvalidMatchWeights    = errors.New("invalid match weights")
 	ErrNoMatchingSongs        = errors.New("no matching songs found")
 	ErrPlaylistExportFailed   = errors.New("playlist export failed")
 
 	// Matching errors
 	ErrNoMatchFound           = errors.New("no match found")
 	ErrMultipleMatchesFound   = errors.New("multiple matches found, confidence too low")
+	ErrEnrichInProgress       = errors.New("enrichment already in progress")
 
 	// General errors
 	ErrInvalidInput           = errors.New("invalid input")
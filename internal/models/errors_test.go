@@ -111,12 +111,19 @@ func TestDomainErrors_Defined(t *testing.T) {
 		ErrDatabaseNotInitialized,
 		ErrSongNotFound,
 		ErrPlaylistNotFound,
+		ErrDeviceNotFound,
+		ErrAliasNotFound,
 		ErrConfigNotFound,
 		ErrRockboxPathNotSet,
 		ErrRockboxPathInvalid,
 		ErrRockboxDatabaseNotFound,
+		ErrUnsupportedTagCacheVersion,
+		ErrDeviceNotMounted,
+		ErrVolumeNotMapped,
 		ErrParseInProgress,
+		ErrEnrichInProgress,
 		ErrNoPreFetchedData,
+		ErrInvalidScrobblerLog,
 		ErrAPINotConfigured,
 		ErrAPIKeyMissing,
 		ErrAPIRequestFailed,
@@ -126,6 +133,7 @@ func TestDomainErrors_Defined(t *testing.T) {
 		ErrInvalidPlaylistType,
 		ErrInvalidDataSource,
 		ErrTagRequired,
+		ErrInvalidMatchWeights,
 		ErrNoMatchingSongs,
 		ErrPlaylistExportFailed,
 		ErrNoMatchFound,
@@ -148,6 +156,8 @@ func TestDomainErrors_Messages(t *testing.T) {
 	}{
 		{ErrSongNotFound, "song not found"},
 		{ErrPlaylistNotFound, "playlist not found"},
+		{ErrDeviceNotFound, "device not found"},
+		{ErrAliasNotFound, "artist alias not found"},
 		{ErrConfigNotFound, "config not found"},
 		{ErrRockboxPathNotSet, "rockbox path not set"},
 		{ErrAPIKeyMissing, "API key is missing"},
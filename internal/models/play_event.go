@@ -0,0 +1,50 @@
+// Package models contains all domain models for Rocklist
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PlayEvent is one play logged on the device by the Last.fm scrobbler
+// plugin. A device never logs two plays in the same second, so the time
+// identifies a play and repeat imports are skipped.
+type PlayEvent struct {
+	gorm.Model
+	DeviceID uint      `gorm:"uniqueIndex:idx_play_events_device_played_at;not null;default:0" json:"device_id"`
+	PlayedAt time.Time `gorm:"uniqueIndex:idx_play_events_device_played_at;not null" json:"played_at"`
+	// SongID is the matched song, nil when no song matched
+	SongID      *uint  `gorm:"index" json:"song_id,omitempty"`
+	Artist      string `json:"artist"`
+	Album       string `json:"album"`
+	Title       string `json:"title"`
+	TrackNumber int    `json:"track_number"`
+	Duration    int    `json:"duration"` // in seconds
+	// Skipped is set for tracks logged as skipped rather than listened to;
+	// they are kept in the history but not counted as plays
+	Skipped       bool   `json:"skipped,omitempty"`
+	MusicBrainzID string `json:"musicbrainz_id,omitempty"`
+	Path          string `json:"path,omitempty"`
+}
+
+// TableName returns the table name for PlayEvent
+func (PlayEvent) TableName() string {
+	return "play_events"
+}
+
+// PlayImportResult summarizes an import of logged plays
+type PlayImportResult struct {
+	// Imported is the number of plays added to the history
+	Imported int `json:"imported"`
+	// Duplicates were imported before and are left alone
+	Duplicates int `json:"duplicates"`
+	// Counted is the number of plays added to song play counts
+	Counted int `json:"counted"`
+	// Skipped tracks were not listened to and are not counted
+	Skipped int `json:"skipped"`
+	// Unmatched plays belong to no song in the library
+	Unmatched int `json:"unmatched"`
+	// Invalid is the number of log lines that could not be read
+	Invalid int `json:"invalid"`
+}
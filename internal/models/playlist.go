@@ -69,6 +69,7 @@ func (ds DataSource) DisplayName() string {
 // Playlist represents a generated playlist
 type Playlist struct {
 	gorm.Model
+	DeviceID    uint         `gorm:"not null;default:0;index" json:"device_id"`
 	Name        string       `gorm:"not null" json:"name"`
 	Description string       `json:"description,omitempty"`
 	Type        PlaylistType `gorm:"not null;index" json:"type"`
@@ -93,6 +94,7 @@ type PlaylistSong struct {
 	PlaylistID uint   `gorm:"not null;index" json:"playlist_id"`
 	SongID     uint   `gorm:"not null;index" json:"song_id"`
 	Position   int    `gorm:"not null" json:"position"`
+	Missing    bool   `gorm:"not null;default:false" json:"missing"` // the song is no longer on the device
 	Song       Song   `gorm:"foreignKey:SongID" json:"song,omitempty"`
 }
 
@@ -109,6 +111,65 @@ type PlaylistRequest struct {
 	Tag            string       `json:"tag,omitempty"`
 	Limit          int          `json:"limit,omitempty"`          // Max songs to include
 	UseAlbumArtist bool         `json:"use_album_artist,omitempty"` // Use album artist for matching if available
+	UseComposer    bool         `json:"use_composer,omitempty"`     // Match the external artist against the composer field
+	// Filters applied to matched songs (case-insensitive substring match)
+	Composer string `json:"composer,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+	Grouping string `json:"grouping,omitempty"`
+	// Match tunes how external tracks are scored against local songs
+	Match MatchWeights `json:"match"`
+}
+
+// MatchWeights tunes how external tracks are scored against local songs.
+// Weights are relative: a track scores the weighted mean of the title,
+// artist, album and duration similarities, leaving out album and duration
+// when either side lacks them. When no weight is set the default weights
+// are used, and a zero threshold or tolerance uses its default.
+type MatchWeights struct {
+	Title    float64 `json:"title,omitempty"`
+	Artist   float64 `json:"artist,omitempty"`
+	Album    float64 `json:"album,omitempty"`
+	Duration float64 `json:"duration,omitempty"`
+	// Threshold is the lowest score (0-1) accepted as a match
+	Threshold float64 `json:"threshold,omitempty"`
+	// ThresholdSet marks a Threshold of 0, which accepts every match, as set
+	ThresholdSet bool `json:"threshold_set,omitempty"`
+	// DurationTolerance is how many seconds apart durations still fully match
+	DurationTolerance int `json:"duration_tolerance,omitempty"`
+	// DurationToleranceSet marks a DurationTolerance of 0, which only fully
+	// matches equal durations, as set
+	DurationToleranceSet bool `json:"duration_tolerance_set,omitempty"`
+}
+
+// HasWeights returns true if any weight is set
+func (mw MatchWeights) HasWeights() bool {
+	return mw.Title != 0 || mw.Artist != 0 || mw.Album != 0 || mw.Duration != 0
+}
+
+// HasThreshold returns true if the threshold is set, including to 0
+func (mw MatchWeights) HasThreshold() bool {
+	return mw.ThresholdSet || mw.Threshold != 0
+}
+
+// HasDurationTolerance returns true if the duration tolerance is set,
+// including to 0
+func (mw MatchWeights) HasDurationTolerance() bool {
+	return mw.DurationToleranceSet || mw.DurationTolerance != 0
+}
+
+// Validate validates the match weights
+func (mw MatchWeights) Validate() error {
+	if mw.Title < 0 || mw.Artist < 0 || mw.Album < 0 || mw.Duration < 0 {
+		return ErrInvalidMatchWeights
+	}
+	if mw.HasWeights() && mw.Title == 0 && mw.Artist == 0 {
+		// Album and duration alone match too many songs
+		return ErrInvalidMatchWeights
+	}
+	if !(mw.Threshold >= 0 && mw.Threshold <= 1) || mw.DurationTolerance < 0 {
+		return ErrInvalidMatchWeights
+	}
+	return nil
 }
 
 // Validate validates the playlist request
@@ -122,8 +183,16 @@ func (pr *PlaylistRequest) Validate() error {
 	if pr.Type == PlaylistTypeTag && pr.Tag == "" {
 		return ErrTagRequired
 	}
+	if err := pr.Match.Validate(); err != nil {
+		return err
+	}
 	if pr.Limit <= 0 {
 		pr.Limit = 50 // Default limit
 	}
 	return nil
 }
+
+// HasFilters returns true if any song filter is set
+func (pr *PlaylistRequest) HasFilters() bool {
+	return pr.Composer != "" || pr.Comment != "" || pr.Grouping != ""
+}
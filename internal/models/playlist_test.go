@@ -1,6 +1,7 @@
 package models
 
 import (
+	"math"
 	"testing"
 )
 
@@ -115,6 +116,46 @@ func TestPlaylistRequest_Validate(t *testing.T) {
 			req:     PlaylistRequest{Type: PlaylistTypeTag, DataSource: DataSourceLastFM},
 			wantErr: ErrTagRequired,
 		},
+		{
+			name:    "custom match weights",
+			req:     PlaylistRequest{Type: PlaylistTypeTopSongs, DataSource: DataSourceSpotify, Match: MatchWeights{Title: 1, Duration: 0.5, Threshold: 0.7}},
+			wantErr: nil,
+		},
+		{
+			name:    "negative match weight",
+			req:     PlaylistRequest{Type: PlaylistTypeTopSongs, DataSource: DataSourceSpotify, Match: MatchWeights{Title: 1, Album: -1}},
+			wantErr: ErrInvalidMatchWeights,
+		},
+		{
+			name:    "match weights without title or artist",
+			req:     PlaylistRequest{Type: PlaylistTypeTopSongs, DataSource: DataSourceSpotify, Match: MatchWeights{Album: 1, Duration: 1}},
+			wantErr: ErrInvalidMatchWeights,
+		},
+		{
+			name:    "match threshold above 1",
+			req:     PlaylistRequest{Type: PlaylistTypeTopSongs, DataSource: DataSourceSpotify, Match: MatchWeights{Threshold: 1.5}},
+			wantErr: ErrInvalidMatchWeights,
+		},
+		{
+			name:    "match threshold and duration tolerance set to 0",
+			req:     PlaylistRequest{Type: PlaylistTypeTopSongs, DataSource: DataSourceSpotify, Match: MatchWeights{ThresholdSet: true, DurationToleranceSet: true}},
+			wantErr: nil,
+		},
+		{
+			name:    "negative match threshold",
+			req:     PlaylistRequest{Type: PlaylistTypeTopSongs, DataSource: DataSourceSpotify, Match: MatchWeights{Threshold: -0.1}},
+			wantErr: ErrInvalidMatchWeights,
+		},
+		{
+			name:    "match threshold not a number",
+			req:     PlaylistRequest{Type: PlaylistTypeTopSongs, DataSource: DataSourceSpotify, Match: MatchWeights{Threshold: math.NaN()}},
+			wantErr: ErrInvalidMatchWeights,
+		},
+		{
+			name:    "negative duration tolerance",
+			req:     PlaylistRequest{Type: PlaylistTypeTopSongs, DataSource: DataSourceSpotify, Match: MatchWeights{DurationTolerance: -1}},
+			wantErr: ErrInvalidMatchWeights,
+		},
 	}
 
 	for _, tt := range tests {
@@ -138,6 +179,27 @@ func TestPlaylistRequest_Validate_DefaultLimit(t *testing.T) {
 	}
 }
 
+func TestPlaylistRequest_HasFilters(t *testing.T) {
+	tests := []struct {
+		name string
+		req  PlaylistRequest
+		want bool
+	}{
+		{"no filters", PlaylistRequest{UseComposer: true}, false},
+		{"composer", PlaylistRequest{Composer: "Bach"}, true},
+		{"comment", PlaylistRequest{Comment: "live"}, true},
+		{"grouping", PlaylistRequest{Grouping: "OST"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.req.HasFilters(); got != tt.want {
+				t.Errorf("PlaylistRequest.HasFilters() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestPlaylist_TableName(t *testing.T) {
 	p := Playlist{}
 	if got := p.TableName(); got != "playlists" {
@@ -205,3 +267,15 @@ func TestPlaylistRequest_UseAlbumArtist(t *testing.T) {
 		})
 	}
 }
+
+func TestMatchWeights_HasThreshold(t *testing.T) {
+	if (MatchWeights{}).HasThreshold() || (MatchWeights{}).HasDurationTolerance() {
+		t.Error("zero MatchWeights should leave the threshold and tolerance unset")
+	}
+	if !(MatchWeights{Threshold: 0.7}).HasThreshold() || !(MatchWeights{ThresholdSet: true}).HasThreshold() {
+		t.Error("HasThreshold() should be true for a threshold that is set, including to 0")
+	}
+	if !(MatchWeights{DurationTolerance: 2}).HasDurationTolerance() || !(MatchWeights{DurationToleranceSet: true}).HasDurationTolerance() {
+		t.Error("HasDurationTolerance() should be true for a tolerance that is set, including to 0")
+	}
+}
@@ -10,15 +10,21 @@ import (
 // Song represents a track in the Rockbox database
 type Song struct {
 	gorm.Model
-	RockboxID       string  `gorm:"uniqueIndex;not null" json:"rockbox_id"`
+	DeviceID        uint    `gorm:"uniqueIndex:idx_songs_device_rockbox_id;not null;default:0" json:"device_id"`
+	RockboxID       string  `gorm:"uniqueIndex:idx_songs_device_rockbox_id;not null" json:"rockbox_id"`
 	Path            string  `gorm:"not null" json:"path"`
 	Title           string  `gorm:"index" json:"title"`
 	Artist          string  `gorm:"index" json:"artist"`
 	AlbumArtist     string  `gorm:"index" json:"album_artist"`
 	Album           string  `gorm:"index" json:"album"`
 	Genre           string  `gorm:"index" json:"genre"`
+	Composer        string  `gorm:"index" json:"composer,omitempty"`
+	Comment         string  `json:"comment,omitempty"`
+	Grouping        string  `gorm:"index" json:"grouping,omitempty"`
 	Year            int     `json:"year"`
 	TrackNumber     int     `json:"track_number"`
+	TrackNumberGenerated bool `json:"track_number_generated,omitempty"` // Rockbox guessed the track number
+	NumericDirty    bool    `gorm:"-" json:"-"` // the device changed its statistics since the database was built
 	DiscNumber      int     `json:"disc_number"`
 	Duration        int     `json:"duration"` // in seconds
 	Bitrate         int     `json:"bitrate"`
@@ -26,7 +32,18 @@ type Song struct {
 	FileSize        int64   `json:"file_size"`
 	Rating          int     `json:"rating"`
 	PlayCount       int     `json:"play_count"`
-	LastPlayed      *time.Time `json:"last_played,omitempty"`
+	LastPlayed      *time.Time `json:"last_played,omitempty"` // best-effort estimate from LastPlayedSerial
+	// Plays imported from the scrobbler log. They are counted in PlayCount
+	// and LastPlayed too and kept here so a re-parse can add them to the
+	// device's statistics again and push-stats can leave them out
+	ImportedPlays    int        `gorm:"not null;default:0" json:"imported_plays,omitempty"`
+	LastImportedPlay *time.Time `json:"last_imported_play,omitempty"`
+	// Rockbox play statistics
+	LastPlayedSerial int    `json:"last_played_serial,omitempty"` // commit-relative lastplayed counter
+	PlayTime        int     `json:"play_time,omitempty"`    // total time played in milliseconds
+	LastElapsed     int     `json:"last_elapsed,omitempty"` // resume position in milliseconds
+	LastOffset      int     `json:"last_offset,omitempty"`  // resume position in bytes
+	FileModifiedAt  *time.Time `json:"file_modified_at,omitempty"`
 	// External IDs for matching
 	MusicBrainzID   string  `gorm:"index" json:"musicbrainz_id,omitempty"`
 	SpotifyID       string  `gorm:"index" json:"spotify_id,omitempty"`
@@ -65,3 +82,123 @@ func (s *Song) GetEffectiveArtist() string {
 	}
 	return s.Artist
 }
+
+// ExternalID returns the ID of the song at a data source, empty when the
+// song has not been matched there
+func (s *Song) ExternalID(source DataSource) string {
+	switch source {
+	case DataSourceLastFM:
+		return s.LastFMID
+	case DataSourceSpotify:
+		return s.SpotifyID
+	case DataSourceMusicBrainz:
+		return s.MusicBrainzID
+	}
+	return ""
+}
+
+// SetExternalMatch records the ID of the song at a data source, with the
+// confidence of the match that found it
+func (s *Song) SetExternalMatch(source DataSource, id string, confidence float64, at time.Time) {
+	switch source {
+	case DataSourceLastFM:
+		s.LastFMID = id
+	case DataSourceSpotify:
+		s.SpotifyID = id
+	case DataSourceMusicBrainz:
+		s.MusicBrainzID = id
+	default:
+		return
+	}
+	s.MatchedSource = string(source)
+	s.MatchedAt = &at
+	s.MatchConfidence = confidence
+}
+
+// DeviceColumns are the song columns read from the Rockbox device.
+// Re-parsing overwrites them and leaves enrichment such as external IDs alone.
+var DeviceColumns = []string{
+	"path", "title", "artist", "album_artist", "album", "genre", "composer", "comment", "grouping",
+	"year", "track_number", "track_number_generated", "disc_number", "duration", "bitrate",
+	"frequency", "file_size", "rating", "play_count", "last_played", "last_played_serial",
+	"play_time", "last_elapsed", "last_offset", "file_modified_at",
+}
+
+// MatchColumns are the song columns set by matching the song at a data source.
+// Saving a match writes only these, leaving the device columns to the parser.
+var MatchColumns = []string{
+	"music_brainz_id", "spotify_id", "last_fm_id", "matched_source", "matched_at", "match_confidence",
+}
+
+// SameDeviceData reports whether two songs hold the same data read from the device.
+// LastPlayed is compared through LastPlayedSerial since the timestamp is an estimate.
+func (s *Song) SameDeviceData(other *Song) bool {
+	return s.Path == other.Path &&
+		s.Title == other.Title &&
+		s.Artist == other.Artist &&
+		s.AlbumArtist == other.AlbumArtist &&
+		s.Album == other.Album &&
+		s.Genre == other.Genre &&
+		s.Composer == other.Composer &&
+		s.Comment == other.Comment &&
+		s.Grouping == other.Grouping &&
+		s.Year == other.Year &&
+		s.TrackNumber == other.TrackNumber &&
+		s.TrackNumberGenerated == other.TrackNumberGenerated &&
+		s.DiscNumber == other.DiscNumber &&
+		s.Duration == other.Duration &&
+		s.Bitrate == other.Bitrate &&
+		s.Frequency == other.Frequency &&
+		s.FileSize == other.FileSize &&
+		s.Rating == other.Rating &&
+		s.PlayCount == other.PlayCount &&
+		s.LastPlayedSerial == other.LastPlayedSerial &&
+		s.PlayTime == other.PlayTime &&
+		s.LastElapsed == other.LastElapsed &&
+		s.LastOffset == other.LastOffset &&
+		sameTime(s.FileModifiedAt, other.FileModifiedAt)
+}
+
+// CountPlay counts an imported play at the given time in the play count and
+// last played time
+func (s *Song) CountPlay(at time.Time) {
+	s.PlayCount++
+	s.ImportedPlays++
+	if s.LastPlayed == nil || at.After(*s.LastPlayed) {
+		s.LastPlayed = &at
+	}
+	if s.LastImportedPlay == nil || at.After(*s.LastImportedPlay) {
+		s.LastImportedPlay = &at
+	}
+}
+
+// KeepImportedPlays adds the plays imported into stored to the statistics of
+// s, which were just read from the device
+func (s *Song) KeepImportedPlays(stored *Song) {
+	s.ImportedPlays = stored.ImportedPlays
+	s.LastImportedPlay = stored.LastImportedPlay
+	s.PlayCount += stored.ImportedPlays
+	if s.LastImportedPlay != nil && (s.LastPlayed == nil || s.LastImportedPlay.After(*s.LastPlayed)) {
+		s.LastPlayed = s.LastImportedPlay
+	}
+}
+
+// DeviceStats returns a copy of s without its imported plays, holding the
+// statistics the device itself recorded
+func (s *Song) DeviceStats() *Song {
+	out := *s
+	out.PlayCount -= s.ImportedPlays
+	if s.LastPlayedSerial == 0 && sameTime(s.LastPlayed, s.LastImportedPlay) {
+		out.LastPlayed = nil
+	}
+	out.ImportedPlays, out.LastImportedPlay = 0, nil
+	return &out
+}
+
+// sameTime compares two optional times
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
@@ -2,6 +2,7 @@ package models
 
 import (
 	"testing"
+	"time"
 )
 
 func TestSong_IsMatched(t *testing.T) {
@@ -46,6 +47,34 @@ func TestSong_IsMatched(t *testing.T) {
 	}
 }
 
+func TestSong_SetExternalMatch(t *testing.T) {
+	at := time.Unix(1700000000, 0)
+	sources := []DataSource{DataSourceLastFM, DataSourceSpotify, DataSourceMusicBrainz}
+	for _, source := range sources {
+		t.Run(string(source), func(t *testing.T) {
+			var song Song
+			song.SetExternalMatch(source, "id-"+string(source), 0.9, at)
+			if got := song.ExternalID(source); got != "id-"+string(source) {
+				t.Errorf("ExternalID(%s) = %q, want %q", source, got, "id-"+string(source))
+			}
+			for _, other := range sources {
+				if other != source && song.ExternalID(other) != "" {
+					t.Errorf("ExternalID(%s) = %q, want empty", other, song.ExternalID(other))
+				}
+			}
+			if song.MatchedSource != string(source) || song.MatchConfidence != 0.9 || song.MatchedAt == nil || !song.MatchedAt.Equal(at) {
+				t.Errorf("SetExternalMatch() = %s/%v/%v, want %s/0.9/%v", song.MatchedSource, song.MatchConfidence, song.MatchedAt, source, at)
+			}
+		})
+	}
+
+	var song Song
+	song.SetExternalMatch(DataSource("unknown"), "id", 0.9, at)
+	if song.MatchedSource != "" || song.ExternalID(DataSource("unknown")) != "" {
+		t.Errorf("SetExternalMatch() with an unknown source = %+v, want no change", song)
+	}
+}
+
 func TestSong_GetDisplayName(t *testing.T) {
 	tests := []struct {
 		name string
@@ -121,3 +150,32 @@ func TestSong_TableName(t *testing.T) {
 		t.Errorf("Song.TableName() = %v, want songs", got)
 	}
 }
+
+func TestSong_SameDeviceData(t *testing.T) {
+	played := time.Date(2024, 3, 9, 21, 30, 0, 0, time.UTC)
+	base := Song{Path: "/a.mp3", Title: "A", PlayCount: 3, LastPlayedSerial: 7, LastPlayed: &played}
+
+	tests := []struct {
+		name   string
+		modify func(s *Song)
+		want   bool
+	}{
+		{"identical", func(s *Song) {}, true},
+		{"enrichment differs", func(s *Song) { s.SpotifyID = "abc"; s.MatchConfidence = 0.5 }, true},
+		{"estimated last played drifts", func(s *Song) { later := played.Add(time.Hour); s.LastPlayed = &later }, true},
+		{"title differs", func(s *Song) { s.Title = "B" }, false},
+		{"play count differs", func(s *Song) { s.PlayCount = 4 }, false},
+		{"lastplayed counter differs", func(s *Song) { s.LastPlayedSerial = 8 }, false},
+		{"modification time set", func(s *Song) { s.FileModifiedAt = &played }, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			other := base
+			tt.modify(&other)
+			if got := base.SameDeviceData(&other); got != tt.want {
+				t.Errorf("SameDeviceData() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package normalize
+
+import (
+	"regexp"
+	"strings"
+)
+
+// creditSeparator splits a credit naming several artists: featured artists
+// ("feat.", "ft.", "featuring", "with"), joint credits ("&", "and", "+", "/",
+// commas) and versus credits ("vs.", "x")
+var creditSeparator = regexp.MustCompile(`(?i)\s+(?:feat\.?|ft\.?|featuring|with|vs\.?|versus|x|and|\+|/)\s+|\s*[,;&]\s*`)
+
+// ArtistKey folds an artist name for lookup. On top of Text, an inverted
+// article is moved back and a leading "the" is dropped, so "The Beatles",
+// "Beatles, The" and "Beatles" share a key.
+func ArtistKey(name string) string {
+	key := Text(uninvert(name))
+	if rest, ok := strings.CutPrefix(key, "the "); ok {
+		return rest
+	}
+	return key
+}
+
+// ArtistCredits returns the artists named by a credit: the whole credit
+// first, then each featured or joint artist. "Jay-Z feat. Alicia Keys"
+// gives "Jay-Z feat. Alicia Keys", "Jay-Z" and "Alicia Keys". Names with
+// the same ArtistKey are returned once.
+func ArtistCredits(credit string) []string {
+	credit = strings.TrimSpace(uninvert(credit))
+	if credit == "" {
+		return nil
+	}
+
+	credits := []string{credit}
+	seen := map[string]bool{ArtistKey(credit): true}
+	// Brackets only group a featured credit: "Song (feat. X)"
+	unbracketed := strings.NewReplacer("(", " ", ")", " ", "[", " ", "]", " ").Replace(credit)
+	for _, part := range creditSeparator.Split(unbracketed, -1) {
+		part = strings.TrimSpace(part)
+		key := ArtistKey(part)
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		credits = append(credits, part)
+	}
+	return credits
+}
+
+// uninvert moves an article inverted for sorting back to the front:
+// "Beatles, The" becomes "The Beatles". Only a trailing article is moved,
+// so "Tyler, the Creator" is left alone.
+func uninvert(name string) string {
+	name = strings.TrimSpace(name)
+	i := strings.LastIndex(name, ",")
+	if i < 0 {
+		return name
+	}
+	article := strings.TrimSpace(name[i+1:])
+	if !strings.EqualFold(article, "the") {
+		return name
+	}
+	return article + " " + strings.TrimSpace(name[:i])
+}
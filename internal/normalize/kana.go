@@ -0,0 +1,132 @@
+package normalize
+
+import (
+	"bytes"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// katakanaOffset is the distance from a katakana to its hiragana
+	katakanaOffset = 'ア' - 'あ'
+	// sokuon doubles the consonant that follows it
+	sokuon = 'っ'
+	// choonpu lengthens the vowel before it; it is dropped like a macron
+	choonpu = 'ー'
+)
+
+// kana are the Hepburn spellings of the hiragana syllables
+var kana = map[rune]string{
+	'あ': "a", 'い': "i", 'う': "u", 'え': "e", 'お': "o",
+	'か': "ka", 'き': "ki", 'く': "ku", 'け': "ke", 'こ': "ko",
+	'さ': "sa", 'し': "shi", 'す': "su", 'せ': "se", 'そ': "so",
+	'た': "ta", 'ち': "chi", 'つ': "tsu", 'て': "te", 'と': "to",
+	'な': "na", 'に': "ni", 'ぬ': "nu", 'ね': "ne", 'の': "no",
+	'は': "ha", 'ひ': "hi", 'ふ': "fu", 'へ': "he", 'ほ': "ho",
+	'ま': "ma", 'み': "mi", 'む': "mu", 'め': "me", 'も': "mo",
+	'や': "ya", 'ゆ': "yu", 'よ': "yo",
+	'ら': "ra", 'り': "ri", 'る': "ru", 'れ': "re", 'ろ': "ro",
+	'わ': "wa", 'ゐ': "i", 'ゑ': "e", 'を': "o", 'ん': "n",
+	'が': "ga", 'ぎ': "gi", 'ぐ': "gu", 'げ': "ge", 'ご': "go",
+	'ざ': "za", 'じ': "ji", 'ず': "zu", 'ぜ': "ze", 'ぞ': "zo",
+	'だ': "da", 'ぢ': "ji", 'づ': "zu", 'で': "de", 'ど': "do",
+	'ば': "ba", 'び': "bi", 'ぶ': "bu", 'べ': "be", 'ぼ': "bo",
+	'ぱ': "pa", 'ぴ': "pi", 'ぷ': "pu", 'ぺ': "pe", 'ぽ': "po",
+	'ゔ': "vu",
+}
+
+// smallKana change the vowel of the syllable before them: き and ゃ are
+// kya, ふ and ぁ are fa
+var smallKana = map[rune]string{
+	'ぁ': "a", 'ぃ': "i", 'ぅ': "u", 'ぇ': "e", 'ぉ': "o",
+	'ゃ': "ya", 'ゅ': "yu", 'ょ': "yo", 'ゎ': "wa",
+}
+
+// romanizeKana spells hiragana and katakana in Hepburn romanization and
+// leaves other characters alone. s must be composed (NFC or NFKC) so voiced
+// syllables such as が are single characters.
+func romanizeKana(s string) string {
+	if !strings.ContainsFunc(s, isKana) {
+		return s
+	}
+
+	b := make([]byte, 0, len(s))
+	afterKana := false // the last bytes written spell a syllable
+	double := false    // a sokuon is waiting for the next syllable
+	for _, r := range s {
+		if r >= 'ァ' && r <= 'ヶ' {
+			r -= katakanaOffset
+		}
+
+		switch {
+		case r == choonpu:
+			continue
+		case r == sokuon:
+			double = true
+			continue
+		}
+
+		if small, ok := smallKana[r]; ok {
+			b = appendSmallKana(b, small, afterKana)
+			afterKana = true
+			continue
+		}
+
+		romaji, ok := kana[r]
+		if !ok {
+			b = utf8.AppendRune(b, r)
+			afterKana, double = false, false
+			continue
+		}
+		if double {
+			b = appendDoubled(b, romaji)
+			double = false
+		}
+		b = append(b, romaji...)
+		afterKana = true
+	}
+	return string(b)
+}
+
+// appendSmallKana merges a small kana into the syllable before it. Small
+// ya, yu and yo follow an i-syllable: ki becomes kya, and shi, chi and ji
+// lose their i (sha, chu, jo). Small vowels replace the vowel before them.
+func appendSmallKana(b []byte, small string, afterKana bool) []byte {
+	if !afterKana || len(b) == 0 {
+		return append(b, small...)
+	}
+	last := b[len(b)-1]
+
+	if small[0] == 'y' {
+		if last != 'i' {
+			return append(b, small...)
+		}
+		b = b[:len(b)-1]
+		if bytes.HasSuffix(b, []byte("sh")) || bytes.HasSuffix(b, []byte("ch")) || bytes.HasSuffix(b, []byte("j")) {
+			return append(b, small[1:]...)
+		}
+		return append(b, small...)
+	}
+
+	if strings.IndexByte("aiueo", last) >= 0 {
+		b = b[:len(b)-1]
+	}
+	return append(b, small...)
+}
+
+// appendDoubled writes the consonant doubled by a sokuon: っか is kka and
+// っち is tchi. Before a vowel the sokuon is a glottal stop and is dropped.
+func appendDoubled(b []byte, romaji string) []byte {
+	switch {
+	case strings.HasPrefix(romaji, "ch"):
+		return append(b, 't')
+	case strings.IndexByte("aiueon", romaji[0]) >= 0:
+		return b
+	}
+	return append(b, romaji[0])
+}
+
+// isKana reports whether r is a hiragana or katakana character
+func isKana(r rune) bool {
+	return (r >= 'ぁ' && r <= 'ゖ') || (r >= 'ァ' && r <= 'ヺ') || r == choonpu
+}
@@ -0,0 +1,96 @@
+// Package normalize folds names and titles to a common form for matching
+// local songs against external data sources
+package normalize
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Text folds s for comparison. Strings that differ only in case, accents,
+// script or punctuation fold to the same value:
+//
+//   - compatibility characters are folded (NFKD), so full-width letters,
+//     ligatures and half-width katakana become their plain forms
+//   - diacritics are stripped: Motörhead becomes motorhead
+//   - Cyrillic, Greek and kana are transliterated to Latin letters, and
+//     letters such as ø, æ and ß are spelled out
+//   - & becomes and, apostrophes are dropped and other punctuation becomes
+//     a single space
+//
+// Scripts without a transliteration, such as Han, are kept as they are.
+func Text(s string) string {
+	// Kana are transliterated on composed text so voiced marks stay on
+	// their syllable, then NFKD splits off the remaining diacritics
+	s = romanizeKana(norm.NFKC.String(strings.ToLower(s)))
+	s = norm.NFKD.String(s)
+
+	var b strings.Builder
+	b.Grow(len(s))
+	space := true // no leading space
+	writeSpace := func() {
+		if !space {
+			b.WriteByte(' ')
+			space = true
+		}
+	}
+	for _, r := range s {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			// diacritic split off by NFKD
+		case isApostrophe(r):
+		case r == '&':
+			writeSpace()
+			b.WriteString("and ")
+		case unicode.IsLetter(r):
+			if latin, ok := transliteration[unicode.ToLower(r)]; ok {
+				b.WriteString(latin)
+			} else {
+				b.WriteRune(unicode.ToLower(r))
+			}
+			space = false
+		case unicode.IsDigit(r):
+			b.WriteRune(r)
+			space = false
+		default:
+			writeSpace()
+		}
+	}
+	// Recompose what NFKD split apart in scripts kept as they are, e.g. Hangul
+	return norm.NFC.String(strings.TrimSuffix(b.String(), " "))
+}
+
+// isApostrophe reports whether r is an apostrophe, which is dropped so
+// "Don't" and "Dont" fold alike
+func isApostrophe(r rune) bool {
+	switch r {
+	case '\'', '`', '´', 'ʼ', '‘', '’':
+		return true
+	}
+	return false
+}
+
+// transliteration spells letters in Latin. Letters with diacritics are
+// listed without them, since NFKD has split the diacritic off: й is и
+// followed by a breve.
+var transliteration = map[rune]string{
+	// Latin letters without a decomposition
+	'ø': "o", 'æ': "ae", 'œ': "oe", 'ß': "ss", 'ł': "l", 'đ': "d", 'ð': "d",
+	'þ': "th", 'ı': "i", 'ħ': "h", 'ŧ': "t", 'ŋ': "n", 'ĸ': "k", 'ſ': "s",
+
+	// Cyrillic
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ж': "zh",
+	'з': "z", 'и': "i", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o",
+	'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "kh",
+	'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "shch", 'ъ': "", 'ы': "y", 'ь': "",
+	'э': "e", 'ю': "yu", 'я': "ya", 'і': "i", 'є': "ye", 'ґ': "g", 'ђ': "dj",
+	'ј': "j", 'љ': "lj", 'њ': "nj", 'ћ': "c", 'џ': "dz", 'ѕ': "dz",
+
+	// Greek
+	'α': "a", 'β': "v", 'γ': "g", 'δ': "d", 'ε': "e", 'ζ': "z", 'η': "i",
+	'θ': "th", 'ι': "i", 'κ': "k", 'λ': "l", 'μ': "m", 'ν': "n", 'ξ': "x",
+	'ο': "o", 'π': "p", 'ρ': "r", 'σ': "s", 'ς': "s", 'τ': "t", 'υ': "y",
+	'φ': "f", 'χ': "ch", 'ψ': "ps", 'ω': "o",
+}
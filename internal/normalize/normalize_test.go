@@ -0,0 +1,186 @@
+package normalize
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestText(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		// Case, spacing and punctuation
+		{"plain", "Master of Puppets", "master of puppets"},
+		{"empty", "", ""},
+		{"only punctuation", " -- ", ""},
+		{"spacing", "  Fade   to\tBlack ", "fade to black"},
+		{"punctuation", "Enter Sandman (Remastered) - Live!", "enter sandman remastered live"},
+		{"apostrophe", "Don't Tread on Me", "dont tread on me"},
+		{"typographic apostrophe", "Don’t Tread on Me", "dont tread on me"},
+		{"dotted initials", "R.E.M.", "r e m"},
+		{"hyphen", "Jay-Z", "jay z"},
+		{"slash", "AC/DC", "ac dc"},
+		{"ampersand", "Simon & Garfunkel", "simon and garfunkel"},
+		{"ampersand unspaced", "Earth,Wind&Fire", "earth wind and fire"},
+		{"ampersand spelled", "Simon and Garfunkel", "simon and garfunkel"},
+		{"digits", "1979", "1979"},
+
+		// Diacritics
+		{"umlaut", "Motörhead", "motorhead"},
+		{"acute", "Sigur Rós", "sigur ros"},
+		{"cedilla", "Françoise Hardy", "francoise hardy"},
+		{"tilde", "Señor", "senor"},
+		{"ring", "Ålesund", "alesund"},
+		{"caron", "Dvořák", "dvorak"},
+		{"decomposed input", "Sigur Ro\u0301s", "sigur ros"},
+		{"heavy metal umlaut", "Mötley Crüe", "motley crue"},
+		{"vietnamese", "Mỹ Tâm", "my tam"},
+		{"turkish dotted capital", "İstanbul", "istanbul"},
+		{"turkish dotless", "Işık", "isik"},
+
+		// Letters without a decomposition
+		{"o slash", "Sørensen", "sorensen"},
+		{"ae", "Ænima", "aenima"},
+		{"sharp s", "Straße", "strasse"},
+		{"polish l", "Łódź", "lodz"},
+		{"eth and thorn", "Þórður", "thordur"},
+		{"oe", "Œuvre", "oeuvre"},
+
+		// Compatibility characters
+		{"ligature", "ﬁre", "fire"},
+		{"full-width", "ＡＢＣ１２３", "abc123"},
+		{"superscript", "E=mc²", "e mc2"},
+		{"circled digit", "Track ①", "track 1"},
+
+		// Cyrillic
+		{"russian", "Кино", "kino"},
+		{"russian name", "Земфира", "zemfira"},
+		{"russian soft sign", "Король и Шут", "korol i shut"},
+		{"russian short i", "Чайковский", "chaikovskii"},
+		{"russian yo", "Ёлка", "elka"},
+		{"russian shch", "Щедрин", "shchedrin"},
+		{"ukrainian", "Океан Ельзи", "okean elzi"},
+		{"ukrainian yi", "Її", "ii"},
+		{"serbian", "Ђорђе Балашевић", "djordje balashevic"},
+
+		// Greek
+		{"greek", "Βαγγέλης", "vaggelis"},
+		{"greek final sigma", "Μίκης Θεοδωράκης", "mikis theodorakis"},
+
+		// Japanese kana
+		{"hiragana", "さくら", "sakura"},
+		{"katakana", "カタカナ", "katakana"},
+		{"voiced", "ガンダム", "gandamu"},
+		{"decomposed voiced", "\u30ab\u3099", "ga"},
+		{"half-width katakana", "ｶﾀｶﾅ", "katakana"},
+		{"yoon", "きゃりーぱみゅぱみゅ", "kyaripamyupamyu"},
+		{"yoon sh ch j", "しゃちゅじょ", "shachujo"},
+		{"yoon hy", "ひゃく", "hyaku"},
+		{"sokuon", "がっこう", "gakkou"},
+		{"sokuon ch", "まっちゃ", "matcha"},
+		{"long vowel", "スーパー", "supa"},
+		{"small vowel", "ファイナルファンタジー", "fainarufantaji"},
+		{"middle dot", "ベン・フォールズ", "ben foruzu"},
+		{"mixed kana and han", "東京事変 ウタ", "東京事変 uta"},
+
+		// Scripts without a transliteration are kept
+		{"han", "坂本龍一", "坂本龍一"},
+		{"hangul", "방탄소년단", "방탄소년단"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Text(tt.in); got != tt.want {
+				t.Errorf("Text(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestText_Equivalent(t *testing.T) {
+	// Pairs seen in the wild between Rockbox tags and API results
+	pairs := [][2]string{
+		{"Motörhead", "Motorhead"},
+		{"Sigur Rós", "Sigur Ros"},
+		{"Mötley Crüe", "MOTLEY CRUE"},
+		{"Guns N' Roses", "Guns N’ Roses"},
+		{"Simon & Garfunkel", "Simon and Garfunkel"},
+		{"Кино", "Kino"},
+		{"Björk", "Bjork"},
+		{"Beyoncé", "Beyonce"},
+		{"Sigur Rós", "Sigur Ro\u0301s"},
+		{"ｻｶﾅｸｼｮﾝ", "サカナクション"},
+	}
+
+	for _, p := range pairs {
+		if a, b := Text(p[0]), Text(p[1]); a != b {
+			t.Errorf("Text(%q) = %q, Text(%q) = %q, want equal", p[0], a, p[1], b)
+		}
+	}
+}
+
+func TestText_Idempotent(t *testing.T) {
+	for _, in := range []string{"Motörhead", "Кино", "きゃりーぱみゅぱみゅ", "방탄소년단", "Simon & Garfunkel"} {
+		once := Text(in)
+		if twice := Text(once); twice != once {
+			t.Errorf("Text(Text(%q)) = %q, want %q", in, twice, once)
+		}
+	}
+}
+
+func TestArtistKey(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"The Beatles", "beatles"},
+		{"Beatles, The", "beatles"},
+		{"beatles,the", "beatles"},
+		{"Beatles", "beatles"},
+		{"The The", "the"},
+		{"Tyler, the Creator", "tyler the creator"},
+		{"Simon & Garfunkel", "simon and garfunkel"},
+		{"Motörhead", "motorhead"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			if got := ArtistKey(tt.in); got != tt.want {
+				t.Errorf("ArtistKey(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestArtistCredits(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"Metallica", []string{"Metallica"}},
+		{"", nil},
+		{"Jay-Z feat. Alicia Keys", []string{"Jay-Z feat. Alicia Keys", "Jay-Z", "Alicia Keys"}},
+		{"Eminem ft Rihanna", []string{"Eminem ft Rihanna", "Eminem", "Rihanna"}},
+		{"Santana (featuring Rob Thomas)", []string{"Santana (featuring Rob Thomas)", "Santana", "Rob Thomas"}},
+		{"Simon & Garfunkel", []string{"Simon & Garfunkel", "Simon", "Garfunkel"}},
+		{"Simon and Garfunkel", []string{"Simon and Garfunkel", "Simon", "Garfunkel"}},
+		{"Crosby, Stills, Nash & Young", []string{"Crosby, Stills, Nash & Young", "Crosby", "Stills", "Nash", "Young"}},
+		{"Beatles, The", []string{"The Beatles"}},
+		{"Tiësto vs. Diplo", []string{"Tiësto vs. Diplo", "Tiësto", "Diplo"}},
+		{"AC/DC", []string{"AC/DC"}},
+		{"Lil Nas X", []string{"Lil Nas X"}},
+		{"Queen & Queen", []string{"Queen & Queen", "Queen"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got := ArtistCredits(tt.in)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("ArtistCredits(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+// Package repository provides data access layer interfaces and implementations
+package repository
+
+import (
+	"context"
+
+	"github.com/Ardakilic/rocklist/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// artistAliasRepository implements ArtistAliasRepository
+type artistAliasRepository struct {
+	db *gorm.DB
+}
+
+// NewArtistAliasRepository creates a new artist alias repository
+func NewArtistAliasRepository(db *gorm.DB) ArtistAliasRepository {
+	return &artistAliasRepository{db: db}
+}
+
+// Set makes alias a name of artist, moving it from any artist it named before
+func (r *artistAliasRepository) Set(ctx context.Context, artist, alias string) (*models.ArtistAlias, error) {
+	err := r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "alias"}},
+		DoUpdates: clause.AssignmentColumns([]string{"artist", "updated_at"}),
+	}).Create(&models.ArtistAlias{Artist: artist, Alias: alias}).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var saved models.ArtistAlias
+	if err := r.db.WithContext(ctx).Where("alias = ?", alias).First(&saved).Error; err != nil {
+		return nil, err
+	}
+	return &saved, nil
+}
+
+// Delete removes an alias. It is deleted for good so the name can be added again.
+func (r *artistAliasRepository) Delete(ctx context.Context, alias string) error {
+	result := r.db.WithContext(ctx).Unscoped().Where("alias = ?", alias).Delete(&models.ArtistAlias{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return models.ErrAliasNotFound
+	}
+	return nil
+}
+
+// FindAll returns all aliases ordered by artist and alias
+func (r *artistAliasRepository) FindAll(ctx context.Context) ([]*models.ArtistAlias, error) {
+	var aliases []*models.ArtistAlias
+	err := r.db.WithContext(ctx).Order("artist ASC, alias ASC").Find(&aliases).Error
+	return aliases, err
+}
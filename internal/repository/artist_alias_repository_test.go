@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Ardakilic/rocklist/internal/models"
+)
+
+func TestArtistAliasRepository(t *testing.T) {
+	db := setupTestDB(t)
+	defer func() { _ = db.Close() }()
+
+	repo := NewArtistAliasRepository(db.DB())
+	ctx := context.Background()
+
+	alias, err := repo.Set(ctx, "Prince", "The Artist Formerly Known as Prince")
+	if err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if alias.ID == 0 || alias.Artist != "Prince" {
+		t.Errorf("Set() = %+v, want a saved alias of Prince", alias)
+	}
+	if _, err := repo.Set(ctx, "Prince", "TAFKAP"); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	// Setting an alias again moves it to the new artist
+	moved, err := repo.Set(ctx, "Prince Rogers Nelson", "TAFKAP")
+	if err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if moved.Artist != "Prince Rogers Nelson" {
+		t.Errorf("Set() artist = %q, want %q", moved.Artist, "Prince Rogers Nelson")
+	}
+
+	aliases, err := repo.FindAll(ctx)
+	if err != nil {
+		t.Fatalf("FindAll() error = %v", err)
+	}
+	if len(aliases) != 2 || aliases[0].Artist != "Prince" || aliases[1].Alias != "TAFKAP" {
+		t.Errorf("FindAll() = %+v, want Prince then Prince Rogers Nelson", aliases)
+	}
+
+	if err := repo.Delete(ctx, "TAFKAP"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if err := repo.Delete(ctx, "TAFKAP"); !errors.Is(err, models.ErrAliasNotFound) {
+		t.Errorf("Delete() of a removed alias error = %v, want ErrAliasNotFound", err)
+	}
+	// A removed alias can be added again
+	if _, err := repo.Set(ctx, "Prince", "TAFKAP"); err != nil {
+		t.Errorf("Set() of a removed alias error = %v", err)
+	}
+	if aliases, _ := repo.FindAll(ctx); len(aliases) != 2 {
+		t.Errorf("FindAll() = %d aliases, want 2", len(aliases))
+	}
+}
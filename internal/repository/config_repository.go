@@ -3,6 +3,7 @@ package repository
 
 import (
 	"context"
+	"strconv"
 	"time"
 
 	"github.com/Ardakilic/rocklist/internal/models"
@@ -11,9 +12,9 @@ import (
 )
 
 const (
-	// ConfigKeyLastParsedAt is the key for last parsed timestamp
+	// ConfigKeyLastParsedAt is the key for last parsed timestamp, kept by devices since
 	ConfigKeyLastParsedAt = "last_parsed_at"
-	// ConfigKeyRockboxPath is the key for Rockbox path
+	// ConfigKeyRockboxPath is the key for Rockbox path, kept by devices since
 	ConfigKeyRockboxPath = "rockbox_path"
 	// ConfigKeyLastFMAPIKey is the key for Last.fm API key
 	ConfigKeyLastFMAPIKey = "lastfm_api_key"
@@ -31,6 +32,18 @@ const (
 	ConfigKeyMusicBrainzUserAgent = "musicbrainz_user_agent"
 	// ConfigKeyMusicBrainzEnabled is the key for MusicBrainz enabled status
 	ConfigKeyMusicBrainzEnabled = "musicbrainz_enabled"
+	// ConfigKeyTagCacheSerial is the key for the serial of the last parsed TagCache, kept by devices since
+	ConfigKeyTagCacheSerial = "tagcache_serial"
+	// ConfigKeyTagCacheCommitID is the key for the commit ID of the last parsed TagCache, kept by devices since
+	ConfigKeyTagCacheCommitID = "tagcache_commit_id"
+	// ConfigKeyVolumes is the key for the volume mount points, stored as a JSON object
+	ConfigKeyVolumes = "volumes"
+	// ConfigKeyActiveDevice is the key for the ID of the device in use
+	ConfigKeyActiveDevice = "active_device"
+	// ConfigKeyWatchPlaylistsPrefix starts the keys holding the playlist requests regenerated by watch mode, per device, stored as a JSON array
+	ConfigKeyWatchPlaylistsPrefix = "watch_playlists_"
+	// ConfigKeyEnrichCursorPrefix starts the keys holding the last song searched by an enrichment job, per device and source
+	ConfigKeyEnrichCursorPrefix = "enrich_cursor_"
 )
 
 // configRepository implements ConfigRepository
@@ -116,3 +129,40 @@ func (r *configRepository) GetLastParsedAt(ctx context.Context) (*time.Time, err
 func (r *configRepository) SetLastParsedAt(ctx context.Context, t time.Time) error {
 	return r.Set(ctx, ConfigKeyLastParsedAt, t.Format(time.RFC3339))
 }
+
+// GetTagCacheVersion returns the serial and commit ID of the last parsed TagCache.
+// ok is false when no version has been recorded.
+func (r *configRepository) GetTagCacheVersion(ctx context.Context) (serial, commitID int32, ok bool, err error) {
+	values := make([]int32, 2)
+	for i, key := range []string{ConfigKeyTagCacheSerial, ConfigKeyTagCacheCommitID} {
+		value, err := r.Get(ctx, key)
+		if err != nil {
+			if err == models.ErrConfigNotFound {
+				return 0, 0, false, nil
+			}
+			return 0, 0, false, err
+		}
+		n, err := strconv.ParseInt(value, 10, 32)
+		if err != nil {
+			return 0, 0, false, err
+		}
+		values[i] = int32(n)
+	}
+	return values[0], values[1], true, nil
+}
+
+// SetTagCacheVersion records the serial and commit ID of the parsed TagCache
+func (r *configRepository) SetTagCacheVersion(ctx context.Context, serial, commitID int32) error {
+	if err := r.Set(ctx, ConfigKeyTagCacheSerial, strconv.Itoa(int(serial))); err != nil {
+		return err
+	}
+	return r.Set(ctx, ConfigKeyTagCacheCommitID, strconv.Itoa(int(commitID)))
+}
+
+// ClearTagCacheVersion forgets the recorded TagCache serial and commit ID.
+// The rows are removed for good so a later Set does not upsert into a soft-deleted row.
+func (r *configRepository) ClearTagCacheVersion(ctx context.Context) error {
+	return r.db.WithContext(ctx).Unscoped().
+		Where("key IN ?", []string{ConfigKeyTagCacheSerial, ConfigKeyTagCacheCommitID}).
+		Delete(&models.Config{}).Error
+}
@@ -246,3 +246,36 @@ func TestConfigKeyConstants(t *testing.T) {
 		}
 	}
 }
+
+func TestConfigRepository_TagCacheVersion(t *testing.T) {
+	db := setupConfigTestDB(t)
+	defer func() { _ = db.Close() }()
+
+	repo := NewConfigRepository(db.DB())
+	ctx := context.Background()
+
+	if _, _, ok, err := repo.GetTagCacheVersion(ctx); err != nil || ok {
+		t.Fatalf("GetTagCacheVersion() = ok %v, err %v, want nothing recorded", ok, err)
+	}
+
+	if err := repo.SetTagCacheVersion(ctx, 42, 7); err != nil {
+		t.Fatalf("SetTagCacheVersion() error = %v", err)
+	}
+	serial, commitID, ok, err := repo.GetTagCacheVersion(ctx)
+	if err != nil || !ok || serial != 42 || commitID != 7 {
+		t.Errorf("GetTagCacheVersion() = %d, %d, %v, %v, want 42, 7, true, nil", serial, commitID, ok, err)
+	}
+
+	if err := repo.ClearTagCacheVersion(ctx); err != nil {
+		t.Fatalf("ClearTagCacheVersion() error = %v", err)
+	}
+	if _, _, ok, _ := repo.GetTagCacheVersion(ctx); ok {
+		t.Error("GetTagCacheVersion() should report nothing after ClearTagCacheVersion()")
+	}
+
+	// Recording again after clearing must work
+	_ = repo.SetTagCacheVersion(ctx, 43, 8)
+	if serial, _, ok, _ := repo.GetTagCacheVersion(ctx); !ok || serial != 43 {
+		t.Errorf("GetTagCacheVersion() serial = %d, ok %v, want 43 after re-recording", serial, ok)
+	}
+}
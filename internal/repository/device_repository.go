@@ -0,0 +1,76 @@
+// Package repository provides data access layer interfaces and implementations
+package repository
+
+import (
+	"context"
+
+	"github.com/Ardakilic/rocklist/internal/models"
+	"gorm.io/gorm"
+)
+
+// deviceRepository implements DeviceRepository
+type deviceRepository struct {
+	db *gorm.DB
+}
+
+// NewDeviceRepository creates a new device repository
+func NewDeviceRepository(db *gorm.DB) DeviceRepository {
+	return &deviceRepository{db: db}
+}
+
+// Create creates a new device
+func (r *deviceRepository) Create(ctx context.Context, device *models.Device) error {
+	return r.db.WithContext(ctx).Create(device).Error
+}
+
+// Update updates an existing device
+func (r *deviceRepository) Update(ctx context.Context, device *models.Device) error {
+	return r.db.WithContext(ctx).Save(device).Error
+}
+
+// FindByID finds a device by ID
+func (r *deviceRepository) FindByID(ctx context.Context, id uint) (*models.Device, error) {
+	var device models.Device
+	err := r.db.WithContext(ctx).First(&device, id).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, models.ErrDeviceNotFound
+		}
+		return nil, err
+	}
+	return &device, nil
+}
+
+// FindByName finds a device by name
+func (r *deviceRepository) FindByName(ctx context.Context, name string) (*models.Device, error) {
+	var device models.Device
+	err := r.db.WithContext(ctx).Where("name = ?", name).First(&device).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, models.ErrDeviceNotFound
+		}
+		return nil, err
+	}
+	return &device, nil
+}
+
+// FindAll returns all devices ordered by name
+func (r *deviceRepository) FindAll(ctx context.Context) ([]*models.Device, error) {
+	var devices []*models.Device
+	err := r.db.WithContext(ctx).Order("name ASC").Find(&devices).Error
+	return devices, err
+}
+
+// ClaimUnassigned moves the songs and playlists without a device, left from
+// a database created before devices existed, to the device with deviceID.
+// Removed songs are moved too so they can still be restored.
+func (r *deviceRepository) ClaimUnassigned(ctx context.Context, deviceID uint) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Model(&models.Song{}).Where("device_id = 0").
+			Update("device_id", deviceID).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Model(&models.Playlist{}).Where("device_id = 0").
+			Update("device_id", deviceID).Error
+	})
+}
@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Ardakilic/rocklist/internal/models"
+)
+
+func TestDeviceRepository(t *testing.T) {
+	db := setupTestDB(t)
+	defer func() { _ = db.Close() }()
+
+	repo := NewDeviceRepository(db.DB())
+	ctx := context.Background()
+
+	ipod := &models.Device{Name: "ipod", Path: "/media/IPOD"}
+	fuze := &models.Device{Name: "fuze"}
+	for _, device := range []*models.Device{ipod, fuze} {
+		if err := repo.Create(ctx, device); err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+	}
+	if err := repo.Create(ctx, &models.Device{Name: "ipod"}); err == nil {
+		t.Error("Create() should reject a duplicate name")
+	}
+
+	ipod.SetTagCacheVersion(12, 3)
+	if err := repo.Update(ctx, ipod); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+
+	found, err := repo.FindByName(ctx, "ipod")
+	if err != nil {
+		t.Fatalf("FindByName() error = %v", err)
+	}
+	if serial, commitID, ok := found.TagCacheVersion(); found.ID != ipod.ID || !ok || serial != 12 || commitID != 3 {
+		t.Errorf("FindByName() = %+v, want ipod at TagCache 12/3", found)
+	}
+	if found, err := repo.FindByID(ctx, fuze.ID); err != nil || found.Name != "fuze" {
+		t.Errorf("FindByID() = %+v, %v, want fuze", found, err)
+	}
+	if _, err := repo.FindByName(ctx, "zune"); !errors.Is(err, models.ErrDeviceNotFound) {
+		t.Errorf("FindByName() error = %v, want ErrDeviceNotFound", err)
+	}
+	if _, err := repo.FindByID(ctx, 999); !errors.Is(err, models.ErrDeviceNotFound) {
+		t.Errorf("FindByID() error = %v, want ErrDeviceNotFound", err)
+	}
+
+	devices, err := repo.FindAll(ctx)
+	if err != nil {
+		t.Fatalf("FindAll() error = %v", err)
+	}
+	if len(devices) != 2 || devices[0].Name != "fuze" || devices[1].Name != "ipod" {
+		t.Errorf("FindAll() = %+v, want fuze and ipod", devices)
+	}
+}
+
+func TestDeviceRepository_ClaimUnassigned(t *testing.T) {
+	db := setupTestDB(t)
+	defer func() { _ = db.Close() }()
+
+	ctx := context.Background()
+	devices := NewDeviceRepository(db.DB())
+	device := &models.Device{Name: models.DefaultDeviceName}
+	if err := devices.Create(ctx, device); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	// Songs and playlists saved before devices existed have no device
+	unassigned := NewSongRepository(db.DB())
+	removed := &models.Song{RockboxID: "2", Path: "/b.mp3"}
+	_ = unassigned.CreateBatch(ctx, []*models.Song{{RockboxID: "1", Path: "/a.mp3"}, removed})
+	_ = unassigned.Delete(ctx, removed.ID)
+	_ = NewPlaylistRepository(db.DB()).Create(ctx, &models.Playlist{Name: "Mix", Type: models.PlaylistTypeTopSongs})
+
+	if err := devices.ClaimUnassigned(ctx, device.ID); err != nil {
+		t.Fatalf("ClaimUnassigned() error = %v", err)
+	}
+
+	if count, _ := unassigned.Count(ctx); count != 0 {
+		t.Errorf("unassigned songs = %d, want 0", count)
+	}
+	if count, _ := NewDeviceSongRepository(db.DB(), device.ID).Count(ctx); count != 1 {
+		t.Errorf("device songs = %d, want 1", count)
+	}
+	var claimed int64
+	db.DB().Unscoped().Model(&models.Song{}).Where("device_id = ?", device.ID).Count(&claimed)
+	if claimed != 2 {
+		t.Errorf("claimed songs including removed = %d, want 2", claimed)
+	}
+	if playlists, _ := NewDevicePlaylistRepository(db.DB(), device.ID).FindAll(ctx); len(playlists) != 1 {
+		t.Errorf("device playlists = %d, want 1", len(playlists))
+	}
+}
@@ -16,6 +16,8 @@ type SongRepository interface {
 	CreateBatch(ctx context.Context, songs []*models.Song) error
 	// Update updates an existing song
 	Update(ctx context.Context, song *models.Song) error
+	// UpdateMatch saves the external IDs and match of an existing song
+	UpdateMatch(ctx context.Context, song *models.Song) error
 	// Delete deletes a song by ID
 	Delete(ctx context.Context, id uint) error
 	// FindByID finds a song by ID
@@ -32,16 +34,37 @@ type SongRepository interface {
 	FindByAlbumArtist(ctx context.Context, albumArtist string) ([]*models.Song, error)
 	// FindByGenre returns all songs matching a genre
 	FindByGenre(ctx context.Context, genre string) ([]*models.Song, error)
-	// FindUnmatched returns songs without external ID matches
+	// FindByComposer returns all songs by a composer
+	FindByComposer(ctx context.Context, composer string) ([]*models.Song, error)
+	// FindByExternalID finds a song by its ID at a data source
+	FindByExternalID(ctx context.Context, source models.DataSource, id string) (*models.Song, error)
+	// FindUnmatched returns songs without external ID matches, ordered by ID
 	FindUnmatched(ctx context.Context, source models.DataSource) ([]*models.Song, error)
 	// GetUniqueArtists returns a list of unique album artists
 	GetUniqueArtists(ctx context.Context) ([]string, error)
 	// GetUniqueGenres returns a list of unique genres
 	GetUniqueGenres(ctx context.Context) ([]string, error)
+	// GetArtistNames returns the distinct artist and album artist names
+	GetArtistNames(ctx context.Context) ([]string, error)
 	// Count returns the total number of songs
 	Count(ctx context.Context) (int64, error)
 	// DeleteAll deletes all songs
 	DeleteAll(ctx context.Context) error
+	// Sync upserts parsed songs reconciled by RockboxID and path, and removes songs no longer present
+	Sync(ctx context.Context, songs []*models.Song) (*models.SyncResult, error)
+	// BeginSync starts a Sync that takes the parsed songs one at a time
+	BeginSync(ctx context.Context) SongSync
+}
+
+// SongSync syncs parsed songs as they arrive. Songs are written in chunks,
+// each in its own transaction, so memory does not grow with the library.
+// Stored songs that were not added are removed by Finish; a sync that is
+// abandoned before Finish removes nothing.
+type SongSync interface {
+	// Add queues a parsed song, writing the queued chunk when it is full
+	Add(ctx context.Context, song *models.Song) error
+	// Finish writes the last chunk, removes songs that were not added and returns the result
+	Finish(ctx context.Context) (*models.SyncResult, error)
 }
 
 // PlaylistRepository defines the interface for playlist data access
@@ -64,8 +87,53 @@ type PlaylistRepository interface {
 	AddSongs(ctx context.Context, playlistID uint, songIDs []uint) error
 	// RemoveSongs removes songs from a playlist
 	RemoveSongs(ctx context.Context, playlistID uint, songIDs []uint) error
-	// GetSongs returns all songs in a playlist
+	// GetSongs returns all songs in a playlist that are still on the device
 	GetSongs(ctx context.Context, playlistID uint) ([]*models.Song, error)
+	// GetEntries returns all entries of a playlist, including missing ones
+	GetEntries(ctx context.Context, playlistID uint) ([]*models.PlaylistSong, error)
+}
+
+// DeviceRepository defines the interface for device data access
+type DeviceRepository interface {
+	// Create creates a new device
+	Create(ctx context.Context, device *models.Device) error
+	// Update updates an existing device
+	Update(ctx context.Context, device *models.Device) error
+	// FindByID finds a device by ID
+	FindByID(ctx context.Context, id uint) (*models.Device, error)
+	// FindByName finds a device by name
+	FindByName(ctx context.Context, name string) (*models.Device, error)
+	// FindAll returns all devices ordered by name
+	FindAll(ctx context.Context) ([]*models.Device, error)
+	// ClaimUnassigned moves the songs and playlists without a device to a device
+	ClaimUnassigned(ctx context.Context, deviceID uint) error
+}
+
+// PlayEventRepository defines the interface for play history data access
+type PlayEventRepository interface {
+	// CreateIfNew saves a play unless a play at the same time was saved
+	// before, and reports whether it was saved
+	CreateIfNew(ctx context.Context, event *models.PlayEvent) (bool, error)
+	// FindAll returns the play history, newest first
+	FindAll(ctx context.Context) ([]*models.PlayEvent, error)
+	// FindBySong returns the plays of a song, newest first
+	FindBySong(ctx context.Context, songID uint) ([]*models.PlayEvent, error)
+	// FindUnmatched returns the listened plays without a song, oldest first
+	FindUnmatched(ctx context.Context) ([]*models.PlayEvent, error)
+	// SetSong records the song a play was matched to
+	SetSong(ctx context.Context, eventID, songID uint) error
+	// Count returns the number of plays in the history
+	Count(ctx context.Context) (int64, error)
+}
+
+// ArtistAliasRepository defines the interface for artist alias data access
+type ArtistAliasRepository interface {
+	// Set makes alias a name of artist, moving it from any artist it named before
+	Set(ctx context.Context, artist, alias string) (*models.ArtistAlias, error)
+	// Delete removes an alias
+	Delete(ctx context.Context, alias string) error
+	// FindAll returns all aliases ordered by artist and alias
+	FindAll(ctx context.Context) ([]*models.ArtistAlias, error)
 }
 
 // ConfigRepository defines the interface for configuration data access
@@ -82,4 +150,10 @@ type ConfigRepository interface {
 	GetLastParsedAt(ctx context.Context) (*time.Time, error)
 	// SetLastParsedAt sets the last parsed timestamp
 	SetLastParsedAt(ctx context.Context, t time.Time) error
+	// GetTagCacheVersion returns the serial and commit ID of the last parsed TagCache
+	GetTagCacheVersion(ctx context.Context) (serial, commitID int32, ok bool, err error)
+	// SetTagCacheVersion records the serial and commit ID of the parsed TagCache
+	SetTagCacheVersion(ctx context.Context, serial, commitID int32) error
+	// ClearTagCacheVersion forgets the recorded TagCache serial and commit ID
+	ClearTagCacheVersion(ctx context.Context) error
 }
@@ -0,0 +1,73 @@
+// Package repository provides data access layer interfaces and implementations
+package repository
+
+import (
+	"context"
+
+	"github.com/Ardakilic/rocklist/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// playEventRepository implements PlayEventRepository for one device
+type playEventRepository struct {
+	db       *gorm.DB
+	deviceID uint
+}
+
+// NewPlayEventRepository creates a play history repository for a device
+func NewPlayEventRepository(db *gorm.DB, deviceID uint) PlayEventRepository {
+	return &playEventRepository{db: db, deviceID: deviceID}
+}
+
+// query starts a query limited to the repository's device
+func (r *playEventRepository) query(ctx context.Context) *gorm.DB {
+	return r.db.WithContext(ctx).Where("device_id = ?", r.deviceID)
+}
+
+// CreateIfNew saves a play unless a play at the same time was saved before,
+// and reports whether it was saved
+func (r *playEventRepository) CreateIfNew(ctx context.Context, event *models.PlayEvent) (bool, error) {
+	event.DeviceID = r.deviceID
+	result := r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "device_id"}, {Name: "played_at"}},
+		DoNothing: true,
+	}).Create(event)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// FindAll returns the play history, newest first
+func (r *playEventRepository) FindAll(ctx context.Context) ([]*models.PlayEvent, error) {
+	var events []*models.PlayEvent
+	err := r.query(ctx).Order("played_at DESC").Find(&events).Error
+	return events, err
+}
+
+// FindBySong returns the plays of a song, newest first
+func (r *playEventRepository) FindBySong(ctx context.Context, songID uint) ([]*models.PlayEvent, error) {
+	var events []*models.PlayEvent
+	err := r.query(ctx).Where("song_id = ?", songID).Order("played_at DESC").Find(&events).Error
+	return events, err
+}
+
+// FindUnmatched returns the listened plays without a song, oldest first
+func (r *playEventRepository) FindUnmatched(ctx context.Context) ([]*models.PlayEvent, error) {
+	var events []*models.PlayEvent
+	err := r.query(ctx).Where("song_id IS NULL AND skipped = ?", false).Order("played_at").Find(&events).Error
+	return events, err
+}
+
+// SetSong records the song a play was matched to
+func (r *playEventRepository) SetSong(ctx context.Context, eventID, songID uint) error {
+	return r.query(ctx).Model(&models.PlayEvent{}).Where("id = ?", eventID).Update("song_id", songID).Error
+}
+
+// Count returns the number of plays in the history
+func (r *playEventRepository) Count(ctx context.Context) (int64, error) {
+	var count int64
+	err := r.query(ctx).Model(&models.PlayEvent{}).Count(&count).Error
+	return count, err
+}
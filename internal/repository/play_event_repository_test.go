@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Ardakilic/rocklist/internal/models"
+)
+
+func TestPlayEventRepository(t *testing.T) {
+	db := setupTestDB(t)
+	defer func() { _ = db.Close() }()
+
+	ctx := context.Background()
+	ipod := NewPlayEventRepository(db.DB(), 1)
+	fuze := NewPlayEventRepository(db.DB(), 2)
+
+	songID := uint(7)
+	at := time.Unix(1700000000, 0).UTC()
+	plays := []*models.PlayEvent{
+		{PlayedAt: at, Artist: "Metallica", Title: "Battery", SongID: &songID},
+		{PlayedAt: at.Add(time.Hour), Artist: "Metallica", Title: "Orion"},
+	}
+	for _, play := range plays {
+		saved, err := ipod.CreateIfNew(ctx, play)
+		if err != nil || !saved {
+			t.Fatalf("CreateIfNew() = %v, %v, want saved", saved, err)
+		}
+	}
+
+	// The same time is a play that was imported before
+	saved, err := ipod.CreateIfNew(ctx, &models.PlayEvent{PlayedAt: at, Artist: "Metallica", Title: "Battery"})
+	if err != nil || saved {
+		t.Errorf("CreateIfNew() of a duplicate = %v, %v, want not saved", saved, err)
+	}
+	// Another device may have played at the same time
+	if saved, err := fuze.CreateIfNew(ctx, &models.PlayEvent{PlayedAt: at, Artist: "Burzum", Title: "Dunkelheit"}); err != nil || !saved {
+		t.Errorf("CreateIfNew() on another device = %v, %v, want saved", saved, err)
+	}
+
+	if count, _ := ipod.Count(ctx); count != 2 {
+		t.Errorf("Count() = %d, want 2", count)
+	}
+	all, err := ipod.FindAll(ctx)
+	if err != nil {
+		t.Fatalf("FindAll() error = %v", err)
+	}
+	if len(all) != 2 || all[0].Title != "Orion" || all[0].DeviceID != 1 {
+		t.Errorf("FindAll() = %+v, want Orion first", all)
+	}
+	if bySong, _ := ipod.FindBySong(ctx, songID); len(bySong) != 1 || bySong[0].Title != "Battery" {
+		t.Errorf("FindBySong() = %+v, want Battery", bySong)
+	}
+
+	// A skipped play is never counted, so it is not looked for again
+	if _, err := ipod.CreateIfNew(ctx, &models.PlayEvent{PlayedAt: at.Add(2 * time.Hour), Title: "One", Skipped: true}); err != nil {
+		t.Fatalf("CreateIfNew() error = %v", err)
+	}
+	unmatched, err := ipod.FindUnmatched(ctx)
+	if err != nil {
+		t.Fatalf("FindUnmatched() error = %v", err)
+	}
+	if len(unmatched) != 1 || unmatched[0].Title != "Orion" {
+		t.Fatalf("FindUnmatched() = %+v, want Orion", unmatched)
+	}
+	if err := ipod.SetSong(ctx, unmatched[0].ID, 8); err != nil {
+		t.Fatalf("SetSong() error = %v", err)
+	}
+	if unmatched, _ := ipod.FindUnmatched(ctx); len(unmatched) != 0 {
+		t.Errorf("FindUnmatched() after SetSong() = %+v, want none", unmatched)
+	}
+	if bySong, _ := ipod.FindBySong(ctx, 8); len(bySong) != 1 || bySong[0].Title != "Orion" {
+		t.Errorf("FindBySong() after SetSong() = %+v, want Orion", bySong)
+	}
+}
@@ -8,18 +8,32 @@ import (
 	"gorm.io/gorm"
 )
 
-// playlistRepository implements PlaylistRepository
+// playlistRepository implements PlaylistRepository for the playlists of one device
 type playlistRepository struct {
-	db *gorm.DB
+	db       *gorm.DB
+	deviceID uint
 }
 
-// NewPlaylistRepository creates a new playlist repository
+// NewPlaylistRepository creates a new playlist repository for playlists
+// without a device
 func NewPlaylistRepository(db *gorm.DB) PlaylistRepository {
 	return &playlistRepository{db: db}
 }
 
+// NewDevicePlaylistRepository creates a playlist repository that only sees
+// and creates playlists of the device with the given ID
+func NewDevicePlaylistRepository(db *gorm.DB, deviceID uint) PlaylistRepository {
+	return &playlistRepository{db: db, deviceID: deviceID}
+}
+
+// query starts a playlist query limited to the repository's device
+func (r *playlistRepository) query(ctx context.Context) *gorm.DB {
+	return r.db.WithContext(ctx).Where("device_id = ?", r.deviceID)
+}
+
 // Create creates a new playlist
 func (r *playlistRepository) Create(ctx context.Context, playlist *models.Playlist) error {
+	playlist.DeviceID = r.deviceID
 	return r.db.WithContext(ctx).Create(playlist).Error
 }
 
@@ -30,6 +44,9 @@ func (r *playlistRepository) Update(ctx context.Context, playlist *models.Playli
 
 // Delete deletes a playlist by ID
 func (r *playlistRepository) Delete(ctx context.Context, id uint) error {
+	if _, err := r.FindByID(ctx, id); err != nil {
+		return err
+	}
 	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		// Delete playlist songs first
 		if err := tx.Where("playlist_id = ?", id).Delete(&models.PlaylistSong{}).Error; err != nil {
@@ -50,7 +67,7 @@ func (r *playlistRepository) Delete(ctx context.Context, id uint) error {
 // FindByID finds a playlist by ID
 func (r *playlistRepository) FindByID(ctx context.Context, id uint) (*models.Playlist, error) {
 	var playlist models.Playlist
-	err := r.db.WithContext(ctx).First(&playlist, id).Error
+	err := r.query(ctx).First(&playlist, id).Error
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return nil, models.ErrPlaylistNotFound
@@ -63,21 +80,21 @@ func (r *playlistRepository) FindByID(ctx context.Context, id uint) (*models.Pla
 // FindAll returns all playlists
 func (r *playlistRepository) FindAll(ctx context.Context) ([]*models.Playlist, error) {
 	var playlists []*models.Playlist
-	err := r.db.WithContext(ctx).Order("created_at DESC").Find(&playlists).Error
+	err := r.query(ctx).Order("created_at DESC").Find(&playlists).Error
 	return playlists, err
 }
 
 // FindByType returns playlists by type
 func (r *playlistRepository) FindByType(ctx context.Context, playlistType models.PlaylistType) ([]*models.Playlist, error) {
 	var playlists []*models.Playlist
-	err := r.db.WithContext(ctx).Where("type = ?", playlistType).Order("created_at DESC").Find(&playlists).Error
+	err := r.query(ctx).Where("type = ?", playlistType).Order("created_at DESC").Find(&playlists).Error
 	return playlists, err
 }
 
 // FindByDataSource returns playlists by data source
 func (r *playlistRepository) FindByDataSource(ctx context.Context, source models.DataSource) ([]*models.Playlist, error) {
 	var playlists []*models.Playlist
-	err := r.db.WithContext(ctx).Where("data_source = ?", source).Order("created_at DESC").Find(&playlists).Error
+	err := r.query(ctx).Where("data_source = ?", source).Order("created_at DESC").Find(&playlists).Error
 	return playlists, err
 }
 
@@ -138,9 +155,21 @@ func (r *playlistRepository) RemoveSongs(ctx context.Context, playlistID uint, s
 func (r *playlistRepository) GetSongs(ctx context.Context, playlistID uint) ([]*models.Song, error) {
 	var songs []*models.Song
 	err := r.db.WithContext(ctx).
-		Joins("JOIN playlist_songs ON playlist_songs.song_id = songs.id").
+		Joins("JOIN playlist_songs ON playlist_songs.song_id = songs.id AND playlist_songs.deleted_at IS NULL").
 		Where("playlist_songs.playlist_id = ?", playlistID).
 		Order("playlist_songs.position ASC").
 		Find(&songs).Error
 	return songs, err
 }
+
+// GetEntries returns all entries of a playlist with their songs, including
+// entries flagged as missing whose song is no longer on the device
+func (r *playlistRepository) GetEntries(ctx context.Context, playlistID uint) ([]*models.PlaylistSong, error) {
+	var entries []*models.PlaylistSong
+	err := r.db.WithContext(ctx).
+		Preload("Song", func(db *gorm.DB) *gorm.DB { return db.Unscoped() }).
+		Where("playlist_id = ?", playlistID).
+		Order("position ASC").
+		Find(&entries).Error
+	return entries, err
+}
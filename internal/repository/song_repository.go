@@ -9,18 +9,31 @@ import (
 	"gorm.io/gorm"
 )
 
-// songRepository implements SongRepository
+// songRepository implements SongRepository for the songs of one device
 type songRepository struct {
-	db *gorm.DB
+	db       *gorm.DB
+	deviceID uint
 }
 
-// NewSongRepository creates a new song repository
+// NewSongRepository creates a new song repository for songs without a device
 func NewSongRepository(db *gorm.DB) SongRepository {
 	return &songRepository{db: db}
 }
 
+// NewDeviceSongRepository creates a song repository that only sees and
+// creates songs of the device with the given ID
+func NewDeviceSongRepository(db *gorm.DB, deviceID uint) SongRepository {
+	return &songRepository{db: db, deviceID: deviceID}
+}
+
+// query starts a query limited to the repository's device
+func (r *songRepository) query(ctx context.Context) *gorm.DB {
+	return r.db.WithContext(ctx).Where("device_id = ?", r.deviceID)
+}
+
 // Create creates a new song
 func (r *songRepository) Create(ctx context.Context, song *models.Song) error {
+	song.DeviceID = r.deviceID
 	return r.db.WithContext(ctx).Create(song).Error
 }
 
@@ -29,6 +42,9 @@ func (r *songRepository) CreateBatch(ctx context.Context, songs []*models.Song)
 	if len(songs) == 0 {
 		return nil
 	}
+	for _, song := range songs {
+		song.DeviceID = r.deviceID
+	}
 	return r.db.WithContext(ctx).CreateInBatches(songs, 100).Error
 }
 
@@ -37,9 +53,17 @@ func (r *songRepository) Update(ctx context.Context, song *models.Song) error {
 	return r.db.WithContext(ctx).Save(song).Error
 }
 
+// UpdateMatch saves the external IDs and match of an existing song. Only the
+// match columns are written, so a parse that ran since the song was read
+// keeps the device data it saved.
+func (r *songRepository) UpdateMatch(ctx context.Context, song *models.Song) error {
+	columns := append([]string{"updated_at"}, models.MatchColumns...)
+	return r.db.WithContext(ctx).Model(song).Select(columns).Updates(song).Error
+}
+
 // Delete deletes a song by ID
 func (r *songRepository) Delete(ctx context.Context, id uint) error {
-	result := r.db.WithContext(ctx).Delete(&models.Song{}, id)
+	result := r.query(ctx).Delete(&models.Song{}, id)
 	if result.Error != nil {
 		return result.Error
 	}
@@ -52,7 +76,7 @@ func (r *songRepository) Delete(ctx context.Context, id uint) error {
 // FindByID finds a song by ID
 func (r *songRepository) FindByID(ctx context.Context, id uint) (*models.Song, error) {
 	var song models.Song
-	err := r.db.WithContext(ctx).First(&song, id).Error
+	err := r.query(ctx).First(&song, id).Error
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return nil, models.ErrSongNotFound
@@ -65,7 +89,7 @@ func (r *songRepository) FindByID(ctx context.Context, id uint) (*models.Song, e
 // FindByRockboxID finds a song by Rockbox ID
 func (r *songRepository) FindByRockboxID(ctx context.Context, rockboxID string) (*models.Song, error) {
 	var song models.Song
-	err := r.db.WithContext(ctx).Where("rockbox_id = ?", rockboxID).First(&song).Error
+	err := r.query(ctx).Where("rockbox_id = ?", rockboxID).First(&song).Error
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return nil, models.ErrSongNotFound
@@ -78,7 +102,7 @@ func (r *songRepository) FindByRockboxID(ctx context.Context, rockboxID string)
 // FindByPath finds a song by file path
 func (r *songRepository) FindByPath(ctx context.Context, path string) (*models.Song, error) {
 	var song models.Song
-	err := r.db.WithContext(ctx).Where("path = ?", path).First(&song).Error
+	err := r.query(ctx).Where("path = ?", path).First(&song).Error
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return nil, models.ErrSongNotFound
@@ -91,21 +115,21 @@ func (r *songRepository) FindByPath(ctx context.Context, path string) (*models.S
 // FindAll returns all songs
 func (r *songRepository) FindAll(ctx context.Context) ([]*models.Song, error) {
 	var songs []*models.Song
-	err := r.db.WithContext(ctx).Find(&songs).Error
+	err := r.query(ctx).Find(&songs).Error
 	return songs, err
 }
 
 // FindByArtist returns all songs by an artist
 func (r *songRepository) FindByArtist(ctx context.Context, artist string) ([]*models.Song, error) {
 	var songs []*models.Song
-	err := r.db.WithContext(ctx).Where("artist = ? OR album_artist = ?", artist, artist).Find(&songs).Error
+	err := r.query(ctx).Where("artist = ? OR album_artist = ?", artist, artist).Find(&songs).Error
 	return songs, err
 }
 
 // FindByAlbumArtist returns all songs by an album artist
 func (r *songRepository) FindByAlbumArtist(ctx context.Context, albumArtist string) ([]*models.Song, error) {
 	var songs []*models.Song
-	err := r.db.WithContext(ctx).Where("album_artist = ?", albumArtist).Find(&songs).Error
+	err := r.query(ctx).Where("album_artist = ?", albumArtist).Find(&songs).Error
 	return songs, err
 }
 
@@ -113,34 +137,64 @@ func (r *songRepository) FindByAlbumArtist(ctx context.Context, albumArtist stri
 func (r *songRepository) FindByGenre(ctx context.Context, genre string) ([]*models.Song, error) {
 	var songs []*models.Song
 	// Use LIKE for partial matching (e.g., "Death Metal" matches "Death Metal", "Melodic Death Metal")
-	err := r.db.WithContext(ctx).Where("genre LIKE ?", fmt.Sprintf("%%%s%%", genre)).Find(&songs).Error
+	err := r.query(ctx).Where("genre LIKE ?", fmt.Sprintf("%%%s%%", genre)).Find(&songs).Error
 	return songs, err
 }
 
-// FindUnmatched returns songs without external ID matches
-func (r *songRepository) FindUnmatched(ctx context.Context, source models.DataSource) ([]*models.Song, error) {
+// FindByComposer returns all songs by a composer
+func (r *songRepository) FindByComposer(ctx context.Context, composer string) ([]*models.Song, error) {
 	var songs []*models.Song
-	var query *gorm.DB
+	err := r.query(ctx).Where("composer = ?", composer).Find(&songs).Error
+	return songs, err
+}
+
+// FindByExternalID finds a song by its ID at a data source
+func (r *songRepository) FindByExternalID(ctx context.Context, source models.DataSource, id string) (*models.Song, error) {
+	column, err := externalIDColumn(source)
+	if err != nil {
+		return nil, err
+	}
 
+	var song models.Song
+	err = r.query(ctx).Where(column+" = ?", id).Order("id ASC").First(&song).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, models.ErrSongNotFound
+		}
+		return nil, err
+	}
+	return &song, nil
+}
+
+// externalIDColumn returns the songs column holding the IDs of a data source
+func externalIDColumn(source models.DataSource) (string, error) {
 	switch source {
 	case models.DataSourceLastFM:
-		query = r.db.WithContext(ctx).Where("lastfm_id = '' OR lastfm_id IS NULL")
+		return "last_fm_id", nil
 	case models.DataSourceSpotify:
-		query = r.db.WithContext(ctx).Where("spotify_id = '' OR spotify_id IS NULL")
+		return "spotify_id", nil
 	case models.DataSourceMusicBrainz:
-		query = r.db.WithContext(ctx).Where("musicbrainz_id = '' OR musicbrainz_id IS NULL")
-	default:
-		return nil, models.ErrInvalidDataSource
+		return "music_brainz_id", nil
 	}
+	return "", models.ErrInvalidDataSource
+}
 
-	err := query.Find(&songs).Error
+// FindUnmatched returns songs without external ID matches, ordered by ID
+func (r *songRepository) FindUnmatched(ctx context.Context, source models.DataSource) ([]*models.Song, error) {
+	column, err := externalIDColumn(source)
+	if err != nil {
+		return nil, err
+	}
+
+	var songs []*models.Song
+	err = r.query(ctx).Where(column + " = '' OR " + column + " IS NULL").Order("id ASC").Find(&songs).Error
 	return songs, err
 }
 
 // GetUniqueArtists returns a list of unique album artists
 func (r *songRepository) GetUniqueArtists(ctx context.Context) ([]string, error) {
 	var artists []string
-	err := r.db.WithContext(ctx).
+	err := r.query(ctx).
 		Model(&models.Song{}).
 		Distinct("album_artist").
 		Where("album_artist != '' AND album_artist IS NOT NULL").
@@ -151,7 +205,7 @@ func (r *songRepository) GetUniqueArtists(ctx context.Context) ([]string, error)
 // GetUniqueGenres returns a list of unique genres
 func (r *songRepository) GetUniqueGenres(ctx context.Context) ([]string, error) {
 	var genres []string
-	err := r.db.WithContext(ctx).
+	err := r.query(ctx).
 		Model(&models.Song{}).
 		Distinct("genre").
 		Where("genre != '' AND genre IS NOT NULL").
@@ -159,14 +213,261 @@ func (r *songRepository) GetUniqueGenres(ctx context.Context) ([]string, error)
 	return genres, err
 }
 
+// GetArtistNames returns the distinct artist and album artist names
+func (r *songRepository) GetArtistNames(ctx context.Context) ([]string, error) {
+	var artists, albumArtists []string
+	if err := r.query(ctx).
+		Model(&models.Song{}).
+		Distinct("artist").
+		Where("artist != '' AND artist IS NOT NULL").
+		Pluck("artist", &artists).Error; err != nil {
+		return nil, err
+	}
+	if err := r.query(ctx).
+		Model(&models.Song{}).
+		Distinct("album_artist").
+		Where("album_artist != '' AND album_artist IS NOT NULL").
+		Pluck("album_artist", &albumArtists).Error; err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool, len(artists))
+	for _, artist := range artists {
+		seen[artist] = true
+	}
+	for _, albumArtist := range albumArtists {
+		if !seen[albumArtist] {
+			seen[albumArtist] = true
+			artists = append(artists, albumArtist)
+		}
+	}
+	return artists, nil
+}
+
 // Count returns the total number of songs
 func (r *songRepository) Count(ctx context.Context) (int64, error) {
 	var count int64
-	err := r.db.WithContext(ctx).Model(&models.Song{}).Count(&count).Error
+	err := r.query(ctx).Model(&models.Song{}).Count(&count).Error
 	return count, err
 }
 
-// DeleteAll deletes all songs
+// DeleteAll deletes all songs of the device
 func (r *songRepository) DeleteAll(ctx context.Context) error {
-	return r.db.WithContext(ctx).Exec("DELETE FROM songs").Error
+	return r.db.WithContext(ctx).Unscoped().Where("device_id = ?", r.deviceID).Delete(&models.Song{}).Error
+}
+
+// syncChunkSize is the number of parsed songs a SongSync writes per transaction
+const syncChunkSize = 500
+
+// Sync upserts parsed songs and removes songs no longer present on the device.
+// It feeds songs through BeginSync, so they are written in chunks.
+func (r *songRepository) Sync(ctx context.Context, songs []*models.Song) (*models.SyncResult, error) {
+	syncer := r.BeginSync(ctx)
+	for _, song := range songs {
+		if err := syncer.Add(ctx, song); err != nil {
+			return nil, err
+		}
+	}
+	return syncer.Finish(ctx)
+}
+
+// BeginSync starts a sync of parsed songs that are added one at a time.
+// Parsed songs are reconciled with stored ones by RockboxID, then by path, so
+// existing IDs survive. Only device columns are updated, keeping enrichment,
+// and the plays imported into a song are added to its device statistics again.
+// Removed songs are soft-deleted and their playlist entries flagged as missing;
+// when a removed song comes back it is restored with its old ID.
+func (r *songRepository) BeginSync(ctx context.Context) SongSync {
+	return r.beginSync(syncChunkSize)
+}
+
+// beginSync starts a sync writing chunkSize songs per transaction
+func (r *songRepository) beginSync(chunkSize int) *songSync {
+	return &songSync{
+		db:        r.db,
+		deviceID:  r.deviceID,
+		chunkSize: chunkSize,
+		matched:   make(map[uint]bool),
+		seen:      make(map[string]bool),
+	}
+}
+
+// songSync implements SongSync. Only the current chunk and the IDs of the
+// synced songs are kept in memory.
+type songSync struct {
+	db        *gorm.DB
+	deviceID  uint
+	chunkSize int
+	pending   []*models.Song
+	// matched holds the IDs of stored songs claimed by a parsed song
+	matched map[uint]bool
+	// seen holds the RockboxIDs synced so far; later duplicates are ignored
+	seen   map[string]bool
+	result models.SyncResult
+}
+
+// Add queues a parsed song and writes the chunk once it is full
+func (s *songSync) Add(ctx context.Context, song *models.Song) error {
+	if s.seen[song.RockboxID] {
+		return nil
+	}
+	s.seen[song.RockboxID] = true
+
+	s.pending = append(s.pending, song)
+	if len(s.pending) < s.chunkSize {
+		return nil
+	}
+	return s.flush(ctx)
+}
+
+// flush writes the pending songs in one transaction
+func (s *songSync) flush(ctx context.Context) error {
+	if len(s.pending) == 0 {
+		return nil
+	}
+	songs := s.pending
+	s.pending = nil
+
+	rockboxIDs := make([]string, len(songs))
+	paths := make([]string, len(songs))
+	for i, song := range songs {
+		song.DeviceID = s.deviceID
+		rockboxIDs[i] = song.RockboxID
+		paths[i] = song.Path
+	}
+
+	var result models.SyncResult
+	matched := make([]uint, 0, len(songs))
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var existing []*models.Song
+		if err := tx.Unscoped().Where("device_id = ?", s.deviceID).
+			Where("rockbox_id IN ? OR path IN ?", rockboxIDs, paths).
+			Find(&existing).Error; err != nil {
+			return err
+		}
+		byRockboxID := make(map[string]*models.Song, len(existing))
+		byPath := make(map[string]*models.Song, len(existing))
+		for _, song := range existing {
+			byRockboxID[song.RockboxID] = song
+			byPath[song.Path] = song
+		}
+
+		columns := append([]string{"updated_at", "rockbox_id"}, models.DeviceColumns...)
+		claimed := make(map[uint]bool, len(songs))
+		var added []*models.Song
+		var restored []uint
+		for _, song := range songs {
+			current, ok := byRockboxID[song.RockboxID]
+			if !ok {
+				current, ok = byPath[song.Path]
+			}
+			if !ok || s.matched[current.ID] || claimed[current.ID] {
+				added = append(added, song)
+				continue
+			}
+			claimed[current.ID] = true
+			matched = append(matched, current.ID)
+			song.ID = current.ID
+			song.KeepImportedPlays(current)
+
+			// A MusicBrainz ID read from the file's tags fills in an
+			// unmatched song but never replaces one found by matching
+			update := columns
+			tagged := song.MusicBrainzID != "" && current.MusicBrainzID == ""
+			if tagged {
+				update = append(update[:len(update):len(update)], "music_brainz_id")
+			}
+
+			if current.DeletedAt.Valid {
+				restored = append(restored, current.ID)
+			} else if current.RockboxID == song.RockboxID && current.SameDeviceData(song) && !tagged {
+				result.Unchanged++
+				continue
+			} else {
+				result.Changed++
+			}
+
+			if err := tx.Unscoped().Model(current).Select(update).Updates(song).Error; err != nil {
+				return fmt.Errorf("failed to update song %s: %w", song.Path, err)
+			}
+		}
+
+		if len(added) > 0 {
+			if err := tx.CreateInBatches(added, 100).Error; err != nil {
+				return fmt.Errorf("failed to add songs: %w", err)
+			}
+			for _, song := range added {
+				matched = append(matched, song.ID)
+			}
+		}
+
+		if len(restored) > 0 {
+			if err := tx.Unscoped().Model(&models.Song{}).Where("id IN ?", restored).
+				Update("deleted_at", nil).Error; err != nil {
+				return fmt.Errorf("failed to restore songs: %w", err)
+			}
+			if err := tx.Model(&models.PlaylistSong{}).Where("song_id IN ?", restored).
+				Update("missing", false).Error; err != nil {
+				return fmt.Errorf("failed to restore playlist entries: %w", err)
+			}
+		}
+		result.Added = len(added) + len(restored)
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, id := range matched {
+		s.matched[id] = true
+	}
+	s.result.Added += result.Added
+	s.result.Changed += result.Changed
+	s.result.Unchanged += result.Unchanged
+	return nil
+}
+
+// Finish writes the last chunk, then removes the stored songs that no parsed
+// song claimed
+func (s *songSync) Finish(ctx context.Context) (*models.SyncResult, error) {
+	if err := s.flush(ctx); err != nil {
+		return nil, err
+	}
+
+	var ids []uint
+	if err := s.db.WithContext(ctx).Model(&models.Song{}).Where("device_id = ?", s.deviceID).
+		Pluck("id", &ids).Error; err != nil {
+		return nil, err
+	}
+	var removed []uint
+	for _, id := range ids {
+		if !s.matched[id] {
+			removed = append(removed, id)
+		}
+	}
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for len(removed) > 0 {
+			chunk := removed[:min(len(removed), s.chunkSize)]
+			removed = removed[len(chunk):]
+
+			flagged := tx.Model(&models.PlaylistSong{}).Where("song_id IN ?", chunk).Update("missing", true)
+			if flagged.Error != nil {
+				return fmt.Errorf("failed to flag playlist entries: %w", flagged.Error)
+			}
+			if err := tx.Delete(&models.Song{}, chunk).Error; err != nil {
+				return fmt.Errorf("failed to remove songs: %w", err)
+			}
+			s.result.Removed += len(chunk)
+			s.result.MissingPlaylistEntries += int(flagged.RowsAffected)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := s.result
+	return &result, nil
 }
@@ -2,14 +2,18 @@ package repository
 
 import (
 	"context"
+	"fmt"
+	"runtime"
+	"slices"
 	"testing"
+	"time"
 
 	"github.com/Ardakilic/rocklist/internal/database"
 	"github.com/Ardakilic/rocklist/internal/models"
 	"gorm.io/gorm/logger"
 )
 
-func setupTestDB(t *testing.T) *database.Database {
+func setupTestDB(t testing.TB) *database.Database {
 	cfg := &database.Config{
 		InMemory: true,
 		LogLevel: logger.Silent,
@@ -258,6 +262,35 @@ func TestSongRepository_Update(t *testing.T) {
 	}
 }
 
+func TestSongRepository_UpdateMatch(t *testing.T) {
+	db := setupTestDB(t)
+	defer func() { _ = db.Close() }()
+
+	repo := NewSongRepository(db.DB())
+	ctx := context.Background()
+
+	song := &models.Song{RockboxID: "match-1", Path: "/match.mp3", Title: "Battery", PlayCount: 3}
+	_ = repo.Create(ctx, song)
+	stale := *song
+
+	// A parse saves new device data while the song is being matched
+	song.PlayCount = 4
+	_ = repo.Update(ctx, song)
+
+	stale.SetExternalMatch(models.DataSourceMusicBrainz, "mbid-1", 0.9, time.Now())
+	if err := repo.UpdateMatch(ctx, &stale); err != nil {
+		t.Fatalf("UpdateMatch() error = %v", err)
+	}
+
+	found, _ := repo.FindByID(ctx, song.ID)
+	if found.MusicBrainzID != "mbid-1" || found.MatchedSource != string(models.DataSourceMusicBrainz) || found.MatchConfidence != 0.9 {
+		t.Errorf("UpdateMatch() match = %q from %q at %v, want mbid-1", found.MusicBrainzID, found.MatchedSource, found.MatchConfidence)
+	}
+	if found.PlayCount != 4 {
+		t.Errorf("UpdateMatch() PlayCount = %d, want the 4 saved by the parse", found.PlayCount)
+	}
+}
+
 func TestSongRepository_FindByPath(t *testing.T) {
 	db := setupTestDB(t)
 	defer func() { _ = db.Close() }()
@@ -331,6 +364,31 @@ func TestSongRepository_FindByGenre(t *testing.T) {
 	}
 }
 
+func TestSongRepository_FindByComposer(t *testing.T) {
+	db := setupTestDB(t)
+	defer func() { _ = db.Close() }()
+
+	repo := NewSongRepository(db.DB())
+	ctx := context.Background()
+
+	songs := []*models.Song{
+		{RockboxID: "c1", Path: "/music/c1.flac", Title: "Symphony No. 5", Artist: "Berliner Philharmoniker", Composer: "Ludwig van Beethoven"},
+		{RockboxID: "c2", Path: "/music/c2.flac", Title: "Requiem", Artist: "Wiener Philharmoniker", Composer: "Wolfgang Amadeus Mozart"},
+	}
+	_ = repo.CreateBatch(ctx, songs)
+
+	found, err := repo.FindByComposer(ctx, "Ludwig van Beethoven")
+	if err != nil {
+		t.Fatalf("FindByComposer() error = %v", err)
+	}
+	if len(found) != 1 {
+		t.Fatalf("FindByComposer() returned %d songs, want 1", len(found))
+	}
+	if found[0].Title != "Symphony No. 5" {
+		t.Errorf("FindByComposer() title = %v, want Symphony No. 5", found[0].Title)
+	}
+}
+
 func TestSongRepository_FindUnmatched_Spotify(t *testing.T) {
 	db := setupTestDB(t)
 	defer func() { _ = db.Close() }()
@@ -350,6 +408,67 @@ func TestSongRepository_FindUnmatched_Spotify(t *testing.T) {
 	}
 }
 
+func TestSongRepository_FindUnmatched_Sources(t *testing.T) {
+	db := setupTestDB(t)
+	defer func() { _ = db.Close() }()
+	
+	repo := NewSongRepository(db.DB())
+	other := NewDeviceSongRepository(db.DB(), 2)
+	ctx := context.Background()
+	
+	_ = repo.Create(ctx, &models.Song{RockboxID: "m1", Path: "/1.mp3", Title: "Matched", MusicBrainzID: "mb-1", LastFMID: "lf-1"})
+	_ = repo.Create(ctx, &models.Song{RockboxID: "m2", Path: "/2.mp3", Title: "Unmatched"})
+	_ = repo.Create(ctx, &models.Song{RockboxID: "m3", Path: "/3.mp3", Title: "Spotify only", SpotifyID: "sp-3"})
+	_ = other.Create(ctx, &models.Song{RockboxID: "m1", Path: "/1.mp3", Title: "Other device"})
+	
+	for _, source := range []models.DataSource{models.DataSourceMusicBrainz, models.DataSourceLastFM} {
+		songs, err := repo.FindUnmatched(ctx, source)
+		if err != nil {
+			t.Fatalf("FindUnmatched(%s) error = %v", source, err)
+		}
+		if len(songs) != 2 || songs[0].Title != "Unmatched" || songs[1].Title != "Spotify only" {
+			t.Errorf("FindUnmatched(%s) = %d songs, want Unmatched and Spotify only in ID order", source, len(songs))
+		}
+	}
+}
+
+func TestSongRepository_FindByExternalID(t *testing.T) {
+	db := setupTestDB(t)
+	defer func() { _ = db.Close() }()
+	
+	repo := NewSongRepository(db.DB())
+	other := NewDeviceSongRepository(db.DB(), 2)
+	ctx := context.Background()
+	
+	_ = repo.Create(ctx, &models.Song{RockboxID: "x1", Path: "/1.mp3", Title: "Battery", MusicBrainzID: "mb-1", SpotifyID: "sp-1", LastFMID: "lf-1"})
+	_ = other.Create(ctx, &models.Song{RockboxID: "x1", Path: "/1.mp3", Title: "Battery", MusicBrainzID: "mb-2"})
+	
+	for source, id := range map[models.DataSource]string{
+		models.DataSourceMusicBrainz: "mb-1",
+		models.DataSourceSpotify:     "sp-1",
+		models.DataSourceLastFM:      "lf-1",
+	} {
+		song, err := repo.FindByExternalID(ctx, source, id)
+		if err != nil {
+			t.Fatalf("FindByExternalID(%s, %s) error = %v", source, id, err)
+		}
+		if song.Title != "Battery" {
+			t.Errorf("FindByExternalID(%s, %s) = %q, want Battery", source, id, song.Title)
+		}
+	}
+	
+	// Songs of other devices are not found
+	if _, err := repo.FindByExternalID(ctx, models.DataSourceMusicBrainz, "mb-2"); err != models.ErrSongNotFound {
+		t.Errorf("FindByExternalID() of another device's song error = %v, want ErrSongNotFound", err)
+	}
+	if _, err := repo.FindByExternalID(ctx, models.DataSourceSpotify, "mb-1"); err != models.ErrSongNotFound {
+		t.Errorf("FindByExternalID() with another source's ID error = %v, want ErrSongNotFound", err)
+	}
+	if _, err := repo.FindByExternalID(ctx, "invalid", "mb-1"); err != models.ErrInvalidDataSource {
+		t.Errorf("FindByExternalID() error = %v, want ErrInvalidDataSource", err)
+	}
+}
+
 func TestSongRepository_FindUnmatched_InvalidSource(t *testing.T) {
 	db := setupTestDB(t)
 	defer func() { _ = db.Close() }()
@@ -383,6 +502,27 @@ func TestSongRepository_GetUniqueGenres(t *testing.T) {
 	}
 }
 
+func TestSongRepository_GetArtistNames(t *testing.T) {
+	db := setupTestDB(t)
+	defer func() { _ = db.Close() }()
+	
+	repo := NewSongRepository(db.DB())
+	ctx := context.Background()
+	
+	_ = repo.Create(ctx, &models.Song{RockboxID: "an1", Path: "/1.mp3", Artist: "Jay-Z feat. Alicia Keys", AlbumArtist: "Jay-Z", Title: "Empire State of Mind"})
+	_ = repo.Create(ctx, &models.Song{RockboxID: "an2", Path: "/2.mp3", Artist: "Jay-Z", AlbumArtist: "Jay-Z", Title: "99 Problems"})
+	_ = repo.Create(ctx, &models.Song{RockboxID: "an3", Path: "/3.mp3", Title: "Untagged"})
+	
+	names, err := repo.GetArtistNames(ctx)
+	if err != nil {
+		t.Fatalf("GetArtistNames() error = %v", err)
+	}
+	slices.Sort(names)
+	if want := []string{"Jay-Z", "Jay-Z feat. Alicia Keys"}; !slices.Equal(names, want) {
+		t.Errorf("GetArtistNames() = %q, want %q", names, want)
+	}
+}
+
 func TestSongRepository_FindAll(t *testing.T) {
 	db := setupTestDB(t)
 	defer func() { _ = db.Close() }()
@@ -435,3 +575,315 @@ func TestSongRepository_Delete_NotFound(t *testing.T) {
 		t.Errorf("Delete() error = %v, want ErrSongNotFound", err)
 	}
 }
+
+func TestSongRepository_Sync(t *testing.T) {
+	db := setupTestDB(t)
+	defer func() { _ = db.Close() }()
+
+	repo := NewSongRepository(db.DB())
+	playlistRepo := NewPlaylistRepository(db.DB())
+	ctx := context.Background()
+
+	kept := &models.Song{RockboxID: "kept", Path: "/kept.mp3", Title: "Kept", PlayCount: 1}
+	changed := &models.Song{RockboxID: "changed", Path: "/changed.mp3", Title: "Changed", PlayCount: 1}
+	removed := &models.Song{RockboxID: "removed", Path: "/removed.mp3", Title: "Removed"}
+	_ = repo.CreateBatch(ctx, []*models.Song{kept, changed, removed})
+
+	// Enrichment that a re-parse must not throw away
+	changed.SpotifyID = "spotify-123"
+	changed.MatchConfidence = 0.9
+	_ = repo.Update(ctx, changed)
+
+	playlist := &models.Playlist{Name: "Test", Type: models.PlaylistTypeTopSongs, DataSource: models.DataSourceLastFM}
+	_ = playlistRepo.Create(ctx, playlist)
+	_ = playlistRepo.AddSongs(ctx, playlist.ID, []uint{changed.ID, removed.ID})
+
+	result, err := repo.Sync(ctx, []*models.Song{
+		{RockboxID: "kept", Path: "/kept.mp3", Title: "Kept", PlayCount: 1},
+		{RockboxID: "changed", Path: "/changed.mp3", Title: "Changed", PlayCount: 5},
+		{RockboxID: "added", Path: "/added.mp3", Title: "Added"},
+		{RockboxID: "added", Path: "/added.mp3", Title: "Added"},
+	})
+	if err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	want := models.SyncResult{Added: 1, Removed: 1, Changed: 1, Unchanged: 1, MissingPlaylistEntries: 1}
+	if *result != want {
+		t.Errorf("Sync() = %+v, want %+v", *result, want)
+	}
+
+	got, err := repo.FindByRockboxID(ctx, "changed")
+	if err != nil {
+		t.Fatalf("FindByRockboxID() error = %v", err)
+	}
+	if got.ID != changed.ID {
+		t.Errorf("changed song ID = %d, want %d to be kept", got.ID, changed.ID)
+	}
+	if got.PlayCount != 5 {
+		t.Errorf("changed song PlayCount = %d, want 5", got.PlayCount)
+	}
+	if got.SpotifyID != "spotify-123" || got.MatchConfidence != 0.9 {
+		t.Errorf("changed song enrichment = %q/%v, want it kept", got.SpotifyID, got.MatchConfidence)
+	}
+
+	if _, err := repo.FindByRockboxID(ctx, "removed"); err != models.ErrSongNotFound {
+		t.Errorf("removed song FindByRockboxID() error = %v, want ErrSongNotFound", err)
+	}
+	if count, _ := repo.Count(ctx); count != 3 {
+		t.Errorf("Count() = %d, want 3", count)
+	}
+
+	songs, err := playlistRepo.GetSongs(ctx, playlist.ID)
+	if err != nil {
+		t.Fatalf("GetSongs() error = %v", err)
+	}
+	if len(songs) != 1 || songs[0].RockboxID != "changed" {
+		t.Errorf("playlist songs = %d, want only the changed song", len(songs))
+	}
+
+	// The entry of the removed song is kept and flagged
+	entries, err := playlistRepo.GetEntries(ctx, playlist.ID)
+	if err != nil {
+		t.Fatalf("GetEntries() error = %v", err)
+	}
+	if len(entries) != 2 || entries[0].Missing || !entries[1].Missing {
+		t.Fatalf("GetEntries() = %d entries, want 2 with only the second missing", len(entries))
+	}
+	if entries[1].Song.Path != "/removed.mp3" {
+		t.Errorf("missing entry song path = %q, want /removed.mp3", entries[1].Song.Path)
+	}
+
+	// A removed song comes back with its old ID and its playlist entry
+	result, err = repo.Sync(ctx, []*models.Song{{RockboxID: "removed", Path: "/removed.mp3"}})
+	if err != nil {
+		t.Fatalf("Sync() re-adding error = %v", err)
+	}
+	if result.Added != 1 || result.Removed != 3 {
+		t.Errorf("Sync() re-adding = %+v, want 1 added and 3 removed", *result)
+	}
+	back, err := repo.FindByRockboxID(ctx, "removed")
+	if err != nil || back.ID != removed.ID {
+		t.Errorf("restored song = %v, %v, want ID %d", back, err, removed.ID)
+	}
+	entries, _ = playlistRepo.GetEntries(ctx, playlist.ID)
+	if len(entries) != 2 || !entries[0].Missing || entries[1].Missing {
+		t.Errorf("after restore the changed song entry should be missing and the restored one not")
+	}
+}
+
+func TestSongRepository_Sync_ReconcilesByPath(t *testing.T) {
+	db := setupTestDB(t)
+	defer func() { _ = db.Close() }()
+
+	repo := NewSongRepository(db.DB())
+	ctx := context.Background()
+
+	song := &models.Song{RockboxID: "old-id", Path: "/a.mp3", Title: "A", LastFMID: "lfm"}
+	_ = repo.Create(ctx, song)
+
+	result, err := repo.Sync(ctx, []*models.Song{{RockboxID: "new-id", Path: "/a.mp3", Title: "A"}})
+	if err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if result.Changed != 1 || result.Added != 0 || result.Removed != 0 {
+		t.Errorf("Sync() = %+v, want the song reconciled by path", *result)
+	}
+
+	got, err := repo.FindByRockboxID(ctx, "new-id")
+	if err != nil {
+		t.Fatalf("FindByRockboxID() error = %v", err)
+	}
+	if got.ID != song.ID || got.LastFMID != "lfm" {
+		t.Errorf("reconciled song ID = %d, LastFMID = %q, want %d and lfm", got.ID, got.LastFMID, song.ID)
+	}
+}
+
+func TestSongRepository_Sync_MusicBrainzIDFromTags(t *testing.T) {
+	db := setupTestDB(t)
+	defer func() { _ = db.Close() }()
+
+	repo := NewSongRepository(db.DB())
+	ctx := context.Background()
+
+	untagged := &models.Song{RockboxID: "untagged", Path: "/untagged.mp3", Title: "Untagged"}
+	matched := &models.Song{RockboxID: "matched", Path: "/matched.mp3", Title: "Matched", MusicBrainzID: "matched-mbid"}
+	_ = repo.CreateBatch(ctx, []*models.Song{untagged, matched})
+
+	result, err := repo.Sync(ctx, []*models.Song{
+		{RockboxID: "untagged", Path: "/untagged.mp3", Title: "Untagged", MusicBrainzID: "tag-mbid"},
+		{RockboxID: "matched", Path: "/matched.mp3", Title: "Matched", MusicBrainzID: "other-mbid"},
+	})
+	if err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if result.Changed != 1 || result.Unchanged != 1 {
+		t.Errorf("Sync() = %+v, want 1 changed and 1 unchanged", *result)
+	}
+
+	if got, _ := repo.FindByRockboxID(ctx, "untagged"); got.MusicBrainzID != "tag-mbid" {
+		t.Errorf("untagged song MusicBrainzID = %q, want tag-mbid", got.MusicBrainzID)
+	}
+	if got, _ := repo.FindByRockboxID(ctx, "matched"); got.MusicBrainzID != "matched-mbid" {
+		t.Errorf("matched song MusicBrainzID = %q, want matched-mbid to be kept", got.MusicBrainzID)
+	}
+}
+
+func TestSongRepository_BeginSync_Chunks(t *testing.T) {
+	db := setupTestDB(t)
+	defer func() { _ = db.Close() }()
+
+	repo := NewSongRepository(db.DB()).(*songRepository)
+	ctx := context.Background()
+
+	stored := &models.Song{RockboxID: "old-id", Path: "/b.mp3", Title: "B", LastFMID: "lfm"}
+	removed := &models.Song{RockboxID: "removed", Path: "/removed.mp3"}
+	_ = repo.CreateBatch(ctx, []*models.Song{stored, removed})
+
+	sync := repo.beginSync(2)
+	songs := []*models.Song{
+		{RockboxID: "a", Path: "/a.mp3", Title: "A"},
+		{RockboxID: "new-id", Path: "/b.mp3", Title: "B"},
+		{RockboxID: "a", Path: "/a.mp3", Title: "A"},
+		{RockboxID: "c", Path: "/c.mp3", Title: "C"},
+		{RockboxID: "d", Path: "/a.mp3", Title: "Same path as A"},
+	}
+	for i, song := range songs {
+		if err := sync.Add(ctx, song); err != nil {
+			t.Fatalf("Add(%d) error = %v", i, err)
+		}
+	}
+
+	// Full chunks are written before Finish, nothing is removed yet
+	if count, _ := repo.Count(ctx); count != 5 {
+		t.Errorf("Count() before Finish = %d, want 5", count)
+	}
+
+	result, err := sync.Finish(ctx)
+	if err != nil {
+		t.Fatalf("Finish() error = %v", err)
+	}
+	want := models.SyncResult{Added: 3, Removed: 1, Changed: 1}
+	if *result != want {
+		t.Errorf("Finish() = %+v, want %+v", *result, want)
+	}
+
+	got, err := repo.FindByRockboxID(ctx, "new-id")
+	if err != nil || got.ID != stored.ID || got.LastFMID != "lfm" {
+		t.Errorf("song reconciled by path = %+v, %v, want ID %d with its LastFMID", got, err, stored.ID)
+	}
+	if _, err := repo.FindByRockboxID(ctx, "d"); err != nil {
+		t.Errorf("song sharing a path with an added song should be added, got %v", err)
+	}
+	if count, _ := repo.Count(ctx); count != 4 {
+		t.Errorf("Count() = %d, want 4", count)
+	}
+}
+
+func TestSongRepository_DeviceScope(t *testing.T) {
+	db := setupTestDB(t)
+	defer func() { _ = db.Close() }()
+
+	ctx := context.Background()
+	ipod := NewDeviceSongRepository(db.DB(), 1)
+	fuze := NewDeviceSongRepository(db.DB(), 2)
+
+	// Both players number their songs from the start, so RockboxIDs overlap
+	for _, repo := range []SongRepository{ipod, fuze} {
+		sync := repo.BeginSync(ctx)
+		_ = sync.Add(ctx, &models.Song{RockboxID: "1", Path: "/Music/a.mp3", Artist: "Metallica"})
+		if _, err := sync.Finish(ctx); err != nil {
+			t.Fatalf("Finish() error = %v", err)
+		}
+	}
+	if err := fuze.Create(ctx, &models.Song{RockboxID: "2", Path: "/Music/b.mp3", Artist: "Metallica"}); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	if count, _ := ipod.Count(ctx); count != 1 {
+		t.Errorf("ipod Count() = %d, want 1", count)
+	}
+	if songs, _ := fuze.FindByArtist(ctx, "Metallica"); len(songs) != 2 {
+		t.Errorf("fuze FindByArtist() = %d songs, want 2", len(songs))
+	}
+	song, err := ipod.FindByRockboxID(ctx, "1")
+	if err != nil || song.DeviceID != 1 {
+		t.Fatalf("FindByRockboxID() = %+v, %v, want the ipod song", song, err)
+	}
+	if _, err := fuze.FindByID(ctx, song.ID); err != models.ErrSongNotFound {
+		t.Errorf("FindByID() of another device's song error = %v, want ErrSongNotFound", err)
+	}
+
+	if err := ipod.DeleteAll(ctx); err != nil {
+		t.Fatalf("DeleteAll() error = %v", err)
+	}
+	if count, _ := fuze.Count(ctx); count != 2 {
+		t.Errorf("DeleteAll() on ipod left fuze with %d songs, want 2", count)
+	}
+}
+
+// BenchmarkSongSync_Memory streams a large library into SQLite through
+// BeginSync the way a parse does. Only the pending chunk and the IDs of the
+// synced songs are held, so the peak live-MB grows by tens of bytes a song
+// while B/op and allocs/op grow with the number of songs written.
+func BenchmarkSongSync_Memory(b *testing.B) {
+	for _, n := range []int{10000, 50000} {
+		b.Run(fmt.Sprintf("songs=%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			var peak uint64
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				db := setupTestDB(b)
+				repo := NewSongRepository(db.DB())
+				ctx := context.Background()
+				base := liveHeap()
+				b.StartTimer()
+
+				songs := repo.BeginSync(ctx)
+				for j := 0; j < n; j++ {
+					song := &models.Song{
+						RockboxID: fmt.Sprintf("%d", j),
+						Path:      fmt.Sprintf("/Music/Artist %d/Album %d/%02d - Track.mp3", j/100, j/10, j%10),
+						Artist:    fmt.Sprintf("Artist %d", j/100),
+						Album:     fmt.Sprintf("Album %d", j/10),
+						Title:     fmt.Sprintf("Track %d", j),
+						Duration:  240,
+					}
+					if err := songs.Add(ctx, song); err != nil {
+						b.Fatalf("Add() error = %v", err)
+					}
+					if (j+1)%(n/10) == 0 {
+						b.StopTimer()
+						peak = max(peak, heapGrowth(base))
+						b.StartTimer()
+					}
+				}
+				result, err := songs.Finish(ctx)
+				if err != nil || result.Added != n {
+					b.Fatalf("Finish() = %+v, %v, want %d added", result, err, n)
+				}
+
+				b.StopTimer()
+				_ = db.Close()
+				b.StartTimer()
+			}
+			b.ReportMetric(float64(peak)/(1<<20), "live-MB")
+		})
+	}
+}
+
+// liveHeap returns the heap in use after a collection
+func liveHeap() uint64 {
+	var stats runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&stats)
+	return stats.HeapAlloc
+}
+
+// heapGrowth returns the live heap above base
+func heapGrowth(base uint64) uint64 {
+	if heap := liveHeap(); heap > base {
+		return heap - base
+	}
+	return 0
+}
@@ -0,0 +1,214 @@
+// Package audiotag reads metadata tags and stream properties from audio files.
+//
+// It supports ID3v1/ID3v2 (MP3), Vorbis comments (FLAC, Ogg Vorbis, Opus) and
+// iTunes-style MP4 atoms (M4A) without any external dependencies. It is used
+// by the filesystem scan when a device has no Rockbox database.
+package audiotag
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ErrUnsupported is returned for file types without a tag reader
+var ErrUnsupported = errors.New("unsupported audio format")
+
+// ErrInvalid is returned when a file does not look like the format its
+// extension claims
+var ErrInvalid = errors.New("invalid audio file")
+
+// maxBlockSize limits the size of a single metadata block read into memory
+const maxBlockSize = 16 << 20
+
+// Tags holds the metadata and stream properties read from an audio file
+type Tags struct {
+	Title       string
+	Artist      string
+	AlbumArtist string
+	Album       string
+	Genre       string
+	Composer    string
+	Comment     string
+	Grouping    string
+	Year        int
+	TrackNumber int
+	DiscNumber  int
+	Duration    int // in milliseconds
+	Bitrate     int // in kbps
+	SampleRate  int // in Hz
+	// MusicBrainz identifiers as written by Picard
+	MusicBrainzTrackID  string // recording ID
+	MusicBrainzAlbumID  string // release ID
+	MusicBrainzArtistID string
+}
+
+// ReadFile reads the tags of the audio file at name, choosing the reader by
+// its extension
+func ReadFile(name string) (*Tags, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	return Read(f, filepath.Ext(name))
+}
+
+// ReadFS reads the tags of the audio file name in fsys. Files that cannot
+// seek, such as compressed archive members, are read into memory first.
+func ReadFS(fsys fs.FS, name string) (*Tags, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	ext := path.Ext(name)
+	if rs, ok := f.(io.ReadSeeker); ok {
+		return Read(rs, ext)
+	}
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	return Read(bytes.NewReader(data), ext)
+}
+
+// Read reads the tags of an audio file. ext is the file extension including
+// the dot and selects the reader.
+func Read(r io.ReadSeeker, ext string) (*Tags, error) {
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	var tags *Tags
+	switch strings.ToLower(ext) {
+	case ".mp3", ".mp2":
+		tags, err = readMP3(r, size)
+	case ".flac":
+		tags, err = readFLAC(r, size)
+	case ".ogg", ".oga", ".opus":
+		tags, err = readOgg(r, size)
+	case ".m4a", ".m4b", ".mp4":
+		tags, err = readMP4(r, size)
+	default:
+		return nil, ErrUnsupported
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if tags.Bitrate == 0 && tags.Duration > 0 {
+		tags.Bitrate = int(size * 8 / int64(tags.Duration))
+	}
+	return tags, nil
+}
+
+// set assigns a tag by its common name, as used by Vorbis comments and
+// ID3v2 TXXX frames. Names are case-insensitive; unknown names are ignored.
+// Values already set are kept so the first occurrence wins.
+func (t *Tags) set(name, value string) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return
+	}
+
+	setString := func(field *string) {
+		if *field == "" {
+			*field = value
+		}
+	}
+	setInt := func(field *int, n int) {
+		if *field == 0 {
+			*field = n
+		}
+	}
+
+	switch strings.ToUpper(name) {
+	case "TITLE":
+		setString(&t.Title)
+	case "ARTIST":
+		setString(&t.Artist)
+	case "ALBUMARTIST", "ALBUM ARTIST", "ALBUM_ARTIST":
+		setString(&t.AlbumArtist)
+	case "ALBUM":
+		setString(&t.Album)
+	case "GENRE":
+		setString(&t.Genre)
+	case "COMPOSER":
+		setString(&t.Composer)
+	case "COMMENT", "DESCRIPTION":
+		setString(&t.Comment)
+	case "GROUPING", "CONTENTGROUP":
+		setString(&t.Grouping)
+	case "DATE", "YEAR", "ORIGINALDATE":
+		setInt(&t.Year, parseYear(value))
+	case "TRACKNUMBER", "TRACK":
+		setInt(&t.TrackNumber, parseNumber(value))
+	case "DISCNUMBER", "DISC":
+		setInt(&t.DiscNumber, parseNumber(value))
+	case "MUSICBRAINZ_TRACKID", "MUSICBRAINZ TRACK ID":
+		setString(&t.MusicBrainzTrackID)
+	case "MUSICBRAINZ_ALBUMID", "MUSICBRAINZ ALBUM ID":
+		setString(&t.MusicBrainzAlbumID)
+	case "MUSICBRAINZ_ARTISTID", "MUSICBRAINZ ARTIST ID":
+		setString(&t.MusicBrainzArtistID)
+	}
+}
+
+// parseNumber parses a track or disc number such as "3" or "3/12"
+func parseNumber(s string) int {
+	if i := strings.IndexByte(s, '/'); i >= 0 {
+		s = s[:i]
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+// parseYear extracts the year of a date such as "2004" or "2004-05-01"
+func parseYear(s string) int {
+	s = strings.TrimSpace(s)
+	if len(s) < 4 {
+		return 0
+	}
+	n, err := strconv.Atoi(s[:4])
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// durationMs returns the duration in milliseconds of samples at rate
+func durationMs(samples, rate int64) int {
+	if samples <= 0 || rate <= 0 {
+		return 0
+	}
+	return int(samples * 1000 / rate)
+}
+
+// readFull reads exactly n bytes, refusing blocks above maxBlockSize
+func readFull(r io.Reader, n int64) ([]byte, error) {
+	if n < 0 || n > maxBlockSize {
+		return nil, ErrInvalid
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
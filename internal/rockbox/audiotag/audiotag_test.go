@@ -0,0 +1,97 @@
+package audiotag
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRead_Unsupported(t *testing.T) {
+	for _, ext := range []string{".wav", ".wma", ""} {
+		if _, err := Read(bytes.NewReader(nil), ext); !errors.Is(err, ErrUnsupported) {
+			t.Errorf("Read(%q) error = %v, want ErrUnsupported", ext, err)
+		}
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "song.flac")
+	if err := os.WriteFile(path, flacFile(48000, 48000, 0, "TITLE=From File"), 0644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	tags, err := ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if tags.Title != "From File" || tags.Duration != 1000 {
+		t.Errorf("Title, Duration = %q, %d, want From File, 1000", tags.Title, tags.Duration)
+	}
+
+	if _, err := ReadFile(filepath.Join(t.TempDir(), "missing.flac")); err == nil {
+		t.Error("ReadFile() of a missing file should return an error")
+	}
+}
+
+func TestTags_Set(t *testing.T) {
+	tags := &Tags{}
+	tags.set("title", "  First  ")
+	tags.set("TITLE", "Second")
+	tags.set("Album Artist", "Album Artist")
+	tags.set("TRACKNUMBER", "not a number")
+	tags.set("UNKNOWN", "ignored")
+	tags.set("ARTIST", "   ")
+
+	if tags.Title != "First" {
+		t.Errorf("Title = %q, want First (trimmed, first value wins)", tags.Title)
+	}
+	if tags.AlbumArtist != "Album Artist" {
+		t.Errorf("AlbumArtist = %q, want Album Artist", tags.AlbumArtist)
+	}
+	if tags.TrackNumber != 0 || tags.Artist != "" {
+		t.Errorf("TrackNumber, Artist = %d, %q, want 0, empty", tags.TrackNumber, tags.Artist)
+	}
+}
+
+func TestParseNumber(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int
+	}{
+		{"3", 3},
+		{"03/12", 3},
+		{" 7 / 9", 7},
+		{"", 0},
+		{"A1", 0},
+		{"-2", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			if got := parseNumber(tt.in); got != tt.want {
+				t.Errorf("parseNumber(%q) = %d, want %d", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseYear(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int
+	}{
+		{"2004", 2004},
+		{"2004-05-01", 2004},
+		{"2019-06-01T07:00:00Z", 2019},
+		{"04", 0},
+		{"circa 1990", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			if got := parseYear(tt.in); got != tt.want {
+				t.Errorf("parseYear(%q) = %d, want %d", tt.in, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,520 @@
+package audiotag
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+const (
+	id3v2HeaderSize = 10
+	id3v1Size       = 128
+	// mpegSearchLimit is how far past the ID3v2 tag to look for the first frame
+	mpegSearchLimit = 64 << 10
+)
+
+// id3v22Frames maps the three-character ID3v2.2 frame IDs to their v2.3 names
+var id3v22Frames = map[string]string{
+	"TT1": "TIT1", "TT2": "TIT2", "TP1": "TPE1", "TP2": "TPE2", "TAL": "TALB",
+	"TCO": "TCON", "TCM": "TCOM", "TYE": "TYER", "TRK": "TRCK", "TPA": "TPOS",
+	"COM": "COMM", "TXX": "TXXX", "UFI": "UFID",
+}
+
+// readMP3 reads ID3v2 and ID3v1 tags and the stream properties of an MP3 file
+func readMP3(r io.ReadSeeker, size int64) (*Tags, error) {
+	tags := &Tags{}
+
+	audioStart, err := readID3v2(r, tags)
+	if err != nil {
+		return nil, err
+	}
+
+	audioEnd := size
+	if size >= id3v1Size {
+		hasV1, err := readID3v1(r, size, tags)
+		if err != nil {
+			return nil, err
+		}
+		if hasV1 {
+			audioEnd -= id3v1Size
+		}
+	}
+
+	if err := readMPEGInfo(r, audioStart, audioEnd, tags); err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+// readID3v2 reads the ID3v2 tag at the start of the file, if any, and
+// returns the offset where the audio data begins
+func readID3v2(r io.ReadSeeker, tags *Tags) (int64, error) {
+	header := make([]byte, id3v2HeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return 0, ErrInvalid
+		}
+		return 0, err
+	}
+	if string(header[:3]) != "ID3" {
+		return 0, nil
+	}
+
+	major := header[3]
+	flags := header[5]
+	size := int64(syncsafe(header[6:10]))
+	end := id3v2HeaderSize + size
+	if flags&0x10 != 0 {
+		end += id3v2HeaderSize // footer
+	}
+	if major < 2 || major > 4 {
+		return end, nil
+	}
+
+	body, err := readFull(r, size)
+	if err != nil {
+		return 0, ErrInvalid
+	}
+	if flags&0x80 != 0 && major < 4 {
+		body = removeUnsync(body)
+	}
+	if flags&0x40 != 0 && major > 2 {
+		body = skipExtendedHeader(body, major)
+	}
+
+	parseID3v2Frames(body, major, tags)
+	return end, nil
+}
+
+// skipExtendedHeader strips the ID3v2 extended header from the tag body
+func skipExtendedHeader(body []byte, major byte) []byte {
+	if len(body) < 4 {
+		return nil
+	}
+	var n int
+	if major == 4 {
+		n = int(syncsafe(body[:4]))
+	} else {
+		n = int(binary.BigEndian.Uint32(body[:4])) + 4
+	}
+	if n > len(body) {
+		return nil
+	}
+	return body[n:]
+}
+
+// parseID3v2Frames walks the frames of an ID3v2 tag body
+func parseID3v2Frames(body []byte, major byte, tags *Tags) {
+	headerSize := 10
+	if major == 2 {
+		headerSize = 6
+	}
+
+	for len(body) >= headerSize {
+		if body[0] == 0 {
+			return // padding
+		}
+
+		var id string
+		var size int
+		var formatFlags byte
+		switch major {
+		case 2:
+			id = id3v22Frames[string(body[:3])]
+			size = int(body[3])<<16 | int(body[4])<<8 | int(body[5])
+		case 3:
+			id = string(body[:4])
+			size = int(binary.BigEndian.Uint32(body[4:8]))
+			formatFlags = body[9]
+		default:
+			id = string(body[:4])
+			size = int(syncsafe(body[4:8]))
+			formatFlags = body[9]
+		}
+		if size < 0 || size > len(body)-headerSize {
+			return
+		}
+		data := body[headerSize : headerSize+size]
+		body = body[headerSize+size:]
+
+		data, ok := frameData(data, major, formatFlags)
+		if !ok {
+			continue
+		}
+		applyID3v2Frame(id, data, tags)
+	}
+}
+
+// frameData undoes the per-frame encoding flags. Compressed and encrypted
+// frames are skipped.
+func frameData(data []byte, major, flags byte) ([]byte, bool) {
+	switch major {
+	case 3:
+		if flags&0xC0 != 0 { // compression, encryption
+			return nil, false
+		}
+		if flags&0x20 != 0 { // grouping identity
+			if len(data) < 1 {
+				return nil, false
+			}
+			data = data[1:]
+		}
+	case 4:
+		if flags&0x0C != 0 { // compression, encryption
+			return nil, false
+		}
+		if flags&0x40 != 0 { // grouping identity
+			if len(data) < 1 {
+				return nil, false
+			}
+			data = data[1:]
+		}
+		if flags&0x02 != 0 {
+			data = removeUnsync(data)
+		}
+		if flags&0x01 != 0 { // data length indicator
+			if len(data) < 4 {
+				return nil, false
+			}
+			data = data[4:]
+		}
+	}
+	return data, true
+}
+
+// applyID3v2Frame stores the value of a supported frame in tags
+func applyID3v2Frame(id string, data []byte, tags *Tags) {
+	if len(data) == 0 {
+		return
+	}
+
+	switch id {
+	case "TIT2":
+		tags.set("TITLE", id3Text(data))
+	case "TPE1":
+		tags.set("ARTIST", id3Text(data))
+	case "TPE2":
+		tags.set("ALBUMARTIST", id3Text(data))
+	case "TALB":
+		tags.set("ALBUM", id3Text(data))
+	case "TCON":
+		tags.set("GENRE", id3Genre(id3Text(data)))
+	case "TCOM":
+		tags.set("COMPOSER", id3Text(data))
+	case "TIT1", "GRP1":
+		tags.set("GROUPING", id3Text(data))
+	case "TYER", "TDRC", "TDOR":
+		tags.set("DATE", id3Text(data))
+	case "TRCK":
+		tags.set("TRACKNUMBER", id3Text(data))
+	case "TPOS":
+		tags.set("DISCNUMBER", id3Text(data))
+	case "TLEN":
+		if tags.Duration == 0 {
+			tags.Duration, _ = strconv.Atoi(strings.TrimSpace(id3Text(data)))
+		}
+	case "COMM":
+		// encoding, 3-byte language, description, text
+		if len(data) < 4 {
+			return
+		}
+		desc, text := splitID3Text(data[0], data[4:])
+		if desc == "" {
+			tags.set("COMMENT", text)
+		}
+	case "TXXX":
+		desc, value := splitID3Text(data[0], data[1:])
+		tags.set(desc, value)
+	case "UFID":
+		// owner identifier, NUL, binary identifier
+		i := bytes.IndexByte(data, 0)
+		if i >= 0 && string(data[:i]) == "http://musicbrainz.org" {
+			tags.set("MUSICBRAINZ_TRACKID", string(data[i+1:]))
+		}
+	}
+}
+
+// id3Text decodes a text frame, keeping only the first of multiple values
+func id3Text(data []byte) string {
+	text, _ := splitID3Text(data[0], data[1:])
+	return text
+}
+
+// splitID3Text decodes the first terminated string of b and the string
+// following it
+func splitID3Text(encoding byte, b []byte) (string, string) {
+	first, rest := cutTerminated(encoding, b)
+	second, _ := cutTerminated(encoding, rest)
+	return decodeID3(encoding, first), decodeID3(encoding, second)
+}
+
+// cutTerminated splits b at the first string terminator of the encoding
+func cutTerminated(encoding byte, b []byte) ([]byte, []byte) {
+	if encoding == 1 || encoding == 2 {
+		for i := 0; i+1 < len(b); i += 2 {
+			if b[i] == 0 && b[i+1] == 0 {
+				return b[:i], b[i+2:]
+			}
+		}
+		return b, nil
+	}
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		return b[:i], b[i+1:]
+	}
+	return b, nil
+}
+
+// decodeID3 decodes ID3v2 text in one of its four encodings
+func decodeID3(encoding byte, b []byte) string {
+	switch encoding {
+	case 1, 2:
+		order := binary.ByteOrder(binary.BigEndian)
+		if encoding == 1 {
+			order = binary.LittleEndian
+		}
+		if len(b) >= 2 {
+			switch {
+			case b[0] == 0xFF && b[1] == 0xFE:
+				order, b = binary.LittleEndian, b[2:]
+			case b[0] == 0xFE && b[1] == 0xFF:
+				order, b = binary.BigEndian, b[2:]
+			}
+		}
+		units := make([]uint16, len(b)/2)
+		for i := range units {
+			units[i] = order.Uint16(b[i*2:])
+		}
+		return string(utf16.Decode(units))
+	case 3:
+		return string(b)
+	default:
+		return latin1(b)
+	}
+}
+
+// latin1 decodes ISO-8859-1 text
+func latin1(b []byte) string {
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
+
+// id3Genre resolves numeric ID3 genre references such as "17" or "(17)Rock"
+func id3Genre(s string) string {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "(") {
+		if end := strings.IndexByte(s, ')'); end > 0 {
+			if rest := strings.TrimSpace(s[end+1:]); rest != "" {
+				return rest
+			}
+			s = s[1:end]
+		}
+	}
+	if n, err := strconv.Atoi(s); err == nil {
+		if name := genreName(n); name != "" {
+			return name
+		}
+	}
+	return s
+}
+
+// readID3v1 reads the ID3v1 tag at the end of the file, if any, filling only
+// the fields the ID3v2 tag left empty
+func readID3v1(r io.ReadSeeker, size int64, tags *Tags) (bool, error) {
+	if _, err := r.Seek(size-id3v1Size, io.SeekStart); err != nil {
+		return false, err
+	}
+	b := make([]byte, id3v1Size)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return false, err
+	}
+	if string(b[:3]) != "TAG" {
+		return false, nil
+	}
+
+	field := func(b []byte) string {
+		if i := bytes.IndexByte(b, 0); i >= 0 {
+			b = b[:i]
+		}
+		return strings.TrimSpace(latin1(b))
+	}
+
+	tags.set("TITLE", field(b[3:33]))
+	tags.set("ARTIST", field(b[33:63]))
+	tags.set("ALBUM", field(b[63:93]))
+	tags.set("YEAR", field(b[93:97]))
+	comment := b[97:127]
+	if comment[28] == 0 && comment[29] != 0 { // ID3v1.1 track number
+		tags.set("TRACKNUMBER", strconv.Itoa(int(comment[29])))
+		comment = comment[:28]
+	}
+	tags.set("COMMENT", field(comment))
+	tags.set("GENRE", genreName(int(b[127])))
+	return true, nil
+}
+
+// syncsafe decodes a 28-bit synchsafe integer
+func syncsafe(b []byte) uint32 {
+	return uint32(b[0]&0x7F)<<21 | uint32(b[1]&0x7F)<<14 | uint32(b[2]&0x7F)<<7 | uint32(b[3]&0x7F)
+}
+
+// removeUnsync reverts the ID3v2 unsynchronisation scheme (0xFF 0x00 -> 0xFF)
+func removeUnsync(b []byte) []byte {
+	out := make([]byte, 0, len(b))
+	for i := 0; i < len(b); i++ {
+		out = append(out, b[i])
+		if b[i] == 0xFF && i+1 < len(b) && b[i+1] == 0 {
+			i++
+		}
+	}
+	return out
+}
+
+// MPEG audio header tables, indexed by [version][layer][index]. Versions are
+// 0 for MPEG-1 and 1 for MPEG-2/2.5; layers are 0 for Layer I through 2 for
+// Layer III.
+var mpegBitrates = [2][3][16]int{
+	{
+		{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448, 0},
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384, 0},
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0},
+	},
+	{
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256, 0},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+	},
+}
+
+var mpegSampleRates = map[byte][3]int{
+	3: {44100, 48000, 32000}, // MPEG-1
+	2: {22050, 24000, 16000}, // MPEG-2
+	0: {11025, 12000, 8000},  // MPEG-2.5
+}
+
+// mpegFrame is a decoded MPEG audio frame header
+type mpegFrame struct {
+	version    byte // 3 = MPEG-1, 2 = MPEG-2, 0 = MPEG-2.5
+	layer      int  // 1, 2 or 3
+	bitrate    int  // kbps
+	sampleRate int
+	mono       bool
+}
+
+// parseMPEGHeader decodes a 4-byte MPEG audio frame header
+func parseMPEGHeader(b []byte) (*mpegFrame, bool) {
+	if b[0] != 0xFF || b[1]&0xE0 != 0xE0 {
+		return nil, false
+	}
+	version := (b[1] >> 3) & 0x03
+	layerBits := (b[1] >> 1) & 0x03
+	bitrateIndex := b[2] >> 4
+	rateIndex := (b[2] >> 2) & 0x03
+	if version == 1 || layerBits == 0 || bitrateIndex == 0x0F || rateIndex == 3 {
+		return nil, false
+	}
+
+	frame := &mpegFrame{
+		version:    version,
+		layer:      4 - int(layerBits),
+		sampleRate: mpegSampleRates[version][rateIndex],
+		mono:       b[3]>>6 == 3,
+	}
+	table := 0
+	if version != 3 {
+		table = 1
+	}
+	frame.bitrate = mpegBitrates[table][frame.layer-1][bitrateIndex]
+	return frame, true
+}
+
+// samplesPerFrame returns the number of samples in one frame
+func (f *mpegFrame) samplesPerFrame() int {
+	switch {
+	case f.layer == 1:
+		return 384
+	case f.layer == 3 && f.version != 3:
+		return 576
+	default:
+		return 1152
+	}
+}
+
+// xingOffset returns the offset of a Xing/Info header from the frame start
+func (f *mpegFrame) xingOffset() int {
+	switch {
+	case f.version == 3 && !f.mono:
+		return 4 + 32
+	case f.version == 3 || !f.mono:
+		return 4 + 17
+	default:
+		return 4 + 9
+	}
+}
+
+// readMPEGInfo finds the first MPEG frame and derives the duration, bitrate
+// and sample rate, using a Xing or VBRI header for VBR files
+func readMPEGInfo(r io.ReadSeeker, start, end int64, tags *Tags) error {
+	if _, err := r.Seek(start, io.SeekStart); err != nil {
+		return err
+	}
+	n := end - start
+	if n > mpegSearchLimit {
+		n = mpegSearchLimit
+	}
+	if n <= 0 {
+		return nil
+	}
+	buf := make([]byte, n)
+	n64, err := io.ReadFull(r, buf)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	buf = buf[:n64]
+
+	for i := 0; i+4 <= len(buf); i++ {
+		frame, ok := parseMPEGHeader(buf[i:])
+		if !ok {
+			continue
+		}
+
+		tags.SampleRate = frame.sampleRate
+		audioBytes := end - start - int64(i)
+
+		if frames := vbrFrameCount(buf[i:], frame); frames > 0 {
+			samples := int64(frames) * int64(frame.samplesPerFrame())
+			tags.Duration = durationMs(samples, int64(frame.sampleRate))
+			if tags.Duration > 0 {
+				tags.Bitrate = int(audioBytes * 8 / int64(tags.Duration))
+			}
+			return nil
+		}
+
+		tags.Bitrate = frame.bitrate
+		if frame.bitrate > 0 && tags.Duration == 0 {
+			tags.Duration = int(audioBytes * 8 / int64(frame.bitrate))
+		}
+		return nil
+	}
+	return nil
+}
+
+// vbrFrameCount reads the frame count of a Xing/Info or VBRI header in the
+// first frame, returning 0 if there is none
+func vbrFrameCount(b []byte, frame *mpegFrame) uint32 {
+	if off := frame.xingOffset(); len(b) >= off+12 {
+		tag := string(b[off : off+4])
+		if (tag == "Xing" || tag == "Info") && b[off+7]&0x01 != 0 {
+			return binary.BigEndian.Uint32(b[off+8:])
+		}
+	}
+	if off := 4 + 32; len(b) >= off+18 && string(b[off:off+4]) == "VBRI" {
+		return binary.BigEndian.Uint32(b[off+14:])
+	}
+	return 0
+}
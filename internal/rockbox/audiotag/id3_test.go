@@ -0,0 +1,289 @@
+package audiotag
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"unicode/utf16"
+)
+
+// id3Frame builds an ID3v2.3/2.4 frame
+func id3Frame(major byte, id string, data []byte) []byte {
+	var b bytes.Buffer
+	b.WriteString(id)
+	size := make([]byte, 4)
+	if major == 4 {
+		putSyncsafe(size, uint32(len(data)))
+	} else {
+		binary.BigEndian.PutUint32(size, uint32(len(data)))
+	}
+	b.Write(size)
+	b.Write([]byte{0, 0})
+	b.Write(data)
+	return b.Bytes()
+}
+
+// id3v22Frame builds an ID3v2.2 frame
+func id3v22Frame(id string, data []byte) []byte {
+	n := len(data)
+	return append([]byte{id[0], id[1], id[2], byte(n >> 16), byte(n >> 8), byte(n)}, data...)
+}
+
+// id3Tag wraps frames in an ID3v2 header, adding some padding
+func id3Tag(major byte, frames ...[]byte) []byte {
+	body := bytes.Join(frames, nil)
+	body = append(body, make([]byte, 16)...)
+	header := []byte{'I', 'D', '3', major, 0, 0, 0, 0, 0, 0}
+	putSyncsafe(header[6:], uint32(len(body)))
+	return append(header, body...)
+}
+
+func putSyncsafe(b []byte, v uint32) {
+	b[0] = byte(v>>21) & 0x7F
+	b[1] = byte(v>>14) & 0x7F
+	b[2] = byte(v>>7) & 0x7F
+	b[3] = byte(v) & 0x7F
+}
+
+// latin1Text builds a text frame payload in ISO-8859-1
+func latin1Text(s string) []byte {
+	return append([]byte{0}, s...)
+}
+
+// utf8Text builds a text frame payload in UTF-8
+func utf8Text(s string) []byte {
+	return append([]byte{3}, s...)
+}
+
+// utf16Text builds a text frame payload in UTF-16 with a little endian BOM
+func utf16Text(s string) []byte {
+	b := []byte{1, 0xFF, 0xFE}
+	for _, u := range utf16.Encode([]rune(s)) {
+		b = append(b, byte(u), byte(u>>8))
+	}
+	return b
+}
+
+// mpegFrames builds n MPEG-1 Layer III frames at 128 kbps, 44.1 kHz stereo.
+// If xingFrames is set the first frame carries a Xing header with that
+// frame count.
+func mpegFrames(n int, xingFrames uint32) []byte {
+	const frameSize = 417
+	out := make([]byte, 0, n*frameSize)
+	for i := 0; i < n; i++ {
+		frame := make([]byte, frameSize)
+		copy(frame, []byte{0xFF, 0xFB, 0x90, 0x00})
+		if i == 0 && xingFrames > 0 {
+			copy(frame[36:], "Xing")
+			binary.BigEndian.PutUint32(frame[40:], 0x01)
+			binary.BigEndian.PutUint32(frame[44:], xingFrames)
+		}
+		out = append(out, frame...)
+	}
+	return out
+}
+
+// id3v1Tag builds an ID3v1.1 tag
+func id3v1Tag(title, artist, album, year string, track, genre byte) []byte {
+	b := make([]byte, id3v1Size)
+	copy(b, "TAG")
+	copy(b[3:33], title)
+	copy(b[33:63], artist)
+	copy(b[63:93], album)
+	copy(b[93:97], year)
+	copy(b[97:125], "v1 comment")
+	b[126] = track
+	b[127] = genre
+	return b
+}
+
+func TestReadMP3_ID3v23(t *testing.T) {
+	comm := append([]byte{0}, "eng"...)
+	comm = append(comm, 0)
+	comm = append(comm, "A comment"...)
+	ufid := append([]byte("http://musicbrainz.org\x00"), "6a4b3c2d-0000-4000-8000-000000000001"...)
+
+	data := id3Tag(3,
+		id3Frame(3, "TIT2", utf16Text("Smörgåsbord")),
+		id3Frame(3, "TPE1", latin1Text("Bj\xf6rk")),
+		id3Frame(3, "TPE2", latin1Text("Various Artists")),
+		id3Frame(3, "TALB", latin1Text("Album")),
+		id3Frame(3, "TCON", latin1Text("(17)")),
+		id3Frame(3, "TCOM", latin1Text("Composer")),
+		id3Frame(3, "TIT1", latin1Text("Grouping")),
+		id3Frame(3, "TYER", latin1Text("1997")),
+		id3Frame(3, "TRCK", latin1Text("3/12")),
+		id3Frame(3, "TPOS", latin1Text("2/2")),
+		id3Frame(3, "COMM", comm),
+		id3Frame(3, "TXXX", latin1Text("MusicBrainz Album Id\x00album-id")),
+		id3Frame(3, "TXXX", latin1Text("MusicBrainz Artist Id\x00artist-id")),
+		id3Frame(3, "UFID", ufid),
+	)
+	data = append(data, mpegFrames(100, 100)...)
+
+	tags, err := Read(bytes.NewReader(data), ".mp3")
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+
+	want := Tags{
+		Title:               "Smörgåsbord",
+		Artist:              "Björk",
+		AlbumArtist:         "Various Artists",
+		Album:               "Album",
+		Genre:               "Rock",
+		Composer:            "Composer",
+		Comment:             "A comment",
+		Grouping:            "Grouping",
+		Year:                1997,
+		TrackNumber:         3,
+		DiscNumber:          2,
+		Duration:            2612, // 100 frames * 1152 samples / 44100 Hz
+		Bitrate:             127,
+		SampleRate:          44100,
+		MusicBrainzTrackID:  "6a4b3c2d-0000-4000-8000-000000000001",
+		MusicBrainzAlbumID:  "album-id",
+		MusicBrainzArtistID: "artist-id",
+	}
+	if *tags != want {
+		t.Errorf("Read() = %+v, want %+v", *tags, want)
+	}
+}
+
+func TestReadMP3_ID3v24(t *testing.T) {
+	data := id3Tag(4,
+		id3Frame(4, "TIT2", utf8Text("Título\x00Second value")),
+		id3Frame(4, "TPE1", utf8Text("Artist")),
+		id3Frame(4, "TDRC", utf8Text("2004-05-01")),
+		id3Frame(4, "TCON", utf8Text("Electronic")),
+		id3Frame(4, "TXXX", utf8Text("MusicBrainz Track Id\x00track-id")),
+	)
+	data = append(data, mpegFrames(10, 0)...)
+
+	tags, err := Read(bytes.NewReader(data), ".MP3")
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if tags.Title != "Título" {
+		t.Errorf("Title = %q, want Título", tags.Title)
+	}
+	if tags.Artist != "Artist" {
+		t.Errorf("Artist = %q, want Artist", tags.Artist)
+	}
+	if tags.Year != 2004 {
+		t.Errorf("Year = %d, want 2004", tags.Year)
+	}
+	if tags.Genre != "Electronic" {
+		t.Errorf("Genre = %q, want Electronic", tags.Genre)
+	}
+	if tags.MusicBrainzTrackID != "track-id" {
+		t.Errorf("MusicBrainzTrackID = %q, want track-id", tags.MusicBrainzTrackID)
+	}
+	// CBR: 4170 bytes at 128 kbps
+	if tags.Bitrate != 128 || tags.Duration != 260 {
+		t.Errorf("Bitrate, Duration = %d, %d, want 128, 260", tags.Bitrate, tags.Duration)
+	}
+}
+
+func TestReadMP3_ID3v22(t *testing.T) {
+	data := id3Tag(2,
+		id3v22Frame("TT2", latin1Text("Old Title")),
+		id3v22Frame("TP1", latin1Text("Old Artist")),
+		id3v22Frame("TRK", latin1Text("7")),
+	)
+	data = append(data, mpegFrames(1, 0)...)
+
+	tags, err := Read(bytes.NewReader(data), ".mp3")
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if tags.Title != "Old Title" || tags.Artist != "Old Artist" || tags.TrackNumber != 7 {
+		t.Errorf("Read() = %+v, want Old Title, Old Artist, track 7", *tags)
+	}
+}
+
+func TestReadMP3_ID3v1(t *testing.T) {
+	data := append(mpegFrames(10, 0), id3v1Tag("V1 Title", "V1 Artist", "V1 Album", "1985", 4, 8)...)
+
+	tags, err := Read(bytes.NewReader(data), ".mp3")
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+
+	want := Tags{
+		Title:       "V1 Title",
+		Artist:      "V1 Artist",
+		Album:       "V1 Album",
+		Genre:       "Jazz",
+		Comment:     "v1 comment",
+		Year:        1985,
+		TrackNumber: 4,
+		Duration:    260, // the ID3v1 tag is not counted as audio
+		Bitrate:     128,
+		SampleRate:  44100,
+	}
+	if *tags != want {
+		t.Errorf("Read() = %+v, want %+v", *tags, want)
+	}
+}
+
+func TestReadMP3_ID3v2TakesPrecedence(t *testing.T) {
+	data := id3Tag(3, id3Frame(3, "TIT2", latin1Text("V2 Title")))
+	data = append(data, mpegFrames(1, 0)...)
+	data = append(data, id3v1Tag("V1 Title", "V1 Artist", "", "", 0, 255)...)
+
+	tags, err := Read(bytes.NewReader(data), ".mp3")
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if tags.Title != "V2 Title" {
+		t.Errorf("Title = %q, want V2 Title", tags.Title)
+	}
+	if tags.Artist != "V1 Artist" {
+		t.Errorf("Artist = %q, want V1 Artist", tags.Artist)
+	}
+	if tags.Genre != "" {
+		t.Errorf("Genre = %q, want empty for genre 255", tags.Genre)
+	}
+}
+
+func TestReadMP3_Invalid(t *testing.T) {
+	if _, err := Read(bytes.NewReader([]byte("test")), ".mp3"); err == nil {
+		t.Error("Read() of a 4 byte file should return an error")
+	}
+
+	// A truncated tag must not be read past the end of the file
+	data := id3Tag(3, id3Frame(3, "TIT2", latin1Text("Title")))
+	if _, err := Read(bytes.NewReader(data[:20]), ".mp3"); err == nil {
+		t.Error("Read() of a truncated tag should return an error")
+	}
+}
+
+func TestID3Genre(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"Rock", "Rock"},
+		{"17", "Rock"},
+		{"(17)", "Rock"},
+		{"(17)Hard Rock", "Hard Rock"},
+		{"(999)", "999"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			if got := id3Genre(tt.in); got != tt.want {
+				t.Errorf("id3Genre(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRemoveUnsync(t *testing.T) {
+	got := removeUnsync([]byte{0xFF, 0x00, 0xE0, 0x01, 0xFF, 0x00, 0x00})
+	want := []byte{0xFF, 0xE0, 0x01, 0xFF, 0x00}
+	if !bytes.Equal(got, want) {
+		t.Errorf("removeUnsync() = %x, want %x", got, want)
+	}
+}
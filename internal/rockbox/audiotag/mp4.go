@@ -0,0 +1,201 @@
+package audiotag
+
+import (
+	"encoding/binary"
+	"io"
+	"strconv"
+)
+
+// maxMoovSize limits the size of the moov atom read into memory, which
+// includes embedded cover art
+const maxMoovSize = 64 << 20
+
+// mp4Containers are the atoms whose children are walked
+var mp4Containers = map[string]bool{
+	"moov": true, "trak": true, "mdia": true, "udta": true, "ilst": true,
+}
+
+// mp4Fields maps iTunes metadata atoms to tag names
+var mp4Fields = map[string]string{
+	"\xa9nam": "TITLE",
+	"\xa9ART": "ARTIST",
+	"aART":    "ALBUMARTIST",
+	"\xa9alb": "ALBUM",
+	"\xa9gen": "GENRE",
+	"\xa9wrt": "COMPOSER",
+	"\xa9cmt": "COMMENT",
+	"\xa9grp": "GROUPING",
+	"\xa9day": "DATE",
+}
+
+// mp4Atom is an atom header and its payload
+type mp4Atom struct {
+	kind string
+	data []byte
+}
+
+// readMP4 finds the moov atom of an MP4 file and reads its metadata
+func readMP4(r io.ReadSeeker, size int64) (*Tags, error) {
+	var pos int64
+	for pos+8 <= size {
+		if _, err := r.Seek(pos, io.SeekStart); err != nil {
+			return nil, err
+		}
+		header := make([]byte, 16)
+		if _, err := io.ReadFull(r, header[:8]); err != nil {
+			return nil, ErrInvalid
+		}
+		atomSize := int64(binary.BigEndian.Uint32(header))
+		kind := string(header[4:8])
+		headerSize := int64(8)
+		switch atomSize {
+		case 0:
+			atomSize = size - pos
+		case 1:
+			if _, err := io.ReadFull(r, header[8:16]); err != nil {
+				return nil, ErrInvalid
+			}
+			atomSize = int64(binary.BigEndian.Uint64(header[8:16]))
+			headerSize = 16
+		}
+		if atomSize < headerSize || pos+atomSize > size {
+			return nil, ErrInvalid
+		}
+		if pos == 0 && kind != "ftyp" {
+			return nil, ErrInvalid
+		}
+
+		if kind == "moov" {
+			if atomSize-headerSize > maxMoovSize {
+				return nil, ErrInvalid
+			}
+			moov, err := readFull(r, atomSize-headerSize)
+			if err != nil {
+				return nil, ErrInvalid
+			}
+			tags := &Tags{}
+			walkMP4(moov, tags)
+			return tags, nil
+		}
+		pos += atomSize
+	}
+	return nil, ErrInvalid
+}
+
+// splitAtoms splits a buffer into its child atoms, stopping at the first
+// malformed one
+func splitAtoms(b []byte) []mp4Atom {
+	var atoms []mp4Atom
+	for len(b) >= 8 {
+		size := int(binary.BigEndian.Uint32(b))
+		if size < 8 || size > len(b) {
+			break
+		}
+		atoms = append(atoms, mp4Atom{kind: string(b[4:8]), data: b[8:size]})
+		b = b[size:]
+	}
+	return atoms
+}
+
+// walkMP4 walks the children of a container atom
+func walkMP4(b []byte, tags *Tags) {
+	for _, atom := range splitAtoms(b) {
+		switch {
+		case atom.kind == "mvhd":
+			if tags.Duration == 0 {
+				timescale, duration := mp4Duration(atom.data, 12)
+				tags.Duration = durationMs(duration, timescale)
+			}
+		case atom.kind == "mdhd":
+			// audio tracks use the sample rate as their timescale
+			if tags.SampleRate == 0 {
+				timescale, _ := mp4Duration(atom.data, 12)
+				tags.SampleRate = int(timescale)
+			}
+		case atom.kind == "minf" || atom.kind == "stbl":
+			// no metadata below these
+		case atom.kind == "meta":
+			walkMP4(metaChildren(atom.data), tags)
+		case mp4Containers[atom.kind]:
+			walkMP4(atom.data, tags)
+		default:
+			applyMP4Item(atom, tags)
+		}
+	}
+}
+
+// metaChildren returns the children of a meta atom, which is a full atom in
+// MP4 files but a plain container in QuickTime files
+func metaChildren(b []byte) []byte {
+	if len(b) >= 8 && string(b[4:8]) == "hdlr" {
+		return b
+	}
+	if len(b) < 4 {
+		return nil
+	}
+	return b[4:]
+}
+
+// mp4Duration reads the timescale and duration of an mvhd or mdhd atom;
+// offset is where the timescale starts in version 0 atoms
+func mp4Duration(b []byte, offset int) (int64, int64) {
+	if len(b) < 4 {
+		return 0, 0
+	}
+	if b[0] == 1 {
+		if len(b) < 32 {
+			return 0, 0
+		}
+		return int64(binary.BigEndian.Uint32(b[20:24])), int64(binary.BigEndian.Uint64(b[24:32]))
+	}
+	if len(b) < offset+8 {
+		return 0, 0
+	}
+	return int64(binary.BigEndian.Uint32(b[offset:])), int64(binary.BigEndian.Uint32(b[offset+4:]))
+}
+
+// applyMP4Item stores an ilst item in tags
+func applyMP4Item(item mp4Atom, tags *Tags) {
+	var name, value []byte
+	var haveValue bool
+	for _, child := range splitAtoms(item.data) {
+		switch child.kind {
+		case "name":
+			if len(child.data) >= 4 {
+				name = child.data[4:]
+			}
+		case "data":
+			// 4 bytes type, 4 bytes locale
+			if len(child.data) >= 8 && !haveValue {
+				value, haveValue = child.data[8:], true
+			}
+		}
+	}
+	if !haveValue {
+		return
+	}
+
+	switch item.kind {
+	case "trkn", "disk":
+		// 2 bytes reserved, 2 bytes number, 2 bytes total
+		if len(value) >= 4 {
+			n := int(binary.BigEndian.Uint16(value[2:4]))
+			if item.kind == "trkn" {
+				tags.set("TRACKNUMBER", strconv.Itoa(n))
+			} else {
+				tags.set("DISCNUMBER", strconv.Itoa(n))
+			}
+		}
+	case "gnre":
+		// ID3v1 genre number plus one
+		if len(value) >= 2 {
+			tags.set("GENRE", genreName(int(binary.BigEndian.Uint16(value))-1))
+		}
+	case "----":
+		tags.set(string(name), string(value))
+	default:
+		if field, ok := mp4Fields[item.kind]; ok {
+			tags.set(field, string(value))
+		}
+	}
+}
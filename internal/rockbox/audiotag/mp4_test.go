@@ -0,0 +1,144 @@
+package audiotag
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// atom builds an MP4 atom from its children or payload
+func atom(kind string, payload ...[]byte) []byte {
+	body := bytes.Join(payload, nil)
+	header := make([]byte, 8)
+	binary.BigEndian.PutUint32(header, uint32(8+len(body)))
+	copy(header[4:], kind)
+	return append(header, body...)
+}
+
+// dataAtom builds an ilst data atom with the given well-known type
+func dataAtom(kind uint32, value []byte) []byte {
+	header := make([]byte, 8)
+	binary.BigEndian.PutUint32(header, kind)
+	return atom("data", header, value)
+}
+
+// textItem builds an ilst item holding UTF-8 text
+func textItem(kind, value string) []byte {
+	return atom(kind, dataAtom(1, []byte(value)))
+}
+
+// freeformItem builds an iTunes "----" item
+func freeformItem(name, value string) []byte {
+	return atom("----",
+		atom("mean", make([]byte, 4), []byte("com.apple.iTunes")),
+		atom("name", make([]byte, 4), []byte(name)),
+		dataAtom(1, []byte(value)),
+	)
+}
+
+// timeAtom builds a version 0 mvhd or mdhd atom
+func timeAtom(kind string, timescale, duration uint32) []byte {
+	b := make([]byte, 20)
+	binary.BigEndian.PutUint32(b[12:], timescale)
+	binary.BigEndian.PutUint32(b[16:], duration)
+	return atom(kind, b)
+}
+
+// m4aFile builds an M4A file with the moov atom after the media data
+func m4aFile(items ...[]byte) []byte {
+	hdlr := atom("hdlr", make([]byte, 8), []byte("mdirappl"), make([]byte, 13))
+	moov := atom("moov",
+		timeAtom("mvhd", 1000, 4500),
+		atom("trak", atom("mdia", timeAtom("mdhd", 44100, 198450))),
+		atom("udta", atom("meta", make([]byte, 4), hdlr, atom("ilst", items...))),
+	)
+	return bytes.Join([][]byte{
+		atom("ftyp", []byte("M4A \x00\x00\x00\x00")),
+		atom("mdat", make([]byte, 45000)),
+		moov,
+	}, nil)
+}
+
+func TestReadMP4(t *testing.T) {
+	data := m4aFile(
+		textItem("\xa9nam", "M4A Title"),
+		textItem("\xa9ART", "M4A Artist"),
+		textItem("aART", "M4A Album Artist"),
+		textItem("\xa9alb", "M4A Album"),
+		atom("gnre", dataAtom(0, []byte{0, 19})),
+		textItem("\xa9wrt", "M4A Composer"),
+		textItem("\xa9cmt", "M4A Comment"),
+		textItem("\xa9grp", "M4A Grouping"),
+		textItem("\xa9day", "2019-06-01T07:00:00Z"),
+		atom("trkn", dataAtom(0, []byte{0, 0, 0, 9, 0, 12, 0, 0})),
+		atom("disk", dataAtom(0, []byte{0, 0, 0, 2, 0, 2})),
+		freeformItem("MusicBrainz Track Id", "m4a-track-id"),
+		freeformItem("MusicBrainz Album Id", "m4a-album-id"),
+		freeformItem("MusicBrainz Artist Id", "m4a-artist-id"),
+		atom("covr", dataAtom(13, make([]byte, 64))),
+	)
+
+	tags, err := Read(bytes.NewReader(data), ".m4a")
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+
+	want := Tags{
+		Title:               "M4A Title",
+		Artist:              "M4A Artist",
+		AlbumArtist:         "M4A Album Artist",
+		Album:               "M4A Album",
+		Genre:               "Techno",
+		Composer:            "M4A Composer",
+		Comment:             "M4A Comment",
+		Grouping:            "M4A Grouping",
+		Year:                2019,
+		TrackNumber:         9,
+		DiscNumber:          2,
+		Duration:            4500,
+		Bitrate:             int(int64(len(data)) * 8 / 4500),
+		SampleRate:          44100,
+		MusicBrainzTrackID:  "m4a-track-id",
+		MusicBrainzAlbumID:  "m4a-album-id",
+		MusicBrainzArtistID: "m4a-artist-id",
+	}
+	if *tags != want {
+		t.Errorf("Read() = %+v, want %+v", *tags, want)
+	}
+}
+
+func TestReadMP4_QuickTimeMeta(t *testing.T) {
+	// QuickTime files have a meta atom without version and flags
+	hdlr := atom("hdlr", make([]byte, 8), []byte("mdta"))
+	data := bytes.Join([][]byte{
+		atom("ftyp", []byte("qt  ")),
+		atom("moov", atom("udta", atom("meta", hdlr, atom("ilst", textItem("\xa9nam", "QT Title"))))),
+	}, nil)
+
+	tags, err := Read(bytes.NewReader(data), ".mp4")
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if tags.Title != "QT Title" {
+		t.Errorf("Title = %q, want QT Title", tags.Title)
+	}
+}
+
+func TestReadMP4_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"too short", []byte("test")},
+		{"no ftyp", atom("moov")},
+		{"no moov", atom("ftyp", []byte("M4A "))},
+		{"atom past end", append(atom("ftyp", []byte("M4A ")), 0, 0, 1, 0, 'm', 'o', 'o', 'v')},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Read(bytes.NewReader(tt.data), ".m4a"); err == nil {
+				t.Error("Read() should return an error")
+			}
+		})
+	}
+}
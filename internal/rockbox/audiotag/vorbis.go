@@ -0,0 +1,241 @@
+package audiotag
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strings"
+)
+
+const (
+	flacStreamInfo    = 0
+	flacVorbisComment = 4
+	// oggTailSize is how much of the end of an Ogg file is searched for the
+	// last page, whose granule position gives the duration
+	oggTailSize = 64 << 10
+	// oggMaxHeaderBytes limits how much is read to find the header packets
+	oggMaxHeaderBytes = 32 << 20
+	opusSampleRate    = 48000
+)
+
+// parseVorbisComments parses a Vorbis comment block (without framing)
+func parseVorbisComments(b []byte, tags *Tags) {
+	next := func() ([]byte, bool) {
+		if len(b) < 4 {
+			return nil, false
+		}
+		n := binary.LittleEndian.Uint32(b)
+		if uint64(n) > uint64(len(b)-4) {
+			return nil, false
+		}
+		field := b[4 : 4+n]
+		b = b[4+n:]
+		return field, true
+	}
+
+	if _, ok := next(); !ok { // vendor string
+		return
+	}
+	if len(b) < 4 {
+		return
+	}
+	count := binary.LittleEndian.Uint32(b)
+	b = b[4:]
+	for i := uint32(0); i < count; i++ {
+		field, ok := next()
+		if !ok {
+			return
+		}
+		key, value, ok := strings.Cut(string(field), "=")
+		if !ok {
+			continue
+		}
+		tags.set(key, value)
+	}
+}
+
+// readFLAC reads the STREAMINFO and VORBIS_COMMENT blocks of a FLAC file
+func readFLAC(r io.ReadSeeker, size int64) (*Tags, error) {
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != "fLaC" {
+		return nil, ErrInvalid
+	}
+
+	tags := &Tags{}
+	header := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return nil, ErrInvalid
+		}
+		last := header[0]&0x80 != 0
+		blockType := header[0] & 0x7F
+		length := int64(header[1])<<16 | int64(header[2])<<8 | int64(header[3])
+
+		switch blockType {
+		case flacStreamInfo, flacVorbisComment:
+			block, err := readFull(r, length)
+			if err != nil {
+				return nil, ErrInvalid
+			}
+			if blockType == flacVorbisComment {
+				parseVorbisComments(block, tags)
+			} else if len(block) >= 18 {
+				// 20 bits sample rate, 3 bits channels, 5 bits bits per
+				// sample, 36 bits total samples
+				v := binary.BigEndian.Uint64(block[10:18])
+				tags.SampleRate = int(v >> 44)
+				samples := int64(v & 0xFFFFFFFFF)
+				tags.Duration = durationMs(samples, int64(tags.SampleRate))
+			}
+		default:
+			if _, err := r.Seek(length, io.SeekCurrent); err != nil {
+				return nil, err
+			}
+		}
+
+		if last {
+			break
+		}
+	}
+
+	if tags.Duration > 0 {
+		pos, err := r.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, err
+		}
+		tags.Bitrate = int((size - pos) * 8 / int64(tags.Duration))
+	}
+	return tags, nil
+}
+
+// oggPage is the header of an Ogg page
+type oggPage struct {
+	headerType byte
+	granule    int64
+	serial     uint32
+	segments   []byte
+}
+
+// readOggPage reads the header of the next Ogg page
+func readOggPage(r io.Reader) (*oggPage, error) {
+	header := make([]byte, 27)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	if string(header[:4]) != "OggS" {
+		return nil, ErrInvalid
+	}
+	page := &oggPage{
+		headerType: header[5],
+		granule:    int64(binary.LittleEndian.Uint64(header[6:14])),
+		serial:     binary.LittleEndian.Uint32(header[14:18]),
+		segments:   make([]byte, header[26]),
+	}
+	if _, err := io.ReadFull(r, page.segments); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// readOggPackets reads the first n packets of the first logical stream
+func readOggPackets(r io.Reader, n int) ([][]byte, error) {
+	var packets [][]byte
+	var current []byte
+	var serial uint32
+	total := 0
+
+	for first := true; len(packets) < n; first = false {
+		page, err := readOggPage(r)
+		if err != nil {
+			return nil, ErrInvalid
+		}
+		if first {
+			serial = page.serial
+		}
+
+		for _, seg := range page.segments {
+			data, err := readFull(r, int64(seg))
+			if err != nil {
+				return nil, ErrInvalid
+			}
+			if page.serial != serial {
+				continue // interleaved stream
+			}
+			total += len(data)
+			if total > oggMaxHeaderBytes {
+				return nil, ErrInvalid
+			}
+			current = append(current, data...)
+			if seg < 255 {
+				packets = append(packets, current)
+				current = nil
+				if len(packets) == n {
+					break
+				}
+			}
+		}
+	}
+	return packets, nil
+}
+
+// readOgg reads the comment header and duration of an Ogg Vorbis or Opus file
+func readOgg(r io.ReadSeeker, size int64) (*Tags, error) {
+	packets, err := readOggPackets(r, 2)
+	if err != nil {
+		return nil, err
+	}
+	ident, comments := packets[0], packets[1]
+
+	tags := &Tags{}
+	var preSkip int64
+	var rate int64
+	switch {
+	case len(ident) >= 16 && string(ident[:7]) == "\x01vorbis":
+		rate = int64(binary.LittleEndian.Uint32(ident[12:16]))
+		tags.SampleRate = int(rate)
+		if bytes.HasPrefix(comments, []byte("\x03vorbis")) {
+			parseVorbisComments(comments[7:], tags)
+		}
+	case len(ident) >= 16 && string(ident[:8]) == "OpusHead":
+		rate = opusSampleRate
+		preSkip = int64(binary.LittleEndian.Uint16(ident[10:12]))
+		tags.SampleRate = int(binary.LittleEndian.Uint32(ident[12:16]))
+		if bytes.HasPrefix(comments, []byte("OpusTags")) {
+			parseVorbisComments(comments[8:], tags)
+		}
+	default:
+		return nil, ErrInvalid
+	}
+
+	granule, err := lastGranule(r, size)
+	if err != nil {
+		return nil, err
+	}
+	tags.Duration = durationMs(granule-preSkip, rate)
+	return tags, nil
+}
+
+// lastGranule returns the granule position of the last Ogg page
+func lastGranule(r io.ReadSeeker, size int64) (int64, error) {
+	start := size - oggTailSize
+	if start < 0 {
+		start = 0
+	}
+	if _, err := r.Seek(start, io.SeekStart); err != nil {
+		return 0, err
+	}
+	tail := make([]byte, size-start)
+	if _, err := io.ReadFull(r, tail); err != nil {
+		return 0, err
+	}
+
+	for i := bytes.LastIndex(tail, []byte("OggS")); i >= 0; i = bytes.LastIndex(tail[:i], []byte("OggS")) {
+		if i+14 <= len(tail) {
+			granule := int64(binary.LittleEndian.Uint64(tail[i+6 : i+14]))
+			if granule >= 0 {
+				return granule, nil
+			}
+		}
+	}
+	return 0, nil
+}
@@ -0,0 +1,207 @@
+package audiotag
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// vorbisComments builds a Vorbis comment block
+func vorbisComments(comments ...string) []byte {
+	var b bytes.Buffer
+	le := func(n int) { _ = binary.Write(&b, binary.LittleEndian, uint32(n)) }
+	le(len("rocklist"))
+	b.WriteString("rocklist")
+	le(len(comments))
+	for _, c := range comments {
+		le(len(c))
+		b.WriteString(c)
+	}
+	return b.Bytes()
+}
+
+// flacFile builds a FLAC file with STREAMINFO, PADDING and VORBIS_COMMENT
+// blocks followed by audioBytes of audio data
+func flacFile(sampleRate, samples uint64, audioBytes int, comments ...string) []byte {
+	var b bytes.Buffer
+	b.WriteString("fLaC")
+	block := func(kind byte, last bool, data []byte) {
+		if last {
+			kind |= 0x80
+		}
+		n := len(data)
+		b.Write([]byte{kind, byte(n >> 16), byte(n >> 8), byte(n)})
+		b.Write(data)
+	}
+
+	streamInfo := make([]byte, 34)
+	// sample rate (20 bits), channels - 1 (3 bits), bits per sample - 1
+	// (5 bits), total samples (36 bits)
+	binary.BigEndian.PutUint64(streamInfo[10:], sampleRate<<44|1<<41|15<<36|samples)
+	block(flacStreamInfo, false, streamInfo)
+	block(1, false, make([]byte, 8))
+	block(flacVorbisComment, true, vorbisComments(comments...))
+	b.Write(make([]byte, audioBytes))
+	return b.Bytes()
+}
+
+// oggPageBytes builds an Ogg page holding whole packets
+func oggPageBytes(granule int64, serial uint32, packets ...[]byte) []byte {
+	var segments []byte
+	var body []byte
+	for _, p := range packets {
+		n := len(p)
+		for n >= 255 {
+			segments = append(segments, 255)
+			n -= 255
+		}
+		segments = append(segments, byte(n))
+		body = append(body, p...)
+	}
+	return buildOggPage(granule, serial, segments, body)
+}
+
+// oggPartialPage builds an Ogg page holding the start of a packet that
+// continues on the next page; len(data) must be a multiple of 255
+func oggPartialPage(serial uint32, data []byte) []byte {
+	segments := bytes.Repeat([]byte{255}, len(data)/255)
+	return buildOggPage(-1, serial, segments, data)
+}
+
+// buildOggPage assembles an Ogg page from its segment table and body
+func buildOggPage(granule int64, serial uint32, segments, body []byte) []byte {
+	header := make([]byte, 27)
+	copy(header, "OggS")
+	binary.LittleEndian.PutUint64(header[6:], uint64(granule))
+	binary.LittleEndian.PutUint32(header[14:], serial)
+	header[26] = byte(len(segments))
+	return append(append(header, segments...), body...)
+}
+
+func TestReadFLAC(t *testing.T) {
+	// 3 seconds at 44.1 kHz
+	data := flacFile(44100, 132300, 30000,
+		"TITLE=Flac Title",
+		"artist=Flac Artist",
+		"ALBUMARTIST=Album Artist",
+		"ALBUM=Flac Album",
+		"GENRE=Ambient",
+		"DATE=2011-02-03",
+		"TRACKNUMBER=05/10",
+		"DISCNUMBER=1",
+		"COMPOSER=Flac Composer",
+		"COMMENT=Flac Comment",
+		"GROUPING=Flac Grouping",
+		"MUSICBRAINZ_TRACKID=flac-track-id",
+		"MUSICBRAINZ_ALBUMID=flac-album-id",
+		"MUSICBRAINZ_ARTISTID=flac-artist-id",
+		"NOT A COMMENT",
+	)
+
+	tags, err := Read(bytes.NewReader(data), ".flac")
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+
+	want := Tags{
+		Title:               "Flac Title",
+		Artist:              "Flac Artist",
+		AlbumArtist:         "Album Artist",
+		Album:               "Flac Album",
+		Genre:               "Ambient",
+		Composer:            "Flac Composer",
+		Comment:             "Flac Comment",
+		Grouping:            "Flac Grouping",
+		Year:                2011,
+		TrackNumber:         5,
+		DiscNumber:          1,
+		Duration:            3000,
+		Bitrate:             80, // 30000 bytes over 3 seconds
+		SampleRate:          44100,
+		MusicBrainzTrackID:  "flac-track-id",
+		MusicBrainzAlbumID:  "flac-album-id",
+		MusicBrainzArtistID: "flac-artist-id",
+	}
+	if *tags != want {
+		t.Errorf("Read() = %+v, want %+v", *tags, want)
+	}
+}
+
+func TestReadFLAC_Invalid(t *testing.T) {
+	if _, err := Read(bytes.NewReader([]byte("test")), ".flac"); err == nil {
+		t.Error("Read() of a non-FLAC file should return an error")
+	}
+
+	data := flacFile(44100, 0, 0, "TITLE=x")
+	if _, err := Read(bytes.NewReader(data[:50]), ".flac"); err == nil {
+		t.Error("Read() of a truncated FLAC file should return an error")
+	}
+}
+
+func TestReadOgg_Vorbis(t *testing.T) {
+	ident := make([]byte, 30)
+	copy(ident, "\x01vorbis")
+	binary.LittleEndian.PutUint32(ident[12:], 48000)
+
+	// the comment packet spans two pages
+	longComment := "COMMENT=" + string(bytes.Repeat([]byte("x"), 300))
+	comments := append([]byte("\x03vorbis"), vorbisComments("TITLE=Ogg Title", "ARTIST=Ogg Artist", longComment)...)
+	comments = append(comments, 1) // framing bit
+
+	var data []byte
+	data = append(data, oggPageBytes(0, 1, ident)...)
+	data = append(data, oggPartialPage(1, comments[:255])...)
+	data = append(data, oggPageBytes(0, 1, comments[255:])...)
+	data = append(data, oggPageBytes(96000, 1, make([]byte, 100))...)
+	data = append(data, oggPageBytes(240000, 1, make([]byte, 100))...)
+
+	tags, err := Read(bytes.NewReader(data), ".ogg")
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if tags.Title != "Ogg Title" || tags.Artist != "Ogg Artist" {
+		t.Errorf("Title, Artist = %q, %q, want Ogg Title, Ogg Artist", tags.Title, tags.Artist)
+	}
+	if len(tags.Comment) != 300 {
+		t.Errorf("len(Comment) = %d, want 300", len(tags.Comment))
+	}
+	if tags.SampleRate != 48000 || tags.Duration != 5000 {
+		t.Errorf("SampleRate, Duration = %d, %d, want 48000, 5000", tags.SampleRate, tags.Duration)
+	}
+}
+
+func TestReadOgg_Opus(t *testing.T) {
+	head := make([]byte, 19)
+	copy(head, "OpusHead")
+	head[8] = 1
+	binary.LittleEndian.PutUint16(head[10:], 312)
+	binary.LittleEndian.PutUint32(head[12:], 44100)
+	tagsPacket := append([]byte("OpusTags"), vorbisComments("TITLE=Opus Title", "TRACKNUMBER=2")...)
+
+	var data []byte
+	data = append(data, oggPageBytes(0, 7, head)...)
+	data = append(data, oggPageBytes(0, 7, tagsPacket)...)
+	data = append(data, oggPageBytes(48000*2+312, 7, make([]byte, 100))...)
+
+	tags, err := Read(bytes.NewReader(data), ".opus")
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if tags.Title != "Opus Title" || tags.TrackNumber != 2 {
+		t.Errorf("Title, TrackNumber = %q, %d, want Opus Title, 2", tags.Title, tags.TrackNumber)
+	}
+	if tags.SampleRate != 44100 || tags.Duration != 2000 {
+		t.Errorf("SampleRate, Duration = %d, %d, want 44100, 2000", tags.SampleRate, tags.Duration)
+	}
+}
+
+func TestReadOgg_Invalid(t *testing.T) {
+	if _, err := Read(bytes.NewReader([]byte("test")), ".ogg"); err == nil {
+		t.Error("Read() of a non-Ogg file should return an error")
+	}
+
+	data := oggPageBytes(0, 1, []byte("\x01notvorbis-padding-padding"), []byte("x"))
+	if _, err := Read(bytes.NewReader(data), ".ogg"); err == nil {
+		t.Error("Read() of an unknown Ogg codec should return an error")
+	}
+}
@@ -0,0 +1,340 @@
+package rockbox
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Ardakilic/rocklist/internal/models"
+)
+
+const (
+	// ChangelogFile is the text export of the database written by
+	// "Export Modifications" on the device
+	ChangelogFile = "database_changelog.txt"
+	// changelogHeader is the first line of a changelog written by tagcache.c
+	changelogHeader = "## Changelog version 1"
+)
+
+// changelogTags are the tags WriteChangelog emits. Rockbox only imports
+// playcount, rating, playtime, lastplayed, commitid, lastelapsed and
+// lastoffset, matched by filename; tags Rocklist does not track are left
+// out so the import keeps the device's values.
+var changelogTags = []TagType{
+	TagArtist, TagAlbum, TagGenre, TagTitle, TagFilename, TagComposer,
+	TagComment, TagAlbumArtist, TagGrouping, TagYear, TagDiscNumber,
+	TagTrackNumber, TagBitrate, TagLength, TagPlayCount, TagRating,
+	TagLastPlayed,
+}
+
+// ChangelogEntry holds the tags of one line of database_changelog.txt
+type ChangelogEntry map[TagType]string
+
+// readChangelog reads all entries from a database changelog.
+// Each line holds one entry written as tag="value" pairs, with '"' and '\'
+// escaped by a backslash and newlines written as \n. Unknown tags are ignored.
+func readChangelog(r io.Reader) ([]ChangelogEntry, error) {
+	var entries []ChangelogEntry
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		entry, err := parseChangelogLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("changelog line %d: %w", lineNo, err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read changelog: %w", err)
+	}
+
+	return entries, nil
+}
+
+// parseChangelogLine decodes the tag="value" pairs of a single changelog line
+func parseChangelogLine(line string) (ChangelogEntry, error) {
+	entry := make(ChangelogEntry)
+
+	i := 0
+	for {
+		for i < len(line) && line[i] == ' ' {
+			i++
+		}
+		if i >= len(line) {
+			return entry, nil
+		}
+
+		eq := strings.Index(line[i:], "=\"")
+		if eq <= 0 {
+			return nil, fmt.Errorf("expected tag=\"value\" at column %d", i+1)
+		}
+		name := line[i : i+eq]
+		i += eq + 2
+
+		var value strings.Builder
+		closed := false
+		for i < len(line) {
+			c := line[i]
+			i++
+			if c == '"' {
+				closed = true
+				break
+			}
+			if c == '\\' && i < len(line) {
+				c = line[i]
+				i++
+				if c == 'n' {
+					c = '\n'
+				}
+			}
+			value.WriteByte(c)
+		}
+		if !closed {
+			return nil, fmt.Errorf("unterminated value for tag %q", name)
+		}
+
+		if tag, ok := tagByName(name); ok {
+			entry[tag] = value.String()
+		}
+	}
+}
+
+// indexEntry converts the numeric tags of a changelog entry into an index entry
+func (e ChangelogEntry) indexEntry() *IndexEntry {
+	entry := &IndexEntry{}
+	for tag := stringTagCount; tag < TagCount; tag++ {
+		if v, err := strconv.ParseInt(e[TagType(tag)], 10, 64); err == nil {
+			entry.TagSeek[tag] = int32(v)
+		}
+	}
+	return entry
+}
+
+// readChangelogEntries builds songs from .rockbox/database_changelog.txt
+func (p *Parser) readChangelogEntries(ctx context.Context, fsys fs.FS) ([]*models.Song, error) {
+	file, err := fsys.Open(path.Join(TagCacheDir, ChangelogFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open changelog: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	entries, err := readChangelog(file)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, errors.New("changelog contains no entries")
+	}
+
+	p.logger.Info("Database changelog: %d entries", len(entries))
+
+	// The changelog has no master header, so the most recent lastplayed
+	// counter stands in for the serial and the export time for the anchor
+	indexEntries := make([]*IndexEntry, len(entries))
+	clock := &playClock{}
+	for i, entry := range entries {
+		indexEntries[i] = entry.indexEntry()
+		if lp := indexEntries[i].TagSeek[TagLastPlayed]; lp >= clock.serial {
+			clock.serial = lp + 1
+		}
+	}
+	if info, err := file.Stat(); err == nil {
+		clock.anchor = info.ModTime()
+	}
+
+	songs := make([]*models.Song, 0, len(entries))
+	for i, entry := range entries {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+
+		lookup := func(tag TagType) string { return entry[tag] }
+		song := p.buildSong(indexEntries[i], lookup, clock)
+
+		// Only add songs with valid paths
+		if song.Path != "" {
+			songs = append(songs, song)
+		}
+	}
+
+	return songs, nil
+}
+
+// changelogValue returns the changelog value of a tag for a song
+func changelogValue(song *models.Song, tag TagType) string {
+	switch tag {
+	case TagArtist:
+		return song.Artist
+	case TagAlbum:
+		return song.Album
+	case TagGenre:
+		return song.Genre
+	case TagTitle:
+		return song.Title
+	case TagFilename:
+		return song.Path
+	case TagComposer:
+		return song.Composer
+	case TagComment:
+		return song.Comment
+	case TagAlbumArtist:
+		return song.AlbumArtist
+	case TagGrouping:
+		return song.Grouping
+	case TagYear:
+		return strconv.Itoa(song.Year)
+	case TagDiscNumber:
+		return strconv.Itoa(song.DiscNumber)
+	case TagTrackNumber:
+		return strconv.Itoa(song.TrackNumber)
+	case TagBitrate:
+		return strconv.Itoa(song.Bitrate)
+	case TagLength:
+		return strconv.Itoa(song.Duration * 1000)
+	case TagPlayCount:
+		return strconv.Itoa(song.PlayCount)
+	case TagRating:
+		return strconv.Itoa(song.Rating)
+	case TagLastPlayed:
+		return strconv.Itoa(song.LastPlayedSerial)
+	}
+	return ""
+}
+
+// escapeChangelogValue escapes a value the way write_tag() in tagcache.c does
+func escapeChangelogValue(v string) string {
+	var b strings.Builder
+	for i := 0; i < len(v); i++ {
+		switch v[i] {
+		case '"', '\\':
+			b.WriteByte('\\')
+			b.WriteByte(v[i])
+		case '\n':
+			b.WriteString(`\n`)
+		default:
+			b.WriteByte(v[i])
+		}
+	}
+	return b.String()
+}
+
+// WriteChangelog writes songs as a database changelog that Rockbox imports
+// on its next database initialisation. Songs without a path are skipped.
+func WriteChangelog(w io.Writer, songs []*models.Song) error {
+	return writeChangelogEntries(w, mergeChangelog(nil, songs))
+}
+
+// writeChangelogEntries writes entries as a database changelog, with the
+// tags Rocklist writes first and any other tags after them
+func writeChangelogEntries(w io.Writer, entries []ChangelogEntry) error {
+	bw := bufio.NewWriter(w)
+	if _, err := bw.WriteString(changelogHeader + "\n"); err != nil {
+		return err
+	}
+
+	written := make(map[TagType]bool, len(changelogTags))
+	for _, tag := range changelogTags {
+		written[tag] = true
+	}
+	for _, entry := range entries {
+		for _, tag := range changelogTags {
+			if _, err := fmt.Fprintf(bw, "%s=\"%s\" ", tag, escapeChangelogValue(entry[tag])); err != nil {
+				return err
+			}
+		}
+		for tag := TagType(0); tag < TagTagCount; tag++ {
+			value, ok := entry[tag]
+			if !ok || written[tag] {
+				continue
+			}
+			if _, err := fmt.Fprintf(bw, "%s=\"%s\" ", tag, escapeChangelogValue(value)); err != nil {
+				return err
+			}
+		}
+		if err := bw.WriteByte('\n'); err != nil {
+			return err
+		}
+	}
+
+	return bw.Flush()
+}
+
+// mergeChangelog sets the tags of songs on the entries with the same
+// filename, keeping their other tags, and appends the songs without an
+// entry. Songs without a path are skipped.
+func mergeChangelog(entries []ChangelogEntry, songs []*models.Song) []ChangelogEntry {
+	byPath := make(map[string]ChangelogEntry, len(entries))
+	for _, entry := range entries {
+		byPath[entry[TagFilename]] = entry
+	}
+
+	for _, song := range songs {
+		if song.Path == "" {
+			continue
+		}
+		entry, ok := byPath[song.Path]
+		if !ok {
+			entry = make(ChangelogEntry, len(changelogTags))
+			byPath[song.Path] = entry
+			entries = append(entries, entry)
+		}
+		for _, tag := range changelogTags {
+			entry[tag] = changelogValue(song, tag)
+		}
+	}
+	return entries
+}
+
+// WriteChangelogFile merges songs into .rockbox/database_changelog.txt under
+// rockboxPath and returns the file path. Songs replace the entries with the
+// same filename and other entries are kept, so a changelog exported from the
+// device stays a complete export of its library. The previous changelog is
+// kept as database_changelog.txt.bak.
+func WriteChangelogFile(rockboxPath string, songs []*models.Song) (string, error) {
+	path := filepath.Join(rockboxPath, TagCacheDir, ChangelogFile)
+
+	var entries []ChangelogEntry
+	if existing, err := os.Open(path); err == nil {
+		entries, err = readChangelog(existing)
+		_ = existing.Close()
+		if err != nil {
+			return "", fmt.Errorf("failed to read existing changelog: %w", err)
+		}
+		if err := os.Rename(path, path+".bak"); err != nil {
+			return "", fmt.Errorf("failed to back up existing changelog: %w", err)
+		}
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to create changelog: %w", err)
+	}
+
+	if err := writeChangelogEntries(file, mergeChangelog(entries, songs)); err != nil {
+		_ = file.Close()
+		return "", fmt.Errorf("failed to write changelog: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return "", fmt.Errorf("failed to write changelog: %w", err)
+	}
+
+	return path, nil
+}
@@ -0,0 +1,269 @@
+package rockbox
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Ardakilic/rocklist/internal/models"
+)
+
+const testChangelog = `## Changelog version 1
+artist="Metallica" album="Master of Puppets" genre="Thrash Metal" title="Battery" filename="/Music/Metallica/01 - Battery.mp3" composer="<Untagged>" comment="" albumartist="Metallica" grouping="" year="1986" discnumber="1" tracknumber="1" bitrate="320" length="312000" playcount="12" rating="8" playtime="3744000" lastplayed="41" commitid="2" mtime="0" lastelapsed="95000" lastoffset="3801088" 
+artist="Sigur Rós" album="( )" genre="Post-Rock" title="Say \"Hi\"\\Bye" filename="/Music/Sigur Rós/01 - Untitled.flac" comment="line one\nline two" year="2002" tracknumber="1" length="398000" playcount="3" lastplayed="42" unknowntag="ignored" 
+`
+
+func TestReadChangelog(t *testing.T) {
+	entries, err := readChangelog(strings.NewReader(testChangelog))
+	if err != nil {
+		t.Fatalf("readChangelog() error = %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("readChangelog() returned %d entries, want 2", len(entries))
+	}
+
+	if entries[0][TagArtist] != "Metallica" {
+		t.Errorf("entries[0] artist = %q, want Metallica", entries[0][TagArtist])
+	}
+	if entries[0][TagLastOffset] != "3801088" {
+		t.Errorf("entries[0] lastoffset = %q, want 3801088", entries[0][TagLastOffset])
+	}
+	if entries[1][TagTitle] != `Say "Hi"\Bye` {
+		t.Errorf("entries[1] title = %q, want escapes decoded", entries[1][TagTitle])
+	}
+	if entries[1][TagComment] != "line one\nline two" {
+		t.Errorf("entries[1] comment = %q, want newline decoded", entries[1][TagComment])
+	}
+	if len(entries[1]) != 11 {
+		t.Errorf("entries[1] has %d tags, want 11 without the unknown tag", len(entries[1]))
+	}
+}
+
+func TestParseChangelogLine_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+	}{
+		{"missing quotes", `artist=Metallica`},
+		{"missing name", `="Metallica"`},
+		{"unterminated value", `artist="Metallica`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseChangelogLine(tt.line); err == nil {
+				t.Errorf("parseChangelogLine(%q) expected error", tt.line)
+			}
+		})
+	}
+}
+
+func TestReadChangelog_InvalidLine(t *testing.T) {
+	_, err := readChangelog(strings.NewReader("## Changelog version 1\nartist=\"x\" title=\"y\n"))
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("readChangelog() error = %v, want error mentioning line 2", err)
+	}
+}
+
+func TestTagType_String(t *testing.T) {
+	if TagAlbumArtist.String() != "albumartist" {
+		t.Errorf("TagAlbumArtist.String() = %q, want albumartist", TagAlbumArtist.String())
+	}
+	if TagLastOffset.String() != "lastoffset" {
+		t.Errorf("TagLastOffset.String() = %q, want lastoffset", TagLastOffset.String())
+	}
+	if TagTagCount.String() != "TagType(22)" {
+		t.Errorf("TagTagCount.String() = %q, want TagType(22)", TagTagCount.String())
+	}
+
+	for tag := TagArtist; tag < TagTagCount; tag++ {
+		got, ok := tagByName(tag.String())
+		if !ok || got != tag {
+			t.Errorf("tagByName(%q) = %v, %v, want %v", tag.String(), got, ok, tag)
+		}
+	}
+}
+
+// writeChangelogFixture writes a .rockbox directory holding only a changelog
+func writeChangelogFixture(t *testing.T, root, content string) {
+	t.Helper()
+
+	rockboxDir := filepath.Join(root, TagCacheDir)
+	if err := os.MkdirAll(rockboxDir, 0755); err != nil {
+		t.Fatalf("Failed to create test dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(rockboxDir, ChangelogFile), []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write changelog: %v", err)
+	}
+}
+
+func TestParser_Parse_Changelog(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeChangelogFixture(t, tmpDir, testChangelog)
+
+	// Audio files on disk must not be picked up by the filename fallback
+	_ = os.WriteFile(filepath.Join(tmpDir, "Other - Song.mp3"), []byte("fake"), 0644)
+
+	parser := NewParser(tmpDir, &mockLogger{})
+	if err := parser.ValidatePath(); err != nil {
+		t.Fatalf("ValidatePath() error = %v, want nil with only a changelog", err)
+	}
+
+	songs, err := parser.Parse(context.Background())
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if len(songs) != 2 {
+		t.Fatalf("Parse() returned %d songs, want 2", len(songs))
+	}
+
+	got := songs[0]
+	if got.Path != "/Music/Metallica/01 - Battery.mp3" {
+		t.Errorf("Path = %q", got.Path)
+	}
+	if got.Album != "Master of Puppets" || got.AlbumArtist != "Metallica" || got.Genre != "Thrash Metal" {
+		t.Errorf("string tags = %q/%q/%q", got.Album, got.AlbumArtist, got.Genre)
+	}
+	if got.Year != 1986 || got.TrackNumber != 1 || got.Duration != 312 || got.Bitrate != 320 {
+		t.Errorf("numeric tags = year %d, track %d, duration %d, bitrate %d", got.Year, got.TrackNumber, got.Duration, got.Bitrate)
+	}
+	if got.PlayCount != 12 || got.Rating != 8 || got.PlayTime != 3744000 || got.LastElapsed != 95000 {
+		t.Errorf("stats = playcount %d, rating %d, playtime %d, lastelapsed %d", got.PlayCount, got.Rating, got.PlayTime, got.LastElapsed)
+	}
+	if got.RockboxID == "" {
+		t.Error("RockboxID should not be empty")
+	}
+
+	// The highest lastplayed counter is the most recent play
+	if songs[1].LastPlayed == nil || songs[0].LastPlayed == nil {
+		t.Fatal("LastPlayed should be estimated for played songs")
+	}
+	if !songs[1].LastPlayed.After(*songs[0].LastPlayed) {
+		t.Errorf("songs[1].LastPlayed = %v, want after %v", songs[1].LastPlayed, songs[0].LastPlayed)
+	}
+}
+
+func TestParser_Parse_ChangelogBeforeFilesystemScan(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeChangelogFixture(t, tmpDir, testChangelog)
+
+	// A corrupt index makes the parser fall back
+	_ = os.WriteFile(filepath.Join(tmpDir, TagCacheDir, DatabaseFile), []byte("garbage"), 0644)
+	_ = os.WriteFile(filepath.Join(tmpDir, "Other - Song.mp3"), []byte("fake"), 0644)
+
+	songs, err := NewParser(tmpDir, &mockLogger{}).Parse(context.Background())
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if len(songs) != 2 || songs[0].Title != "Battery" {
+		t.Errorf("Parse() = %d songs, want the 2 changelog entries", len(songs))
+	}
+}
+
+func TestParser_Parse_InvalidChangelogFallsBackToScan(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeChangelogFixture(t, tmpDir, "## Changelog version 1\n")
+	_ = os.WriteFile(filepath.Join(tmpDir, "Other - Song.mp3"), []byte("fake"), 0644)
+
+	songs, err := NewParser(tmpDir, &mockLogger{}).Parse(context.Background())
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if len(songs) != 1 || songs[0].Artist != "Other" {
+		t.Errorf("Parse() = %d songs, want 1 from filesystem fallback", len(songs))
+	}
+}
+
+func TestWriteChangelog_RoundTrip(t *testing.T) {
+	songs := []*models.Song{
+		{
+			Path: "/Music/Metallica/01 - Battery.mp3", Title: "Battery", Artist: "Metallica",
+			Album: "Master of Puppets", Year: 1986, TrackNumber: 1, Duration: 312,
+			PlayCount: 15, Rating: 10, LastPlayedSerial: 43,
+		},
+		{Path: "/Music/Quotes/Say \"Hi\"\\Bye.mp3", Title: "Say \"Hi\"", Comment: "one\ntwo"},
+		{Title: "No path is skipped"},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteChangelog(&buf, songs); err != nil {
+		t.Fatalf("WriteChangelog() error = %v", err)
+	}
+	if !strings.HasPrefix(buf.String(), changelogHeader+"\n") {
+		t.Errorf("WriteChangelog() should start with %q", changelogHeader)
+	}
+	if strings.Contains(buf.String(), "playtime=") || strings.Contains(buf.String(), "commitid=") {
+		t.Error("WriteChangelog() should not write statistics Rocklist does not track")
+	}
+
+	entries, err := readChangelog(&buf)
+	if err != nil {
+		t.Fatalf("readChangelog() error = %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("readChangelog() returned %d entries, want 2", len(entries))
+	}
+
+	want := map[TagType]string{
+		TagFilename: songs[0].Path, TagTitle: "Battery", TagLength: "312000",
+		TagPlayCount: "15", TagRating: "10", TagLastPlayed: "43",
+	}
+	for tag, v := range want {
+		if entries[0][tag] != v {
+			t.Errorf("entries[0][%s] = %q, want %q", tag, entries[0][tag], v)
+		}
+	}
+	if entries[1][TagFilename] != songs[1].Path || entries[1][TagComment] != "one\ntwo" {
+		t.Errorf("entries[1] = %v, want escapes to round trip", entries[1])
+	}
+}
+
+func TestWriteChangelogFile_MergesExisting(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeChangelogFixture(t, tmpDir, testChangelog)
+
+	battery := &models.Song{Path: "/Music/Metallica/01 - Battery.mp3", Title: "Battery", PlayCount: 20}
+	path, err := WriteChangelogFile(tmpDir, []*models.Song{{Path: "/a.mp3", Rating: 4}, battery})
+	if err != nil {
+		t.Fatalf("WriteChangelogFile() error = %v", err)
+	}
+	if path != filepath.Join(tmpDir, TagCacheDir, ChangelogFile) {
+		t.Errorf("WriteChangelogFile() path = %q", path)
+	}
+
+	backup, err := os.ReadFile(path + ".bak")
+	if err != nil || string(backup) != testChangelog {
+		t.Errorf("existing changelog should be kept as .bak, got %q, %v", backup, err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer func() { _ = file.Close() }()
+	entries, err := readChangelog(file)
+	if err != nil {
+		t.Fatalf("readChangelog() error = %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("written changelog has %d entries, want the 2 existing and the pushed one", len(entries))
+	}
+	if entries[0][TagPlayCount] != "20" || entries[0][TagCommitID] != "2" {
+		t.Errorf("entries[0] = %v, want the new play count and the other tags kept", entries[0])
+	}
+	if entries[1][TagPlayCount] != "3" {
+		t.Errorf("entries[1] = %v, want the untouched entry kept", entries[1])
+	}
+	if entries[2][TagFilename] != "/a.mp3" || entries[2][TagRating] != "4" {
+		t.Errorf("entries[2] = %v, want the pushed song", entries[2])
+	}
+}
+
+func TestWriteChangelogFile_NoRockboxDir(t *testing.T) {
+	if _, err := WriteChangelogFile(t.TempDir(), nil); err == nil {
+		t.Error("WriteChangelogFile() expected error without a .rockbox directory")
+	}
+}
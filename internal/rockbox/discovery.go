@@ -0,0 +1,194 @@
+package rockbox
+
+import (
+	"bufio"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// InfoFile is written by the Rockbox installer and names the target and
+// firmware version
+const InfoFile = "rockbox-info.txt"
+
+// mediaDepth is how deep below a media folder mount points are looked for:
+// /media/LABEL and /media/USER/LABEL
+const mediaDepth = 2
+
+// DeviceInfo is a mounted player with a Rockbox database
+type DeviceInfo struct {
+	// Path is the mount point, to be used as the Rockbox path
+	Path string `json:"path"`
+	// Name is the volume label, taken from the mount point
+	Name string `json:"name"`
+	// Target is the Rockbox target, e.g. ipodvideo or sansafuzeplus
+	Target string `json:"target,omitempty"`
+	// Version is the installed Rockbox version
+	Version string `json:"version,omitempty"`
+}
+
+// Discovery finds mounted Rockbox devices. A device is a mount point with a
+// .rockbox/database_idx.tcd; players whose database has not been built yet
+// are not listed since there is nothing to parse.
+type Discovery struct {
+	// MountsFile lists the mounted file systems in /proc/mounts format
+	MountsFile string
+	// MediaDirs are folders removable drives are mounted under
+	MediaDirs []string
+}
+
+// NewDiscovery returns a discovery of the Linux mount points in
+// /proc/mounts, /media and /run/media
+func NewDiscovery() *Discovery {
+	return &Discovery{
+		MountsFile: "/proc/mounts",
+		MediaDirs:  []string{"/media", "/run/media"},
+	}
+}
+
+// Find returns the devices found, sorted by path. Unreadable mount points
+// and a missing mounts file are skipped.
+func (d *Discovery) Find() []*DeviceInfo {
+	seen := make(map[string]bool)
+	var devices []*DeviceInfo
+	add := func(dir string) {
+		dir = filepath.Clean(dir)
+		if seen[dir] {
+			return
+		}
+		seen[dir] = true
+		if device, ok := probeDevice(dir); ok {
+			devices = append(devices, device)
+		}
+	}
+
+	for _, dir := range readMounts(d.MountsFile) {
+		add(dir)
+	}
+	for _, media := range d.MediaDirs {
+		for _, dir := range listMediaDirs(media, mediaDepth) {
+			add(dir)
+		}
+	}
+
+	sort.Slice(devices, func(i, j int) bool {
+		return devices[i].Path < devices[j].Path
+	})
+	return devices
+}
+
+// IsDeviceRoot reports whether dir is a host folder holding a .rockbox
+// folder, so files written there land on the device. Archives and disk
+// images are not device roots.
+func IsDeviceRoot(dir string) bool {
+	if dir == "" {
+		return false
+	}
+	info, err := os.Stat(filepath.Join(dir, TagCacheDir))
+	return err == nil && info.IsDir()
+}
+
+// probeDevice checks dir for a Rockbox database and reads its info file
+func probeDevice(dir string) (*DeviceInfo, bool) {
+	info, err := os.Stat(filepath.Join(dir, TagCacheDir, DatabaseFile))
+	if err != nil || !info.Mode().IsRegular() {
+		return nil, false
+	}
+
+	device, _ := ReadDeviceInfo(os.DirFS(dir))
+	device.Path = dir
+	device.Name = filepath.Base(dir)
+	return device, true
+}
+
+// ReadDeviceInfo reads the target and version from .rockbox/rockbox-info.txt.
+// The file is optional: on error the returned info is empty, not nil.
+func ReadDeviceInfo(fsys fs.FS) (*DeviceInfo, error) {
+	device := &DeviceInfo{}
+	file, err := fsys.Open(TagCacheDir + "/" + InfoFile)
+	if err != nil {
+		return device, err
+	}
+	defer func() { _ = file.Close() }()
+
+	// Lines are "Key: value", e.g. "Target: ipodvideo" and "Version: 3.15"
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		switch strings.TrimSpace(key) {
+		case "Target":
+			device.Target = strings.TrimSpace(value)
+		case "Version":
+			device.Version = strings.TrimSpace(value)
+		}
+	}
+	return device, scanner.Err()
+}
+
+// readMounts returns the mount points of block devices listed in a
+// /proc/mounts style file. Virtual file systems are left out.
+func readMounts(name string) []string {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil
+	}
+	defer func() { _ = file.Close() }()
+
+	var dirs []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// source mountpoint fstype options dump pass
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || !strings.HasPrefix(fields[0], "/dev/") {
+			continue
+		}
+		dirs = append(dirs, unescapeMount(fields[1]))
+	}
+	return dirs
+}
+
+// unescapeMount decodes the octal escapes the kernel writes for spaces,
+// tabs, newlines and backslashes in mount points, e.g. \040 for a space
+func unescapeMount(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+4 <= len(s) {
+			if n, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// listMediaDirs returns the folders below media up to depth levels deep
+func listMediaDirs(media string, depth int) []string {
+	entries, err := os.ReadDir(media)
+	if err != nil {
+		return nil
+	}
+	var dirs []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		dir := filepath.Join(media, entry.Name())
+		dirs = append(dirs, dir)
+		if depth > 1 {
+			dirs = append(dirs, listMediaDirs(dir, depth-1)...)
+		}
+	}
+	return dirs
+}
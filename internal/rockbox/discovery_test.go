@@ -0,0 +1,95 @@
+package rockbox
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+// writeDevice creates a mount point with a database and an optional info file
+func writeDevice(t *testing.T, dir, info string) {
+	t.Helper()
+	_ = os.MkdirAll(filepath.Join(dir, TagCacheDir), 0755)
+	_ = os.WriteFile(filepath.Join(dir, TagCacheDir, DatabaseFile), []byte("TCH"), 0644)
+	if info != "" {
+		_ = os.WriteFile(filepath.Join(dir, TagCacheDir, InfoFile), []byte(info), 0644)
+	}
+}
+
+func TestDiscovery_Find(t *testing.T) {
+	root := t.TempDir()
+	ipod := filepath.Join(root, "mnt", "MY IPOD")
+	sansa := filepath.Join(root, "media", "user", "SANSA")
+	unbuilt := filepath.Join(root, "media", "user", "CLIP")
+	other := filepath.Join(root, "mnt", "usb")
+
+	writeDevice(t, ipod, "Target: ipodvideo\nTarget id: 23\nMemory: 32\nVersion: 3.15\n")
+	writeDevice(t, sansa, "")
+	_ = os.MkdirAll(filepath.Join(unbuilt, TagCacheDir), 0755)
+	_ = os.MkdirAll(other, 0755)
+
+	// The Sansa is found twice, in the mounts file and under /media
+	mounts := "proc /proc proc rw 0 0\n" +
+		"/dev/sdb1 " + filepath.Join(root, "mnt", `MY\040IPOD`) + " vfat rw 0 0\n" +
+		"/dev/sdd1 " + sansa + " vfat rw 0 0\n" +
+		"/dev/sdc1 " + other + " vfat rw 0 0\n" +
+		"tmpfs " + root + " tmpfs rw 0 0\n"
+	mountsFile := filepath.Join(root, "mounts")
+	_ = os.WriteFile(mountsFile, []byte(mounts), 0644)
+
+	discovery := &Discovery{
+		MountsFile: mountsFile,
+		MediaDirs:  []string{filepath.Join(root, "media"), filepath.Join(root, "run", "media")},
+	}
+	devices := discovery.Find()
+
+	if len(devices) != 2 {
+		t.Fatalf("Find() returned %d devices, want 2: %+v", len(devices), devices)
+	}
+	if d := devices[0]; d.Path != sansa || d.Name != "SANSA" || d.Target != "" || d.Version != "" {
+		t.Errorf("devices[0] = %+v, want the Sansa without info", *d)
+	}
+	if d := devices[1]; d.Path != ipod || d.Name != "MY IPOD" || d.Target != "ipodvideo" || d.Version != "3.15" {
+		t.Errorf("devices[1] = %+v, want the iPod with target and version", *d)
+	}
+}
+
+func TestDiscovery_Find_NoMounts(t *testing.T) {
+	discovery := &Discovery{MountsFile: filepath.Join(t.TempDir(), "missing")}
+	if devices := discovery.Find(); len(devices) != 0 {
+		t.Errorf("Find() = %+v, want no devices", devices)
+	}
+}
+
+func TestReadDeviceInfo(t *testing.T) {
+	fsys := fstest.MapFS{
+		TagCacheDir + "/" + InfoFile: {Data: []byte("Target: sansafuzeplus\r\nVersion: 4.0\r\nFeatures: :lcd_color:\r\n")},
+	}
+	device, err := ReadDeviceInfo(fsys)
+	if err != nil {
+		t.Fatalf("ReadDeviceInfo() error = %v", err)
+	}
+	if device.Target != "sansafuzeplus" || device.Version != "4.0" {
+		t.Errorf("ReadDeviceInfo() = %+v, want sansafuzeplus 4.0", *device)
+	}
+
+	if device, err := ReadDeviceInfo(fstest.MapFS{}); err == nil || device == nil {
+		t.Errorf("ReadDeviceInfo() = %v, %v, want empty info and an error", device, err)
+	}
+}
+
+func TestUnescapeMount(t *testing.T) {
+	tests := map[string]string{
+		"/media/IPOD":         "/media/IPOD",
+		`/media/MY\040IPOD`:   "/media/MY IPOD",
+		`/media/a\134b`:       `/media/a\b`,
+		`/media/trailing\04`:  `/media/trailing\04`,
+		`/media/not\999octal`: `/media/not\999octal`,
+	}
+	for in, want := range tests {
+		if got := unescapeMount(in); got != want {
+			t.Errorf("unescapeMount(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,619 @@
+// Package fatfs provides read-only access to FAT12, FAT16 and FAT32 disk
+// images through io/fs, so the Rockbox parser can read the image of a
+// player without mounting it.
+//
+// Both partition images and whole-disk images with an MBR partition table
+// are supported; for the latter the first FAT partition is used. Names are
+// matched case-insensitively like on the device, and long file names are
+// read from VFAT LFN entries.
+package fatfs
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf16"
+)
+
+// ErrNotFAT is returned when an image holds no FAT file system
+var ErrNotFAT = errors.New("not a FAT file system image")
+
+const (
+	sectorSize   = 512
+	dirEntrySize = 32
+
+	attrVolumeID  = 0x08
+	attrDirectory = 0x10
+	attrLFN       = 0x0F
+)
+
+// mbrFATTypes lists the MBR partition types of FAT file systems
+var mbrFATTypes = map[byte]bool{
+	0x01: true, 0x04: true, 0x06: true, 0x0B: true, 0x0C: true, 0x0E: true,
+}
+
+// FS is a read-only FAT file system
+type FS struct {
+	r io.ReaderAt
+
+	fatType     int // 12, 16 or 32
+	clusterSize int64
+	dataOffset  int64 // offset of cluster 2
+	fat         []uint32
+
+	// FAT12/16 keep the root directory in a fixed region, FAT32 in a chain
+	rootOffset  int64
+	rootSize    int64
+	rootCluster uint32
+
+	mu   sync.Mutex
+	dirs map[uint32][]*entry // directory listings by first cluster, 0 is the root
+}
+
+// entry is a decoded directory entry
+type entry struct {
+	name    string
+	dir     bool
+	cluster uint32
+	size    int64
+	modTime time.Time
+}
+
+// New reads the FAT file system in the image r of the given size
+func New(r io.ReaderAt, size int64) (*FS, error) {
+	offset, err := findVolume(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	boot := make([]byte, sectorSize)
+	if _, err := r.ReadAt(boot, offset); err != nil {
+		return nil, ErrNotFAT
+	}
+	bps := int64(binary.LittleEndian.Uint16(boot[11:]))
+	spc := int64(boot[13])
+	reserved := int64(binary.LittleEndian.Uint16(boot[14:]))
+	numFATs := int64(boot[16])
+	rootEntries := int64(binary.LittleEndian.Uint16(boot[17:]))
+	totalSectors := int64(binary.LittleEndian.Uint16(boot[19:]))
+	if totalSectors == 0 {
+		totalSectors = int64(binary.LittleEndian.Uint32(boot[32:]))
+	}
+	fatSectors := int64(binary.LittleEndian.Uint16(boot[22:]))
+	if fatSectors == 0 {
+		fatSectors = int64(binary.LittleEndian.Uint32(boot[36:]))
+	}
+
+	// The boot sector comes from the image, so its geometry is checked
+	// against the image size before anything is allocated from it
+	imageSectors := (size - offset) / bps
+	rootSectors := (rootEntries*dirEntrySize + bps - 1) / bps
+	firstData := reserved + numFATs*fatSectors + rootSectors
+	if totalSectors <= firstData {
+		return nil, ErrNotFAT
+	}
+	if totalSectors > imageSectors {
+		return nil, fmt.Errorf("%w: the volume has %d sectors but the image holds %d", ErrNotFAT, totalSectors, imageSectors)
+	}
+	clusters := (totalSectors - firstData) / spc
+
+	f := &FS{
+		r:           r,
+		clusterSize: bps * spc,
+		dataOffset:  offset + firstData*bps,
+		rootOffset:  offset + (reserved+numFATs*fatSectors)*bps,
+		rootSize:    rootSectors * bps,
+		dirs:        make(map[uint32][]*entry),
+	}
+	switch {
+	case clusters < 4085:
+		f.fatType = 12
+	case clusters < 65525:
+		f.fatType = 16
+	default:
+		f.fatType = 32
+		f.rootCluster = binary.LittleEndian.Uint32(boot[44:]) & 0x0FFFFFFF
+	}
+
+	if capacity := fatSectors * bps * 8 / int64(f.fatType); clusters+2 > capacity {
+		return nil, fmt.Errorf("%w: %d clusters do not fit a FAT of %d entries", ErrNotFAT, clusters, capacity)
+	}
+
+	fatBytes, err := io.ReadAll(io.NewSectionReader(r, offset+reserved*bps, fatSectors*bps))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read FAT: %w", err)
+	}
+	f.fat = decodeFAT(fatBytes, f.fatType, clusters+2)
+
+	return f, nil
+}
+
+// findVolume returns the offset of the FAT boot sector, which is either at
+// the start of the image or at the first FAT partition of an MBR
+func findVolume(r io.ReaderAt, size int64) (int64, error) {
+	sector := make([]byte, sectorSize)
+	if size < sectorSize {
+		return 0, ErrNotFAT
+	}
+	if _, err := r.ReadAt(sector, 0); err != nil {
+		return 0, ErrNotFAT
+	}
+	if isBootSector(sector) {
+		return 0, nil
+	}
+	if sector[510] != 0x55 || sector[511] != 0xAA {
+		return 0, ErrNotFAT
+	}
+
+	for i := 0; i < 4; i++ {
+		part := sector[446+i*16 : 446+(i+1)*16]
+		if !mbrFATTypes[part[4]] {
+			continue
+		}
+		offset := int64(binary.LittleEndian.Uint32(part[8:])) * sectorSize
+		if offset+sectorSize > size {
+			continue
+		}
+		boot := make([]byte, sectorSize)
+		if _, err := r.ReadAt(boot, offset); err == nil && isBootSector(boot) {
+			return offset, nil
+		}
+	}
+	return 0, ErrNotFAT
+}
+
+// isBootSector reports whether b looks like a FAT boot sector
+func isBootSector(b []byte) bool {
+	if (b[0] != 0xEB && b[0] != 0xE9) || b[510] != 0x55 || b[511] != 0xAA {
+		return false
+	}
+	bps := binary.LittleEndian.Uint16(b[11:])
+	spc := b[13]
+	switch bps {
+	case 512, 1024, 2048, 4096:
+	default:
+		return false
+	}
+	return spc != 0 && spc&(spc-1) == 0 && b[16] != 0 && binary.LittleEndian.Uint16(b[14:]) != 0
+}
+
+// decodeFAT decodes the first n entries of a file allocation table
+func decodeFAT(b []byte, fatType int, n int64) []uint32 {
+	fat := make([]uint32, n)
+	for i := int64(0); i < n; i++ {
+		switch fatType {
+		case 12:
+			off := i + i/2
+			if off+1 >= int64(len(b)) {
+				return fat
+			}
+			v := uint32(binary.LittleEndian.Uint16(b[off:]))
+			if i%2 == 1 {
+				v >>= 4
+			}
+			fat[i] = v & 0x0FFF
+		case 16:
+			if i*2+2 > int64(len(b)) {
+				return fat
+			}
+			fat[i] = uint32(binary.LittleEndian.Uint16(b[i*2:]))
+		default:
+			if i*4+4 > int64(len(b)) {
+				return fat
+			}
+			fat[i] = binary.LittleEndian.Uint32(b[i*4:]) & 0x0FFFFFFF
+		}
+	}
+	return fat
+}
+
+// endOfChain reports whether a FAT entry ends a cluster chain
+func (f *FS) endOfChain(v uint32) bool {
+	switch f.fatType {
+	case 12:
+		return v >= 0xFF8
+	case 16:
+		return v >= 0xFFF8
+	default:
+		return v >= 0x0FFFFFF8
+	}
+}
+
+// chain returns the clusters of the chain starting at start
+func (f *FS) chain(start uint32) ([]uint32, error) {
+	var clusters []uint32
+	for c := start; !f.endOfChain(c); c = f.fat[c] {
+		if c < 2 || int(c) >= len(f.fat) || len(clusters) >= len(f.fat) {
+			return nil, fmt.Errorf("fatfs: broken cluster chain at %d", c)
+		}
+		clusters = append(clusters, c)
+	}
+	return clusters, nil
+}
+
+// clusterOffset returns the image offset of a data cluster
+func (f *FS) clusterOffset(c uint32) int64 {
+	return f.dataOffset + int64(c-2)*f.clusterSize
+}
+
+// readDir returns the entries of the directory starting at cluster, where
+// 0 is the root directory
+func (f *FS) readDir(cluster uint32) ([]*entry, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	key := cluster
+	if entries, ok := f.dirs[key]; ok {
+		return entries, nil
+	}
+
+	var data []byte
+	if cluster == 0 && f.fatType != 32 {
+		data = make([]byte, f.rootSize)
+		if _, err := f.r.ReadAt(data, f.rootOffset); err != nil {
+			return nil, err
+		}
+	} else {
+		if cluster == 0 {
+			cluster = f.rootCluster
+		}
+		clusters, err := f.chain(cluster)
+		if err != nil {
+			return nil, err
+		}
+		data = make([]byte, int64(len(clusters))*f.clusterSize)
+		for i, c := range clusters {
+			buf := data[int64(i)*f.clusterSize : int64(i+1)*f.clusterSize]
+			if _, err := f.r.ReadAt(buf, f.clusterOffset(c)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	entries := parseDir(data)
+	f.dirs[key] = entries
+	return entries, nil
+}
+
+// parseDir decodes the raw entries of a directory, joining long file names
+func parseDir(data []byte) []*entry {
+	var entries []*entry
+	var lfn []uint16
+	var lfnSum byte
+
+	for off := 0; off+dirEntrySize <= len(data); off += dirEntrySize {
+		raw := data[off : off+dirEntrySize]
+		switch raw[0] {
+		case 0x00:
+			return entries
+		case 0xE5:
+			lfn = nil
+			continue
+		}
+
+		attr := raw[11]
+		if attr&attrLFN == attrLFN {
+			seq := raw[0] & 0x1F
+			if raw[0]&0x40 != 0 {
+				lfn = make([]uint16, 13*int(seq))
+				lfnSum = raw[13]
+			}
+			if seq == 0 || lfn == nil || int(seq)*13 > len(lfn) || raw[13] != lfnSum {
+				lfn = nil
+				continue
+			}
+			units := lfn[(int(seq)-1)*13:]
+			for i, pos := range []int{1, 3, 5, 7, 9, 14, 16, 18, 20, 22, 24, 28, 30} {
+				units[i] = binary.LittleEndian.Uint16(raw[pos:])
+			}
+			continue
+		}
+		if attr&attrVolumeID != 0 {
+			lfn = nil
+			continue
+		}
+
+		name := shortName(raw)
+		if lfn != nil && checksum(raw[:11]) == lfnSum {
+			name = decodeLFN(lfn)
+		}
+		lfn = nil
+		if name == "." || name == ".." {
+			continue
+		}
+
+		cluster := uint32(binary.LittleEndian.Uint16(raw[20:]))<<16 | uint32(binary.LittleEndian.Uint16(raw[26:]))
+		entries = append(entries, &entry{
+			name:    name,
+			dir:     attr&attrDirectory != 0,
+			cluster: cluster,
+			size:    int64(binary.LittleEndian.Uint32(raw[28:])),
+			modTime: fatTime(binary.LittleEndian.Uint16(raw[24:]), binary.LittleEndian.Uint16(raw[22:])),
+		})
+	}
+	return entries
+}
+
+// shortName decodes an 8.3 name, honouring the lowercase flags set by
+// Windows NT for names that differ only in case
+func shortName(raw []byte) string {
+	base := strings.TrimRight(string(raw[0:8]), " ")
+	ext := strings.TrimRight(string(raw[8:11]), " ")
+	if raw[0] == 0x05 {
+		base = "\xe5" + base[1:]
+	}
+	if raw[12]&0x08 != 0 {
+		base = strings.ToLower(base)
+	}
+	if raw[12]&0x10 != 0 {
+		ext = strings.ToLower(ext)
+	}
+	if ext == "" {
+		return base
+	}
+	return base + "." + ext
+}
+
+// decodeLFN decodes a long file name up to its terminator
+func decodeLFN(units []uint16) string {
+	for i, u := range units {
+		if u == 0 || u == 0xFFFF {
+			units = units[:i]
+			break
+		}
+	}
+	return string(utf16.Decode(units))
+}
+
+// checksum computes the short name checksum stored in LFN entries
+func checksum(name []byte) byte {
+	var sum byte
+	for _, c := range name {
+		sum = (sum>>1 | sum<<7) + c
+	}
+	return sum
+}
+
+// fatTime decodes a FAT date and time in local time
+func fatTime(date, clock uint16) time.Time {
+	if date == 0 {
+		return time.Time{}
+	}
+	return time.Date(
+		int(date>>9)+1980, time.Month(date>>5&0x0F), int(date&0x1F),
+		int(clock>>11), int(clock>>5&0x3F), int(clock&0x1F)*2, 0, time.Local,
+	)
+}
+
+// lookup resolves a slash-separated path to its entry
+func (f *FS) lookup(name string) (*entry, error) {
+	current := &entry{name: ".", dir: true}
+	if name == "." {
+		return current, nil
+	}
+
+	for _, part := range strings.Split(name, "/") {
+		if !current.dir {
+			return nil, fs.ErrNotExist
+		}
+		entries, err := f.readDir(current.cluster)
+		if err != nil {
+			return nil, err
+		}
+		var match *entry
+		for _, e := range entries {
+			if e.name == part {
+				match = e
+				break
+			}
+			if match == nil && strings.EqualFold(e.name, part) {
+				match = e
+			}
+		}
+		if match == nil {
+			return nil, fs.ErrNotExist
+		}
+		current = match
+	}
+	return current, nil
+}
+
+// Open opens the named file or directory
+func (f *FS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	e, err := f.lookup(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	info := &fileInfo{e: e, name: path.Base(name)}
+	if e.dir {
+		entries, err := f.readDir(e.cluster)
+		if err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+		return &dirFile{info: info, entries: entries}, nil
+	}
+
+	var clusters []uint32
+	if e.size > 0 {
+		clusters, err = f.chain(e.cluster)
+		if err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+		if int64(len(clusters))*f.clusterSize < e.size {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: fmt.Errorf("fatfs: cluster chain shorter than file")}
+		}
+	}
+	return &file{fs: f, info: info, clusters: clusters}, nil
+}
+
+// ReadDir reads the named directory, sorted by file name
+func (f *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	file, err := f.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	dir, ok := file.(*dirFile)
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	entries, _ := dir.ReadDir(-1)
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+// fileInfo implements fs.FileInfo for an entry
+type fileInfo struct {
+	e    *entry
+	name string
+}
+
+func (i *fileInfo) Name() string       { return i.name }
+func (i *fileInfo) Size() int64        { return i.e.size }
+func (i *fileInfo) ModTime() time.Time { return i.e.modTime }
+func (i *fileInfo) IsDir() bool        { return i.e.dir }
+func (i *fileInfo) Sys() interface{}   { return nil }
+func (i *fileInfo) Mode() fs.FileMode {
+	if i.e.dir {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+// file is an open regular file
+type file struct {
+	fs       *FS
+	info     *fileInfo
+	clusters []uint32
+	pos      int64
+}
+
+func (f *file) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *file) Close() error               { return nil }
+
+// ReadAt reads from the file's clusters at offset off
+func (f *file) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fs.ErrInvalid
+	}
+	n := 0
+	for n < len(p) {
+		if off >= f.info.e.size {
+			return n, io.EOF
+		}
+		idx := off / f.fs.clusterSize
+		within := off % f.fs.clusterSize
+		chunk := f.fs.clusterSize - within
+		if remaining := f.info.e.size - off; chunk > remaining {
+			chunk = remaining
+		}
+		if chunk > int64(len(p)-n) {
+			chunk = int64(len(p) - n)
+		}
+		read, err := f.fs.r.ReadAt(p[n:n+int(chunk)], f.fs.clusterOffset(f.clusters[idx])+within)
+		n += read
+		off += int64(read)
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+func (f *file) Read(p []byte) (int, error) {
+	n, err := f.ReadAt(p, f.pos)
+	f.pos += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+func (f *file) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.pos
+	case io.SeekEnd:
+		offset += f.info.e.size
+	default:
+		return 0, fs.ErrInvalid
+	}
+	if offset < 0 {
+		return 0, fs.ErrInvalid
+	}
+	f.pos = offset
+	return offset, nil
+}
+
+// dirFile is an open directory
+type dirFile struct {
+	info    *fileInfo
+	entries []*entry
+	offset  int
+}
+
+func (d *dirFile) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *dirFile) Close() error               { return nil }
+func (d *dirFile) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.name, Err: errors.New("is a directory")}
+}
+
+// ReadDir returns the next n entries, or all remaining ones if n <= 0
+func (d *dirFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	remaining := d.entries[d.offset:]
+	if n > 0 && len(remaining) == 0 {
+		return nil, io.EOF
+	}
+	if n > 0 && n < len(remaining) {
+		remaining = remaining[:n]
+	}
+	d.offset += len(remaining)
+
+	out := make([]fs.DirEntry, len(remaining))
+	for i, e := range remaining {
+		out[i] = fs.FileInfoToDirEntry(&fileInfo{e: e, name: e.name})
+	}
+	return out, nil
+}
+
+// Image is a FAT file system read from an image file
+type Image struct {
+	*FS
+	file *os.File
+}
+
+// Open opens the FAT image file at name
+func Open(name string) (*Image, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	fsys, err := New(file, info.Size())
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return &Image{FS: fsys, file: file}, nil
+}
+
+// Close closes the image file
+func (i *Image) Close() error {
+	return i.file.Close()
+}
@@ -0,0 +1,496 @@
+package fatfs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"unicode/utf16"
+)
+
+// sparseImage is an in-memory disk image that only stores written sectors,
+// so FAT32 images with many clusters stay small
+type sparseImage struct {
+	sectors map[int64][]byte
+	size    int64
+}
+
+func (s *sparseImage) ReadAt(p []byte, off int64) (int, error) {
+	for i := range p {
+		pos := off + int64(i)
+		if pos >= s.size {
+			return i, io.EOF
+		}
+		if sector, ok := s.sectors[pos/sectorSize]; ok {
+			p[i] = sector[pos%sectorSize]
+		} else {
+			p[i] = 0
+		}
+	}
+	return len(p), nil
+}
+
+func (s *sparseImage) write(off int64, b []byte) {
+	for i, c := range b {
+		pos := off + int64(i)
+		sector, ok := s.sectors[pos/sectorSize]
+		if !ok {
+			sector = make([]byte, sectorSize)
+			s.sectors[pos/sectorSize] = sector
+		}
+		sector[pos%sectorSize] = c
+	}
+}
+
+func (s *sparseImage) bytes() []byte {
+	b := make([]byte, s.size)
+	_, _ = s.ReadAt(b, 0)
+	return b
+}
+
+// layout describes the geometry of a generated FAT volume
+type layout struct {
+	fatType      int
+	spc          int64
+	reserved     int64
+	rootEntries  int64
+	totalSectors int64
+	fatSectors   int64
+}
+
+var layouts = map[int]layout{
+	12: {fatType: 12, spc: 1, reserved: 1, rootEntries: 64, totalSectors: 2000, fatSectors: 6},
+	16: {fatType: 16, spc: 1, reserved: 1, rootEntries: 512, totalSectors: 10000, fatSectors: 40},
+	32: {fatType: 32, spc: 1, reserved: 32, totalSectors: 70000, fatSectors: 560},
+}
+
+// imageBuilder writes a FAT volume holding a set of files
+type imageBuilder struct {
+	img      *sparseImage
+	l        layout
+	base     int64 // volume offset within the image
+	fat      map[uint32]uint32
+	next     uint32
+	dataOff  int64
+	rootOff  int64
+	shortSeq int
+}
+
+// buildImage builds a FAT volume at sector start of an image holding files
+func buildImage(fatType int, start int64, files map[string]string) *sparseImage {
+	l := layouts[fatType]
+	b := &imageBuilder{
+		img:  &sparseImage{sectors: map[int64][]byte{}, size: (start + l.totalSectors) * sectorSize},
+		l:    l,
+		base: start * sectorSize,
+		fat:  map[uint32]uint32{},
+		next: 2,
+	}
+	rootSectors := l.rootEntries * dirEntrySize / sectorSize
+	b.rootOff = b.base + (l.reserved+2*l.fatSectors)*sectorSize
+	b.dataOff = b.rootOff + rootSectors*sectorSize
+
+	root := b.writeDir(files, true)
+
+	boot := make([]byte, sectorSize)
+	boot[0] = 0xEB
+	binary.LittleEndian.PutUint16(boot[11:], sectorSize)
+	boot[13] = byte(l.spc)
+	binary.LittleEndian.PutUint16(boot[14:], uint16(l.reserved))
+	boot[16] = 2
+	binary.LittleEndian.PutUint16(boot[17:], uint16(l.rootEntries))
+	if fatType == 32 {
+		binary.LittleEndian.PutUint32(boot[32:], uint32(l.totalSectors))
+		binary.LittleEndian.PutUint32(boot[36:], uint32(l.fatSectors))
+		binary.LittleEndian.PutUint32(boot[44:], root)
+	} else {
+		binary.LittleEndian.PutUint16(boot[19:], uint16(l.totalSectors))
+		binary.LittleEndian.PutUint16(boot[22:], uint16(l.fatSectors))
+	}
+	boot[510], boot[511] = 0x55, 0xAA
+	b.img.write(b.base, boot)
+
+	fat := make([]byte, l.fatSectors*sectorSize)
+	for c, v := range b.fat {
+		switch fatType {
+		case 12:
+			off := c + c/2
+			cur := binary.LittleEndian.Uint16(fat[off:])
+			if c%2 == 1 {
+				cur = cur&0x000F | uint16(v)<<4
+			} else {
+				cur = cur&0xF000 | uint16(v)&0x0FFF
+			}
+			binary.LittleEndian.PutUint16(fat[off:], cur)
+		case 16:
+			binary.LittleEndian.PutUint16(fat[c*2:], uint16(v))
+		default:
+			binary.LittleEndian.PutUint32(fat[c*4:], v)
+		}
+	}
+	b.img.write(b.base+l.reserved*sectorSize, fat)
+	return b.img
+}
+
+// alloc allocates a chain for n bytes, leaving a gap after every cluster so
+// chains are never contiguous, and returns its first cluster
+func (b *imageBuilder) alloc(data []byte) uint32 {
+	clusterSize := b.l.spc * sectorSize
+	n := (int64(len(data)) + clusterSize - 1) / clusterSize
+	if n == 0 {
+		n = 1
+	}
+	first := b.next
+	for i := int64(0); i < n; i++ {
+		c := b.next
+		b.next += 2
+		if i == n-1 {
+			b.fat[c] = 0x0FFFFFFF
+		} else {
+			b.fat[c] = b.next
+		}
+		end := (i + 1) * clusterSize
+		if end > int64(len(data)) {
+			end = int64(len(data))
+		}
+		if i*clusterSize < end {
+			b.img.write(b.dataOff+int64(c-2)*clusterSize, data[i*clusterSize:end])
+		}
+	}
+	return first
+}
+
+// writeDir writes the directory holding files (paths relative to it) and
+// returns its first cluster
+func (b *imageBuilder) writeDir(files map[string]string, root bool) uint32 {
+	children := map[string]map[string]string{}
+	var names []string
+	fileData := map[string]string{}
+	for p, data := range files {
+		head, rest, isDir := strings.Cut(p, "/")
+		if isDir {
+			if children[head] == nil {
+				children[head] = map[string]string{}
+				names = append(names, head)
+			}
+			children[head][rest] = data
+		} else {
+			fileData[head] = data
+			names = append(names, head)
+		}
+	}
+	sort.Strings(names)
+
+	var dir bytes.Buffer
+	if root {
+		dir.Write(shortEntry("NO NAME    ", attrVolumeID, 0, 0, 0))
+	} else {
+		dir.Write(shortEntry(".          ", attrDirectory, 0, 0, 0))
+		dir.Write(shortEntry("..         ", attrDirectory, 0, 0, 0))
+	}
+	// a deleted entry must be skipped
+	deleted := shortEntry("DELETED TXT", 0, 0, 0, 0)
+	deleted[0] = 0xE5
+	dir.Write(deleted)
+
+	for _, n := range names {
+		if sub, ok := children[n]; ok {
+			cluster := b.writeDir(sub, false)
+			dir.Write(b.dirEntry(n, attrDirectory, cluster, 0))
+			continue
+		}
+		data := []byte(fileData[n])
+		var cluster uint32
+		if len(data) > 0 {
+			cluster = b.alloc(data)
+		}
+		dir.Write(b.dirEntry(n, 0, cluster, len(data)))
+	}
+
+	if root && b.l.fatType != 32 {
+		b.img.write(b.rootOff, dir.Bytes())
+		return 0
+	}
+	return b.alloc(dir.Bytes())
+}
+
+// dirEntry builds the entries for name, using an 8.3 name when possible and
+// LFN entries otherwise
+func (b *imageBuilder) dirEntry(name string, attr byte, cluster uint32, size int) []byte {
+	if short, flags, ok := fitsShortName(name); ok {
+		return shortEntry(short, attr, cluster, size, flags)
+	}
+
+	b.shortSeq++
+	short := fmt.Sprintf("LFN~%-4d   ", b.shortSeq)
+	sum := checksum([]byte(short))
+	units := utf16.Encode([]rune(name))
+	units = append(units, 0)
+	for len(units)%13 != 0 {
+		units = append(units, 0xFFFF)
+	}
+	count := len(units) / 13
+
+	var out []byte
+	for seq := count; seq >= 1; seq-- {
+		e := make([]byte, dirEntrySize)
+		e[0] = byte(seq)
+		if seq == count {
+			e[0] |= 0x40
+		}
+		e[11] = attrLFN
+		e[13] = sum
+		part := units[(seq-1)*13 : seq*13]
+		for i, pos := range []int{1, 3, 5, 7, 9, 14, 16, 18, 20, 22, 24, 28, 30} {
+			binary.LittleEndian.PutUint16(e[pos:], part[i])
+		}
+		out = append(out, e...)
+	}
+	return append(out, shortEntry(short, attr, cluster, size, 0)...)
+}
+
+// fitsShortName returns the padded 8.3 form of name and the NT lowercase
+// flags if name can be stored without LFN entries
+func fitsShortName(name string) (string, byte, bool) {
+	base, ext, _ := strings.Cut(name, ".")
+	if base == "" || len(base) > 8 || len(ext) > 3 || strings.ContainsAny(name, " ~") || strings.Count(name, ".") > 1 {
+		return "", 0, false
+	}
+	var flags byte
+	for _, part := range []struct {
+		s    string
+		flag byte
+	}{{base, 0x08}, {ext, 0x10}} {
+		switch part.s {
+		case strings.ToUpper(part.s):
+		case strings.ToLower(part.s):
+			flags |= part.flag
+		default:
+			return "", 0, false
+		}
+	}
+	return fmt.Sprintf("%-8s%-3s", strings.ToUpper(base), strings.ToUpper(ext)), flags, true
+}
+
+// shortEntry builds an 8.3 directory entry dated 2024-03-09 21:30:10
+func shortEntry(short string, attr byte, cluster uint32, size int, flags byte) []byte {
+	e := make([]byte, dirEntrySize)
+	copy(e, short)
+	e[11] = attr
+	e[12] = flags
+	binary.LittleEndian.PutUint16(e[20:], uint16(cluster>>16))
+	binary.LittleEndian.PutUint16(e[22:], 21<<11|30<<5|5)
+	binary.LittleEndian.PutUint16(e[24:], (2024-1980)<<9|3<<5|9)
+	binary.LittleEndian.PutUint16(e[26:], uint16(cluster))
+	binary.LittleEndian.PutUint32(e[28:], uint32(size))
+	return e
+}
+
+// testFiles is the device content used by the tests
+var testFiles = map[string]string{
+	".rockbox/database_idx.tcd":                   "TCH\x10 index",
+	".rockbox/database_changelog.txt":             "## Changelog version 1\n",
+	"Music/Björk/Homogenic/01 Hunter.mp3":         strings.Repeat("hunter", 400),
+	"Music/Artist - A Rather Long Song Name.flac": strings.Repeat("0123456789", 150),
+	"README.TXT": "readme",
+	"song.mp3":   "",
+}
+
+func testFileNames() []string {
+	var names []string
+	for name := range testFiles {
+		names = append(names, name)
+	}
+	return names
+}
+
+func TestFS(t *testing.T) {
+	for _, fatType := range []int{12, 16, 32} {
+		t.Run(fmt.Sprintf("FAT%d", fatType), func(t *testing.T) {
+			img := buildImage(fatType, 0, testFiles)
+			fsys, err := New(img, img.size)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			if fsys.fatType != fatType {
+				t.Fatalf("fatType = %d, want %d", fsys.fatType, fatType)
+			}
+
+			if err := fstest.TestFS(fsys, testFileNames()...); err != nil {
+				t.Fatal(err)
+			}
+
+			for name, want := range testFiles {
+				got, err := fs.ReadFile(fsys, name)
+				if err != nil {
+					t.Fatalf("ReadFile(%q) error = %v", name, err)
+				}
+				if string(got) != want {
+					t.Errorf("ReadFile(%q) = %d bytes, want %d", name, len(got), len(want))
+				}
+			}
+		})
+	}
+}
+
+func TestFS_CaseInsensitive(t *testing.T) {
+	img := buildImage(16, 0, testFiles)
+	fsys, err := New(img, img.size)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	data, err := fs.ReadFile(fsys, ".ROCKBOX/DATABASE_IDX.TCD")
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if string(data) != testFiles[".rockbox/database_idx.tcd"] {
+		t.Errorf("ReadFile() = %q", data)
+	}
+
+	if _, err := fsys.Open("Music/missing.mp3"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Open() missing file error = %v, want fs.ErrNotExist", err)
+	}
+	if _, err := fsys.Open("README.TXT/child"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Open() below a file error = %v, want fs.ErrNotExist", err)
+	}
+	if _, err := fsys.Open("/README.TXT"); err == nil {
+		t.Error("Open() of an invalid path should return an error")
+	}
+}
+
+func TestFS_ModTime(t *testing.T) {
+	img := buildImage(12, 0, testFiles)
+	fsys, _ := New(img, img.size)
+
+	info, err := fs.Stat(fsys, "README.TXT")
+	if err != nil {
+		t.Fatalf("Stat() error = %v", err)
+	}
+	want := "2024-03-09 21:30:10"
+	if got := info.ModTime().Format("2006-01-02 15:04:05"); got != want {
+		t.Errorf("ModTime() = %s, want %s", got, want)
+	}
+}
+
+func TestNew_MBR(t *testing.T) {
+	const start = 63
+	img := buildImage(16, start, testFiles)
+	mbr := make([]byte, sectorSize)
+	part := mbr[446:]
+	part[4] = 0x06
+	binary.LittleEndian.PutUint32(part[8:], start)
+	binary.LittleEndian.PutUint32(part[12:], uint32(layouts[16].totalSectors))
+	mbr[510], mbr[511] = 0x55, 0xAA
+	img.write(0, mbr)
+
+	fsys, err := New(img, img.size)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if _, err := fs.Stat(fsys, ".rockbox/database_idx.tcd"); err != nil {
+		t.Errorf("Stat() error = %v", err)
+	}
+}
+
+func TestNew_NotFAT(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"too small", []byte("test")},
+		{"zeros", make([]byte, 4096)},
+		{"zip", append([]byte("PK\x03\x04"), make([]byte, 1020)...)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(bytes.NewReader(tt.data), int64(len(tt.data))); !errors.Is(err, ErrNotFAT) {
+				t.Errorf("New() error = %v, want ErrNotFAT", err)
+			}
+		})
+	}
+}
+
+func TestNew_BadGeometry(t *testing.T) {
+	tests := []struct {
+		name  string
+		patch func(boot []byte)
+	}{
+		{"FAT larger than the image", func(boot []byte) {
+			binary.LittleEndian.PutUint16(boot[22:], 0)
+			binary.LittleEndian.PutUint32(boot[36:], 0x7FFFFFFF)
+		}},
+		{"volume larger than the image", func(boot []byte) {
+			binary.LittleEndian.PutUint16(boot[19:], 0)
+			binary.LittleEndian.PutUint32(boot[32:], 0xFFFFFFFF)
+		}},
+		{"more clusters than the FAT holds", func(boot []byte) {
+			binary.LittleEndian.PutUint16(boot[22:], 1)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := buildImage(12, 0, testFiles).bytes()
+			tt.patch(data)
+			if _, err := New(bytes.NewReader(data), int64(len(data))); !errors.Is(err, ErrNotFAT) {
+				t.Errorf("New() error = %v, want ErrNotFAT", err)
+			}
+		})
+	}
+}
+
+func FuzzNew(f *testing.F) {
+	f.Add(buildImage(12, 0, testFiles).bytes())
+	boot := make([]byte, 4096)
+	boot[0] = 0xEB
+	binary.LittleEndian.PutUint16(boot[11:], sectorSize)
+	boot[13], boot[14], boot[16] = 1, 1, 2
+	binary.LittleEndian.PutUint32(boot[32:], 0xFFFFFFFF)
+	binary.LittleEndian.PutUint32(boot[36:], 0x00FFFFFF)
+	boot[510], boot[511] = 0x55, 0xAA
+	f.Add(boot)
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		fsys, err := New(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return
+		}
+		// Whatever the image holds, walking and reading it must not panic
+		_ = fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+			if err == nil && !d.IsDir() {
+				_, _ = fs.ReadFile(fsys, name)
+			}
+			return nil
+		})
+	})
+}
+
+func TestOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "player.img")
+	if err := os.WriteFile(path, buildImage(12, 0, testFiles).bytes(), 0644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	img, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer func() { _ = img.Close() }()
+
+	data, err := fs.ReadFile(img, "README.TXT")
+	if err != nil || string(data) != "readme" {
+		t.Errorf("ReadFile() = %q, %v, want readme", data, err)
+	}
+
+	if _, err := Open(filepath.Join(t.TempDir(), "missing.img")); err == nil {
+		t.Error("Open() of a missing file should return an error")
+	}
+}
@@ -2,19 +2,28 @@
 package rockbox
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"crypto/md5"
 	"encoding/binary"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"maps"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
 
 	"github.com/Ardakilic/rocklist/internal/models"
+	"github.com/Ardakilic/rocklist/internal/rockbox/audiotag"
 )
 
 const (
@@ -22,8 +31,9 @@ const (
 	TagCacheDir = ".rockbox"
 	// DatabaseFile is the main database index file
 	DatabaseFile = "database_idx.tcd"
-	// TagCacheMagic is the magic number for TagCache files (version 0x10)
-	// From Rockbox source: TAGCACHE_MAGIC = 0x54434810 in apps/tagcache.c
+	// TagCacheMagic is the magic number of the current TagCache version 0x10.
+	// From Rockbox source: TAGCACHE_MAGIC = 0x54434810 in apps/tagcache.c.
+	// Older versions are read too, see tagCacheFormats.
 	TagCacheMagic = 0x54434810 // "TCH\x10"
 )
 
@@ -59,9 +69,13 @@ const (
 // Parser handles parsing of Rockbox database files
 type Parser struct {
 	rockboxPath string
-	logger      Logger
-	mu          sync.RWMutex
-	status      *models.ParseStatus
+	// fsys is the device file system; nil reads rockboxPath from disk
+	fsys fs.FS
+	// volumes holds the extra volumes of the player by name, see SplitVolume
+	volumes map[string]fs.FS
+	logger  Logger
+	mu      sync.RWMutex
+	status  *models.ParseStatus
 }
 
 // Logger interface for logging parse operations
@@ -96,11 +110,55 @@ func NewParser(rockboxPath string, logger Logger) *Parser {
 	}
 }
 
+// NewParserFS creates a parser that reads the device from fsys, such as an
+// opened archive or disk image. name describes the source in log messages.
+func NewParserFS(fsys fs.FS, name string, logger Logger) *Parser {
+	parser := NewParser(name, logger)
+	parser.fsys = fsys
+	return parser
+}
+
 // SetPath sets the Rockbox path
 func (p *Parser) SetPath(path string) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 	p.rockboxPath = path
+	p.fsys = nil
+}
+
+// SetFS makes the parser read the device from fsys; name describes the
+// source in log messages
+func (p *Parser) SetFS(fsys fs.FS, name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.rockboxPath = name
+	p.fsys = fsys
+}
+
+// SetVolumes sets the file systems of the player's extra volumes, keyed by
+// volume name such as "microSD1". The filesystem scan names their files with
+// the volume prefix, as Rockbox does.
+func (p *Parser) SetVolumes(volumes map[string]fs.FS) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.volumes = volumes
+}
+
+// getVolumes returns the extra volumes
+func (p *Parser) getVolumes() map[string]fs.FS {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.volumes
+}
+
+// root returns the file system of the device
+func (p *Parser) root() fs.FS {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.fsys != nil {
+		return p.fsys
+	}
+	return os.DirFS(p.rockboxPath)
 }
 
 // GetPath returns the current Rockbox path
@@ -115,23 +173,26 @@ func (p *Parser) GetStatus() *models.ParseStatus {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
 	statusCopy := *p.status
+	statusCopy.Diagnostics = append([]models.ParseDiagnostic(nil), p.status.Diagnostics...)
 	return &statusCopy
 }
 
 // ValidatePath checks if the Rockbox path is valid
 func (p *Parser) ValidatePath() error {
-	if p.rockboxPath == "" {
+	if p.GetPath() == "" {
 		return models.ErrRockboxPathNotSet
 	}
+	fsys := p.root()
 
-	rockboxDir := filepath.Join(p.rockboxPath, TagCacheDir)
-	if _, err := os.Stat(rockboxDir); os.IsNotExist(err) {
+	if _, err := fs.Stat(fsys, TagCacheDir); errors.Is(err, fs.ErrNotExist) {
 		return models.ErrRockboxPathInvalid
 	}
 
-	dbFile := filepath.Join(rockboxDir, DatabaseFile)
-	if _, err := os.Stat(dbFile); os.IsNotExist(err) {
-		return models.ErrRockboxDatabaseNotFound
+	if _, err := fs.Stat(fsys, path.Join(TagCacheDir, DatabaseFile)); errors.Is(err, fs.ErrNotExist) {
+		// An exported changelog is enough to read the library
+		if _, err := fs.Stat(fsys, path.Join(TagCacheDir, ChangelogFile)); err != nil {
+			return models.ErrRockboxDatabaseNotFound
+		}
 	}
 
 	return nil
@@ -139,14 +200,30 @@ func (p *Parser) ValidatePath() error {
 
 // Parse parses the Rockbox database and returns all songs
 func (p *Parser) Parse(ctx context.Context) ([]*models.Song, error) {
-	if err := p.ValidatePath(); err != nil {
+	var songs []*models.Song
+	err := p.Stream(ctx, func(song *models.Song) error {
+		songs = append(songs, song)
+		return nil
+	})
+	if err != nil {
 		return nil, err
 	}
+	return songs, nil
+}
+
+// Stream parses the Rockbox database and passes each song to fn as soon as
+// it is read, so a large library never has to be held in memory at once.
+// ProcessedSongs in the status counts the songs fn accepted. An error from fn
+// stops the parse and is returned.
+func (p *Parser) Stream(ctx context.Context, fn func(*models.Song) error) error {
+	if err := p.ValidatePath(); err != nil {
+		return err
+	}
 
 	p.mu.Lock()
 	if p.status.InProgress {
 		p.mu.Unlock()
-		return nil, models.ErrParseInProgress
+		return models.ErrParseInProgress
 	}
 	now := time.Now()
 	p.status = &models.ParseStatus{
@@ -166,174 +243,333 @@ func (p *Parser) Parse(ctx context.Context) ([]*models.Song, error) {
 	p.logger.Info("Starting Rockbox database parse from: %s", p.rockboxPath)
 
 	// Parse the database files
-	songs, err := p.parseDatabase(ctx)
+	err := p.parseDatabase(ctx, p.root(), func(song *models.Song) error {
+		if err := fn(song); err != nil {
+			return err
+		}
+		p.mu.Lock()
+		p.status.ProcessedSongs++
+		p.mu.Unlock()
+		return nil
+	})
 	if err != nil {
 		p.mu.Lock()
 		p.status.LastError = err.Error()
 		p.status.ErrorCount++
 		p.mu.Unlock()
-		return nil, err
+		return err
 	}
 
 	p.mu.Lock()
-	p.status.TotalSongs = len(songs)
-	p.status.ProcessedSongs = len(songs)
+	p.status.TotalSongs = p.status.ProcessedSongs
+	count := p.status.ProcessedSongs
 	p.mu.Unlock()
 
-	p.logger.Info("Successfully parsed %d songs", len(songs))
-	return songs, nil
+	p.logger.Info("Successfully parsed %d songs", count)
+	return nil
 }
 
-// parseDatabase reads and parses the Rockbox TagCache database files
-func (p *Parser) parseDatabase(ctx context.Context) ([]*models.Song, error) {
-	rockboxDir := filepath.Join(p.rockboxPath, TagCacheDir)
+// parseDatabase reads the Rockbox TagCache database files and passes the
+// songs to emit
+func (p *Parser) parseDatabase(ctx context.Context, fsys fs.FS, emit func(*models.Song) error) error {
+	// Open the tag cache; once songs are emitted there is no falling back
+	tc, err := p.openTagCache(fsys)
+	if err == nil {
+		defer tc.close()
+		p.setSource(models.ParseSourceTagCache)
+		return p.streamTagCache(ctx, tc, emit)
+	}
 
-	// Read all tag cache files
-	entries, err := p.readTagCacheEntries(ctx, rockboxDir)
-	if err != nil {
-		// If we can't read the tag cache, try scanning the filesystem
-		p.logger.Info("TagCache not readable (%v), falling back to filesystem scan", err)
-		return p.scanFilesystem(ctx)
+	// If we can't read the tag cache, try the exported changelog
+	p.logger.Info("TagCache not readable (%v), trying database changelog", err)
+	songs, clErr := p.readChangelogEntries(ctx, fsys)
+	if clErr == nil {
+		p.setSource(models.ParseSourceChangelog)
+		for _, song := range songs {
+			if err := emit(song); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// A database of an unknown version is not a reason to replace the
+	// library with a filename scan
+	if errors.Is(err, models.ErrUnsupportedTagCacheVersion) {
+		return err
 	}
 
-	return entries, nil
+	// As a last resort scan the filesystem
+	p.logger.Info("Database changelog not readable (%v), falling back to filesystem scan", clErr)
+	p.setSource(models.ParseSourceFilesystem)
+	return p.scanFilesystem(ctx, fsys, emit)
+}
+
+// setSource records where the songs of the current parse come from
+func (p *Parser) setSource(source string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.status.Source = source
 }
 
-// readTagCacheEntries reads entries from TagCache files
-func (p *Parser) readTagCacheEntries(ctx context.Context, rockboxDir string) ([]*models.Song, error) {
-	dbPath := filepath.Join(rockboxDir, DatabaseFile)
+// maxDiagnostics limits the diagnostics kept per parse; further problems are
+// only counted in ErrorCount
+const maxDiagnostics = 1000
+
+// diagnose records a problem with a record in a database file. file is
+// relative to the .rockbox folder, offset and entry are -1 when the problem
+// concerns the whole file. The parse carries on without the record.
+func (p *Parser) diagnose(file string, offset int64, entry int, format string, args ...interface{}) {
+	d := models.ParseDiagnostic{
+		File:   file,
+		Offset: offset,
+		Entry:  entry,
+		Reason: fmt.Sprintf(format, args...),
+	}
+	p.logger.Debug("%s", d)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.status.ErrorCount++
+	p.status.LastError = d.String()
+	if len(p.status.Diagnostics) < maxDiagnostics {
+		p.status.Diagnostics = append(p.status.Diagnostics, d)
+	}
+}
 
-	file, err := os.Open(dbPath)
+// ReadMasterHeader reads the master header of the device's TagCache index
+// without parsing the entries
+func (p *Parser) ReadMasterHeader() (*MasterHeader, error) {
+	file, err := p.root().Open(path.Join(TagCacheDir, DatabaseFile))
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database file: %w", err)
 	}
 	defer func() { _ = file.Close() }()
 
-	// Read header
-	header := make([]byte, 12)
-	if _, err := io.ReadFull(file, header); err != nil {
-		return nil, fmt.Errorf("failed to read database header: %w", err)
-	}
+	return readMasterHeader(file)
+}
+
+// tagCacheReader reads a TagCache database one index entry at a time
+type tagCacheReader struct {
+	file    fs.File
+	index   *bufio.Reader
+	header  *MasterHeader
+	tagData map[int]*tagFile
+	clock   *playClock
+	// first is the first index entry, read to check that the index is usable
+	first *IndexEntry
+}
 
-	magic := binary.LittleEndian.Uint32(header[0:4])
-	if magic != TagCacheMagic {
-		// Try big endian
-		magic = binary.BigEndian.Uint32(header[0:4])
-		if magic != TagCacheMagic {
-			return nil, fmt.Errorf("invalid TagCache magic number: %x", magic)
+// close closes the index file
+func (tc *tagCacheReader) close() {
+	_ = tc.file.Close()
+}
+
+// openTagCache reads the master header and the tag files of the database.
+// It fails if the index has no readable entry, so the caller can fall back
+// to another source before any song was emitted.
+func (p *Parser) openTagCache(fsys fs.FS) (tc *tagCacheReader, err error) {
+	file, err := fsys.Open(path.Join(TagCacheDir, DatabaseFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database file: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = file.Close()
 		}
+	}()
+
+	index := bufio.NewReader(file)
+	header, err := readMasterHeader(index)
+	if err != nil {
+		return nil, err
 	}
 
-	dataSize := binary.LittleEndian.Uint32(header[4:8])
-	entryCount := binary.LittleEndian.Uint32(header[8:12])
+	p.logger.Info("TagCache: version=0x%02x, data_size=%d, entry_count=%d, serial=%d, commit_id=%d",
+		header.Version, header.DataSize, header.EntryCount, header.Serial, header.CommitID)
 
-	p.logger.Info("TagCache: data_size=%d, entry_count=%d", dataSize, entryCount)
+	if header.EntryCount < 0 {
+		return nil, fmt.Errorf("invalid entry count: %d", header.EntryCount)
+	}
 
-	// Read tag files
-	songs := make([]*models.Song, 0, entryCount)
-	// Tag files correspond to tag types defined in tagcache.h:
-	// tag_artist=0, tag_album=1, tag_genre=2, tag_title=3, tag_filename=4,
-	// tag_composer=5, tag_comment=6, tag_albumartist=7, tag_grouping=8
-	tagFiles := []string{
-		"database_0.tcd", // Artist
-		"database_1.tcd", // Album
-		"database_2.tcd", // Genre
-		"database_3.tcd", // Title
-		"database_4.tcd", // Filename
-		"database_5.tcd", // Composer
-		"database_6.tcd", // Comment
-		"database_7.tcd", // Album Artist
-		"database_8.tcd", // Grouping
+	tc = &tagCacheReader{
+		file:    file,
+		index:   index,
+		header:  header,
+		tagData: make(map[int]*tagFile),
+		clock:   &playClock{serial: header.Serial},
+	}
+	if info, err := file.Stat(); err == nil {
+		tc.clock.anchor = info.ModTime()
 	}
 
-	tagData := make(map[int]map[int]string)
-	for i, tagFile := range tagFiles {
-		data, err := p.readTagFile(filepath.Join(rockboxDir, tagFile))
+	// A truncated index still yields the entries before the damage
+	format := header.format
+	if header.EntryCount > 0 {
+		tc.first, err = readIndexEntry(index, make([]byte, format.entrySize()), header.ByteOrder, format)
 		if err != nil {
-			p.logger.Debug("Could not read tag file %s: %v", tagFile, err)
-			continue
+			return nil, fmt.Errorf("failed to read index entry 0: %w", err)
 		}
-		tagData[i] = data
 	}
 
-	// Read numeric tags from index
-	numericData, err := p.readNumericTags(file, int(entryCount))
-	if err != nil {
-		p.logger.Debug("Could not read numeric tags: %v", err)
+	// Read the tag files of the version, keyed by tag type
+	for _, tag := range format.stringTags() {
+		name, _ := format.tagFileName(tag)
+		data, err := p.readTagFile(fsys, path.Join(TagCacheDir, name))
+		if err != nil {
+			p.diagnose(name, -1, -1, "tag file not readable: %v", err)
+			continue
+		}
+		if data.version != format.version {
+			p.diagnose(name, 0, -1, "tag file version 0x%02x does not match index version 0x%02x",
+				data.version, format.version)
+			continue
+		}
+		tc.tagData[int(tag)] = data
 	}
 
-	// Build song entries
-	for i := 0; i < int(entryCount); i++ {
+	p.mu.Lock()
+	p.status.TagCacheVersion = int(format.version)
+	p.status.TotalSongs = int(header.EntryCount)
+	p.status.DatabaseDirty = header.Dirty != 0
+	p.status.Serial = header.Serial
+	p.status.CommitID = header.CommitID
+	p.mu.Unlock()
+
+	return tc, nil
+}
+
+// streamTagCache reads the index entries of an opened database and passes
+// their songs to emit. Only the tag files and one entry are held in memory.
+func (p *Parser) streamTagCache(ctx context.Context, tc *tagCacheReader, emit func(*models.Song) error) error {
+	header := tc.header
+	format := header.format
+	buf := make([]byte, format.entrySize())
+
+	for i := 0; i < int(header.EntryCount); i++ {
 		select {
 		case <-ctx.Done():
-			return nil, ctx.Err()
+			return ctx.Err()
 		default:
 		}
 
-		song := &models.Song{}
-
-		// Get string tags
-		if artists, ok := tagData[0]; ok {
-			if artist, ok := artists[i]; ok {
-				song.Artist = artist
-			}
-		}
-		if albums, ok := tagData[1]; ok {
-			if album, ok := albums[i]; ok {
-				song.Album = album
-			}
-		}
-		if genres, ok := tagData[2]; ok {
-			if genre, ok := genres[i]; ok {
-				song.Genre = genre
-			}
-		}
-		if titles, ok := tagData[3]; ok {
-			if title, ok := titles[i]; ok {
-				song.Title = title
-			}
-		}
-		if filenames, ok := tagData[4]; ok {
-			if filename, ok := filenames[i]; ok {
-				song.Path = filename
-			}
-		}
-		if albumArtists, ok := tagData[7]; ok {
-			if albumArtist, ok := albumArtists[i]; ok {
-				song.AlbumArtist = albumArtist
+		entry := tc.first
+		if i > 0 {
+			var err error
+			if entry, err = readIndexEntry(tc.index, buf, header.ByteOrder, format); err != nil {
+				p.diagnose(DatabaseFile, int64(masterHeaderSize+i*format.entrySize()), i,
+					"index ends after %d of %d entries", i, header.EntryCount)
+				return nil
 			}
 		}
 
-		// Get numeric tags
-		if numericData != nil {
-			if numeric, ok := numericData[i]; ok {
-				song.Year = numeric.Year
-				song.TrackNumber = numeric.TrackNumber
-				song.DiscNumber = numeric.DiscNumber
-				song.Duration = numeric.Length
-				song.Bitrate = numeric.Bitrate
-				song.PlayCount = numeric.PlayCount
-				song.Rating = numeric.Rating
-			}
+		p.countFlags(entry)
+		if entry.HasFlag(FlagDeleted) {
+			continue
 		}
 
-		// Generate Rockbox ID
-		song.RockboxID = p.generateRockboxID(song)
+		song := p.buildSong(entry, tagCacheLookup(i, entry, tc.tagData), tc.clock)
 
 		// Only add songs with valid paths
 		if song.Path != "" {
-			songs = append(songs, song)
+			if err := emit(song); err != nil {
+				return err
+			}
+		} else if _, ok := tc.tagData[int(TagFilename)]; ok {
+			name, _ := format.tagFileName(TagFilename)
+			p.diagnose(DatabaseFile, int64(masterHeaderSize+i*format.entrySize()), i,
+				"filename seek %d does not point at an entry in %s, song skipped",
+				entry.TagSeek[TagFilename], name)
 		}
+	}
+
+	return nil
+}
 
-		// Update progress
-		if i%100 == 0 {
-			p.mu.Lock()
-			p.status.ProcessedSongs = i
-			p.mu.Unlock()
+// countFlags records the flags of an index entry in the parse status
+func (p *Parser) countFlags(entry *IndexEntry) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if entry.HasFlag(FlagDeleted) {
+		p.status.DeletedEntries++
+	}
+	if entry.HasFlag(FlagDirCache) {
+		p.status.DirCacheEntries++
+	}
+	if entry.HasFlag(FlagDirtyNum) {
+		p.status.DirtyNumEntries++
+	}
+	if entry.HasFlag(FlagTrkNumGen) {
+		p.status.GeneratedTrackNumbers++
+	}
+	if entry.HasFlag(FlagResurrected) {
+		p.status.ResurrectedEntries++
+	}
+}
+
+// tagCacheLookup resolves the string tags of the index entry at position idx
+// through the loaded tag files
+func tagCacheLookup(idx int, entry *IndexEntry, tagData map[int]*tagFile) func(TagType) string {
+	return func(tag TagType) string {
+		data, ok := tagData[int(tag)]
+		if !ok {
+			return ""
 		}
+		// With FLAG_DIRCACHE the filename seek is a pointer into the device's
+		// directory cache, so find the filename entry owned by this index entry
+		if tag == TagFilename && entry.HasFlag(FlagDirCache) {
+			value, _ := data.owned(idx)
+			return value
+		}
+		value, _ := data.value(entry.TagSeek[tag])
+		return value
 	}
+}
 
-	return songs, nil
+// buildSong creates a song from the numeric values and flags of an index entry,
+// resolving string tags through lookup
+func (p *Parser) buildSong(entry *IndexEntry, tagLookup func(TagType) string, clock *playClock) *models.Song {
+	lookup := func(tag TagType) string {
+		if value := tagLookup(tag); value != Untagged {
+			return value
+		}
+		return ""
+	}
+
+	song := &models.Song{
+		Artist:      lookup(TagArtist),
+		Album:       lookup(TagAlbum),
+		Genre:       lookup(TagGenre),
+		Title:       lookup(TagTitle),
+		Path:        lookup(TagFilename),
+		Composer:    lookup(TagComposer),
+		Comment:     lookup(TagComment),
+		AlbumArtist: lookup(TagAlbumArtist),
+		Grouping:    lookup(TagGrouping),
+	}
+
+	numeric := entry.numericTags()
+	song.Year = numeric.Year
+	song.TrackNumber = numeric.TrackNumber
+	song.DiscNumber = numeric.DiscNumber
+	song.Duration = numeric.Length / 1000
+	song.Bitrate = numeric.Bitrate
+	song.PlayCount = numeric.PlayCount
+	song.Rating = numeric.Rating
+	song.PlayTime = numeric.PlayTime
+	song.LastPlayedSerial = int(numeric.LastPlayed)
+	song.LastPlayed = clock.lastPlayed(numeric.LastPlayed)
+	song.LastElapsed = numeric.LastElapsed
+	song.LastOffset = numeric.LastOffset
+	song.FileModifiedAt = fatTime(numeric.MTime)
+	song.TrackNumberGenerated = entry.HasFlag(FlagTrkNumGen)
+	song.NumericDirty = entry.HasFlag(FlagDirtyNum)
+
+	// Generate Rockbox ID
+	song.RockboxID = p.generateRockboxID(song)
+
+	return song
 }
 
 // NumericTagData holds numeric tag values for a song
@@ -342,10 +578,15 @@ type NumericTagData struct {
 	DiscNumber  int
 	TrackNumber int
 	Bitrate     int
-	Length      int
+	Length      int // in milliseconds
 	PlayCount   int
 	Rating      int
-	LastPlayed  int64
+	PlayTime    int   // total time played in milliseconds
+	LastPlayed  int64 // commit-relative counter, see playClock
+	CommitID    int   // commit in which the entry was added
+	MTime       uint32
+	LastElapsed int // resume position in milliseconds
+	LastOffset  int // resume position in bytes
 }
 
 // TagFileEntry represents an entry in a Rockbox tag file
@@ -356,119 +597,162 @@ type TagFileEntry struct {
 	TagData   string // The actual tag string
 }
 
-// readTagFile reads a single tag file and returns a map of index -> value
+// tagFile holds a database_N.tcd file. Values are decoded on lookup, so a
+// library costs the size of its tag files rather than a string per entry.
+type tagFile struct {
+	// version is the version byte of the file's magic
+	version byte
+	order   binary.ByteOrder
+	data    []byte
+	// starts holds the offsets of the readable entries in ascending order;
+	// tag_seek values must point at one of them
+	starts []int32
+	// owners maps idx_id to the offset of the entry owned by that index
+	// entry; it is built on first use since only FLAG_DIRCACHE needs it
+	owners map[int32]int32
+}
+
+// value returns the string of the entry at offset, as stored in tag_seek
+func (f *tagFile) value(offset int32) (string, bool) {
+	if _, ok := slices.BinarySearch(f.starts, offset); !ok {
+		return "", false
+	}
+	start := int(offset) + tagFileEntryHeaderSize
+	length := int(int32(f.order.Uint32(f.data[offset:])))
+	// Remove the null terminator and any alignment padding
+	return string(bytes.TrimRight(f.data[start:start+length], "\x00")), true
+}
+
+// owned returns the string of the entry owned by the index entry idxID
+func (f *tagFile) owned(idxID int) (string, bool) {
+	if f.owners == nil {
+		f.owners = make(map[int32]int32)
+		for _, offset := range f.starts {
+			if id := int32(f.order.Uint32(f.data[offset+4:])); id >= 0 {
+				f.owners[id] = offset
+			}
+		}
+	}
+	offset, ok := f.owners[int32(idxID)]
+	if !ok {
+		return "", false
+	}
+	return f.value(offset)
+}
+
+// readTagFile reads a single tag file
 // Tag files contain entries with: tag_length (4 bytes), idx_id (4 bytes), tag_data (variable)
-func (p *Parser) readTagFile(path string) (map[int]string, error) {
-	file, err := os.Open(path)
+// Damaged entries are reported as diagnostics and skipped; only an unreadable
+// header fails the whole file.
+func (p *Parser) readTagFile(fsys fs.FS, name string) (*tagFile, error) {
+	data, err := fs.ReadFile(fsys, name)
 	if err != nil {
 		return nil, err
 	}
-	defer func() { _ = file.Close() }()
 
-	// Read header (12 bytes: magic, datasize, entry_count)
-	header := make([]byte, 12)
-	if _, err := io.ReadFull(file, header); err != nil {
-		return nil, fmt.Errorf("failed to read tag file header: %w", err)
+	// Header is 12 bytes: magic, datasize, entry_count
+	if len(data) < tagCacheHeaderSize {
+		return nil, fmt.Errorf("failed to read tag file header: %w", io.ErrUnexpectedEOF)
 	}
 
-	magic := binary.LittleEndian.Uint32(header[0:4])
-	if magic != TagCacheMagic {
-		// Try big endian for cross-platform compatibility
-		magic = binary.BigEndian.Uint32(header[0:4])
-		if magic != TagCacheMagic {
-			return nil, fmt.Errorf("invalid magic number: got 0x%08x, want 0x%08x", magic, TagCacheMagic)
-		}
+	format, order, err := detectFormat(data[0:4])
+	if err != nil {
+		return nil, err
 	}
 
-	// dataSize := binary.LittleEndian.Uint32(header[4:8]) // Total data size (unused, we read until EOF)
-	entryCount := binary.LittleEndian.Uint32(header[8:12])
+	// The data size is unused, entries are read until entry_count or EOF
+	entryCount := int(int32(order.Uint32(data[8:12])))
+	file := path.Base(name)
 
-	result := make(map[int]string, entryCount)
+	result := &tagFile{
+		version: format.version,
+		order:   order,
+		data:    data,
+		starts:  make([]int32, 0, min(max(entryCount, 0), len(data)/tagFileEntryHeaderSize)),
+	}
+	offset := tagCacheHeaderSize
 
-	// Read tag file entries
-	// Each entry has: tag_length (4 bytes), idx_id (4 bytes), tag_data (tag_length bytes)
-	for i := 0; i < int(entryCount); i++ {
-		// Read entry header (8 bytes)
-		entryHeader := make([]byte, 8)
-		if _, err := io.ReadFull(file, entryHeader); err != nil {
-			if err == io.EOF {
-				break
-			}
-			return nil, fmt.Errorf("failed to read entry header at index %d: %w", i, err)
+	for i := 0; i < entryCount; i++ {
+		if offset+tagFileEntryHeaderSize > len(data) {
+			p.diagnose(file, int64(offset), i, "file ends after %d of %d entries", i, entryCount)
+			break
 		}
 
-		tagLength := int32(binary.LittleEndian.Uint32(entryHeader[0:4]))
-		idxID := int32(binary.LittleEndian.Uint32(entryHeader[4:8]))
-
-		if tagLength <= 0 {
-			continue // Skip deleted entries (empty tag)
-		}
+		tagLength := int32(order.Uint32(data[offset:]))
+		entryOffset := offset
 
-		// Read tag data
-		tagData := make([]byte, tagLength)
-		if _, err := io.ReadFull(file, tagData); err != nil {
-			if err == io.EOF {
+		if tagLength < 0 || int64(tagLength) > int64(len(data)-offset-tagFileEntryHeaderSize) {
+			p.diagnose(file, int64(offset), i, "tag length %d runs past the end of the file", tagLength)
+			next := resyncTagFile(data, offset+1, order)
+			if next < 0 {
 				break
 			}
-			return nil, fmt.Errorf("failed to read tag data at index %d: %w", i, err)
+			p.diagnose(file, int64(offset), i, "skipped %d bytes to the next readable entry", next-offset)
+			offset = next
+			continue
 		}
+		offset += tagFileEntryHeaderSize + int(tagLength)
 
-		// Remove null terminator if present
-		tagStr := string(tagData)
-		if len(tagStr) > 0 && tagStr[len(tagStr)-1] == 0 {
-			tagStr = tagStr[:len(tagStr)-1]
+		if tagLength == 0 {
+			continue // Skip deleted entries (empty tag)
 		}
-		tagStr = strings.TrimRight(tagStr, "\x00")
 
-		// Map by idx_id (the master index this tag belongs to)
-		if idxID >= 0 {
-			result[int(idxID)] = tagStr
-		}
+		result.starts = append(result.starts, int32(entryOffset))
 	}
 
 	return result, nil
 }
 
-// readNumericTags reads numeric tags from the index file
-func (p *Parser) readNumericTags(file *os.File, entryCount int) (map[int]*NumericTagData, error) {
-	result := make(map[int]*NumericTagData, entryCount)
-
-	// Skip to numeric data section (after header)
-	// Each entry has fixed-size numeric fields
-	entrySize := 32 // Approximate size per entry
+// tagFileEntryHeaderSize is the size of tag_length and idx_id
+const tagFileEntryHeaderSize = 8
+
+// resyncTagFile finds the first offset from start that holds a plausible tag
+// file entry: a length that fits the file and a non-empty, null-terminated
+// string followed only by padding. It returns -1 if there is none.
+func resyncTagFile(data []byte, start int, order binary.ByteOrder) int {
+	for offset := start; offset+tagFileEntryHeaderSize < len(data); offset++ {
+		tagLength := int(int32(order.Uint32(data[offset:])))
+		idxID := int32(order.Uint32(data[offset+4:]))
+		if tagLength < 2 || tagLength > len(data)-offset-tagFileEntryHeaderSize || idxID < -1 {
+			continue
+		}
 
-	for i := 0; i < entryCount; i++ {
-		data := make([]byte, entrySize)
-		n, err := file.Read(data)
-		if err != nil {
-			if err == io.EOF {
-				break
-			}
-			return nil, err
+		value := data[offset+tagFileEntryHeaderSize : offset+tagFileEntryHeaderSize+tagLength]
+		end := bytes.IndexByte(value, 0)
+		if end <= 0 || !utf8.Valid(value[:end]) {
+			continue
 		}
-		if n < entrySize {
-			break
+		if len(bytes.Trim(value[end:], "\x00")) == 0 {
+			return offset
 		}
+	}
+	return -1
+}
 
-		result[i] = &NumericTagData{
-			Year:        int(binary.LittleEndian.Uint16(data[0:2])),
-			DiscNumber:  int(data[2]),
-			TrackNumber: int(data[3]),
-			Bitrate:     int(binary.LittleEndian.Uint16(data[4:6])),
-			Length:      int(binary.LittleEndian.Uint32(data[6:10])),
-			PlayCount:   int(binary.LittleEndian.Uint32(data[10:14])),
-			Rating:      int(data[14]),
+// scanFilesystem scans the filesystem and the mapped extra volumes for audio
+// files and passes a song for each to emit
+func (p *Parser) scanFilesystem(ctx context.Context, fsys fs.FS, emit func(*models.Song) error) error {
+	p.logger.Info("Scanning filesystem for audio files...")
+
+	found := 0
+	if err := p.scanVolume(ctx, fsys, "", emit, &found); err != nil {
+		return err
+	}
+	volumes := p.getVolumes()
+	for _, volume := range slices.Sorted(maps.Keys(volumes)) {
+		p.logger.Info("Scanning volume %s...", volumeLabel(volume))
+		if err := p.scanVolume(ctx, volumes[volume], volume, emit, &found); err != nil {
+			return err
 		}
 	}
 
-	return result, nil
+	p.logger.Info("Found %d audio files", found)
+	return nil
 }
 
-// scanFilesystem scans the filesystem for audio files
-func (p *Parser) scanFilesystem(ctx context.Context) ([]*models.Song, error) {
-	p.logger.Info("Scanning filesystem for audio files...")
-
-	var songs []*models.Song
+// scanVolume scans one volume for audio files, naming them with the volume
+// prefix, and counts them in found
+func (p *Parser) scanVolume(ctx context.Context, fsys fs.FS, volume string, emit func(*models.Song) error, found *int) error {
 	audioExts := map[string]bool{
 		".mp3":  true,
 		".flac": true,
@@ -482,7 +766,7 @@ func (p *Parser) scanFilesystem(ctx context.Context) ([]*models.Song, error) {
 		".opus": true,
 	}
 
-	err := filepath.Walk(p.rockboxPath, func(path string, info os.FileInfo, err error) error {
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return nil // Skip files with errors
 		}
@@ -493,26 +777,26 @@ func (p *Parser) scanFilesystem(ctx context.Context) ([]*models.Song, error) {
 		default:
 		}
 
-		if info.IsDir() {
+		if d.IsDir() {
 			// Skip hidden directories
-			if strings.HasPrefix(info.Name(), ".") && path != p.rockboxPath {
-				return filepath.SkipDir
+			if strings.HasPrefix(d.Name(), ".") && name != "." {
+				return fs.SkipDir
 			}
 			return nil
 		}
 
-		ext := strings.ToLower(filepath.Ext(path))
+		ext := strings.ToLower(path.Ext(name))
 		if !audioExts[ext] {
 			return nil
 		}
 
-		// Create relative path for Rockbox
-		relPath, err := filepath.Rel(p.rockboxPath, path)
+		info, err := d.Info()
 		if err != nil {
-			relPath = path
+			return nil
 		}
-		// Convert to Rockbox path format (forward slashes)
-		rockboxPath := "/" + strings.ReplaceAll(relPath, "\\", "/")
+
+		// Rockbox paths are absolute from the root of the volume
+		rockboxPath := VolumePath(volume, "/"+name)
 
 		song := &models.Song{
 			Path:     rockboxPath,
@@ -520,7 +804,7 @@ func (p *Parser) scanFilesystem(ctx context.Context) ([]*models.Song, error) {
 		}
 
 		// Extract metadata from filename if no other info
-		baseName := strings.TrimSuffix(info.Name(), ext)
+		baseName := strings.TrimSuffix(d.Name(), ext)
 		parts := strings.SplitN(baseName, " - ", 2)
 		if len(parts) == 2 {
 			song.Artist = strings.TrimSpace(parts[0])
@@ -529,25 +813,53 @@ func (p *Parser) scanFilesystem(ctx context.Context) ([]*models.Song, error) {
 			song.Title = baseName
 		}
 
+		if tags, err := audiotag.ReadFS(fsys, name); err == nil {
+			applyAudioTags(song, tags)
+		} else if !errors.Is(err, audiotag.ErrUnsupported) {
+			p.logger.Debug("Could not read tags of %s: %v", rockboxPath, err)
+		}
+
 		song.RockboxID = p.generateRockboxID(song)
-		songs = append(songs, song)
+		if err := emit(song); err != nil {
+			return err
+		}
 
-		if len(songs)%100 == 0 {
-			p.mu.Lock()
-			p.status.ProcessedSongs = len(songs)
-			p.mu.Unlock()
-			p.logger.Debug("Scanned %d files...", len(songs))
+		*found++
+		if *found%100 == 0 {
+			p.logger.Debug("Scanned %d files...", *found)
 		}
 
 		return nil
 	})
 
 	if err != nil {
-		return nil, fmt.Errorf("filesystem scan failed: %w", err)
+		return fmt.Errorf("filesystem scan failed: %w", err)
 	}
+	return nil
+}
 
-	p.logger.Info("Found %d audio files", len(songs))
-	return songs, nil
+// applyAudioTags fills a scanned song from the tags read from its file,
+// keeping the values derived from the filename where a tag is missing
+func applyAudioTags(song *models.Song, tags *audiotag.Tags) {
+	if tags.Title != "" {
+		song.Title = tags.Title
+	}
+	if tags.Artist != "" {
+		song.Artist = tags.Artist
+	}
+	song.AlbumArtist = tags.AlbumArtist
+	song.Album = tags.Album
+	song.Genre = tags.Genre
+	song.Composer = tags.Composer
+	song.Comment = tags.Comment
+	song.Grouping = tags.Grouping
+	song.Year = tags.Year
+	song.TrackNumber = tags.TrackNumber
+	song.DiscNumber = tags.DiscNumber
+	song.Duration = tags.Duration / 1000
+	song.Bitrate = tags.Bitrate
+	song.Frequency = tags.SampleRate
+	song.MusicBrainzID = tags.MusicBrainzTrackID
 }
 
 // generateRockboxID generates a unique ID for a song based on its path
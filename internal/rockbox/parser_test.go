@@ -1,11 +1,15 @@
 package rockbox
 
 import (
+	"bytes"
 	"context"
 	"encoding/binary"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"reflect"
 	"testing"
+	"testing/fstest"
 
 	"github.com/Ardakilic/rocklist/internal/models"
 )
@@ -95,16 +99,12 @@ func TestParser_ValidatePath_Invalid(t *testing.T) {
 }
 
 func TestParser_ValidatePath_NoDB(t *testing.T) {
-	// Create temp dir with .rockbox but no database
-	tmpDir := t.TempDir()
-	rockboxDir := filepath.Join(tmpDir, TagCacheDir)
-	if err := os.MkdirAll(rockboxDir, 0755); err != nil {
-		t.Fatalf("Failed to create test dir: %v", err)
+	// .rockbox exists but holds no database
+	fsys := fstest.MapFS{
+		TagCacheDir + "/config.cfg": &fstest.MapFile{Data: []byte("volume: -10")},
 	}
 
-	parser := NewParser(tmpDir, nil)
-	err := parser.ValidatePath()
-
+	err := NewParserFS(fsys, "device", nil).ValidatePath()
 	if err != models.ErrRockboxDatabaseNotFound {
 		t.Errorf("ValidatePath() error = %v, want ErrRockboxDatabaseNotFound", err)
 	}
@@ -131,6 +131,38 @@ func TestParser_ValidatePath_Valid(t *testing.T) {
 	}
 }
 
+func TestParser_ValidatePath_FS(t *testing.T) {
+	tests := []struct {
+		name string
+		fsys fstest.MapFS
+		want error
+	}{
+		{"empty", fstest.MapFS{}, models.ErrRockboxPathInvalid},
+		{"database", fstest.MapFS{TagCacheDir + "/" + DatabaseFile: {}}, nil},
+		{"changelog only", fstest.MapFS{TagCacheDir + "/" + ChangelogFile: {}}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := NewParserFS(tt.fsys, "device.zip", nil).ValidatePath(); err != tt.want {
+				t.Errorf("ValidatePath() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParser_SetFS(t *testing.T) {
+	parser := NewParser("/device", nil)
+	parser.SetFS(fstest.MapFS{}, "backup.zip")
+	if parser.GetPath() != "backup.zip" || parser.fsys == nil {
+		t.Errorf("SetFS() path = %q, fsys = %v, want backup.zip and the file system", parser.GetPath(), parser.fsys)
+	}
+
+	parser.SetPath("/device")
+	if parser.fsys != nil {
+		t.Error("SetPath() should switch back to reading from disk")
+	}
+}
+
 func TestParser_Parse_InvalidPath(t *testing.T) {
 	parser := NewParser("", nil)
 	_, err := parser.Parse(context.Background())
@@ -268,65 +300,134 @@ func TestNumericTagData_Fields(t *testing.T) {
 	}
 }
 
-func TestParser_ScanFilesystem(t *testing.T) {
-	tmpDir := t.TempDir()
-
-	// Create some audio files
-	musicDir := filepath.Join(tmpDir, "Music")
-	_ = os.MkdirAll(musicDir, 0755)
-
-	testFiles := []string{
-		"Artist - Song.mp3",
-		"Another Artist - Another Song.flac",
-		"Simple Title.ogg",
-		"not_audio.txt",
-	}
+// scanSongs runs the filesystem scan and collects the songs it emits
+func scanSongs(ctx context.Context, parser *Parser, fsys fs.FS) ([]*models.Song, error) {
+	var songs []*models.Song
+	err := parser.scanFilesystem(ctx, fsys, func(song *models.Song) error {
+		songs = append(songs, song)
+		return nil
+	})
+	return songs, err
+}
 
-	for _, f := range testFiles {
-		_ = os.WriteFile(filepath.Join(musicDir, f), []byte("test"), 0644)
+func TestParser_ScanFilesystem(t *testing.T) {
+	fsys := fstest.MapFS{
+		"Music/Artist - Song.mp3":                  {Data: []byte("test")},
+		"Music/Another Artist - Another Song.flac": {Data: []byte("test")},
+		"Music/Simple Title.ogg":                   {Data: []byte("test")},
+		"Music/not_audio.txt":                      {Data: []byte("test")},
+		".hidden/hidden.mp3":                       {Data: []byte("test")}, // hidden dirs are skipped
+		TagCacheDir + "/" + DatabaseFile:           {Data: []byte("test")},
 	}
 
-	// Create hidden dir that should be skipped
-	hiddenDir := filepath.Join(tmpDir, ".hidden")
-	_ = os.MkdirAll(hiddenDir, 0755)
-	_ = os.WriteFile(filepath.Join(hiddenDir, "hidden.mp3"), []byte("test"), 0644)
-
 	logger := &mockLogger{}
-	parser := NewParser(tmpDir, logger)
+	parser := NewParserFS(fsys, "device", logger)
 
-	songs, err := parser.scanFilesystem(context.Background())
+	songs, err := scanSongs(context.Background(), parser, fsys)
 	if err != nil {
 		t.Fatalf("scanFilesystem() error = %v", err)
 	}
 
 	// Should find 3 audio files (not the txt or hidden)
 	if len(songs) != 3 {
-		t.Errorf("scanFilesystem() found %d songs, want 3", len(songs))
+		t.Fatalf("scanFilesystem() found %d songs, want 3", len(songs))
 	}
 
-	// Check metadata extraction from filename
-	for _, song := range songs {
-		if song.Path == "" {
-			t.Error("Song path should not be empty")
+	// WalkDir visits files in lexical order
+	want := []struct{ path, artist, title string }{
+		{"/Music/Another Artist - Another Song.flac", "Another Artist", "Another Song"},
+		{"/Music/Artist - Song.mp3", "Artist", "Song"},
+		{"/Music/Simple Title.ogg", "", "Simple Title"},
+	}
+	for i, song := range songs {
+		if song.Path != want[i].path || song.Artist != want[i].artist || song.Title != want[i].title {
+			t.Errorf("song %d = %q %q/%q, want %q %q/%q", i, song.Path, song.Artist, song.Title,
+				want[i].path, want[i].artist, want[i].title)
 		}
-		if song.RockboxID == "" {
-			t.Error("Song RockboxID should not be empty")
+		if song.RockboxID == "" || song.FileSize != 4 {
+			t.Errorf("song %d RockboxID = %q, FileSize = %d", i, song.RockboxID, song.FileSize)
 		}
 	}
 }
 
-func TestParser_ScanFilesystem_Cancelled(t *testing.T) {
-	tmpDir := t.TempDir()
-	musicDir := filepath.Join(tmpDir, "Music")
-	_ = os.MkdirAll(musicDir, 0755)
-	_ = os.WriteFile(filepath.Join(musicDir, "test.mp3"), []byte("test"), 0644)
+// flacFixture builds a minimal FLAC file with one second of audio at 44.1 kHz
+// and the given Vorbis comments
+func flacFixture(comments ...string) []byte {
+	var vc bytes.Buffer
+	le := func(n int) { _ = binary.Write(&vc, binary.LittleEndian, uint32(n)) }
+	le(0) // empty vendor string
+	le(len(comments))
+	for _, c := range comments {
+		le(len(c))
+		vc.WriteString(c)
+	}
+
+	var b bytes.Buffer
+	b.WriteString("fLaC")
+	streamInfo := make([]byte, 34)
+	binary.BigEndian.PutUint64(streamInfo[10:], 44100<<44|1<<41|15<<36|44100)
+	b.Write([]byte{0, 0, 0, byte(len(streamInfo))})
+	b.Write(streamInfo)
+	n := vc.Len()
+	b.Write([]byte{0x84, byte(n >> 16), byte(n >> 8), byte(n)}) // last block, VORBIS_COMMENT
+	b.Write(vc.Bytes())
+	b.Write(make([]byte, 1000))
+	return b.Bytes()
+}
 
-	parser := NewParser(tmpDir, nil)
+func TestParser_ScanFilesystem_ReadsTags(t *testing.T) {
+	tagged := flacFixture(
+		"TITLE=Tagged Title",
+		"ARTIST=Tagged Artist",
+		"ALBUM=Tagged Album",
+		"GENRE=Jazz",
+		"DATE=1959",
+		"TRACKNUMBER=2",
+		"MUSICBRAINZ_TRACKID=mbid-123",
+	)
+	fsys := fstest.MapFS{
+		"Music/01 - track.flac": {Data: tagged},
+		// Tags without a title keep the title from the filename
+		"Music/File Artist - File Title.flac": {Data: flacFixture("ALBUM=Only Album")},
+	}
+
+	parser := NewParserFS(fsys, "device", &mockLogger{})
+	songs, err := scanSongs(context.Background(), parser, fsys)
+	if err != nil {
+		t.Fatalf("scanFilesystem() error = %v", err)
+	}
+	if len(songs) != 2 {
+		t.Fatalf("scanFilesystem() found %d songs, want 2", len(songs))
+	}
+
+	got := songs[0]
+	if got.Title != "Tagged Title" || got.Artist != "Tagged Artist" || got.Album != "Tagged Album" {
+		t.Errorf("song = %q/%q/%q, want the tag values", got.Artist, got.Album, got.Title)
+	}
+	if got.Genre != "Jazz" || got.Year != 1959 || got.TrackNumber != 2 {
+		t.Errorf("Genre, Year, TrackNumber = %q, %d, %d, want Jazz, 1959, 2", got.Genre, got.Year, got.TrackNumber)
+	}
+	if got.Duration != 1 || got.Frequency != 44100 {
+		t.Errorf("Duration, Frequency = %d, %d, want 1, 44100", got.Duration, got.Frequency)
+	}
+	if got.MusicBrainzID != "mbid-123" {
+		t.Errorf("MusicBrainzID = %q, want mbid-123", got.MusicBrainzID)
+	}
+
+	got = songs[1]
+	if got.Title != "File Title" || got.Artist != "File Artist" || got.Album != "Only Album" {
+		t.Errorf("song = %q/%q/%q, want filename artist and title with the tag album", got.Artist, got.Album, got.Title)
+	}
+}
+
+func TestParser_ScanFilesystem_Cancelled(t *testing.T) {
+	fsys := fstest.MapFS{"Music/test.mp3": {Data: []byte("test")}}
+	parser := NewParserFS(fsys, "device", nil)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	cancel() // Cancel immediately
 
-	_, err := parser.scanFilesystem(ctx)
+	_, err := scanSongs(ctx, parser, fsys)
 	// Error is wrapped, so check if it's non-nil
 	if err == nil {
 		t.Error("scanFilesystem() with cancelled context should return error")
@@ -336,23 +437,20 @@ func TestParser_ScanFilesystem_Cancelled(t *testing.T) {
 func TestParser_ReadTagFile_NotFound(t *testing.T) {
 	parser := NewParser("/test", nil)
 
-	_, err := parser.readTagFile("/nonexistent/file.tcd")
+	_, err := parser.readTagFile(fstest.MapFS{}, "nonexistent/file.tcd")
 	if err == nil {
 		t.Error("readTagFile() should return error for nonexistent file")
 	}
 }
 
 func TestParser_ReadTagFile_InvalidMagic(t *testing.T) {
-	tmpDir := t.TempDir()
-	tagFile := filepath.Join(tmpDir, "test.tcd")
-
 	// Write file with invalid magic
 	data := make([]byte, 12)
 	binary.LittleEndian.PutUint32(data[0:4], 0x12345678) // Invalid magic
-	_ = os.WriteFile(tagFile, data, 0644)
+	fsys := fstest.MapFS{"test.tcd": {Data: data}}
 
-	parser := NewParser(tmpDir, nil)
-	_, err := parser.readTagFile(tagFile)
+	parser := NewParserFS(fsys, "device", nil)
+	_, err := parser.readTagFile(fsys, "test.tcd")
 
 	if err == nil {
 		t.Error("readTagFile() should return error for invalid magic")
@@ -360,9 +458,6 @@ func TestParser_ReadTagFile_InvalidMagic(t *testing.T) {
 }
 
 func TestParser_ReadTagFile_Valid(t *testing.T) {
-	tmpDir := t.TempDir()
-	tagFile := filepath.Join(tmpDir, "test.tcd")
-
 	// Create valid tag file with proper Rockbox format
 	// Each entry has: tag_length (4 bytes), idx_id (4 bytes), tag_data (tag_length bytes)
 	header := make([]byte, 12)
@@ -384,80 +479,198 @@ func TestParser_ReadTagFile_Valid(t *testing.T) {
 
 	fullData := append(header, entry1...)
 	fullData = append(fullData, entry2...)
-	_ = os.WriteFile(tagFile, fullData, 0644)
+	fsys := fstest.MapFS{"test.tcd": {Data: fullData}}
 
-	parser := NewParser(tmpDir, nil)
-	result, err := parser.readTagFile(tagFile)
+	parser := NewParserFS(fsys, "device", nil)
+	result, err := parser.readTagFile(fsys, "test.tcd")
 
 	if err != nil {
 		t.Fatalf("readTagFile() error = %v", err)
 	}
 
-	if len(result) != 2 {
-		t.Errorf("readTagFile() returned %d entries, want 2", len(result))
+	values := tagFileValues(result)
+	if len(values) != 2 {
+		t.Errorf("readTagFile() returned %d entries, want 2", len(values))
+	}
+
+	// Entries are keyed by their file offset (header is 12 bytes, entry 1 is 14 bytes)
+	if values[12] != "test1" {
+		t.Errorf("readTagFile() entry at 12 = %v, want test1", values[12])
 	}
 
-	if result[0] != "test1" {
-		t.Errorf("readTagFile() entry 0 = %v, want test1", result[0])
+	if values[26] != "test2" {
+		t.Errorf("readTagFile() entry at 26 = %v, want test2", values[26])
 	}
 
-	if result[1] != "test2" {
-		t.Errorf("readTagFile() entry 1 = %v, want test2", result[1])
+	if got, _ := result.owned(1); got != "test2" {
+		t.Errorf("readTagFile() idx_id 1 = %v, want test2", got)
+	}
+
+	if _, ok := result.value(13); ok {
+		t.Error("value() should not resolve an offset inside an entry")
 	}
 }
 
-func TestParser_ReadNumericTags(t *testing.T) {
-	tmpDir := t.TempDir()
-	testFile := filepath.Join(tmpDir, "numeric.tcd")
+func TestParser_ReadTagFile_BigEndian(t *testing.T) {
+	data := make([]byte, 12+14)
+	binary.BigEndian.PutUint32(data[0:4], TagCacheMagic)
+	binary.BigEndian.PutUint32(data[4:8], 14)  // data size
+	binary.BigEndian.PutUint32(data[8:12], 1)  // entry count
+	binary.BigEndian.PutUint32(data[12:16], 6) // tag_length including null
+	binary.BigEndian.PutUint32(data[16:20], 3) // idx_id
+	copy(data[20:], []byte("test1\x00"))
+	fsys := fstest.MapFS{"test.tcd": {Data: data}}
+
+	parser := NewParserFS(fsys, "device", nil)
+	result, err := parser.readTagFile(fsys, "test.tcd")
+	if err != nil {
+		t.Fatalf("readTagFile() error = %v", err)
+	}
 
-	// Create file with numeric data
-	data := make([]byte, 64) // 2 entries
+	if got, _ := result.value(12); got != "test1" {
+		t.Errorf("readTagFile() entry at 12 = %v, want test1", got)
+	}
+	if got, _ := result.owned(3); got != "test1" {
+		t.Errorf("readTagFile() idx_id 3 = %v, want test1", got)
+	}
+}
 
-	// Entry 0
-	binary.LittleEndian.PutUint16(data[0:2], 2024)    // Year
-	data[2] = 1                                       // DiscNumber
-	data[3] = 5                                       // TrackNumber
-	binary.LittleEndian.PutUint16(data[4:6], 320)     // Bitrate
-	binary.LittleEndian.PutUint32(data[6:10], 240000) // Length
-	binary.LittleEndian.PutUint32(data[10:14], 10)    // PlayCount
-	data[14] = 5                                      // Rating
+// tagFileValues returns the values of a tag file keyed by entry offset
+func tagFileValues(f *tagFile) map[int]string {
+	values := make(map[int]string, len(f.starts))
+	for _, offset := range f.starts {
+		values[int(offset)], _ = f.value(offset)
+	}
+	return values
+}
 
-	_ = os.WriteFile(testFile, data, 0644)
+// tagFileBytes builds a little-endian tag file from raw entries, claiming
+// count entries in the header
+func tagFileBytes(count int, entries ...[]byte) []byte {
+	body := bytes.Join(entries, nil)
+	data := make([]byte, 12, 12+len(body))
+	binary.LittleEndian.PutUint32(data[0:4], TagCacheMagic)
+	binary.LittleEndian.PutUint32(data[4:8], uint32(len(body)))
+	binary.LittleEndian.PutUint32(data[8:12], uint32(count))
+	return append(data, body...)
+}
 
-	file, _ := os.Open(testFile)
-	defer func() { _ = file.Close() }()
+// tagEntry builds a tag file entry with an explicit tag_length
+func tagEntry(length, idxID int32, value string) []byte {
+	entry := make([]byte, 8, 8+len(value))
+	binary.LittleEndian.PutUint32(entry[0:4], uint32(length))
+	binary.LittleEndian.PutUint32(entry[4:8], uint32(idxID))
+	return append(entry, value...)
+}
 
-	parser := NewParser(tmpDir, nil)
-	result, err := parser.readNumericTags(file, 2)
+func TestParser_ReadTagFile_Corrupt(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  []byte
+		want  map[int]string
+		diags []models.ParseDiagnostic
+	}{
+		{
+			name: "truncated entry data",
+			data: tagFileBytes(2, tagEntry(6, 0, "test1\x00"), tagEntry(6, 1, "te")),
+			want: map[int]string{12: "test1"},
+			diags: []models.ParseDiagnostic{
+				{File: "test.tcd", Offset: 26, Entry: 1, Reason: "tag length 6 runs past the end of the file"},
+			},
+		},
+		{
+			name: "fewer entries than the header",
+			data: tagFileBytes(3, tagEntry(6, 0, "test1\x00")),
+			want: map[int]string{12: "test1"},
+			diags: []models.ParseDiagnostic{
+				{File: "test.tcd", Offset: 26, Entry: 1, Reason: "file ends after 1 of 3 entries"},
+			},
+		},
+		{
+			name: "bad length recovers at the next entry",
+			data: tagFileBytes(3,
+				tagEntry(6, 0, "test1\x00"),
+				tagEntry(-40, 1, "garbage\x00"),
+				tagEntry(8, 2, "test3\x00\x00\x00")),
+			want: map[int]string{12: "test1", 42: "test3"},
+			diags: []models.ParseDiagnostic{
+				{File: "test.tcd", Offset: 26, Entry: 1, Reason: "tag length -40 runs past the end of the file"},
+				{File: "test.tcd", Offset: 26, Entry: 1, Reason: "skipped 16 bytes to the next readable entry"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fsys := fstest.MapFS{".rockbox/test.tcd": {Data: tt.data}}
+			parser := NewParserFS(fsys, "device", &mockLogger{})
+
+			result, err := parser.readTagFile(fsys, ".rockbox/test.tcd")
+			if err != nil {
+				t.Fatalf("readTagFile() error = %v", err)
+			}
+			if got := tagFileValues(result); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readTagFile() = %v, want %v", got, tt.want)
+			}
+
+			status := parser.GetStatus()
+			if !reflect.DeepEqual(status.Diagnostics, tt.diags) {
+				t.Errorf("Diagnostics = %+v, want %+v", status.Diagnostics, tt.diags)
+			}
+			if status.ErrorCount != len(tt.diags) {
+				t.Errorf("ErrorCount = %d, want %d", status.ErrorCount, len(tt.diags))
+			}
+		})
+	}
+}
 
-	if err != nil {
-		t.Fatalf("readNumericTags() error = %v", err)
+func TestParser_Diagnose_Limit(t *testing.T) {
+	parser := NewParser("/test", &mockLogger{})
+	for i := 0; i < maxDiagnostics+5; i++ {
+		parser.diagnose(DatabaseFile, int64(i), i, "bad entry")
 	}
 
-	if result[0].Year != 2024 {
-		t.Errorf("Year = %v, want 2024", result[0].Year)
+	status := parser.GetStatus()
+	if len(status.Diagnostics) != maxDiagnostics || status.ErrorCount != maxDiagnostics+5 {
+		t.Errorf("kept %d diagnostics, counted %d, want %d and %d",
+			len(status.Diagnostics), status.ErrorCount, maxDiagnostics, maxDiagnostics+5)
 	}
-	if result[0].TrackNumber != 5 {
-		t.Errorf("TrackNumber = %v, want 5", result[0].TrackNumber)
+	if status.LastError != "database_idx.tcd:1004: entry 1004: bad entry" {
+		t.Errorf("LastError = %q", status.LastError)
 	}
 }
 
-func TestParser_ParseWithFilesystemFallback(t *testing.T) {
-	tmpDir := t.TempDir()
-	rockboxDir := filepath.Join(tmpDir, TagCacheDir)
-	_ = os.MkdirAll(rockboxDir, 0755)
+func FuzzReadTagFile(f *testing.F) {
+	f.Add(tagFileBytes(2, tagEntry(6, 0, "test1\x00"), tagEntry(6, 1, "test2\x00")))
+	f.Add(tagFileBytes(3, tagEntry(6, 0, "test1\x00"), tagEntry(-40, 1, "garbage\x00"), tagEntry(6, 2, "test3\x00")))
+	f.Add(tagFileBytes(1 << 30))
+	f.Add([]byte("TCH"))
 
-	// Create invalid database file to trigger fallback
-	dbFile := filepath.Join(rockboxDir, DatabaseFile)
-	_ = os.WriteFile(dbFile, []byte("invalid"), 0644)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		fsys := fstest.MapFS{"test.tcd": {Data: data}}
+		parser := NewParserFS(fsys, "device", &mockLogger{})
 
-	// Create some audio files
-	musicDir := filepath.Join(tmpDir, "Music")
-	_ = os.MkdirAll(musicDir, 0755)
-	_ = os.WriteFile(filepath.Join(musicDir, "test.mp3"), []byte("test"), 0644)
+		result, err := parser.readTagFile(fsys, "test.tcd")
+		if err != nil {
+			return
+		}
+		for offset, value := range tagFileValues(result) {
+			if offset < tagCacheHeaderSize || offset+tagFileEntryHeaderSize+len(value) > len(data) {
+				t.Errorf("entry offset %d outside the file of %d bytes", offset, len(data))
+			}
+		}
+	})
+}
+
+func TestParser_ParseWithFilesystemFallback(t *testing.T) {
+	fsys := fstest.MapFS{
+		// Invalid database file to trigger fallback
+		TagCacheDir + "/" + DatabaseFile: {Data: []byte("invalid")},
+		"Music/test.mp3":                 {Data: []byte("test")},
+	}
 
 	logger := &mockLogger{}
-	parser := NewParser(tmpDir, logger)
+	parser := NewParserFS(fsys, "backup.zip", logger)
 
 	songs, err := parser.Parse(context.Background())
 	if err != nil {
@@ -0,0 +1,137 @@
+package rockbox
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Ardakilic/rocklist/internal/models"
+)
+
+const (
+	// ScrobblerLogFile is written to the root of the device by the Last.fm
+	// scrobbler plugin
+	ScrobblerLogFile = ".scrobbler.log"
+	// scrobblerHeader starts the first line of an Audioscrobbler portable log
+	scrobblerHeader = "#AUDIOSCROBBLER/"
+)
+
+// ScrobblerLog is a parsed .scrobbler.log
+type ScrobblerLog struct {
+	// Version is the format version from the header, e.g. 1.1
+	Version string
+	// TZ is UTC when timestamps are in UTC, and UNKNOWN when they are the
+	// device's local time, which is the case on players without a time zone
+	TZ string
+	// Client names the player and plugin, e.g. "Rockbox ipodvideo $Revision$"
+	Client string
+	// Plays holds the plays in log order
+	Plays []*models.PlayEvent
+	// Invalid is the number of lines that were skipped as unreadable
+	Invalid int
+}
+
+// ReadScrobblerLog reads a log in the Audioscrobbler portable player format.
+// After the #-prefixed header, each line holds the tab-separated fields
+//
+//	ARTIST ALBUM TITLE TRACKNUM LENGTH RATING TIMESTAMP MUSICBRAINZ_TRACKID
+//
+// where RATING is L for a track listened to and S for a skipped one, and
+// TIMESTAMP is in Unix seconds. The MusicBrainz ID may be empty or left
+// out; a value starting with / is read as the file path instead. A line
+// cut short, as when the player was switched off mid-write, is skipped
+// and counted as invalid.
+func ReadScrobblerLog(r io.Reader) (*ScrobblerLog, error) {
+	log := &ScrobblerLog{}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	first := true
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if first {
+			first = false
+			line = strings.TrimPrefix(line, "\ufeff")
+			version, ok := strings.CutPrefix(line, scrobblerHeader)
+			if !ok {
+				return nil, fmt.Errorf("%w: missing %s header", models.ErrInvalidScrobblerLog, scrobblerHeader)
+			}
+			log.Version = version
+			continue
+		}
+
+		if value, ok := strings.CutPrefix(line, "#TZ/"); ok {
+			log.TZ = value
+			continue
+		}
+		if value, ok := strings.CutPrefix(line, "#CLIENT/"); ok {
+			log.Client = value
+			continue
+		}
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		play, ok := parseScrobblerLine(line)
+		if !ok {
+			log.Invalid++
+			continue
+		}
+		log.Plays = append(log.Plays, play)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read scrobbler log: %w", err)
+	}
+	if first {
+		return nil, fmt.Errorf("%w: empty file", models.ErrInvalidScrobblerLog)
+	}
+
+	return log, nil
+}
+
+// parseScrobblerLine decodes one play. The artist, title, rating and
+// timestamp are required; the track number and length may be empty.
+func parseScrobblerLine(line string) (*models.PlayEvent, bool) {
+	fields := strings.Split(line, "\t")
+	if len(fields) < 7 {
+		return nil, false
+	}
+
+	play := &models.PlayEvent{
+		Artist: fields[0],
+		Album:  fields[1],
+		Title:  fields[2],
+	}
+	if play.Artist == "" || play.Title == "" {
+		return nil, false
+	}
+
+	play.TrackNumber, _ = strconv.Atoi(fields[3])
+	play.Duration, _ = strconv.Atoi(fields[4])
+
+	switch fields[5] {
+	case "L":
+	case "S":
+		play.Skipped = true
+	default:
+		return nil, false
+	}
+
+	timestamp, err := strconv.ParseInt(fields[6], 10, 64)
+	if err != nil || timestamp <= 0 {
+		return nil, false
+	}
+	play.PlayedAt = time.Unix(timestamp, 0).UTC()
+
+	if len(fields) > 7 {
+		if id := strings.TrimSpace(fields[7]); strings.HasPrefix(id, "/") {
+			play.Path = id
+		} else {
+			play.MusicBrainzID = id
+		}
+	}
+	return play, true
+}
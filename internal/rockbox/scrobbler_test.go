@@ -0,0 +1,75 @@
+package rockbox
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Ardakilic/rocklist/internal/models"
+)
+
+const testScrobblerLog = "#AUDIOSCROBBLER/1.1\n" +
+	"#TZ/UNKNOWN\n" +
+	"#CLIENT/Rockbox ipodvideo $Revision$\n" +
+	"Metallica\tMaster of Puppets\tBattery\t1\t312\tL\t1700000000\tb1a9c0e9-d987-4042-ae91-78d6a3267d69\n" +
+	"Sigur Rós\t( )\tUntitled 1\t\t398\tS\t1700000400\t\n" +
+	"Burzum\tFilosofem\tDunkelheit\t1\t425\tL\t1700000900\t/<microSD1>/Music/Burzum/01 - Dunkelheit.mp3\n" +
+	"Emperor\tAnthems\tAlsvartr\t2\t\tL\t1700001400\n" +
+	"Truncated\tLine\tTitle\t1\t200\tL\n" +
+	"No Title\tAlbum\t\t1\t200\tL\t1700002000\t\n" +
+	"Bad Rating\tAlbum\tTitle\t1\t200\tX\t1700002100\t\n"
+
+func TestReadScrobblerLog(t *testing.T) {
+	log, err := ReadScrobblerLog(strings.NewReader(testScrobblerLog))
+	if err != nil {
+		t.Fatalf("ReadScrobblerLog() error = %v", err)
+	}
+
+	if log.Version != "1.1" || log.TZ != "UNKNOWN" || log.Client != "Rockbox ipodvideo $Revision$" {
+		t.Errorf("header = %q, %q, %q", log.Version, log.TZ, log.Client)
+	}
+	if log.Invalid != 3 {
+		t.Errorf("Invalid = %d, want 3", log.Invalid)
+	}
+	if len(log.Plays) != 4 {
+		t.Fatalf("ReadScrobblerLog() returned %d plays, want 4", len(log.Plays))
+	}
+
+	battery := log.Plays[0]
+	if battery.Artist != "Metallica" || battery.Album != "Master of Puppets" || battery.Title != "Battery" ||
+		battery.TrackNumber != 1 || battery.Duration != 312 || battery.Skipped ||
+		battery.MusicBrainzID != "b1a9c0e9-d987-4042-ae91-78d6a3267d69" {
+		t.Errorf("Plays[0] = %+v", battery)
+	}
+	if !battery.PlayedAt.Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("Plays[0].PlayedAt = %v, want 1700000000", battery.PlayedAt)
+	}
+	if !log.Plays[1].Skipped || log.Plays[1].TrackNumber != 0 || log.Plays[1].Artist != "Sigur Rós" {
+		t.Errorf("Plays[1] = %+v, want a skipped track without a track number", log.Plays[1])
+	}
+	if log.Plays[2].Path != "/<microSD1>/Music/Burzum/01 - Dunkelheit.mp3" || log.Plays[2].MusicBrainzID != "" {
+		t.Errorf("Plays[2] = %+v, want the path read from the last field", log.Plays[2])
+	}
+	if log.Plays[3].Title != "Alsvartr" || log.Plays[3].Duration != 0 {
+		t.Errorf("Plays[3] = %+v, want a play without a MusicBrainz field", log.Plays[3])
+	}
+}
+
+func TestReadScrobblerLog_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		log  string
+	}{
+		{"empty", ""},
+		{"no header", "Metallica\tMaster of Puppets\tBattery\t1\t312\tL\t1700000000\t\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ReadScrobblerLog(strings.NewReader(tt.log)); !errors.Is(err, models.ErrInvalidScrobblerLog) {
+				t.Errorf("ReadScrobblerLog() error = %v, want ErrInvalidScrobblerLog", err)
+			}
+		})
+	}
+}
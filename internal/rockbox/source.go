@@ -0,0 +1,100 @@
+package rockbox
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/Ardakilic/rocklist/internal/rockbox/fatfs"
+)
+
+// ErrNoRockboxFolder is returned when a source has no .rockbox folder near
+// its root
+var ErrNoRockboxFolder = errors.New("no .rockbox folder found")
+
+// maxSourceDepth is how deep below the root of an archive or image the
+// .rockbox folder is looked for
+const maxSourceDepth = 2
+
+// OpenSource opens a device backup for parsing. source is a directory, a zip
+// archive or a FAT disk image. The returned file system is rooted at the
+// folder holding .rockbox, which may be nested up to two levels deep, as
+// happens when a device folder is zipped. The closer must be closed once the
+// parse is done.
+func OpenSource(source string) (fs.FS, io.Closer, error) {
+	info, err := os.Stat(source)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var fsys fs.FS
+	var closer io.Closer
+	switch {
+	case info.IsDir():
+		fsys, closer = os.DirFS(source), io.NopCloser(nil)
+	case strings.EqualFold(path.Ext(source), ".zip"):
+		archive, err := zip.OpenReader(source)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open archive: %w", err)
+		}
+		fsys, closer = archive, archive
+	default:
+		image, err := fatfs.Open(source)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open disk image: %w", err)
+		}
+		fsys, closer = image, image
+	}
+
+	dir, err := findRockboxRoot(fsys, ".", maxSourceDepth)
+	if err != nil {
+		_ = closer.Close()
+		return nil, nil, err
+	}
+	if dir == "." {
+		return fsys, closer, nil
+	}
+
+	sub, err := fs.Sub(fsys, dir)
+	if err != nil {
+		_ = closer.Close()
+		return nil, nil, err
+	}
+	return sub, closer, nil
+}
+
+// findRockboxRoot returns the shallowest folder below dir that contains
+// TagCacheDir, searching depth levels deep in name order
+func findRockboxRoot(fsys fs.FS, dir string, depth int) (string, error) {
+	if info, err := fs.Stat(fsys, path.Join(dir, TagCacheDir)); err == nil && info.IsDir() {
+		return dir, nil
+	}
+	if depth == 0 {
+		return "", ErrNoRockboxFolder
+	}
+
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return "", err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	// Check every folder on this level before descending further
+	for level := 1; level <= depth; level++ {
+		for _, entry := range entries {
+			if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+				continue
+			}
+			if found, err := findRockboxRoot(fsys, path.Join(dir, entry.Name()), level-1); err == nil {
+				return found, nil
+			}
+		}
+	}
+	return "", ErrNoRockboxFolder
+}
@@ -0,0 +1,125 @@
+package rockbox
+
+import (
+	"archive/zip"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/Ardakilic/rocklist/internal/rockbox/fatfs"
+)
+
+// writeZip writes an archive holding files to a temp dir
+func writeZip(t *testing.T, files map[string]string) string {
+	t.Helper()
+	name := filepath.Join(t.TempDir(), "backup.zip")
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatalf("Failed to create archive: %v", err)
+	}
+	w := zip.NewWriter(f)
+	for file, content := range files {
+		fw, err := w.Create(file)
+		if err != nil {
+			t.Fatalf("Failed to add %s: %v", file, err)
+		}
+		_, _ = fw.Write([]byte(content))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Failed to write archive: %v", err)
+	}
+	_ = f.Close()
+	return name
+}
+
+func TestOpenSource_Zip(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+	}{
+		{"at root", map[string]string{
+			".rockbox/database_idx.tcd": "db",
+			"Music/song.mp3":            "audio",
+		}},
+		{"nested", map[string]string{
+			"IPOD/.rockbox/database_idx.tcd": "db",
+			"IPOD/Music/song.mp3":            "audio",
+		}},
+		{"two levels", map[string]string{
+			"backup/IPOD/.rockbox/database_idx.tcd": "db",
+			"backup/IPOD/Music/song.mp3":            "audio",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fsys, closer, err := OpenSource(writeZip(t, tt.files))
+			if err != nil {
+				t.Fatalf("OpenSource() error = %v", err)
+			}
+			defer func() { _ = closer.Close() }()
+
+			data, err := fs.ReadFile(fsys, ".rockbox/database_idx.tcd")
+			if err != nil || string(data) != "db" {
+				t.Errorf("ReadFile() = %q, %v, want db", data, err)
+			}
+			if _, err := fs.Stat(fsys, "Music/song.mp3"); err != nil {
+				t.Errorf("Stat() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestOpenSource_Directory(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(tmpDir, "device", TagCacheDir), 0755); err != nil {
+		t.Fatalf("Failed to create test dir: %v", err)
+	}
+
+	fsys, closer, err := OpenSource(tmpDir)
+	if err != nil {
+		t.Fatalf("OpenSource() error = %v", err)
+	}
+	defer func() { _ = closer.Close() }()
+
+	if _, err := fs.Stat(fsys, TagCacheDir); err != nil {
+		t.Errorf("Stat() error = %v", err)
+	}
+}
+
+func TestOpenSource_Errors(t *testing.T) {
+	tmpDir := t.TempDir()
+	image := filepath.Join(tmpDir, "device.img")
+	_ = os.WriteFile(image, make([]byte, 4096), 0644)
+
+	tests := []struct {
+		name   string
+		source string
+		want   error
+	}{
+		{"missing", filepath.Join(tmpDir, "missing.zip"), fs.ErrNotExist},
+		{"no rockbox folder", writeZip(t, map[string]string{"a/b/c/.rockbox/x": ""}), ErrNoRockboxFolder},
+		{"not a disk image", image, fatfs.ErrNotFAT},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := OpenSource(tt.source)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("OpenSource() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindRockboxRoot_SkipsHidden(t *testing.T) {
+	fsys := fstest.MapFS{
+		".Trash/.rockbox/database_idx.tcd": {},
+		"SD/.rockbox/database_idx.tcd":     {},
+	}
+	dir, err := findRockboxRoot(fsys, ".", maxSourceDepth)
+	if err != nil || dir != "SD" {
+		t.Errorf("findRockboxRoot() = %q, %v, want SD", dir, err)
+	}
+}
@@ -0,0 +1,105 @@
+package rockbox
+
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/Ardakilic/rocklist/internal/models"
+)
+
+// FieldChange is a single statistic that differs between Rocklist and the device
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// StatsChange lists the statistics of one song that differ from the device
+type StatsChange struct {
+	Path    string        `json:"path"`
+	Changes []FieldChange `json:"changes"`
+	// Skipped is set when the device changed the song's statistics itself
+	// since its database was built (FLAG_DIRTYNUM); Rockbox ignores
+	// changelog entries for such songs, so the change is not written
+	Skipped bool `json:"skipped,omitempty"`
+	// Song holds the values to write to the changelog
+	Song *models.Song `json:"-"`
+}
+
+// DiffStats compares the Rating, PlayCount and LastPlayed of local songs with
+// the songs currently on the device, matched by path. Songs that are not on
+// the device are ignored since Rockbox cannot import them.
+//
+// A last played time is only pushed when it was set in Rocklist, i.e. it has
+// no lastplayed counter from the device, and is newer than the device's. Such
+// songs get new counters above the device's most recent one, in play order.
+// Changes to songs flagged FLAG_DIRTYNUM on the device are marked Skipped.
+func DiffStats(device, local []*models.Song) []*StatsChange {
+	byPath := make(map[string]*models.Song, len(device))
+	maxSerial := 0
+	for _, song := range device {
+		byPath[song.Path] = song
+		if song.LastPlayedSerial > maxSerial {
+			maxSerial = song.LastPlayedSerial
+		}
+	}
+
+	var changes []*StatsChange
+	var replayed []*StatsChange
+	for _, song := range local {
+		current, ok := byPath[song.Path]
+		if !ok {
+			continue
+		}
+
+		out := *current
+		change := &StatsChange{Path: song.Path, Song: &out}
+
+		if song.Rating != current.Rating {
+			change.Changes = append(change.Changes, FieldChange{
+				Field: "rating", Old: strconv.Itoa(current.Rating), New: strconv.Itoa(song.Rating),
+			})
+			out.Rating = song.Rating
+		}
+		if song.PlayCount != current.PlayCount {
+			change.Changes = append(change.Changes, FieldChange{
+				Field: "play_count", Old: strconv.Itoa(current.PlayCount), New: strconv.Itoa(song.PlayCount),
+			})
+			out.PlayCount = song.PlayCount
+		}
+		if song.LastPlayed != nil && song.LastPlayedSerial == 0 &&
+			(current.LastPlayed == nil || song.LastPlayed.After(*current.LastPlayed)) {
+			change.Changes = append(change.Changes, FieldChange{
+				Field: "last_played", Old: formatPlayed(current.LastPlayed), New: formatPlayed(song.LastPlayed),
+			})
+			out.LastPlayed = song.LastPlayed
+			if !current.NumericDirty {
+				replayed = append(replayed, change)
+			}
+		}
+		change.Skipped = current.NumericDirty
+
+		if len(change.Changes) > 0 {
+			changes = append(changes, change)
+		}
+	}
+
+	sort.SliceStable(replayed, func(i, j int) bool {
+		return replayed[i].Song.LastPlayed.Before(*replayed[j].Song.LastPlayed)
+	})
+	for i, change := range replayed {
+		change.Song.LastPlayedSerial = maxSerial + 1 + i
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes
+}
+
+// formatPlayed formats a last played time for a diff
+func formatPlayed(t *time.Time) string {
+	if t == nil {
+		return "never"
+	}
+	return t.Local().Format("2006-01-02 15:04")
+}
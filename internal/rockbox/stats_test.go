@@ -0,0 +1,103 @@
+package rockbox
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Ardakilic/rocklist/internal/models"
+)
+
+func TestDiffStats(t *testing.T) {
+	played := func(h int) *time.Time {
+		t := time.Date(2024, 3, 9, h, 0, 0, 0, time.UTC)
+		return &t
+	}
+
+	device := []*models.Song{
+		{Path: "/a.mp3", Rating: 4, PlayCount: 2, LastPlayedSerial: 10, LastPlayed: played(10)},
+		{Path: "/b.mp3", Rating: 6, PlayCount: 5, LastPlayedSerial: 20, LastPlayed: played(12)},
+		{Path: "/c.mp3", PlayCount: 1, LastPlayedSerial: 5, LastPlayed: played(8)},
+		{Path: "/d.mp3"},
+	}
+	local := []*models.Song{
+		// Rating edited in Rocklist
+		{Path: "/a.mp3", Rating: 8, PlayCount: 2, LastPlayedSerial: 10, LastPlayed: played(10)},
+		// Plays merged in Rocklist, played after the device's last play
+		{Path: "/b.mp3", Rating: 6, PlayCount: 7, LastPlayed: played(18)},
+		// Merged play older than the device's one keeps the device value
+		{Path: "/c.mp3", PlayCount: 1, LastPlayed: played(7)},
+		// Never played on the device, played elsewhere before b
+		{Path: "/d.mp3", LastPlayed: played(15)},
+		// Not on the device
+		{Path: "/e.mp3", Rating: 10},
+	}
+
+	changes := DiffStats(device, local)
+	if len(changes) != 3 {
+		t.Fatalf("DiffStats() returned %d changes, want 3", len(changes))
+	}
+
+	if changes[0].Path != "/a.mp3" || len(changes[0].Changes) != 1 {
+		t.Fatalf("changes[0] = %+v, want only a rating change for /a.mp3", changes[0])
+	}
+	if got := changes[0].Changes[0]; got != (FieldChange{Field: "rating", Old: "4", New: "8"}) {
+		t.Errorf("changes[0].Changes[0] = %+v", got)
+	}
+	if changes[0].Song.LastPlayedSerial != 10 {
+		t.Errorf("unchanged last played should keep the device counter, got %d", changes[0].Song.LastPlayedSerial)
+	}
+
+	b := changes[1]
+	if b.Path != "/b.mp3" || len(b.Changes) != 2 {
+		t.Fatalf("changes[1] = %+v, want play count and last played for /b.mp3", b)
+	}
+	if b.Song.PlayCount != 7 || b.Song.Rating != 6 {
+		t.Errorf("b song = playcount %d, rating %d", b.Song.PlayCount, b.Song.Rating)
+	}
+
+	d := changes[2]
+	if d.Path != "/d.mp3" || d.Changes[0].Old != "never" {
+		t.Fatalf("changes[2] = %+v, want last played for /d.mp3", d)
+	}
+
+	// New counters follow the device's most recent one in play order
+	if d.Song.LastPlayedSerial != 21 || b.Song.LastPlayedSerial != 22 {
+		t.Errorf("counters = d %d, b %d, want 21 and 22", d.Song.LastPlayedSerial, b.Song.LastPlayedSerial)
+	}
+
+	// The device songs are left untouched
+	if device[1].PlayCount != 5 || device[1].LastPlayedSerial != 20 {
+		t.Error("DiffStats() should not modify the device songs")
+	}
+}
+
+func TestDiffStats_NoChanges(t *testing.T) {
+	songs := []*models.Song{{Path: "/a.mp3", Rating: 4, PlayCount: 2, LastPlayedSerial: 3}}
+	if changes := DiffStats(songs, songs); len(changes) != 0 {
+		t.Errorf("DiffStats() = %d changes, want 0", len(changes))
+	}
+}
+
+func TestDiffStats_SkipsNumericDirty(t *testing.T) {
+	played := time.Date(2024, 3, 9, 18, 0, 0, 0, time.UTC)
+	device := []*models.Song{
+		{Path: "/a.mp3", PlayCount: 2, LastPlayedSerial: 10, NumericDirty: true},
+		{Path: "/b.mp3", PlayCount: 1, LastPlayedSerial: 5},
+	}
+	local := []*models.Song{
+		{Path: "/a.mp3", PlayCount: 4, LastPlayed: &played},
+		{Path: "/b.mp3", PlayCount: 3, LastPlayed: &played},
+	}
+
+	changes := DiffStats(device, local)
+	if len(changes) != 2 {
+		t.Fatalf("DiffStats() returned %d changes, want 2", len(changes))
+	}
+	if !changes[0].Skipped || changes[1].Skipped {
+		t.Errorf("Skipped = %v, %v, want only the dirty song skipped", changes[0].Skipped, changes[1].Skipped)
+	}
+	// The skipped song takes no lastplayed counter
+	if changes[1].Song.LastPlayedSerial != 11 {
+		t.Errorf("LastPlayedSerial = %d, want 11", changes[1].Song.LastPlayedSerial)
+	}
+}
@@ -0,0 +1,190 @@
+package rockbox
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	// tagCacheHeaderSize is the size of struct tagcache_header shared by all files
+	tagCacheHeaderSize = 12
+	// masterHeaderSize is the size of struct master_header in database_idx.tcd
+	masterHeaderSize = 24
+	// TagCount is the number of tag_seek slots in an index entry (TAG_COUNT)
+	TagCount = int(TagTagCount)
+	// stringTagCount is the number of tags stored in database_N.tcd files.
+	// Tags from TagYear onwards keep their value directly in tag_seek.
+	stringTagCount = int(TagYear)
+)
+
+// Untagged is what Rockbox stores in place of an empty string tag (UNTAGGED
+// in tagcache.c); it is read back as an empty value
+const Untagged = "<Untagged>"
+
+// tagNames are the tag names used in database_changelog.txt (tags_str in tagcache.c)
+var tagNames = [TagCount]string{
+	"artist", "album", "genre", "title", "filename", "composer", "comment",
+	"albumartist", "grouping", "year", "discnumber", "tracknumber", "bitrate",
+	"length", "playcount", "rating", "playtime", "lastplayed", "commitid",
+	"mtime", "lastelapsed", "lastoffset",
+}
+
+// String returns the Rockbox name of the tag
+func (t TagType) String() string {
+	if t < 0 || int(t) >= TagCount {
+		return fmt.Sprintf("TagType(%d)", int(t))
+	}
+	return tagNames[t]
+}
+
+// tagByName returns the tag with the given Rockbox name
+func tagByName(name string) (TagType, bool) {
+	for i, n := range tagNames {
+		if n == name {
+			return TagType(i), true
+		}
+	}
+	return 0, false
+}
+
+// Index entry flags from tagcache.h
+const (
+	// FlagDeleted marks an entry that has been removed from the database
+	FlagDeleted int32 = 0x0001
+	// FlagDirCache marks an entry whose filename seek is a dircache pointer
+	FlagDirCache int32 = 0x0002
+	// FlagDirtyNum marks an entry whose numeric data has been modified
+	FlagDirtyNum int32 = 0x0004
+	// FlagTrkNumGen marks an entry whose track number has been generated
+	FlagTrkNumGen int32 = 0x0008
+	// FlagResurrected marks an entry whose statistics have been resurrected
+	FlagResurrected int32 = 0x0010
+)
+
+// MasterHeader mirrors struct master_header from tagcache.c
+type MasterHeader struct {
+	Magic      uint32
+	DataSize   int32
+	EntryCount int32
+	Serial     int32 // Increasing counting number
+	CommitID   int32 // Number of commits so far
+	Dirty      int32
+	// ByteOrder is the byte order detected from the magic number
+	ByteOrder binary.ByteOrder
+	// Version is the version byte of the magic number
+	Version byte
+
+	format *tagCacheFormat
+}
+
+// IndexEntry mirrors struct index_entry from tagcache.c
+// For string tags TagSeek holds the byte offset of the entry in the
+// corresponding tag file, for numeric tags it holds the value itself.
+type IndexEntry struct {
+	TagSeek [TagCount]int32
+	Flag    int32
+}
+
+// HasFlag reports whether the entry has the given flag set
+func (e *IndexEntry) HasFlag(flag int32) bool {
+	return e.Flag&flag != 0
+}
+
+// readMasterHeader reads and validates the master index header
+func readMasterHeader(r io.Reader) (*MasterHeader, error) {
+	buf := make([]byte, masterHeaderSize)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, fmt.Errorf("failed to read database header: %w", err)
+	}
+
+	format, order, err := detectFormat(buf[0:4])
+	if err != nil {
+		return nil, err
+	}
+
+	return &MasterHeader{
+		Magic:      order.Uint32(buf[0:4]),
+		DataSize:   int32(order.Uint32(buf[4:8])),
+		EntryCount: int32(order.Uint32(buf[8:12])),
+		Serial:     int32(order.Uint32(buf[12:16])),
+		CommitID:   int32(order.Uint32(buf[16:20])),
+		Dirty:      int32(order.Uint32(buf[20:24])),
+		ByteOrder:  order,
+		Version:    format.version,
+		format:     format,
+	}, nil
+}
+
+// readIndexEntry reads the next index entry in the layout of format, using
+// buf of format.entrySize() bytes for the raw entry
+func readIndexEntry(r io.Reader, buf []byte, order binary.ByteOrder, format *tagCacheFormat) (*IndexEntry, error) {
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+
+	entry := &IndexEntry{}
+	for slot, tag := range format.tags {
+		entry.TagSeek[tag] = int32(order.Uint32(buf[slot*4:]))
+	}
+	entry.Flag = int32(order.Uint32(buf[len(format.tags)*4:]))
+	return entry, nil
+}
+
+// numericTags extracts the numeric tag values of an index entry
+func (e *IndexEntry) numericTags() *NumericTagData {
+	return &NumericTagData{
+		Year:        int(e.TagSeek[TagYear]),
+		DiscNumber:  int(e.TagSeek[TagDiscNumber]),
+		TrackNumber: int(e.TagSeek[TagTrackNumber]),
+		Bitrate:     int(e.TagSeek[TagBitrate]),
+		Length:      int(e.TagSeek[TagLength]),
+		PlayCount:   int(e.TagSeek[TagPlayCount]),
+		Rating:      int(e.TagSeek[TagRating]),
+		PlayTime:    int(e.TagSeek[TagPlayTime]),
+		LastPlayed:  int64(e.TagSeek[TagLastPlayed]),
+		CommitID:    int(e.TagSeek[TagCommitID]),
+		MTime:       uint32(e.TagSeek[TagMTime]),
+		LastElapsed: int(e.TagSeek[TagLastElapsed]),
+		LastOffset:  int(e.TagSeek[TagLastOffset]),
+	}
+}
+
+// estimatedPlayInterval is the assumed time between two consecutive plays
+// when turning a lastplayed counter into a timestamp
+const estimatedPlayInterval = 4 * time.Minute
+
+// playClock converts commit-relative lastplayed counters into timestamps.
+// Rockbox does not record when a track was played: it stamps the entry with
+// the current master serial and then increments the serial. The distance to
+// the header serial is therefore the number of plays since, which is mapped
+// backwards from the time the index was last written.
+type playClock struct {
+	serial int32
+	anchor time.Time // modification time of database_idx.tcd
+}
+
+// lastPlayed returns the estimated time of a lastplayed counter, or nil if
+// the track was never played or the counter cannot be placed
+func (c *playClock) lastPlayed(counter int64) *time.Time {
+	if c == nil || c.anchor.IsZero() || counter <= 0 || counter >= int64(c.serial) {
+		return nil
+	}
+	playsSince := int64(c.serial) - 1 - counter
+	t := c.anchor.Add(-time.Duration(playsSince) * estimatedPlayInterval)
+	return &t
+}
+
+// fatTime decodes the FAT date/time stored in tag_mtime
+// (date in the high 16 bits, time in the low 16 bits, local time)
+func fatTime(v uint32) *time.Time {
+	date, clock := v>>16, v&0xffff
+	month, day := int(date>>5&0x0f), int(date&0x1f)
+	if date == 0 || month < 1 || month > 12 || day < 1 {
+		return nil
+	}
+	t := time.Date(1980+int(date>>9), time.Month(month), day,
+		int(clock>>11), int(clock>>5&0x3f), int(clock&0x1f)*2, 0, time.Local)
+	return &t
+}
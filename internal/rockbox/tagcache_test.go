@@ -0,0 +1,835 @@
+package rockbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/Ardakilic/rocklist/internal/models"
+	"github.com/Ardakilic/rocklist/internal/rockbox/tcbuilder"
+)
+
+// fixtureEntry describes one master index entry of a TagCache fixture
+type fixtureEntry struct {
+	song models.Song
+	flag int32
+}
+
+// fixtureDB describes a TagCache fixture database
+type fixtureDB struct {
+	serial   int32
+	commitID int32
+	entries  []fixtureEntry
+	// order is the byte order of all files, little-endian when nil
+	order binary.ByteOrder
+	// modTime is the modification time of the index file, left alone when zero
+	modTime time.Time
+}
+
+// writeTagCacheFixture writes a complete .rockbox directory under root
+func writeTagCacheFixture(t testing.TB, root string, db fixtureDB) {
+	t.Helper()
+
+	build := &tcbuilder.Database{Order: db.order, Serial: db.serial, CommitID: db.commitID}
+	for i := range db.entries {
+		build.Entries = append(build.Entries, tcbuilder.Entry{Song: &db.entries[i].song, Flag: db.entries[i].flag})
+	}
+	if err := build.Write(root); err != nil {
+		t.Fatalf("Failed to write TagCache fixture: %v", err)
+	}
+
+	if !db.modTime.IsZero() {
+		if err := os.Chtimes(filepath.Join(root, TagCacheDir, DatabaseFile), db.modTime, db.modTime); err != nil {
+			t.Fatalf("Failed to set index file time: %v", err)
+		}
+	}
+}
+
+// fixtureSongs returns a small library sharing artist/album strings
+func fixtureSongs() fixtureDB {
+	return fixtureDB{
+		serial:   7,
+		commitID: 3,
+		modTime:  time.Date(2024, 3, 9, 21, 30, 0, 0, time.UTC),
+		entries: []fixtureEntry{
+			{song: models.Song{
+				Path: "/Music/Metallica/Master of Puppets/01 - Battery.mp3", Title: "Battery",
+				Artist: "Metallica", AlbumArtist: "Metallica", Album: "Master of Puppets", Genre: "Thrash Metal",
+				Year: 1986, DiscNumber: 1, TrackNumber: 1, Bitrate: 320, Duration: 312, PlayCount: 12, Rating: 8,
+				LastPlayedSerial: 6, PlayTime: 3744000, LastElapsed: 95000, LastOffset: 3801088,
+				FileModifiedAt: fixtureTime(2019, 5, 14, 18, 42, 10),
+			}},
+			{song: models.Song{
+				Path: "/Music/Metallica/Master of Puppets/02 - Master of Puppets.mp3", Title: "Master of Puppets",
+				Artist: "Metallica", AlbumArtist: "Metallica", Album: "Master of Puppets", Genre: "Thrash Metal",
+				Year: 1986, DiscNumber: 1, TrackNumber: 2, Bitrate: 320, Duration: 515, PlayCount: 30, Rating: 10,
+				LastPlayedSerial: 4, PlayTime: 15450000,
+			}},
+			{song: models.Song{
+				Path: "/Music/Sigur Rós/Ágætis byrjun/03 - Svefn-g-englar.flac", Title: "Svefn-g-englar",
+				Artist: "Sigur Rós", Album: "Ágætis byrjun", Genre: "Post-Rock",
+				Composer: "Jón Þór Birgisson", Comment: "Remastered", Grouping: "Icelandic",
+				Year: 1999, TrackNumber: 3, Bitrate: 900, Duration: 604,
+			}},
+		},
+	}
+}
+
+func TestReadMasterHeader(t *testing.T) {
+	var buf bytes.Buffer
+	_ = binary.Write(&buf, binary.LittleEndian, []int32{TagCacheMagic, 184, 2, 42, 9, 1})
+
+	header, err := readMasterHeader(&buf)
+	if err != nil {
+		t.Fatalf("readMasterHeader() error = %v", err)
+	}
+
+	if header.EntryCount != 2 {
+		t.Errorf("EntryCount = %d, want 2", header.EntryCount)
+	}
+	if header.Serial != 42 {
+		t.Errorf("Serial = %d, want 42", header.Serial)
+	}
+	if header.CommitID != 9 {
+		t.Errorf("CommitID = %d, want 9", header.CommitID)
+	}
+	if header.Dirty != 1 {
+		t.Errorf("Dirty = %d, want 1", header.Dirty)
+	}
+	if header.ByteOrder != binary.LittleEndian {
+		t.Errorf("ByteOrder = %v, want LittleEndian", header.ByteOrder)
+	}
+}
+
+func TestReadMasterHeader_BigEndian(t *testing.T) {
+	var buf bytes.Buffer
+	_ = binary.Write(&buf, binary.BigEndian, []int32{TagCacheMagic, 184, 2, 42, 9, 0})
+
+	header, err := readMasterHeader(&buf)
+	if err != nil {
+		t.Fatalf("readMasterHeader() error = %v", err)
+	}
+
+	if header.ByteOrder != binary.BigEndian {
+		t.Errorf("ByteOrder = %v, want BigEndian", header.ByteOrder)
+	}
+	if header.EntryCount != 2 {
+		t.Errorf("EntryCount = %d, want 2", header.EntryCount)
+	}
+	if header.Serial != 42 {
+		t.Errorf("Serial = %d, want 42", header.Serial)
+	}
+	if header.CommitID != 9 {
+		t.Errorf("CommitID = %d, want 9", header.CommitID)
+	}
+}
+
+func TestReadMasterHeader_Short(t *testing.T) {
+	var buf bytes.Buffer
+	_ = binary.Write(&buf, binary.LittleEndian, []int32{TagCacheMagic, 0, 0})
+
+	if _, err := readMasterHeader(&buf); err == nil {
+		t.Error("readMasterHeader() should fail on a 12-byte header")
+	}
+}
+
+func TestReadIndexEntry(t *testing.T) {
+	var buf bytes.Buffer
+	var seek [TagCount]int32
+	seek[TagArtist] = 12
+	seek[TagYear] = 2001
+	seek[TagLength] = 185000
+	seek[TagRating] = 6
+	_ = binary.Write(&buf, binary.LittleEndian, seek)
+	_ = binary.Write(&buf, binary.LittleEndian, int32(0x0008))
+
+	entry, err := readIndexEntry(&buf, make([]byte, currentFormat.entrySize()), binary.LittleEndian, currentFormat)
+	if err != nil {
+		t.Fatalf("readIndexEntry() error = %v", err)
+	}
+	if entry.TagSeek[TagArtist] != 12 {
+		t.Errorf("TagSeek[TagArtist] = %d, want 12", entry.TagSeek[TagArtist])
+	}
+	if entry.Flag != 0x0008 {
+		t.Errorf("Flag = %#x, want 0x8", entry.Flag)
+	}
+
+	numeric := entry.numericTags()
+	if numeric.Year != 2001 {
+		t.Errorf("Year = %d, want 2001", numeric.Year)
+	}
+	if numeric.Length != 185000 {
+		t.Errorf("Length = %d, want 185000", numeric.Length)
+	}
+	if numeric.Rating != 6 {
+		t.Errorf("Rating = %d, want 6", numeric.Rating)
+	}
+}
+
+func TestReadIndexEntry_Truncated(t *testing.T) {
+	buf := bytes.NewReader(make([]byte, currentFormat.entrySize()-10))
+
+	if _, err := readIndexEntry(buf, make([]byte, currentFormat.entrySize()), binary.LittleEndian, currentFormat); err == nil {
+		t.Error("readIndexEntry() should fail when the index is truncated")
+	}
+}
+
+// FuzzStreamTagCache fuzzes the index file read by the parser, with the tag
+// files of a valid database next to it
+func FuzzStreamTagCache(f *testing.F) {
+	dir := f.TempDir()
+	db := fixtureSongs()
+	db.entries[1].flag = FlagDirCache
+	writeTagCacheFixture(f, dir, db)
+
+	fsys := fstest.MapFS{}
+	files, _ := os.ReadDir(filepath.Join(dir, TagCacheDir))
+	for _, file := range files {
+		data, err := os.ReadFile(filepath.Join(dir, TagCacheDir, file.Name()))
+		if err != nil {
+			f.Fatalf("ReadFile() error = %v", err)
+		}
+		fsys[path.Join(TagCacheDir, file.Name())] = &fstest.MapFile{Data: data}
+	}
+	index := fsys[path.Join(TagCacheDir, DatabaseFile)].Data
+	f.Add(index)
+	f.Add(index[:masterHeaderSize+currentFormat.entrySize()+10])
+	f.Add([]byte{0x10, 0x48, 0x43, 0x54, 0, 0, 0, 0, 0xff, 0xff, 0xff, 0x7f})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		fuzzed := maps.Clone(fsys)
+		fuzzed[path.Join(TagCacheDir, DatabaseFile)] = &fstest.MapFile{Data: data}
+
+		p := NewParserFS(fuzzed, "fuzz", &mockLogger{})
+		tc, err := p.openTagCache(fuzzed)
+		if err != nil {
+			return
+		}
+		defer tc.close()
+
+		songs := 0
+		err = p.streamTagCache(context.Background(), tc, func(*models.Song) error {
+			songs++
+			return nil
+		})
+		if err != nil {
+			t.Errorf("streamTagCache() error = %v, want damage reported as diagnostics", err)
+		}
+		if limit := (len(data) - masterHeaderSize) / tc.header.format.entrySize(); songs > limit {
+			t.Errorf("streamTagCache() emitted %d songs from %d bytes", songs, len(data))
+		}
+	})
+}
+
+// currentTagFile returns the name of the tag file holding tag in the
+// current version
+func currentTagFile(t *testing.T, tag TagType) string {
+	t.Helper()
+	name, ok := currentFormat.tagFileName(tag)
+	if !ok {
+		t.Fatalf("tagFileName(%d) not found in the current version", tag)
+	}
+	return name
+}
+
+// fixtureTime returns a local time with FAT's two second resolution
+func fixtureTime(year int, month time.Month, day, hour, min, sec int) *time.Time {
+	t := time.Date(year, month, day, hour, min, sec, 0, time.Local)
+	return &t
+}
+
+func TestParser_Parse_TagCacheFixture(t *testing.T) {
+	tmpDir := t.TempDir()
+	db := fixtureSongs()
+	writeTagCacheFixture(t, tmpDir, db)
+
+	parser := NewParser(tmpDir, &mockLogger{})
+	songs, err := parser.Parse(context.Background())
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	if len(songs) != len(db.entries) {
+		t.Fatalf("Parse() returned %d songs, want %d", len(songs), len(db.entries))
+	}
+
+	for i, got := range songs {
+		want := db.entries[i].song
+		if got.Path != want.Path {
+			t.Errorf("song %d Path = %q, want %q", i, got.Path, want.Path)
+		}
+		if got.Title != want.Title {
+			t.Errorf("song %d Title = %q, want %q", i, got.Title, want.Title)
+		}
+		if got.Artist != want.Artist {
+			t.Errorf("song %d Artist = %q, want %q", i, got.Artist, want.Artist)
+		}
+		if got.AlbumArtist != want.AlbumArtist {
+			t.Errorf("song %d AlbumArtist = %q, want %q", i, got.AlbumArtist, want.AlbumArtist)
+		}
+		if got.Album != want.Album {
+			t.Errorf("song %d Album = %q, want %q", i, got.Album, want.Album)
+		}
+		if got.Genre != want.Genre {
+			t.Errorf("song %d Genre = %q, want %q", i, got.Genre, want.Genre)
+		}
+		if got.Composer != want.Composer {
+			t.Errorf("song %d Composer = %q, want %q", i, got.Composer, want.Composer)
+		}
+		if got.Comment != want.Comment {
+			t.Errorf("song %d Comment = %q, want %q", i, got.Comment, want.Comment)
+		}
+		if got.Grouping != want.Grouping {
+			t.Errorf("song %d Grouping = %q, want %q", i, got.Grouping, want.Grouping)
+		}
+		if got.Year != want.Year {
+			t.Errorf("song %d Year = %d, want %d", i, got.Year, want.Year)
+		}
+		if got.DiscNumber != want.DiscNumber {
+			t.Errorf("song %d DiscNumber = %d, want %d", i, got.DiscNumber, want.DiscNumber)
+		}
+		if got.TrackNumber != want.TrackNumber {
+			t.Errorf("song %d TrackNumber = %d, want %d", i, got.TrackNumber, want.TrackNumber)
+		}
+		if got.Bitrate != want.Bitrate {
+			t.Errorf("song %d Bitrate = %d, want %d", i, got.Bitrate, want.Bitrate)
+		}
+		if got.Duration != want.Duration {
+			t.Errorf("song %d Duration = %d, want %d", i, got.Duration, want.Duration)
+		}
+		if got.PlayCount != want.PlayCount {
+			t.Errorf("song %d PlayCount = %d, want %d", i, got.PlayCount, want.PlayCount)
+		}
+		if got.Rating != want.Rating {
+			t.Errorf("song %d Rating = %d, want %d", i, got.Rating, want.Rating)
+		}
+		if got.RockboxID == "" {
+			t.Errorf("song %d RockboxID should not be empty", i)
+		}
+	}
+}
+
+func TestParser_Parse_TagCacheFixture_MissingTagFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTagCacheFixture(t, tmpDir, fixtureSongs())
+	_ = os.Remove(filepath.Join(tmpDir, TagCacheDir, currentTagFile(t, TagGenre)))
+
+	parser := NewParser(tmpDir, &mockLogger{})
+	songs, err := parser.Parse(context.Background())
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	if len(songs) != 3 {
+		t.Fatalf("Parse() returned %d songs, want 3", len(songs))
+	}
+	if songs[0].Genre != "" {
+		t.Errorf("Genre = %q, want empty when database_2.tcd is missing", songs[0].Genre)
+	}
+	if songs[0].Title != "Battery" {
+		t.Errorf("Title = %q, want Battery", songs[0].Title)
+	}
+
+	diags := parser.GetStatus().Diagnostics
+	if len(diags) != 1 || diags[0].File != currentTagFile(t, TagGenre) || diags[0].Entry != -1 {
+		t.Errorf("Diagnostics = %+v, want one for the missing %s", diags, currentTagFile(t, TagGenre))
+	}
+}
+
+func TestParser_Parse_TagCacheFixture_BadFilenameSeek(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTagCacheFixture(t, tmpDir, fixtureSongs())
+
+	// Point the filename of the second entry into the middle of a string
+	idxPath := filepath.Join(tmpDir, TagCacheDir, DatabaseFile)
+	data, _ := os.ReadFile(idxPath)
+	entryOffset := masterHeaderSize + currentFormat.entrySize()
+	binary.LittleEndian.PutUint32(data[entryOffset+int(TagFilename)*4:], 15)
+	_ = os.WriteFile(idxPath, data, 0644)
+
+	parser := NewParser(tmpDir, &mockLogger{})
+	songs, err := parser.Parse(context.Background())
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if len(songs) != 2 {
+		t.Errorf("Parse() returned %d songs, want 2", len(songs))
+	}
+
+	want := []models.ParseDiagnostic{{
+		File:   DatabaseFile,
+		Offset: int64(entryOffset),
+		Entry:  1,
+		Reason: "filename seek 15 does not point at an entry in database_4.tcd, song skipped",
+	}}
+	if diags := parser.GetStatus().Diagnostics; !reflect.DeepEqual(diags, want) {
+		t.Errorf("Diagnostics = %+v, want %+v", diags, want)
+	}
+}
+
+func TestParser_Parse_TagCacheFixture_TruncatedIndex(t *testing.T) {
+	tmpDir := t.TempDir()
+	db := fixtureSongs()
+	writeTagCacheFixture(t, tmpDir, db)
+
+	// Cut the last index entry in half
+	idxPath := filepath.Join(tmpDir, TagCacheDir, DatabaseFile)
+	data, _ := os.ReadFile(idxPath)
+	_ = os.WriteFile(idxPath, data[:len(data)-currentFormat.entrySize()/2], 0644)
+
+	parser := NewParser(tmpDir, &mockLogger{})
+	songs, err := parser.Parse(context.Background())
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	// The entries before the damage are kept
+	want := len(db.entries) - 1
+	if len(songs) != want {
+		t.Errorf("Parse() returned %d songs, want %d", len(songs), want)
+	}
+
+	status := parser.GetStatus()
+	if status.Source != models.ParseSourceTagCache {
+		t.Errorf("Source = %q, want %q", status.Source, models.ParseSourceTagCache)
+	}
+	wantDiag := models.ParseDiagnostic{
+		File:   DatabaseFile,
+		Offset: int64(masterHeaderSize + want*currentFormat.entrySize()),
+		Entry:  want,
+		Reason: fmt.Sprintf("index ends after %d of %d entries", want, len(db.entries)),
+	}
+	if len(status.Diagnostics) != 1 || status.Diagnostics[0] != wantDiag {
+		t.Errorf("Diagnostics = %+v, want %+v", status.Diagnostics, wantDiag)
+	}
+}
+
+func TestParser_Parse_TagCacheFixture_UnreadableIndex(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTagCacheFixture(t, tmpDir, fixtureSongs())
+
+	// Cut into the first index entry so no entry is readable
+	idxPath := filepath.Join(tmpDir, TagCacheDir, DatabaseFile)
+	data, _ := os.ReadFile(idxPath)
+	_ = os.WriteFile(idxPath, data[:masterHeaderSize+currentFormat.entrySize()/2], 0644)
+
+	musicDir := filepath.Join(tmpDir, "Music")
+	_ = os.MkdirAll(musicDir, 0755)
+	_ = os.WriteFile(filepath.Join(musicDir, "Artist - Song.mp3"), []byte("test"), 0644)
+
+	parser := NewParser(tmpDir, &mockLogger{})
+	songs, err := parser.Parse(context.Background())
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	// Falls back to the filesystem scan
+	if len(songs) != 1 {
+		t.Errorf("Parse() returned %d songs, want 1 from filesystem fallback", len(songs))
+	}
+}
+
+func TestParser_Parse_TagCacheFixture_Flags(t *testing.T) {
+	tmpDir := t.TempDir()
+	db := fixtureSongs()
+	db.entries[0].flag = FlagDeleted
+	db.entries[1].flag = FlagTrkNumGen | FlagDirtyNum
+	db.entries[2].flag = FlagDirCache | FlagResurrected
+	writeTagCacheFixture(t, tmpDir, db)
+
+	parser := NewParser(tmpDir, &mockLogger{})
+	songs, err := parser.Parse(context.Background())
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	// The deleted entry must not come back as a song
+	if len(songs) != 2 {
+		t.Fatalf("Parse() returned %d songs, want 2", len(songs))
+	}
+	if songs[0].Title != "Master of Puppets" {
+		t.Errorf("songs[0].Title = %q, want Master of Puppets", songs[0].Title)
+	}
+	if !songs[0].TrackNumberGenerated {
+		t.Error("songs[0] should be marked as having a generated track number")
+	}
+	if songs[1].TrackNumberGenerated {
+		t.Error("songs[1] should not be marked as having a generated track number")
+	}
+	if !songs[0].NumericDirty || songs[1].NumericDirty {
+		t.Error("only songs[0] should be marked as having statistics changed on the device")
+	}
+
+	// The dircache entry resolves its filename through idx_id
+	if songs[1].Path != db.entries[2].song.Path {
+		t.Errorf("songs[1].Path = %q, want %q", songs[1].Path, db.entries[2].song.Path)
+	}
+
+	status := parser.GetStatus()
+	if status.DeletedEntries != 1 {
+		t.Errorf("DeletedEntries = %d, want 1", status.DeletedEntries)
+	}
+	if status.GeneratedTrackNumbers != 1 {
+		t.Errorf("GeneratedTrackNumbers = %d, want 1", status.GeneratedTrackNumbers)
+	}
+	if status.DirtyNumEntries != 1 {
+		t.Errorf("DirtyNumEntries = %d, want 1", status.DirtyNumEntries)
+	}
+	if status.DirCacheEntries != 1 {
+		t.Errorf("DirCacheEntries = %d, want 1", status.DirCacheEntries)
+	}
+	if status.ResurrectedEntries != 1 {
+		t.Errorf("ResurrectedEntries = %d, want 1", status.ResurrectedEntries)
+	}
+	if status.TotalSongs != 2 {
+		t.Errorf("TotalSongs = %d, want 2", status.TotalSongs)
+	}
+}
+
+func TestIndexEntry_HasFlag(t *testing.T) {
+	entry := &IndexEntry{Flag: FlagDeleted | FlagResurrected}
+
+	if !entry.HasFlag(FlagDeleted) {
+		t.Error("HasFlag(FlagDeleted) = false, want true")
+	}
+	if !entry.HasFlag(FlagResurrected) {
+		t.Error("HasFlag(FlagResurrected) = false, want true")
+	}
+	if entry.HasFlag(FlagDirCache) {
+		t.Error("HasFlag(FlagDirCache) = true, want false")
+	}
+}
+
+func TestParser_Parse_TagCacheFixture_ByteOrders(t *testing.T) {
+	parse := func(order binary.ByteOrder) []*models.Song {
+		tmpDir := t.TempDir()
+		db := fixtureSongs()
+		db.order = order
+		db.entries[1].flag = FlagTrkNumGen
+		writeTagCacheFixture(t, tmpDir, db)
+
+		songs, err := NewParser(tmpDir, &mockLogger{}).Parse(context.Background())
+		if err != nil {
+			t.Fatalf("Parse(%v) error = %v", order, err)
+		}
+		return songs
+	}
+
+	little := parse(binary.LittleEndian)
+	big := parse(binary.BigEndian)
+
+	if len(little) != 3 {
+		t.Fatalf("little-endian Parse() returned %d songs, want 3", len(little))
+	}
+	if !reflect.DeepEqual(little, big) {
+		for i := range little {
+			t.Errorf("song %d differs:\n little: %+v\n big:    %+v", i, *little[i], *big[i])
+		}
+	}
+}
+
+func TestParser_Parse_TagCacheFixture_PlayStats(t *testing.T) {
+	tmpDir := t.TempDir()
+	db := fixtureSongs()
+	writeTagCacheFixture(t, tmpDir, db)
+
+	songs, err := NewParser(tmpDir, &mockLogger{}).Parse(context.Background())
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if len(songs) != 3 {
+		t.Fatalf("Parse() returned %d songs, want 3", len(songs))
+	}
+
+	for i, got := range songs {
+		want := db.entries[i].song
+		if got.LastPlayedSerial != want.LastPlayedSerial {
+			t.Errorf("song %d LastPlayedSerial = %d, want %d", i, got.LastPlayedSerial, want.LastPlayedSerial)
+		}
+		if got.PlayTime != want.PlayTime {
+			t.Errorf("song %d PlayTime = %d, want %d", i, got.PlayTime, want.PlayTime)
+		}
+		if got.LastElapsed != want.LastElapsed {
+			t.Errorf("song %d LastElapsed = %d, want %d", i, got.LastElapsed, want.LastElapsed)
+		}
+		if got.LastOffset != want.LastOffset {
+			t.Errorf("song %d LastOffset = %d, want %d", i, got.LastOffset, want.LastOffset)
+		}
+	}
+
+	// Serial 7 means the last play was stamped 6: song 0 is the most recent
+	// play and song 1 was played two plays earlier
+	if songs[0].LastPlayed == nil || !songs[0].LastPlayed.Equal(db.modTime) {
+		t.Errorf("songs[0].LastPlayed = %v, want %v", songs[0].LastPlayed, db.modTime)
+	}
+	wantSecond := db.modTime.Add(-2 * estimatedPlayInterval)
+	if songs[1].LastPlayed == nil || !songs[1].LastPlayed.Equal(wantSecond) {
+		t.Errorf("songs[1].LastPlayed = %v, want %v", songs[1].LastPlayed, wantSecond)
+	}
+	if songs[2].LastPlayed != nil {
+		t.Errorf("songs[2].LastPlayed = %v, want nil for a never played track", songs[2].LastPlayed)
+	}
+
+	if songs[0].FileModifiedAt == nil || !songs[0].FileModifiedAt.Equal(*db.entries[0].song.FileModifiedAt) {
+		t.Errorf("songs[0].FileModifiedAt = %v, want %v", songs[0].FileModifiedAt, db.entries[0].song.FileModifiedAt)
+	}
+	if songs[1].FileModifiedAt != nil {
+		t.Errorf("songs[1].FileModifiedAt = %v, want nil", songs[1].FileModifiedAt)
+	}
+}
+
+func TestPlayClock_LastPlayed(t *testing.T) {
+	anchor := time.Date(2024, 3, 9, 21, 30, 0, 0, time.UTC)
+	clock := &playClock{serial: 100, anchor: anchor}
+
+	tests := []struct {
+		name    string
+		counter int64
+		want    *time.Time
+	}{
+		{"never played", 0, nil},
+		{"most recent", 99, &anchor},
+		{"ten plays ago", 89, func() *time.Time { t := anchor.Add(-10 * estimatedPlayInterval); return &t }()},
+		{"counter from the future", 100, nil},
+		{"negative", -1, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := clock.lastPlayed(tt.counter)
+			if (got == nil) != (tt.want == nil) {
+				t.Fatalf("lastPlayed(%d) = %v, want %v", tt.counter, got, tt.want)
+			}
+			if got != nil && !got.Equal(*tt.want) {
+				t.Errorf("lastPlayed(%d) = %v, want %v", tt.counter, got, tt.want)
+			}
+		})
+	}
+
+	var unknown *playClock
+	if got := unknown.lastPlayed(5); got != nil {
+		t.Errorf("nil clock lastPlayed() = %v, want nil", got)
+	}
+	if got := (&playClock{serial: 10}).lastPlayed(5); got != nil {
+		t.Errorf("clock without anchor lastPlayed() = %v, want nil", got)
+	}
+}
+
+func TestFATTime(t *testing.T) {
+	want := fixtureTime(2019, 5, 14, 18, 42, 10)
+	// FAT date 2019-05-14 in the high half, time 18:42:10 in the low half
+	got := fatTime(0x4eae9545)
+	if got == nil || !got.Equal(*want) {
+		t.Errorf("fatTime() = %v, want %v", got, want)
+	}
+
+	for _, v := range []uint32{0, 0x00000001, 0x01a00000} {
+		if got := fatTime(v); got != nil {
+			t.Errorf("fatTime(0x%08x) = %v, want nil", v, got)
+		}
+	}
+}
+
+func TestParser_ReadMasterHeader(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTagCacheFixture(t, tmpDir, fixtureSongs())
+
+	parser := NewParser(tmpDir, &mockLogger{})
+	header, err := parser.ReadMasterHeader()
+	if err != nil {
+		t.Fatalf("ReadMasterHeader() error = %v", err)
+	}
+	if header.Serial != 7 || header.CommitID != 3 {
+		t.Errorf("ReadMasterHeader() serial/commit = %d/%d, want 7/3", header.Serial, header.CommitID)
+	}
+
+	if _, err := NewParser(t.TempDir(), &mockLogger{}).ReadMasterHeader(); err == nil {
+		t.Error("ReadMasterHeader() expected error without a database")
+	}
+}
+
+func TestParser_Parse_ReportsSource(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTagCacheFixture(t, tmpDir, fixtureSongs())
+
+	parser := NewParser(tmpDir, &mockLogger{})
+	if _, err := parser.Parse(context.Background()); err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	status := parser.GetStatus()
+	if status.Source != models.ParseSourceTagCache || status.Serial != 7 || status.CommitID != 3 {
+		t.Errorf("status source/serial/commit = %q/%d/%d, want tagcache/7/3", status.Source, status.Serial, status.CommitID)
+	}
+
+	// A truncated index falls back to the filesystem scan
+	_ = os.Truncate(filepath.Join(tmpDir, TagCacheDir, DatabaseFile), masterHeaderSize+10)
+	if _, err := parser.Parse(context.Background()); err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if got := parser.GetStatus().Source; got != models.ParseSourceFilesystem {
+		t.Errorf("status source = %q, want filesystem", got)
+	}
+}
+
+func TestParser_Stream(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTagCacheFixture(t, tmpDir, fixtureSongs())
+
+	parser := NewParser(tmpDir, &mockLogger{})
+	var paths []string
+	var processed []int
+	err := parser.Stream(context.Background(), func(song *models.Song) error {
+		paths = append(paths, song.Path)
+		status := parser.GetStatus()
+		processed = append(processed, status.ProcessedSongs)
+		if !status.InProgress || status.TotalSongs != 3 {
+			t.Errorf("status during the parse = %+v, want in progress with 3 entries", *status)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Stream() error = %v", err)
+	}
+
+	// Songs arrive in index order and progress counts the songs handed on
+	if len(paths) != 3 || paths[0] != "/Music/Metallica/Master of Puppets/01 - Battery.mp3" {
+		t.Errorf("Stream() paths = %v", paths)
+	}
+	if !reflect.DeepEqual(processed, []int{0, 1, 2}) {
+		t.Errorf("ProcessedSongs during the parse = %v, want [0 1 2]", processed)
+	}
+	status := parser.GetStatus()
+	if status.InProgress || status.ProcessedSongs != 3 || status.TotalSongs != 3 {
+		t.Errorf("status after the parse = %+v, want 3 of 3 processed", *status)
+	}
+}
+
+func TestParser_Stream_CallbackError(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTagCacheFixture(t, tmpDir, fixtureSongs())
+
+	errStop := errors.New("disk full")
+	parser := NewParser(tmpDir, &mockLogger{})
+	calls := 0
+	err := parser.Stream(context.Background(), func(song *models.Song) error {
+		calls++
+		if calls == 2 {
+			return errStop
+		}
+		return nil
+	})
+	if !errors.Is(err, errStop) {
+		t.Fatalf("Stream() error = %v, want %v", err, errStop)
+	}
+	if calls != 2 {
+		t.Errorf("callback called %d times, want the parse to stop after 2", calls)
+	}
+
+	status := parser.GetStatus()
+	if status.InProgress || status.ProcessedSongs != 1 || status.LastError != errStop.Error() {
+		t.Errorf("status = %+v, want 1 processed song and the callback error", *status)
+	}
+}
+
+// benchmarkLibrary writes a TagCache database of n songs sharing artists,
+// albums and genres the way a real library does
+func benchmarkLibrary(b *testing.B, n int) string {
+	b.Helper()
+	songs := make([]*models.Song, n)
+	for i := range songs {
+		artist := fmt.Sprintf("Artist %d", i%(n/20+1))
+		songs[i] = &models.Song{
+			Path:        fmt.Sprintf("/Music/%s/Album %d/%02d - Track %d.flac", artist, i/12, i%12+1, i),
+			Title:       fmt.Sprintf("Track %d", i),
+			Artist:      artist,
+			AlbumArtist: artist,
+			Album:       fmt.Sprintf("Album %d", i/12),
+			Genre:       fmt.Sprintf("Genre %d", i%40),
+			Year:        1970 + i%50,
+			TrackNumber: i%12 + 1,
+			Bitrate:     900,
+			Duration:    240,
+			PlayCount:   i % 7,
+		}
+	}
+
+	root := b.TempDir()
+	if err := tcbuilder.New(songs).Write(root); err != nil {
+		b.Fatalf("Failed to write library: %v", err)
+	}
+	return root
+}
+
+// liveHeap returns the heap in use after a collection
+func liveHeap() uint64 {
+	var stats runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&stats)
+	return stats.HeapAlloc
+}
+
+// heapGrowth returns the live heap above base
+func heapGrowth(base uint64) uint64 {
+	if heap := liveHeap(); heap > base {
+		return heap - base
+	}
+	return 0
+}
+
+// BenchmarkParser_Memory compares the peak live heap of collecting a large
+// library with Parse against handing it on with Stream. Stream holds the tag
+// files and the current song, so its live-MB stays near the size of the
+// database files while Parse grows with every song.
+func BenchmarkParser_Memory(b *testing.B) {
+	for _, n := range []int{10000, 50000} {
+		root := benchmarkLibrary(b, n)
+
+		b.Run(fmt.Sprintf("Parse/songs=%d", n), func(b *testing.B) {
+			var peak uint64
+			for i := 0; i < b.N; i++ {
+				base := liveHeap()
+				songs, err := NewParser(root, &mockLogger{}).Parse(context.Background())
+				if err != nil || len(songs) != n {
+					b.Fatalf("Parse() = %d songs, %v", len(songs), err)
+				}
+				b.StopTimer()
+				peak = max(peak, heapGrowth(base))
+				runtime.KeepAlive(songs)
+				b.StartTimer()
+			}
+			b.ReportMetric(float64(peak)/(1<<20), "live-MB")
+		})
+
+		b.Run(fmt.Sprintf("Stream/songs=%d", n), func(b *testing.B) {
+			var peak uint64
+			for i := 0; i < b.N; i++ {
+				base := liveHeap()
+				count := 0
+				err := NewParser(root, &mockLogger{}).Stream(context.Background(), func(song *models.Song) error {
+					count++
+					if count%(n/10) == 0 {
+						b.StopTimer()
+						peak = max(peak, heapGrowth(base))
+						b.StartTimer()
+					}
+					return nil
+				})
+				if err != nil || count != n {
+					b.Fatalf("Stream() = %d songs, %v", count, err)
+				}
+			}
+			b.ReportMetric(float64(peak)/(1<<20), "live-MB")
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package tcbuilder
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/Ardakilic/rocklist/internal/models"
+	"gorm.io/gorm"
+)
+
+// Anonymize returns copies of songs with every name replaced by a numbered
+// placeholder such as "Artist 3". Equal values get equal placeholders, so
+// shared artists, albums and folders stay shared. Numbers, statistics and
+// empty tags are kept, as are file extensions and volume folders such as
+// "<microSD1>". External IDs are dropped.
+func Anonymize(songs []*models.Song) []*models.Song {
+	a := &anonymizer{names: make(map[string]map[string]string)}
+
+	result := make([]*models.Song, len(songs))
+	for i, song := range songs {
+		copied := *song
+		copied.Model = gorm.Model{}
+		copied.Artist = a.name("Artist", song.Artist)
+		copied.AlbumArtist = a.name("Artist", song.AlbumArtist)
+		copied.Album = a.name("Album", song.Album)
+		copied.Genre = a.name("Genre", song.Genre)
+		copied.Title = a.name("Title", song.Title)
+		copied.Composer = a.name("Composer", song.Composer)
+		copied.Comment = a.name("Comment", song.Comment)
+		copied.Grouping = a.name("Grouping", song.Grouping)
+		copied.Path = a.path(song.Path)
+		copied.RockboxID = ""
+		copied.MusicBrainzID = ""
+		copied.SpotifyID = ""
+		copied.LastFMID = ""
+		copied.MatchedSource = ""
+		copied.MatchedAt = nil
+		copied.MatchConfidence = 0
+		result[i] = &copied
+	}
+	return result
+}
+
+// anonymizer hands out placeholders per kind of name
+type anonymizer struct {
+	names map[string]map[string]string
+}
+
+// name returns the placeholder of value, numbering new values per kind
+func (a *anonymizer) name(kind, value string) string {
+	if value == "" || value == Untagged {
+		return value
+	}
+	names, ok := a.names[kind]
+	if !ok {
+		names = make(map[string]string)
+		a.names[kind] = names
+	}
+	if name, ok := names[value]; ok {
+		return name
+	}
+	name := fmt.Sprintf("%s %d", kind, len(names)+1)
+	names[value] = name
+	return name
+}
+
+// path replaces every folder and file name of p, keeping the extension
+func (a *anonymizer) path(p string) string {
+	parts := strings.Split(p, "/")
+	for i, part := range parts {
+		switch {
+		case part == "" || strings.HasPrefix(part, "<") && strings.HasSuffix(part, ">"):
+			// Keep the root and volume folders
+		case i == len(parts)-1:
+			ext := path.Ext(part)
+			parts[i] = a.name("File", strings.TrimSuffix(part, ext)) + ext
+		default:
+			// Folders are numbered by their full path so equal names in
+			// different places stay apart
+			parts[i] = a.name("Folder", strings.Join(parts[:i+1], "/"))
+		}
+	}
+	return strings.Join(parts, "/")
+}
@@ -0,0 +1,43 @@
+package tcbuilder
+
+import (
+	"testing"
+
+	"github.com/Ardakilic/rocklist/internal/models"
+)
+
+func TestAnonymize(t *testing.T) {
+	songs := testSongs()
+	songs[0].ID = 42
+	songs[0].MusicBrainzID = "mbid"
+	songs[2].Path = "/<microSD1>/Music/Sigur Rós/03 - Svefn-g-englar.flac"
+
+	got := Anonymize(songs)
+
+	want := []models.Song{
+		{Path: "/Folder 1/Folder 2/Folder 3/File 1.mp3", Title: "Title 1", Artist: "Artist 1",
+			AlbumArtist: "Artist 1", Album: "Album 1", Genre: "Genre 1"},
+		{Path: "/Folder 1/Folder 2/Folder 3/File 2.mp3", Title: "Title 2", Artist: "Artist 1",
+			AlbumArtist: "Artist 1", Album: "Album 1", Genre: "Genre 1"},
+		{Path: "/<microSD1>/Folder 4/Folder 5/File 3.flac", Title: "Title 3", Artist: "Artist 2",
+			Album: "Album 2", Genre: "Genre 2", Composer: "Composer 1", Comment: "Comment 1", Grouping: "Grouping 1"},
+	}
+	for i, song := range got {
+		w := want[i]
+		if song.Path != w.Path || song.Title != w.Title || song.Artist != w.Artist || song.AlbumArtist != w.AlbumArtist ||
+			song.Album != w.Album || song.Genre != w.Genre || song.Composer != w.Composer ||
+			song.Comment != w.Comment || song.Grouping != w.Grouping {
+			t.Errorf("song %d = %+v, want %+v", i, *song, w)
+		}
+	}
+
+	if got[0].ID != 0 || got[0].MusicBrainzID != "" {
+		t.Errorf("ID, MusicBrainzID = %d, %q, want both cleared", got[0].ID, got[0].MusicBrainzID)
+	}
+	if got[0].PlayCount != 12 || got[0].Duration != 312 || got[1].TrackNumberGenerated != true {
+		t.Error("Anonymize() should keep numbers and statistics")
+	}
+	if songs[0].Artist != "Metallica" {
+		t.Error("Anonymize() should not modify its input")
+	}
+}
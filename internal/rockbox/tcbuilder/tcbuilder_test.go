@@ -0,0 +1,227 @@
+package tcbuilder
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/Ardakilic/rocklist/internal/models"
+	"github.com/Ardakilic/rocklist/internal/rockbox"
+)
+
+// testSongs returns a small library sharing artist and album strings
+func testSongs() []*models.Song {
+	mtime := time.Date(2019, 5, 14, 18, 42, 10, 0, time.Local)
+	return []*models.Song{
+		{
+			Path: "/Music/Metallica/Master of Puppets/01 - Battery.mp3", Title: "Battery",
+			Artist: "Metallica", AlbumArtist: "Metallica", Album: "Master of Puppets", Genre: "Thrash Metal",
+			Year: 1986, DiscNumber: 1, TrackNumber: 1, Bitrate: 320, Duration: 312, PlayCount: 12, Rating: 8,
+			LastPlayedSerial: 6, PlayTime: 3744000, LastElapsed: 95000, LastOffset: 3801088,
+			FileModifiedAt: &mtime,
+		},
+		{
+			Path: "/Music/Metallica/Master of Puppets/02 - Master of Puppets.mp3", Title: "Master of Puppets",
+			Artist: "Metallica", AlbumArtist: "Metallica", Album: "Master of Puppets", Genre: "Thrash Metal",
+			Year: 1986, DiscNumber: 1, TrackNumber: 2, Bitrate: 320, Duration: 515, PlayCount: 30, Rating: 10,
+			LastPlayedSerial: 4, PlayTime: 15450000, TrackNumberGenerated: true,
+		},
+		{
+			Path: "/Music/Sigur Rós/Ágætis byrjun/03 - Svefn-g-englar.flac", Title: "Svefn-g-englar",
+			Artist: "Sigur Rós", Album: "Ágætis byrjun", Genre: "Post-Rock",
+			Composer: "Jón Þór Birgisson", Comment: "Remastered", Grouping: "Icelandic",
+			Year: 1999, TrackNumber: 3, Bitrate: 900, Duration: 604,
+		},
+	}
+}
+
+// mapFS returns the database files as a device file system
+func mapFS(db *Database) fstest.MapFS {
+	fsys := fstest.MapFS{}
+	for name, data := range db.Files() {
+		fsys[Dir+"/"+name] = &fstest.MapFile{Data: data}
+	}
+	return fsys
+}
+
+func TestDatabase_RoundTrip(t *testing.T) {
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		t.Run(order.String(), func(t *testing.T) {
+			want := testSongs()
+			db := New(want)
+			db.Order = order
+
+			parser := rockbox.NewParserFS(mapFS(db), "fixture", &quietLogger{})
+			songs, err := parser.Parse(context.Background())
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if len(songs) != len(want) {
+				t.Fatalf("Parse() returned %d songs, want %d", len(songs), len(want))
+			}
+
+			for i, got := range songs {
+				w := want[i]
+				if got.Path != w.Path || got.Title != w.Title || got.Artist != w.Artist ||
+					got.AlbumArtist != w.AlbumArtist || got.Album != w.Album || got.Genre != w.Genre ||
+					got.Composer != w.Composer || got.Comment != w.Comment || got.Grouping != w.Grouping {
+					t.Errorf("song %d strings = %+v, want %+v", i, got, w)
+				}
+				if got.Year != w.Year || got.DiscNumber != w.DiscNumber || got.TrackNumber != w.TrackNumber ||
+					got.Bitrate != w.Bitrate || got.Duration != w.Duration || got.PlayCount != w.PlayCount ||
+					got.Rating != w.Rating || got.PlayTime != w.PlayTime || got.LastPlayedSerial != w.LastPlayedSerial ||
+					got.LastElapsed != w.LastElapsed || got.LastOffset != w.LastOffset {
+					t.Errorf("song %d numbers = %+v, want %+v", i, got, w)
+				}
+				if got.TrackNumberGenerated != w.TrackNumberGenerated {
+					t.Errorf("song %d TrackNumberGenerated = %v, want %v", i, got.TrackNumberGenerated, w.TrackNumberGenerated)
+				}
+			}
+
+			if mtime := songs[0].FileModifiedAt; mtime == nil || !mtime.Equal(*want[0].FileModifiedAt) {
+				t.Errorf("FileModifiedAt = %v, want %v", mtime, want[0].FileModifiedAt)
+			}
+
+			status := parser.GetStatus()
+			if status.Serial != 7 || status.CommitID != 1 || len(status.Diagnostics) != 0 {
+				t.Errorf("status serial %d, commit %d, diagnostics %v, want 7, 1 and none",
+					status.Serial, status.CommitID, status.Diagnostics)
+			}
+		})
+	}
+}
+
+func TestDatabase_OlderVersions(t *testing.T) {
+	tests := []struct {
+		version     byte
+		files       int
+		hasGrouping bool
+	}{
+		{0x0e, 9, false},
+		{0x0f, 10, true},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("0x%02x", tt.version), func(t *testing.T) {
+			want := testSongs()
+			db := New(want)
+			db.Version = tt.version
+			if files := db.Files(); len(files) != tt.files {
+				t.Errorf("Files() returned %d files, want %d", len(files), tt.files)
+			}
+
+			parser := rockbox.NewParserFS(mapFS(db), "fixture", &quietLogger{})
+			songs, err := parser.Parse(context.Background())
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if len(songs) != len(want) {
+				t.Fatalf("Parse() returned %d songs, want %d", len(songs), len(want))
+			}
+
+			got := songs[2]
+			if got.Title != want[2].Title || got.Comment != want[2].Comment || got.Year != want[2].Year ||
+				got.PlayCount != want[2].PlayCount || got.Bitrate != want[2].Bitrate {
+				t.Errorf("song = %+v, want %+v", got, want[2])
+			}
+			if (got.Grouping != "") != tt.hasGrouping {
+				t.Errorf("Grouping = %q, hasGrouping %v", got.Grouping, tt.hasGrouping)
+			}
+			// Resume positions were added in 0x10
+			if songs[0].LastElapsed != 0 || songs[0].LastOffset != 0 {
+				t.Errorf("LastElapsed, LastOffset = %d, %d, want 0", songs[0].LastElapsed, songs[0].LastOffset)
+			}
+
+			status := parser.GetStatus()
+			if status.TagCacheVersion != int(tt.version) || len(status.Diagnostics) != 0 {
+				t.Errorf("status version 0x%02x, diagnostics %v, want 0x%02x and none",
+					status.TagCacheVersion, status.Diagnostics, tt.version)
+			}
+		})
+	}
+}
+
+func TestDatabase_Flags(t *testing.T) {
+	db := New(testSongs())
+	db.Entries[0].Flag = FlagDeleted
+	db.Entries[2].Flag = FlagDirCache | FlagResurrected
+	db.Dirty = true
+
+	parser := rockbox.NewParserFS(mapFS(db), "fixture", &quietLogger{})
+	songs, err := parser.Parse(context.Background())
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	// The deleted entry is skipped and the dircache entry is resolved by idx_id
+	if len(songs) != 2 || songs[1].Path != testSongs()[2].Path {
+		t.Fatalf("Parse() = %d songs, want the last two", len(songs))
+	}
+
+	status := parser.GetStatus()
+	if !status.DatabaseDirty || status.DeletedEntries != 1 || status.DirCacheEntries != 1 ||
+		status.ResurrectedEntries != 1 || status.GeneratedTrackNumbers != 1 {
+		t.Errorf("status = %+v, want dirty with one entry per flag", *status)
+	}
+}
+
+func TestDatabase_TagFileLayout(t *testing.T) {
+	files := New(testSongs()).Files()
+	if len(files) != 10 {
+		t.Errorf("Files() returned %d files, want the index and nine tag files", len(files))
+	}
+
+	// Artists are shared, sorted and aligned to 8 bytes
+	artists := files[TagFileName(tagArtist)]
+	le := binary.LittleEndian
+	if le.Uint32(artists[0:]) != Magic || le.Uint32(artists[8:]) != 2 {
+		t.Fatalf("artist header = % x, want magic and 2 entries", artists[:12])
+	}
+	if length, idxID := le.Uint32(artists[12:]), int32(le.Uint32(artists[16:])); length != 16 || idxID != -1 {
+		t.Errorf("first artist length %d, idx_id %d, want 16 and -1", length, idxID)
+	}
+	if got := string(bytes.TrimRight(artists[20:36], "\x00")); got != "Metallica" {
+		t.Errorf("first artist = %q, want Metallica", got)
+	}
+
+	// Empty tags are stored as <Untagged>
+	if !bytes.Contains(files[TagFileName(tagComposer)], []byte(Untagged+"\x00")) {
+		t.Error("composer file should hold <Untagged> for songs without a composer")
+	}
+
+	// Filenames are owned by their index entry
+	filenames := files[TagFileName(tagFilename)]
+	if le.Uint32(filenames[8:]) != 3 {
+		t.Errorf("filename entries = %d, want 3", le.Uint32(filenames[8:]))
+	}
+}
+
+func TestDatabase_Write(t *testing.T) {
+	root := t.TempDir()
+	if err := New(testSongs()).Write(root); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	songs, err := rockbox.NewParser(root, &quietLogger{}).Parse(context.Background())
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if len(songs) != 3 {
+		t.Errorf("Parse() returned %d songs, want 3", len(songs))
+	}
+	if _, err := os.Stat(filepath.Join(root, Dir, TagFileName(tagGrouping))); err != nil {
+		t.Errorf("grouping tag file not written: %v", err)
+	}
+}
+
+// quietLogger discards parser logs
+type quietLogger struct{}
+
+func (l *quietLogger) Info(msg string, args ...interface{})  {}
+func (l *quietLogger) Error(msg string, args ...interface{}) {}
+func (l *quietLogger) Debug(msg string, args ...interface{}) {}
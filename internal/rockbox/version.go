@@ -0,0 +1,116 @@
+package rockbox
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/Ardakilic/rocklist/internal/models"
+)
+
+// tagCacheMagicBase is "TCH" followed by the version byte
+const tagCacheMagicBase = 0x54434800
+
+// tagCacheFormat describes the index layout of a TagCache version.
+// Rockbox bumps the version byte of TAGCACHE_MAGIC whenever tags are added,
+// which changes TAG_COUNT and with it the size of every index entry.
+type tagCacheFormat struct {
+	version byte
+	// tags lists the tag kept in each tag_seek slot of an index entry.
+	// String tags come first; database_N.tcd holds the tag of slot N.
+	tags []TagType
+}
+
+// tagCacheFormats lists the known versions, oldest first
+var tagCacheFormats = []*tagCacheFormat{
+	// Before tag_grouping: eight tag files, the year in slot 8
+	{version: 0x0e, tags: []TagType{
+		TagArtist, TagAlbum, TagGenre, TagTitle, TagFilename, TagComposer, TagComment, TagAlbumArtist,
+		TagYear, TagDiscNumber, TagTrackNumber, TagBitrate, TagLength, TagPlayCount, TagRating,
+		TagPlayTime, TagLastPlayed, TagCommitID, TagMTime,
+	}},
+	// Before autoresume added tag_lastelapsed and tag_lastoffset
+	{version: 0x0f, tags: []TagType{
+		TagArtist, TagAlbum, TagGenre, TagTitle, TagFilename, TagComposer, TagComment, TagAlbumArtist,
+		TagGrouping, TagYear, TagDiscNumber, TagTrackNumber, TagBitrate, TagLength, TagPlayCount,
+		TagRating, TagPlayTime, TagLastPlayed, TagCommitID, TagMTime,
+	}},
+	// Current layout, TAG_COUNT = 22
+	{version: 0x10, tags: []TagType{
+		TagArtist, TagAlbum, TagGenre, TagTitle, TagFilename, TagComposer, TagComment, TagAlbumArtist,
+		TagGrouping, TagYear, TagDiscNumber, TagTrackNumber, TagBitrate, TagLength, TagPlayCount,
+		TagRating, TagPlayTime, TagLastPlayed, TagCommitID, TagMTime, TagLastElapsed, TagLastOffset,
+	}},
+}
+
+// currentFormat is the layout of TagCacheMagic
+var currentFormat = tagCacheFormats[len(tagCacheFormats)-1]
+
+// magic returns the TAGCACHE_MAGIC of the version
+func (f *tagCacheFormat) magic() uint32 {
+	return tagCacheMagicBase | uint32(f.version)
+}
+
+// entrySize returns the size of an index entry: tag_seek[TAG_COUNT] + flag
+func (f *tagCacheFormat) entrySize() int {
+	return (len(f.tags) + 1) * 4
+}
+
+// stringTags returns the tags stored in tag files, in file order
+func (f *tagCacheFormat) stringTags() []TagType {
+	for i, tag := range f.tags {
+		if tag >= TagYear {
+			return f.tags[:i]
+		}
+	}
+	return f.tags
+}
+
+// tagFileName returns the name of the tag file holding tag, or false if the
+// version does not store the tag
+func (f *tagCacheFormat) tagFileName(tag TagType) (string, bool) {
+	for i, t := range f.stringTags() {
+		if t == tag {
+			return fmt.Sprintf("database_%d.tcd", i), true
+		}
+	}
+	return "", false
+}
+
+// formatByVersion returns the layout of a version byte
+func formatByVersion(version byte) (*tagCacheFormat, bool) {
+	for _, f := range tagCacheFormats {
+		if f.version == version {
+			return f, true
+		}
+	}
+	return nil, false
+}
+
+// detectFormat determines the version and byte order of a TagCache file from
+// its magic. ARM players write little-endian files, Coldfire and SH1 players
+// big-endian ones.
+func detectFormat(magic []byte) (*tagCacheFormat, binary.ByteOrder, error) {
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		v := order.Uint32(magic)
+		if v&^0xff != tagCacheMagicBase {
+			continue
+		}
+		if f, ok := formatByVersion(byte(v)); ok {
+			return f, order, nil
+		}
+		return nil, nil, fmt.Errorf("%w: version 0x%02x, supported versions are %s",
+			models.ErrUnsupportedTagCacheVersion, byte(v), supportedVersions())
+	}
+	return nil, nil, fmt.Errorf("invalid TagCache magic number: got 0x%08x, want 0x%08x",
+		binary.LittleEndian.Uint32(magic), TagCacheMagic)
+}
+
+// supportedVersions lists the known version bytes for error messages
+func supportedVersions() string {
+	versions := make([]string, len(tagCacheFormats))
+	for i, f := range tagCacheFormats {
+		versions[i] = fmt.Sprintf("0x%02x", f.version)
+	}
+	return strings.Join(versions, ", ")
+}
@@ -0,0 +1,226 @@
+package rockbox
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Ardakilic/rocklist/internal/models"
+	"github.com/Ardakilic/rocklist/internal/rockbox/tcbuilder"
+)
+
+func TestDetectFormat(t *testing.T) {
+	magic := func(order binary.ByteOrder, v uint32) []byte {
+		b := make([]byte, 4)
+		order.PutUint32(b, v)
+		return b
+	}
+
+	tests := []struct {
+		name        string
+		magic       []byte
+		wantVersion byte
+		wantOrder   binary.ByteOrder
+		wantErr     error
+	}{
+		{"0x10 little endian", magic(binary.LittleEndian, 0x54434810), 0x10, binary.LittleEndian, nil},
+		{"0x10 big endian", magic(binary.BigEndian, 0x54434810), 0x10, binary.BigEndian, nil},
+		{"0x0f", magic(binary.LittleEndian, 0x5443480f), 0x0f, binary.LittleEndian, nil},
+		{"0x0e big endian", magic(binary.BigEndian, 0x5443480e), 0x0e, binary.BigEndian, nil},
+		{"unknown version", magic(binary.LittleEndian, 0x5443480b), 0, nil, models.ErrUnsupportedTagCacheVersion},
+		{"newer version", magic(binary.BigEndian, 0x54434811), 0, nil, models.ErrUnsupportedTagCacheVersion},
+		{"not a TagCache file", []byte{1, 2, 3, 4}, 0, nil, errors.New("invalid")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			format, order, err := detectFormat(tt.magic)
+			if tt.wantErr != nil {
+				if err == nil {
+					t.Fatalf("detectFormat() error = nil, want %v", tt.wantErr)
+				}
+				isVersion := errors.Is(err, models.ErrUnsupportedTagCacheVersion)
+				if isVersion != errors.Is(tt.wantErr, models.ErrUnsupportedTagCacheVersion) {
+					t.Errorf("detectFormat() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("detectFormat() error = %v", err)
+			}
+			if format.version != tt.wantVersion || order != tt.wantOrder {
+				t.Errorf("detectFormat() = 0x%02x, %v, want 0x%02x, %v", format.version, order, tt.wantVersion, tt.wantOrder)
+			}
+		})
+	}
+}
+
+func TestTagCacheFormat_Layout(t *testing.T) {
+	tests := []struct {
+		version       byte
+		entrySize     int
+		stringTags    int
+		groupingFile  string
+		albumArtistAt string
+	}{
+		{0x0e, 80, 8, "", "database_7.tcd"},
+		{0x0f, 84, 9, "database_8.tcd", "database_7.tcd"},
+		{0x10, 92, 9, "database_8.tcd", "database_7.tcd"},
+	}
+
+	for _, tt := range tests {
+		format, ok := formatByVersion(tt.version)
+		if !ok {
+			t.Fatalf("formatByVersion(0x%02x) not found", tt.version)
+		}
+		if got := format.entrySize(); got != tt.entrySize {
+			t.Errorf("0x%02x entrySize() = %d, want %d", tt.version, got, tt.entrySize)
+		}
+		if got := len(format.stringTags()); got != tt.stringTags {
+			t.Errorf("0x%02x stringTags() = %d tags, want %d", tt.version, got, tt.stringTags)
+		}
+		if got, _ := format.tagFileName(TagGrouping); got != tt.groupingFile {
+			t.Errorf("0x%02x tagFileName(TagGrouping) = %q, want %q", tt.version, got, tt.groupingFile)
+		}
+		if got, _ := format.tagFileName(TagAlbumArtist); got != tt.albumArtistAt {
+			t.Errorf("0x%02x tagFileName(TagAlbumArtist) = %q, want %q", tt.version, got, tt.albumArtistAt)
+		}
+	}
+
+	if currentFormat.magic() != TagCacheMagic {
+		t.Errorf("currentFormat.magic() = 0x%08x, want 0x%08x", currentFormat.magic(), TagCacheMagic)
+	}
+	// index_entry is tag_seek[TAG_COUNT] followed by a flag word
+	if got := len(currentFormat.tags); got != TagCount {
+		t.Errorf("currentFormat has %d tags, want TAG_COUNT %d", got, TagCount)
+	}
+}
+
+// TestParser_Parse_ReleaseFixtures parses the checked-in databases in
+// testdata/tagcache, one per version, whose bytes follow the tag order of
+// that release rather than tagCacheFormats. Every slot holds a distinct
+// value, so a slot read from the wrong position shows up as a wrong field.
+func TestParser_Parse_ReleaseFixtures(t *testing.T) {
+	want := models.Song{
+		Path:                 "/Music/Metallica/Master of Puppets/01 - Battery.mp3",
+		Title:                "Battery",
+		Artist:               "Metallica",
+		AlbumArtist:          "Metallica (Album Artist)",
+		Album:                "Master of Puppets",
+		Genre:                "Thrash Metal",
+		Composer:             "Hetfield/Ulrich",
+		Comment:              "Remastered",
+		Grouping:             "Side A",
+		Year:                 1986,
+		TrackNumber:          1,
+		TrackNumberGenerated: true,
+		DiscNumber:           2,
+		Duration:             312,
+		Bitrate:              320,
+		Rating:               8,
+		PlayCount:            12,
+		LastPlayedSerial:     40,
+		PlayTime:             3744000,
+		LastElapsed:          95000,
+		LastOffset:           3801088,
+	}
+
+	tests := []struct {
+		dir     string
+		version int
+		// noGrouping and noResume mark the tags the version does not store
+		noGrouping bool
+		noResume   bool
+	}{
+		{"v0e", 0x0e, true, true},
+		{"v0f", 0x0f, false, true},
+		{"v10", 0x10, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.dir, func(t *testing.T) {
+			parser := NewParser(filepath.Join("testdata", "tagcache", tt.dir), &mockLogger{})
+			songs, err := parser.Parse(context.Background())
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if status := parser.GetStatus(); status.TagCacheVersion != tt.version || len(status.Diagnostics) != 0 {
+				t.Errorf("status = version 0x%02x, diagnostics %+v, want 0x%02x and none", status.TagCacheVersion, status.Diagnostics, tt.version)
+			}
+			if len(songs) != 1 {
+				t.Fatalf("Parse() = %d songs, want 1", len(songs))
+			}
+
+			expected := want
+			if tt.noGrouping {
+				expected.Grouping = ""
+			}
+			if tt.noResume {
+				expected.LastElapsed, expected.LastOffset = 0, 0
+			}
+			got := *songs[0]
+			if modified := fixtureTime(2019, 5, 14, 18, 42, 10); got.FileModifiedAt == nil || !got.FileModifiedAt.Equal(*modified) {
+				t.Errorf("FileModifiedAt = %v, want %v", got.FileModifiedAt, modified)
+			}
+			got.RockboxID, got.LastPlayed, got.FileModifiedAt = "", nil, nil
+			if got != expected {
+				t.Errorf("Parse() =\n%+v\nwant\n%+v", got, expected)
+			}
+		})
+	}
+}
+
+func TestParser_Parse_UnsupportedVersion(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTagCacheFixture(t, tmpDir, fixtureSongs())
+
+	// Rewrite the index magic to version 0x0b
+	name := filepath.Join(tmpDir, TagCacheDir, DatabaseFile)
+	data, _ := os.ReadFile(name)
+	binary.LittleEndian.PutUint32(data, 0x5443480b)
+	_ = os.WriteFile(name, data, 0644)
+
+	parser := NewParser(tmpDir, &mockLogger{})
+	songs, err := parser.Parse(context.Background())
+	if !errors.Is(err, models.ErrUnsupportedTagCacheVersion) {
+		t.Fatalf("Parse() error = %v, want ErrUnsupportedTagCacheVersion", err)
+	}
+	if songs != nil {
+		t.Errorf("Parse() = %d songs, want none instead of a filesystem scan", len(songs))
+	}
+}
+
+func TestParser_Parse_TagFileVersionMismatch(t *testing.T) {
+	tmpDir := t.TempDir()
+	db := tcbuilder.New([]*models.Song{
+		{Path: "/Music/a.mp3", Title: "A", Artist: "Artist"},
+	})
+	if err := db.Write(tmpDir); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	// An artist file left over from an older firmware
+	db.Version = 0x0f
+	stale := db.Files()[tcbuilder.TagFileName(int(TagArtist))]
+	_ = os.WriteFile(filepath.Join(tmpDir, TagCacheDir, currentTagFile(t, TagArtist)), stale, 0644)
+
+	parser := NewParser(tmpDir, &mockLogger{})
+	songs, err := parser.Parse(context.Background())
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if len(songs) != 1 || songs[0].Artist != "" || songs[0].Title != "A" {
+		t.Errorf("Parse() = %+v, want one song without artist", songs)
+	}
+
+	status := parser.GetStatus()
+	if status.TagCacheVersion != 0x10 {
+		t.Errorf("TagCacheVersion = 0x%02x, want 0x10", status.TagCacheVersion)
+	}
+	if len(status.Diagnostics) != 1 || status.Diagnostics[0].File != currentTagFile(t, TagArtist) {
+		t.Errorf("Diagnostics = %+v, want one for %s", status.Diagnostics, currentTagFile(t, TagArtist))
+	}
+}
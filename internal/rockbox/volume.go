@@ -0,0 +1,68 @@
+package rockbox
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/Ardakilic/rocklist/internal/models"
+)
+
+// Rockbox names files on every volume but the first with a volume prefix:
+// /<microSD1>/Music/song.mp3 on players with an SD slot, /<HD1>/ on players
+// with a second drive (VOL_START_TOK and VOL_END_TOK in pathfuncs.h). Files on
+// the first volume keep plain absolute paths.
+const (
+	volumeStart = '<'
+	volumeEnd   = '>'
+)
+
+// SplitVolume splits a Rockbox path into its volume name and the absolute
+// path on that volume. The volume is "" for the first volume.
+func SplitVolume(p string) (volume, rest string) {
+	if !strings.HasPrefix(p, "/") {
+		return "", p
+	}
+	first, rest, _ := strings.Cut(p[1:], "/")
+	if len(first) < 3 || first[0] != volumeStart || first[len(first)-1] != volumeEnd {
+		return "", p
+	}
+	return first[1 : len(first)-1], "/" + rest
+}
+
+// VolumePath returns the Rockbox path of the absolute path rest on volume
+func VolumePath(volume, rest string) string {
+	if volume == "" {
+		return rest
+	}
+	return "/" + string(volumeStart) + volume + string(volumeEnd) + rest
+}
+
+// ValidVolumeName reports whether name can be used as a volume name
+func ValidVolumeName(name string) bool {
+	return name != "" && !strings.ContainsAny(name, "/\\<>")
+}
+
+// VolumeMap maps volume names to the host folders they are mounted at. The
+// first volume has the name "".
+type VolumeMap map[string]string
+
+// HostPath returns where a Rockbox path is found on the host. It fails with
+// models.ErrVolumeNotMapped when the path is on a volume without a folder.
+func (m VolumeMap) HostPath(p string) (string, error) {
+	volume, rest := SplitVolume(p)
+	root, ok := m[volume]
+	if !ok || root == "" {
+		return "", fmt.Errorf("%w: %s", models.ErrVolumeNotMapped, volumeLabel(volume))
+	}
+	return filepath.Join(root, filepath.FromSlash(path.Clean(rest))), nil
+}
+
+// volumeLabel names a volume in messages
+func volumeLabel(volume string) string {
+	if volume == "" {
+		return "main volume"
+	}
+	return string(volumeStart) + volume + string(volumeEnd)
+}
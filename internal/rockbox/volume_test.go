@@ -0,0 +1,101 @@
+package rockbox
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/Ardakilic/rocklist/internal/models"
+)
+
+func TestSplitVolume(t *testing.T) {
+	tests := []struct {
+		path       string
+		wantVolume string
+		wantRest   string
+	}{
+		{"/Music/a.mp3", "", "/Music/a.mp3"},
+		{"/<microSD1>/Music/a.mp3", "microSD1", "/Music/a.mp3"},
+		{"/<HD1>/a.flac", "HD1", "/a.flac"},
+		{"/<microSD1>/", "microSD1", "/"},
+		{"/<>/a.mp3", "", "/<>/a.mp3"},
+		{"/Music/<microSD1>/a.mp3", "", "/Music/<microSD1>/a.mp3"},
+		{"/<Untagged/a.mp3", "", "/<Untagged/a.mp3"},
+		{"relative.mp3", "", "relative.mp3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			volume, rest := SplitVolume(tt.path)
+			if volume != tt.wantVolume || rest != tt.wantRest {
+				t.Errorf("SplitVolume() = %q, %q, want %q, %q", volume, rest, tt.wantVolume, tt.wantRest)
+			}
+			if got := VolumePath(volume, rest); tt.wantVolume != "" && got != tt.path {
+				t.Errorf("VolumePath() = %q, want %q", got, tt.path)
+			}
+		})
+	}
+}
+
+func TestValidVolumeName(t *testing.T) {
+	for name, want := range map[string]bool{"microSD1": true, "HD1": true, "": false, "a/b": false, "<x>": false} {
+		if got := ValidVolumeName(name); got != want {
+			t.Errorf("ValidVolumeName(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestVolumeMap_HostPath(t *testing.T) {
+	mounts := VolumeMap{"": "/media/ipod", "microSD1": "/media/sd"}
+
+	tests := []struct {
+		path    string
+		want    string
+		wantErr error
+	}{
+		{"/Music/a.mp3", filepath.Join("/media/ipod", "Music", "a.mp3"), nil},
+		{"/<microSD1>/Music/a.mp3", filepath.Join("/media/sd", "Music", "a.mp3"), nil},
+		{"/<microSD1>/../../etc/passwd", filepath.Join("/media/sd", "etc", "passwd"), nil},
+		{"/<HD1>/a.mp3", "", models.ErrVolumeNotMapped},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := mounts.HostPath(tt.path)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("HostPath() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("HostPath() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParser_ScanFilesystem_Volumes(t *testing.T) {
+	internal := fstest.MapFS{
+		TagCacheDir + "/config.cfg": {Data: []byte("")},
+		"Music/Internal - Song.mp3": {Data: []byte("test")},
+	}
+	parser := NewParserFS(internal, "device", &mockLogger{})
+	parser.SetVolumes(map[string]fs.FS{
+		"microSD1": fstest.MapFS{"Music/Card - Song.flac": {Data: []byte("test")}},
+	})
+
+	songs, err := scanSongs(context.Background(), parser, internal)
+	if err != nil {
+		t.Fatalf("scanFilesystem() error = %v", err)
+	}
+	if len(songs) != 2 {
+		t.Fatalf("scanFilesystem() found %d songs, want 2", len(songs))
+	}
+	if songs[0].Path != "/Music/Internal - Song.mp3" || songs[1].Path != "/<microSD1>/Music/Card - Song.flac" {
+		t.Errorf("paths = %q, %q", songs[0].Path, songs[1].Path)
+	}
+	if songs[0].RockboxID == songs[1].RockboxID {
+		t.Error("songs on different volumes should have different Rockbox IDs")
+	}
+}
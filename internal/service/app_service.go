@@ -4,9 +4,13 @@ package service
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -15,6 +19,7 @@ import (
 	"github.com/Ardakilic/rocklist/internal/models"
 	"github.com/Ardakilic/rocklist/internal/repository"
 	"github.com/Ardakilic/rocklist/internal/rockbox"
+	"github.com/Ardakilic/rocklist/internal/rockbox/tcbuilder"
 )
 
 // AppService is the main application service that coordinates all operations
@@ -23,11 +28,23 @@ type AppService struct {
 	songRepo        repository.SongRepository
 	playlistRepo    repository.PlaylistRepository
 	configRepo      repository.ConfigRepository
+	deviceRepo      repository.DeviceRepository
+	playRepo        repository.PlayEventRepository
+	aliasRepo       repository.ArtistAliasRepository
 	parser          *rockbox.Parser
+	discovery       *rockbox.Discovery
 	playlistService *PlaylistService
-	config          *models.AppConfig
-	logBuffer       *LogBuffer
-	mu              sync.RWMutex
+	// device is the active device; the song, playlist and play history
+	// repositories are scoped to it
+	device    *models.Device
+	config    *models.AppConfig
+	logBuffer *LogBuffer
+	mu        sync.RWMutex
+
+	// Library enrichment job, guarded by enrichMu
+	enrichStatus *models.EnrichStatus
+	enrichCancel context.CancelFunc
+	enrichMu     sync.Mutex
 
 	// API clients
 	lastfmClient      *api.LastFMClient
@@ -145,17 +162,22 @@ func NewAppService(dbPath string) (*AppService, error) {
 	songRepo := repository.NewSongRepository(db.DB())
 	playlistRepo := repository.NewPlaylistRepository(db.DB())
 	configRepo := repository.NewConfigRepository(db.DB())
+	aliasRepo := repository.NewArtistAliasRepository(db.DB())
 
 	// Create services
 	parser := rockbox.NewParser("", logger)
 	playlistService := NewPlaylistService(songRepo, playlistRepo, "", logger)
+	playlistService.SetAliasRepository(aliasRepo)
 
 	app := &AppService{
 		db:              db,
 		songRepo:        songRepo,
 		playlistRepo:    playlistRepo,
 		configRepo:      configRepo,
+		deviceRepo:      repository.NewDeviceRepository(db.DB()),
+		aliasRepo:       aliasRepo,
 		parser:          parser,
+		discovery:       rockbox.NewDiscovery(),
 		playlistService: playlistService,
 		config:          &models.AppConfig{},
 		logBuffer:       logBuffer,
@@ -170,6 +192,9 @@ func NewAppService(dbPath string) (*AppService, error) {
 	if err := app.loadConfig(context.Background()); err != nil {
 		logger.Debug("No existing config found, using defaults")
 	}
+	if err := app.loadDevice(context.Background()); err != nil {
+		return nil, fmt.Errorf("failed to load device: %w", err)
+	}
 
 	return app, nil
 }
@@ -186,10 +211,13 @@ func (s *AppService) loadConfig(ctx context.Context) error {
 		return err
 	}
 
-	if path, ok := configs[repository.ConfigKeyRockboxPath]; ok {
-		s.config.RockboxPath = path
-		s.parser.SetPath(path)
+	if volumes, ok := configs[repository.ConfigKeyVolumes]; ok {
+		// An unreadable value is dropped; the next SetVolumes replaces it
+		if err := json.Unmarshal([]byte(volumes), &s.config.Volumes); err != nil {
+			s.config.Volumes = nil
+		}
 	}
+	s.applyVolumes()
 
 	// Last.fm config
 	if apiKey, ok := configs[repository.ConfigKeyLastFMAPIKey]; ok {
@@ -224,15 +252,125 @@ func (s *AppService) loadConfig(ctx context.Context) error {
 	// Update clients
 	s.updateClients()
 
-	// Load last parsed timestamp
-	lastParsed, err := s.configRepo.GetLastParsedAt(ctx)
-	if err == nil && lastParsed != nil {
-		s.config.LastParsedAt = lastParsed
+	return nil
+}
+
+// loadDevice activates the device used last, or the first one. The first
+// start after upgrading creates the default device from the saved Rockbox
+// path and parse history, and hands it the existing songs and playlists.
+func (s *AppService) loadDevice(ctx context.Context) error {
+	if value, err := s.configRepo.Get(ctx, repository.ConfigKeyActiveDevice); err == nil {
+		if id, err := strconv.ParseUint(value, 10, 64); err == nil {
+			if device, err := s.deviceRepo.FindByID(ctx, uint(id)); err == nil {
+				s.useDevice(device)
+				return nil
+			}
+		}
+	}
+
+	devices, err := s.deviceRepo.FindAll(ctx)
+	if err != nil {
+		return err
+	}
+	if len(devices) > 0 {
+		s.useDevice(devices[0])
+		return nil
 	}
 
+	device := &models.Device{Name: models.DefaultDeviceName}
+	if path, err := s.configRepo.Get(ctx, repository.ConfigKeyRockboxPath); err == nil {
+		device.Path = path
+	}
+	if lastParsed, err := s.configRepo.GetLastParsedAt(ctx); err == nil {
+		device.LastParsedAt = lastParsed
+	}
+	if serial, commitID, ok, err := s.configRepo.GetTagCacheVersion(ctx); err == nil && ok {
+		device.SetTagCacheVersion(serial, commitID)
+	}
+	if err := s.deviceRepo.Create(ctx, device); err != nil {
+		return err
+	}
+	if err := s.deviceRepo.ClaimUnassigned(ctx, device.ID); err != nil {
+		return err
+	}
+	s.useDevice(device)
 	return nil
 }
 
+// useDevice makes device the active one: songs and playlists are read from
+// and saved to its library, and its path is parsed and exported to
+func (s *AppService) useDevice(device *models.Device) {
+	s.device = device
+	s.songRepo = repository.NewDeviceSongRepository(s.db.DB(), device.ID)
+	s.playlistRepo = repository.NewDevicePlaylistRepository(s.db.DB(), device.ID)
+	s.playRepo = repository.NewPlayEventRepository(s.db.DB(), device.ID)
+	s.playlistService.SetRepositories(s.songRepo, s.playlistRepo)
+
+	s.config.RockboxPath = device.Path
+	s.config.LastParsedAt = device.LastParsedAt
+	s.parser.SetPath(device.Path)
+	if device.Path != "" {
+		s.playlistService.SetPlaylistDir(filepath.Join(device.Path, "Playlists"))
+	}
+	s.applyVolumes()
+}
+
+// SelectDevice makes the named device the active one, creating it when it
+// is new. A new device named after the volume label of a mounted player
+// starts with that player's path.
+func (s *AppService) SelectDevice(ctx context.Context, name string) (*models.Device, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, fmt.Errorf("%w: device name is required", models.ErrInvalidInput)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	device, err := s.findOrCreateDevice(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.configRepo.Set(ctx, repository.ConfigKeyActiveDevice, strconv.FormatUint(uint64(device.ID), 10)); err != nil {
+		return nil, err
+	}
+	s.useDevice(device)
+	NewAppLogger(s.logBuffer).Info("Using device %s", device.Name)
+	return device, nil
+}
+
+// findOrCreateDevice returns the named device, creating it when it is new
+func (s *AppService) findOrCreateDevice(ctx context.Context, name string) (*models.Device, error) {
+	device, err := s.deviceRepo.FindByName(ctx, name)
+	if errors.Is(err, models.ErrDeviceNotFound) {
+		device = &models.Device{Name: name}
+		for _, found := range s.discovery.Find() {
+			if found.Name == name {
+				device.Path, device.Target, device.Version = found.Path, found.Target, found.Version
+				break
+			}
+		}
+		err = s.deviceRepo.Create(ctx, device)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return device, nil
+}
+
+// GetDevices returns the known devices ordered by name
+func (s *AppService) GetDevices(ctx context.Context) ([]*models.Device, error) {
+	return s.deviceRepo.FindAll(ctx)
+}
+
+// ActiveDevice returns the device whose library is in use
+func (s *AppService) ActiveDevice() *models.Device {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.device
+}
+
 // updateClients updates API clients with current config
 func (s *AppService) updateClients() {
 	s.lastfmClient.SetCredentials(s.config.LastFM.APIKey, s.config.LastFM.APISecret)
@@ -268,8 +406,11 @@ func (s *AppService) SaveConfig(ctx context.Context, config *models.AppConfig) e
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	// Save to database
-	if err := s.configRepo.Set(ctx, repository.ConfigKeyRockboxPath, config.RockboxPath); err != nil {
+	// Save to database; the Rockbox path belongs to the active device
+	if err := s.setDevicePath(ctx, config.RockboxPath); err != nil {
+		return err
+	}
+	if err := s.saveVolumes(ctx, config.Volumes); err != nil {
 		return err
 	}
 
@@ -315,71 +456,264 @@ func (s *AppService) SaveConfig(ctx context.Context, config *models.AppConfig) e
 		return err
 	}
 
+	config.LastParsedAt = s.device.LastParsedAt
 	s.config = config
 	s.parser.SetPath(config.RockboxPath)
+	s.applyVolumes()
 	s.updateClients()
 
 	return nil
 }
 
-// SetRockboxPath sets the Rockbox device path
+// SetRockboxPath sets the path of the active device
 func (s *AppService) SetRockboxPath(path string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	if err := s.setDevicePath(context.Background(), path); err != nil {
+		return err
+	}
+
 	s.config.RockboxPath = path
 	s.parser.SetPath(path)
+	s.applyVolumes()
 
 	// Update playlist directory
 	playlistDir := filepath.Join(path, "Playlists")
 	s.playlistService.SetPlaylistDir(playlistDir)
 
-	return s.configRepo.Set(context.Background(), repository.ConfigKeyRockboxPath, path)
+	return nil
+}
+
+// setDevicePath saves the path of the active device. A different path may
+// hold a different database, so the recorded TagCache version is forgotten.
+func (s *AppService) setDevicePath(ctx context.Context, path string) error {
+	if s.device.Path == path {
+		return nil
+	}
+	if s.device.Path != "" {
+		s.device.ClearTagCacheVersion()
+	}
+	s.device.Path = path
+	return s.deviceRepo.Update(ctx, s.device)
+}
+
+// SetVolumes maps the player's extra volumes, such as microSD1 or HD1, to the
+// host folders they are mounted at. Songs on those volumes have paths like
+// /<microSD1>/Music/song.mp3; the mapping lets the filesystem scan find them
+// and exports check that their files exist. An empty folder removes a volume.
+func (s *AppService) SetVolumes(ctx context.Context, volumes map[string]string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	merged := make(map[string]string, len(s.config.Volumes)+len(volumes))
+	for name, dir := range s.config.Volumes {
+		merged[name] = dir
+	}
+	for name, dir := range volumes {
+		if !rockbox.ValidVolumeName(name) {
+			return fmt.Errorf("%w: volume name %q", models.ErrInvalidInput, name)
+		}
+		if dir == "" {
+			delete(merged, name)
+		} else {
+			merged[name] = dir
+		}
+	}
+
+	if err := s.saveVolumes(ctx, merged); err != nil {
+		return err
+	}
+	s.config.Volumes = merged
+	s.applyVolumes()
+	return nil
 }
 
-// ParseRockboxDatabase parses the Rockbox database
-func (s *AppService) ParseRockboxDatabase(ctx context.Context, usePrefetched bool) error {
+// saveVolumes stores the volume mount points. An empty mapping is stored as
+// well rather than deleted: Delete is a soft delete, and a later Set would
+// upsert into the deleted row and stay invisible.
+func (s *AppService) saveVolumes(ctx context.Context, volumes map[string]string) error {
+	if volumes == nil {
+		volumes = map[string]string{}
+	}
+	data, err := json.Marshal(volumes)
+	if err != nil {
+		return err
+	}
+	return s.configRepo.Set(ctx, repository.ConfigKeyVolumes, string(data))
+}
+
+// applyVolumes hands the volume mount points to the parser and the
+// playlist service. The configured Rockbox path is the main volume.
+func (s *AppService) applyVolumes() {
+	volumes := make(map[string]fs.FS, len(s.config.Volumes))
+	for name, dir := range s.config.Volumes {
+		volumes[name] = os.DirFS(dir)
+	}
+	s.parser.SetVolumes(volumes)
+
+	if s.config.RockboxPath == "" && len(s.config.Volumes) == 0 {
+		s.playlistService.SetVolumes(nil)
+		return
+	}
+	mounts := rockbox.VolumeMap{"": s.config.RockboxPath}
+	for name, dir := range s.config.Volumes {
+		mounts[name] = dir
+	}
+	s.playlistService.SetVolumes(mounts)
+}
+
+// ParseRockboxDatabase parses the Rockbox database and syncs the stored songs.
+// The parse is skipped when the TagCache serial and commit ID match the last
+// parse; otherwise songs are upserted by RockboxID so enrichment survives.
+func (s *AppService) ParseRockboxDatabase(ctx context.Context, usePrefetched bool) (*models.SyncResult, error) {
 	logger := NewAppLogger(s.logBuffer)
 
+	count, err := s.songRepo.Count(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	if usePrefetched {
 		// Check if we have pre-fetched data
-		count, err := s.songRepo.Count(ctx)
-		if err != nil {
-			return err
-		}
 		if count > 0 {
 			logger.Info("Using pre-fetched data: %d songs", count)
-			return nil
+			return &models.SyncResult{Unchanged: int(count), Skipped: true}, nil
 		}
-		return models.ErrNoPreFetchedData
+		return nil, models.ErrNoPreFetchedData
 	}
 
-	// Parse database
-	songs, err := s.parser.Parse(ctx)
+	if count > 0 && s.tagCacheUnchanged(ctx) {
+		logger.Info("TagCache unchanged since the last parse, keeping %d songs", count)
+		return &models.SyncResult{Unchanged: int(count), Skipped: true}, nil
+	}
+
+	return s.syncParse(ctx, logger, true)
+}
+
+// ParseFrom parses a device backup into the library of the named device,
+// which is created when new. The active device is left as it was, so the
+// parse does not change which device later commands use. source is a
+// folder, a zip archive or a FAT disk image holding a .rockbox folder.
+// The device must be named: the sync removes the songs the backup lacks, so
+// a backup is never synced into whichever device happens to be active.
+// The backup is not the device, so its TagCache version is not remembered
+// and the next ParseRockboxDatabase parses the device in full.
+func (s *AppService) ParseFrom(ctx context.Context, source, device string) (*models.SyncResult, error) {
+	logger := NewAppLogger(s.logBuffer)
+
+	if strings.TrimSpace(device) == "" {
+		return nil, fmt.Errorf("%w: name the device to parse the backup into", models.ErrInvalidInput)
+	}
+
+	fsys, closer, err := rockbox.OpenSource(source)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	defer func() { _ = closer.Close() }()
+
+	target, err := s.findOrCreateDevice(ctx, strings.TrimSpace(device))
+	if err != nil {
+		return nil, err
+	}
+
+	// Use the named device's library for this parse only
+	s.mu.Lock()
+	previous := s.device
+	if target.ID == previous.ID {
+		// Keep one value, so the parse history recorded on it stays in use
+		target = previous
+	}
+	s.useDevice(target)
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.useDevice(previous)
+	}()
+
+	// Parse with the shared parser so GetParseStatus reports progress. The
+	// backup holds the main volume only, so the mounted volumes are not scanned.
+	s.parser.SetFS(fsys, source)
+	s.parser.SetVolumes(nil)
+
+	return s.syncParse(ctx, logger, false)
+}
+
+// syncParse parses the database and records the parse. Songs are saved in
+// chunks while they are read, so memory stays bounded on large libraries; a
+// failed parse keeps the chunks already saved but removes no songs.
+// fromDevice remembers the TagCache version so an unchanged database can be
+// skipped; otherwise any recorded version is forgotten.
+func (s *AppService) syncParse(ctx context.Context, logger *AppLogger, fromDevice bool) (*models.SyncResult, error) {
+	songs := s.songRepo.BeginSync(ctx)
+	err := s.parser.Stream(ctx, func(song *models.Song) error {
+		if err := songs.Add(ctx, song); err != nil {
+			return fmt.Errorf("failed to save songs: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	logger.Info("Parsed %d songs, saving to database...", len(songs))
+	result, err := songs.Finish(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save songs: %w", err)
+	}
 
-	// Clear existing songs and save new ones
-	if err := s.songRepo.DeleteAll(ctx); err != nil {
-		return fmt.Errorf("failed to clear existing songs: %w", err)
+	// Plays imported before their song was on the device are counted now
+	if counted, err := s.countUnmatchedPlays(ctx); err != nil {
+		logger.Error("Failed to count imported plays: %v", err)
+	} else if counted > 0 {
+		logger.Info("Counted %d imported plays of songs added by this parse", counted)
 	}
 
-	if err := s.songRepo.CreateBatch(ctx, songs); err != nil {
-		return fmt.Errorf("failed to save songs: %w", err)
+	// Remember the TagCache version, or forget it when the songs came from a fallback
+	status := s.parser.GetStatus()
+	logger.Info("Parsed %d songs from %s", status.ProcessedSongs, status.Source)
+	if fromDevice && status.Source == models.ParseSourceTagCache {
+		s.device.SetTagCacheVersion(status.Serial, status.CommitID)
+	} else {
+		s.device.ClearTagCacheVersion()
+	}
+	if fromDevice {
+		if info, err := rockbox.ReadDeviceInfo(os.DirFS(s.device.Path)); err == nil {
+			s.device.Target, s.device.Version = info.Target, info.Version
+		}
 	}
 
 	// Update last parsed timestamp
 	now := time.Now()
 	s.config.LastParsedAt = &now
-	if err := s.configRepo.SetLastParsedAt(ctx, now); err != nil {
-		logger.Error("Failed to save last parsed timestamp: %v", err)
+	s.device.LastParsedAt = &now
+	if err := s.deviceRepo.Update(ctx, s.device); err != nil {
+		logger.Error("Failed to save parse history: %v", err)
 	}
 
-	logger.Info("Successfully saved %d songs to database", len(songs))
-	return nil
+	logger.Info("Synced songs: %d added, %d removed, %d changed, %d unchanged",
+		result.Added, result.Removed, result.Changed, result.Unchanged)
+	if result.MissingPlaylistEntries > 0 {
+		logger.Info("%d playlist entries point at songs no longer on the device and are flagged as missing",
+			result.MissingPlaylistEntries)
+	}
+	return result, nil
+}
+
+// tagCacheUnchanged reports whether the device's TagCache has the serial and
+// commit ID recorded by the last parse
+func (s *AppService) tagCacheUnchanged(ctx context.Context) bool {
+	serial, commitID, ok := s.device.TagCacheVersion()
+	if !ok {
+		return false
+	}
+
+	header, err := s.parser.ReadMasterHeader()
+	if err != nil {
+		return false
+	}
+
+	return header.Serial == serial && header.CommitID == commitID
 }
 
 // GetParseStatus returns the current parse status
@@ -387,9 +721,110 @@ func (s *AppService) GetParseStatus() *models.ParseStatus {
 	return s.parser.GetStatus()
 }
 
-// GetLastParsedAt returns the last parsed timestamp
+// FindDevices returns the mounted players that have a Rockbox database, to
+// offer as the Rockbox path
+func (s *AppService) FindDevices() []*rockbox.DeviceInfo {
+	return s.discovery.Find()
+}
+
+// InspectDatabase parses the device without saving the songs and returns the
+// parse status. Its diagnostics list the damaged records that were skipped,
+// which explains songs missing after a parse.
+func (s *AppService) InspectDatabase(ctx context.Context) (*models.ParseStatus, error) {
+	if _, err := s.parser.Parse(ctx); err != nil {
+		return nil, err
+	}
+	return s.parser.GetStatus(), nil
+}
+
+// MakeFixture parses the device and writes its songs as a new TagCache
+// database under dir, so a library can be shared to reproduce a problem.
+// Names are replaced by placeholders unless keepNames is set. It returns the
+// number of songs written.
+func (s *AppService) MakeFixture(ctx context.Context, dir string, keepNames bool) (int, error) {
+	songs, err := s.parser.Parse(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if !keepNames {
+		songs = tcbuilder.Anonymize(songs)
+	}
+
+	db := tcbuilder.New(songs)
+	if status := s.parser.GetStatus(); status.Source == models.ParseSourceTagCache {
+		db.Serial = max(db.Serial, status.Serial)
+		db.CommitID = max(db.CommitID, status.CommitID)
+		db.Dirty = status.DatabaseDirty
+	}
+
+	if err := db.Write(dir); err != nil {
+		return 0, fmt.Errorf("failed to write fixture: %w", err)
+	}
+	return len(songs), nil
+}
+
+// GetLastParsedAt returns when the active device was last parsed
 func (s *AppService) GetLastParsedAt(ctx context.Context) (*time.Time, error) {
-	return s.configRepo.GetLastParsedAt(ctx)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.device.LastParsedAt, nil
+}
+
+// PushStats compares the ratings, play counts and last played times stored in
+// Rocklist with the device and writes the differences to the device's database
+// changelog, which Rockbox imports on its next database initialisation.
+// Only the mounted root of the active device is written to, never a backup
+// opened with ParseFrom. The changelog keeps every song of the device, so it
+// stays a complete export of the library. Songs whose statistics the device
+// changed itself are reported as skipped, since Rockbox would ignore them.
+// With dryRun the changes are only returned.
+func (s *AppService) PushStats(ctx context.Context, dryRun bool) ([]*rockbox.StatsChange, error) {
+	logger := NewAppLogger(s.logBuffer)
+
+	s.mu.RLock()
+	root := s.device.Path
+	s.mu.RUnlock()
+	if !rockbox.IsDeviceRoot(root) {
+		return nil, fmt.Errorf("%w: %q has no .rockbox folder", models.ErrDeviceNotMounted, root)
+	}
+
+	stored, err := s.songRepo.FindAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// The device counts the plays it logs itself when its runtime database
+	// is enabled, so imported plays are left out of the comparison
+	local := make([]*models.Song, len(stored))
+	for i, song := range stored {
+		local[i] = song.DeviceStats()
+	}
+
+	device, err := rockbox.NewParser(root, logger).Parse(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := rockbox.DiffStats(device, local)
+	var changed []*models.Song
+	for _, change := range changes {
+		if change.Skipped {
+			logger.Info("Skipping %s: its statistics changed on the device, initialize the database on the device first", change.Path)
+			continue
+		}
+		changed = append(changed, change.Song)
+	}
+	logger.Info("Found %d songs with changed statistics, %d skipped", len(changes), len(changes)-len(changed))
+	if dryRun || len(changed) == 0 {
+		return changes, nil
+	}
+
+	path, err := rockbox.WriteChangelogFile(root, append(device, changed...))
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("Wrote %d changes to %s", len(changed), path)
+	return changes, nil
 }
 
 // GeneratePlaylist generates a playlist
@@ -438,6 +873,11 @@ func (s *AppService) GetPlaylist(ctx context.Context, id uint) (*models.Playlist
 	return s.playlistRepo.FindByID(ctx, id)
 }
 
+// GetPlaylistEntries returns the entries of a playlist, including missing ones
+func (s *AppService) GetPlaylistEntries(ctx context.Context, id uint) ([]*models.PlaylistSong, error) {
+	return s.playlistRepo.GetEntries(ctx, id)
+}
+
 // DeletePlaylist deletes a playlist
 func (s *AppService) DeletePlaylist(ctx context.Context, id uint) error {
 	// Get playlist to find exported file
@@ -457,7 +897,16 @@ func (s *AppService) DeletePlaylist(ctx context.Context, id uint) error {
 // WipeData wipes all pre-fetched data
 func (s *AppService) WipeData(ctx context.Context) error {
 	NewAppLogger(s.logBuffer).Info("Wiping all pre-fetched data...")
-	return s.db.WipeData()
+	if err := s.db.WipeData(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.device.LastParsedAt = nil
+	s.device.ClearTagCacheVersion()
+	s.config.LastParsedAt = nil
+	return nil
 }
 
 // GetLogs returns the current logs
@@ -1,13 +1,21 @@
 package service
 
 import (
+	"archive/zip"
 	"context"
+	"errors"
+	"io/fs"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/Ardakilic/rocklist/internal/database"
 	"github.com/Ardakilic/rocklist/internal/models"
 	"github.com/Ardakilic/rocklist/internal/repository"
+	"github.com/Ardakilic/rocklist/internal/rockbox"
+	"github.com/Ardakilic/rocklist/internal/rockbox/tcbuilder"
 	"gorm.io/gorm/logger"
 )
 
@@ -39,6 +47,8 @@ func setupTestAppService(t *testing.T) (*database.Database, *AppService) {
 		songRepo:     songRepo,
 		playlistRepo: playlistRepo,
 		configRepo:   configRepo,
+		deviceRepo:   repository.NewDeviceRepository(db.DB()),
+		parser:       rockbox.NewParser("", appLogger),
 		config:       &models.AppConfig{},
 		logBuffer:    logBuffer,
 	}
@@ -46,6 +56,10 @@ func setupTestAppService(t *testing.T) (*database.Database, *AppService) {
 	// Initialize playlist service
 	svc.playlistService = NewPlaylistService(songRepo, playlistRepo, "", appLogger)
 
+	if err := svc.loadDevice(context.Background()); err != nil {
+		t.Fatalf("Failed to load device: %v", err)
+	}
+
 	return db, svc
 }
 
@@ -416,6 +430,203 @@ func TestAppService_SetRockboxPath(t *testing.T) {
 	}
 }
 
+func TestAppService_SetVolumes(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := tmpDir + "/test.db"
+
+	svc, err := NewAppService(dbPath)
+	if err != nil {
+		t.Fatalf("NewAppService() error = %v", err)
+	}
+	ctx := context.Background()
+
+	if err := svc.SetVolumes(ctx, map[string]string{"<microSD1>": tmpDir}); !errors.Is(err, models.ErrInvalidInput) {
+		t.Errorf("SetVolumes() error = %v, want ErrInvalidInput", err)
+	}
+	if err := svc.SetVolumes(ctx, map[string]string{"microSD1": tmpDir + "/sd", "HD1": tmpDir + "/hd"}); err != nil {
+		t.Fatalf("SetVolumes() error = %v", err)
+	}
+	if err := svc.SetVolumes(ctx, map[string]string{"HD1": ""}); err != nil {
+		t.Fatalf("SetVolumes() error = %v", err)
+	}
+	_ = svc.Close()
+
+	// Removing every volume and adding one back is stored too
+	svc, err = NewAppService(dbPath)
+	if err != nil {
+		t.Fatalf("NewAppService() error = %v", err)
+	}
+	if err := svc.SetVolumes(ctx, map[string]string{"microSD1": ""}); err != nil {
+		t.Fatalf("SetVolumes() error = %v", err)
+	}
+	if len(svc.GetConfig().Volumes) != 0 {
+		t.Errorf("Volumes = %v, want none", svc.GetConfig().Volumes)
+	}
+	if err := svc.SetVolumes(ctx, map[string]string{"microSD1": tmpDir + "/sd"}); err != nil {
+		t.Fatalf("SetVolumes() error = %v", err)
+	}
+	_ = svc.Close()
+
+	// The mapping is stored and loaded with the config
+	svc, err = NewAppService(dbPath)
+	if err != nil {
+		t.Fatalf("NewAppService() error = %v", err)
+	}
+	defer func() { _ = svc.Close() }()
+
+	volumes := svc.GetConfig().Volumes
+	if len(volumes) != 1 || volumes["microSD1"] != tmpDir+"/sd" {
+		t.Errorf("Volumes = %v, want only microSD1", volumes)
+	}
+}
+
+func TestAppService_FindDevices(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	svc, err := NewAppService(tmpDir + "/test.db")
+	if err != nil {
+		t.Fatalf("NewAppService() error = %v", err)
+	}
+	defer func() { _ = svc.Close() }()
+
+	device := filepath.Join(tmpDir, "media", "IPOD")
+	writeTestTagCache(t, device, 1, 1, []string{"/Music/a.mp3"})
+	svc.discovery = &rockbox.Discovery{
+		MountsFile: filepath.Join(tmpDir, "mounts"),
+		MediaDirs:  []string{filepath.Join(tmpDir, "media")},
+	}
+
+	devices := svc.FindDevices()
+	if len(devices) != 1 || devices[0].Path != device || devices[0].Name != "IPOD" {
+		t.Errorf("FindDevices() = %+v, want the IPOD", devices)
+	}
+}
+
+func TestAppService_SelectDevice(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := tmpDir + "/test.db"
+
+	svc, err := NewAppService(dbPath)
+	if err != nil {
+		t.Fatalf("NewAppService() error = %v", err)
+	}
+	ctx := context.Background()
+
+	if device := svc.ActiveDevice(); device == nil || device.Name != models.DefaultDeviceName {
+		t.Fatalf("ActiveDevice() = %+v, want the default device", device)
+	}
+
+	// The default device parses the iPod
+	ipod := filepath.Join(tmpDir, "IPOD")
+	writeTestTagCache(t, ipod, 3, 1, []string{"/Music/a.mp3", "/Music/b.mp3"})
+	_ = svc.SetRockboxPath(ipod)
+	if _, err := svc.ParseRockboxDatabase(ctx, false); err != nil {
+		t.Fatalf("ParseRockboxDatabase() error = %v", err)
+	}
+
+	// A new device named after a mounted player starts with its path
+	fuze := filepath.Join(tmpDir, "media", "FUZE")
+	writeTestTagCache(t, fuze, 3, 1, []string{"/Music/c.mp3"})
+	svc.discovery = &rockbox.Discovery{MediaDirs: []string{filepath.Join(tmpDir, "media")}}
+
+	device, err := svc.SelectDevice(ctx, "FUZE")
+	if err != nil {
+		t.Fatalf("SelectDevice() error = %v", err)
+	}
+	if device.Path != fuze || svc.GetConfig().RockboxPath != fuze || svc.GetConfig().LastParsedAt != nil {
+		t.Errorf("SelectDevice() = %+v, config %+v, want the FUZE path and no parse yet", device, svc.GetConfig())
+	}
+	if count, _ := svc.GetSongCount(ctx); count != 0 {
+		t.Errorf("GetSongCount() = %d, want 0 before the FUZE is parsed", count)
+	}
+
+	// Same TagCache version as the iPod, but the FUZE has never been parsed
+	result, err := svc.ParseRockboxDatabase(ctx, false)
+	if err != nil {
+		t.Fatalf("ParseRockboxDatabase() error = %v", err)
+	}
+	if result.Skipped || result.Added != 1 {
+		t.Errorf("ParseRockboxDatabase() = %+v, want the FUZE song added", *result)
+	}
+
+	if _, err := svc.SelectDevice(ctx, " "); !errors.Is(err, models.ErrInvalidInput) {
+		t.Errorf("SelectDevice() with no name error = %v, want ErrInvalidInput", err)
+	}
+	_ = svc.Close()
+
+	// The selection survives a restart
+	svc, err = NewAppService(dbPath)
+	if err != nil {
+		t.Fatalf("NewAppService() error = %v", err)
+	}
+	defer func() { _ = svc.Close() }()
+
+	if device := svc.ActiveDevice(); device.Name != "FUZE" || svc.GetConfig().RockboxPath != fuze {
+		t.Errorf("ActiveDevice() = %+v, want FUZE after a restart", device)
+	}
+	devices, _ := svc.GetDevices(ctx)
+	if len(devices) != 2 {
+		t.Fatalf("GetDevices() = %+v, want 2 devices", devices)
+	}
+
+	if _, err := svc.SelectDevice(ctx, models.DefaultDeviceName); err != nil {
+		t.Fatalf("SelectDevice() error = %v", err)
+	}
+	if count, _ := svc.GetSongCount(ctx); count != 2 {
+		t.Errorf("GetSongCount() = %d, want the 2 iPod songs back", count)
+	}
+	if last, _ := svc.GetLastParsedAt(ctx); last == nil {
+		t.Error("GetLastParsedAt() = nil, want the iPod's last parse")
+	}
+	result, _ = svc.ParseRockboxDatabase(ctx, false)
+	if !result.Skipped {
+		t.Errorf("ParseRockboxDatabase() = %+v, want the unchanged iPod skipped", *result)
+	}
+}
+
+func TestAppService_LoadDevice_Upgrade(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := tmpDir + "/test.db"
+	ctx := context.Background()
+
+	// A database from before devices: the path and parse history are
+	// config values and the songs and playlists have no device
+	db, err := database.New(&database.Config{Path: dbPath, LogLevel: logger.Silent})
+	if err != nil {
+		t.Fatalf("database.New() error = %v", err)
+	}
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	configRepo := repository.NewConfigRepository(db.DB())
+	_ = configRepo.Set(ctx, repository.ConfigKeyRockboxPath, "/media/IPOD")
+	_ = configRepo.SetLastParsedAt(ctx, time.Now())
+	_ = configRepo.SetTagCacheVersion(ctx, 12, 3)
+	_ = repository.NewSongRepository(db.DB()).Create(ctx, &models.Song{RockboxID: "1", Path: "/Music/a.mp3"})
+	_ = repository.NewPlaylistRepository(db.DB()).Create(ctx, &models.Playlist{Name: "Mix", Type: models.PlaylistTypeTopSongs})
+	_ = db.Close()
+
+	svc, err := NewAppService(dbPath)
+	if err != nil {
+		t.Fatalf("NewAppService() error = %v", err)
+	}
+	defer func() { _ = svc.Close() }()
+
+	device := svc.ActiveDevice()
+	if device.Name != models.DefaultDeviceName || device.Path != "/media/IPOD" || device.LastParsedAt == nil {
+		t.Errorf("ActiveDevice() = %+v, want the default device with the saved path and parse time", device)
+	}
+	if serial, commitID, ok := device.TagCacheVersion(); !ok || serial != 12 || commitID != 3 {
+		t.Errorf("TagCacheVersion() = %d/%d (%v), want 12/3", serial, commitID, ok)
+	}
+	if count, _ := svc.GetSongCount(ctx); count != 1 {
+		t.Errorf("GetSongCount() = %d, want 1", count)
+	}
+	if playlists, _ := svc.GetAllPlaylists(ctx); len(playlists) != 1 {
+		t.Errorf("GetAllPlaylists() = %d playlists, want 1", len(playlists))
+	}
+}
+
 func TestAppService_GeneratePlaylist_NoClient(t *testing.T) {
 	tmpDir := t.TempDir()
 	dbPath := tmpDir + "/test.db"
@@ -486,3 +697,484 @@ func TestAppService_ExportLogsToFile(t *testing.T) {
 		t.Error("ExportLogsToFile() should create the log file")
 	}
 }
+
+func TestAppService_PushStats(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	svc, err := NewAppService(tmpDir + "/test.db")
+	if err != nil {
+		t.Fatalf("NewAppService() error = %v", err)
+	}
+	defer func() { _ = svc.Close() }()
+
+	// A device holding only an exported changelog
+	rockboxPath := filepath.Join(tmpDir, "device")
+	changelog := filepath.Join(rockboxPath, ".rockbox", "database_changelog.txt")
+	if err := os.MkdirAll(filepath.Dir(changelog), 0755); err != nil {
+		t.Fatalf("Failed to create device dir: %v", err)
+	}
+	device := "## Changelog version 1\n" +
+		`artist="Metallica" title="Battery" filename="/Music/Battery.mp3" playcount="3" rating="4" lastplayed="7" ` + "\n" +
+		`artist="Metallica" title="Orion" filename="/Music/Orion.mp3" playcount="1" rating="2" lastplayed="6" ` + "\n"
+	if err := os.WriteFile(changelog, []byte(device), 0644); err != nil {
+		t.Fatalf("Failed to write changelog: %v", err)
+	}
+
+	ctx := context.Background()
+	if err := svc.SetRockboxPath(rockboxPath); err != nil {
+		t.Fatalf("SetRockboxPath() error = %v", err)
+	}
+	if _, err := svc.ParseRockboxDatabase(ctx, false); err != nil {
+		t.Fatalf("ParseRockboxDatabase() error = %v", err)
+	}
+
+	song, err := svc.songRepo.FindByPath(ctx, "/Music/Battery.mp3")
+	if err != nil {
+		t.Fatalf("FindByPath() error = %v", err)
+	}
+	song.Rating = 10
+	if err := svc.songRepo.Update(ctx, song); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+
+	changes, err := svc.PushStats(ctx, true)
+	if err != nil {
+		t.Fatalf("PushStats(dry run) error = %v", err)
+	}
+	if len(changes) != 1 || changes[0].Path != "/Music/Battery.mp3" {
+		t.Fatalf("PushStats(dry run) = %+v, want one change for Battery", changes)
+	}
+	if _, err := os.Stat(changelog + ".bak"); !os.IsNotExist(err) {
+		t.Error("PushStats(dry run) should not write anything")
+	}
+
+	if _, err := svc.PushStats(ctx, false); err != nil {
+		t.Fatalf("PushStats() error = %v", err)
+	}
+	written, err := os.ReadFile(changelog)
+	if err != nil {
+		t.Fatalf("Failed to read changelog: %v", err)
+	}
+	if !strings.Contains(string(written), `filename="/Music/Battery.mp3"`) || !strings.Contains(string(written), `rating="10"`) {
+		t.Errorf("written changelog = %q, want Battery with rating 10", written)
+	}
+	// The other songs stay in the changelog, so it still holds the whole library
+	if !strings.Contains(string(written), `filename="/Music/Orion.mp3"`) {
+		t.Error("unchanged songs should be kept in the changelog")
+	}
+	if _, err := os.Stat(changelog + ".bak"); err != nil {
+		t.Errorf("existing changelog should be backed up: %v", err)
+	}
+
+	// A reparse still finds every song
+	result, err := svc.ParseRockboxDatabase(ctx, false)
+	if err != nil {
+		t.Fatalf("ParseRockboxDatabase() error = %v", err)
+	}
+	if result.Removed != 0 {
+		t.Errorf("ParseRockboxDatabase() removed %d songs after PushStats, want 0", result.Removed)
+	}
+}
+
+func TestAppService_PushStats_NotMounted(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	svc, err := NewAppService(tmpDir + "/test.db")
+	if err != nil {
+		t.Fatalf("NewAppService() error = %v", err)
+	}
+	defer func() { _ = svc.Close() }()
+
+	ctx := context.Background()
+	if _, err := svc.PushStats(ctx, true); !errors.Is(err, models.ErrDeviceNotMounted) {
+		t.Errorf("PushStats() without a device error = %v, want %v", err, models.ErrDeviceNotMounted)
+	}
+
+	// A backup archive is not a device to write to
+	backup := filepath.Join(tmpDir, "backup.zip")
+	if err := os.WriteFile(backup, nil, 0644); err != nil {
+		t.Fatalf("Failed to write backup: %v", err)
+	}
+	if err := svc.SetRockboxPath(backup); err != nil {
+		t.Fatalf("SetRockboxPath() error = %v", err)
+	}
+	if _, err := svc.PushStats(ctx, false); !errors.Is(err, models.ErrDeviceNotMounted) {
+		t.Errorf("PushStats() on an archive error = %v, want %v", err, models.ErrDeviceNotMounted)
+	}
+}
+
+func TestAppService_PushStats_SkipsNumericDirty(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	svc, err := NewAppService(tmpDir + "/test.db")
+	if err != nil {
+		t.Fatalf("NewAppService() error = %v", err)
+	}
+	defer func() { _ = svc.Close() }()
+
+	rockboxPath := filepath.Join(tmpDir, "device")
+	db := tcbuilder.New([]*models.Song{
+		{Path: "/Music/Battery.mp3", Title: "Battery"},
+		{Path: "/Music/Orion.mp3", Title: "Orion"},
+	})
+	db.Entries[1].Flag = tcbuilder.FlagDirtyNum
+	if err := db.Write(rockboxPath); err != nil {
+		t.Fatalf("Failed to write TagCache: %v", err)
+	}
+
+	ctx := context.Background()
+	if err := svc.SetRockboxPath(rockboxPath); err != nil {
+		t.Fatalf("SetRockboxPath() error = %v", err)
+	}
+	if _, err := svc.ParseRockboxDatabase(ctx, false); err != nil {
+		t.Fatalf("ParseRockboxDatabase() error = %v", err)
+	}
+	songs, err := svc.songRepo.FindAll(ctx)
+	if err != nil {
+		t.Fatalf("FindAll() error = %v", err)
+	}
+	for _, song := range songs {
+		song.Rating = 8
+		if err := svc.songRepo.Update(ctx, song); err != nil {
+			t.Fatalf("Update() error = %v", err)
+		}
+	}
+
+	changes, err := svc.PushStats(ctx, false)
+	if err != nil {
+		t.Fatalf("PushStats() error = %v", err)
+	}
+	if len(changes) != 2 || changes[0].Skipped || !changes[1].Skipped {
+		t.Fatalf("PushStats() = %+v, want Orion reported as skipped", changes)
+	}
+
+	written, err := os.ReadFile(filepath.Join(rockboxPath, ".rockbox", "database_changelog.txt"))
+	if err != nil {
+		t.Fatalf("Failed to read changelog: %v", err)
+	}
+	if strings.Count(string(written), `rating="8"`) != 1 {
+		t.Errorf("written changelog = %q, want only Battery's rating changed", written)
+	}
+}
+
+// writeTestTagCache writes a TagCache holding the given paths, with the file
+// name as title
+func writeTestTagCache(t *testing.T, root string, serial, commitID int32, paths []string) {
+	t.Helper()
+
+	songs := make([]*models.Song, len(paths))
+	for i, p := range paths {
+		songs[i] = &models.Song{Path: p, Title: filepath.Base(p)}
+	}
+	db := tcbuilder.New(songs)
+	db.Serial, db.CommitID = serial, commitID
+	if err := db.Write(root); err != nil {
+		t.Fatalf("Failed to write TagCache: %v", err)
+	}
+}
+
+func TestAppService_ParseRockboxDatabase_Incremental(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	svc, err := NewAppService(tmpDir + "/test.db")
+	if err != nil {
+		t.Fatalf("NewAppService() error = %v", err)
+	}
+	defer func() { _ = svc.Close() }()
+
+	ctx := context.Background()
+	rockboxPath := filepath.Join(tmpDir, "device")
+	writeTestTagCache(t, rockboxPath, 10, 1, []string{"/Music/a.mp3", "/Music/b.mp3"})
+	if err := svc.SetRockboxPath(rockboxPath); err != nil {
+		t.Fatalf("SetRockboxPath() error = %v", err)
+	}
+
+	result, err := svc.ParseRockboxDatabase(ctx, false)
+	if err != nil {
+		t.Fatalf("ParseRockboxDatabase() error = %v", err)
+	}
+	if result.Added != 2 || result.Skipped {
+		t.Fatalf("first parse = %+v, want 2 added", *result)
+	}
+
+	song, _ := svc.songRepo.FindByPath(ctx, "/Music/a.mp3")
+	song.MusicBrainzID = "mbid-a"
+	_ = svc.songRepo.Update(ctx, song)
+
+	// Same serial and commit ID: nothing is parsed
+	result, err = svc.ParseRockboxDatabase(ctx, false)
+	if err != nil {
+		t.Fatalf("ParseRockboxDatabase() error = %v", err)
+	}
+	if !result.Skipped || result.Unchanged != 2 {
+		t.Errorf("unchanged parse = %+v, want skipped", *result)
+	}
+
+	// A new commit adds c and removes b
+	writeTestTagCache(t, rockboxPath, 12, 2, []string{"/Music/a.mp3", "/Music/c.mp3"})
+	result, err = svc.ParseRockboxDatabase(ctx, false)
+	if err != nil {
+		t.Fatalf("ParseRockboxDatabase() error = %v", err)
+	}
+	want := models.SyncResult{Added: 1, Removed: 1, Unchanged: 1}
+	if *result != want {
+		t.Errorf("changed parse = %+v, want %+v", *result, want)
+	}
+
+	got, err := svc.songRepo.FindByPath(ctx, "/Music/a.mp3")
+	if err != nil || got.ID != song.ID || got.MusicBrainzID != "mbid-a" {
+		t.Errorf("kept song = %+v, %v, want ID %d with its MusicBrainz ID", got, err, song.ID)
+	}
+
+	serial, commitID, ok := svc.ActiveDevice().TagCacheVersion()
+	if !ok || serial != 12 || commitID != 2 {
+		t.Errorf("recorded version = %d/%d (%v), want 12/2", serial, commitID, ok)
+	}
+
+	// Switching devices forgets the recorded version
+	if err := svc.SetRockboxPath(filepath.Join(tmpDir, "other")); err != nil {
+		t.Fatalf("SetRockboxPath() error = %v", err)
+	}
+	if _, _, ok := svc.ActiveDevice().TagCacheVersion(); ok {
+		t.Error("SetRockboxPath() with a new path should clear the TagCache version")
+	}
+}
+
+func TestAppService_ParseRockboxDatabase_FlagsMissingPlaylistEntries(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	svc, err := NewAppService(tmpDir + "/test.db")
+	if err != nil {
+		t.Fatalf("NewAppService() error = %v", err)
+	}
+	defer func() { _ = svc.Close() }()
+
+	ctx := context.Background()
+	rockboxPath := filepath.Join(tmpDir, "device")
+	writeTestTagCache(t, rockboxPath, 1, 1, []string{"/Music/a.mp3", "/Music/b.mp3"})
+	_ = svc.SetRockboxPath(rockboxPath)
+	if _, err := svc.ParseRockboxDatabase(ctx, false); err != nil {
+		t.Fatalf("ParseRockboxDatabase() error = %v", err)
+	}
+
+	a, _ := svc.songRepo.FindByPath(ctx, "/Music/a.mp3")
+	b, _ := svc.songRepo.FindByPath(ctx, "/Music/b.mp3")
+	playlist := &models.Playlist{Name: "Mix", Type: models.PlaylistTypeTopSongs, DataSource: models.DataSourceLastFM}
+	_ = svc.playlistRepo.Create(ctx, playlist)
+	_ = svc.playlistRepo.AddSongs(ctx, playlist.ID, []uint{a.ID, b.ID})
+
+	writeTestTagCache(t, rockboxPath, 2, 2, []string{"/Music/a.mp3"})
+	result, err := svc.ParseRockboxDatabase(ctx, false)
+	if err != nil {
+		t.Fatalf("ParseRockboxDatabase() error = %v", err)
+	}
+	if result.MissingPlaylistEntries != 1 {
+		t.Errorf("MissingPlaylistEntries = %d, want 1", result.MissingPlaylistEntries)
+	}
+
+	entries, err := svc.GetPlaylistEntries(ctx, playlist.ID)
+	if err != nil {
+		t.Fatalf("GetPlaylistEntries() error = %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("GetPlaylistEntries() returned %d entries, want 2", len(entries))
+	}
+	if entries[0].SongID != a.ID || entries[0].Missing {
+		t.Errorf("entries[0] = song %d, missing %v, want song %d present", entries[0].SongID, entries[0].Missing, a.ID)
+	}
+	if entries[1].SongID != b.ID || !entries[1].Missing {
+		t.Errorf("entries[1] = song %d, missing %v, want song %d missing", entries[1].SongID, entries[1].Missing, b.ID)
+	}
+}
+
+func TestAppService_ParseFrom(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	svc, err := NewAppService(tmpDir + "/test.db")
+	if err != nil {
+		t.Fatalf("NewAppService() error = %v", err)
+	}
+	defer func() { _ = svc.Close() }()
+
+	ctx := context.Background()
+	devicePath := filepath.Join(tmpDir, "device")
+	_ = svc.SetRockboxPath(devicePath)
+
+	// Zip a device backup with the .rockbox folder one level down
+	backup := filepath.Join(tmpDir, "backup")
+	writeTestTagCache(t, filepath.Join(backup, "IPOD"), 5, 5, []string{"/Music/a.mp3", "/Music/b.mp3"})
+	archive := filepath.Join(tmpDir, "backup.zip")
+	f, _ := os.Create(archive)
+	w := zip.NewWriter(f)
+	_ = filepath.WalkDir(backup, func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, _ := filepath.Rel(backup, name)
+		fw, _ := w.Create(filepath.ToSlash(rel))
+		data, _ := os.ReadFile(name)
+		_, err = fw.Write(data)
+		return err
+	})
+	_ = w.Close()
+	_ = f.Close()
+
+	result, err := svc.ParseFrom(ctx, archive, models.DefaultDeviceName)
+	if err != nil {
+		t.Fatalf("ParseFrom() error = %v", err)
+	}
+	if result.Added != 2 {
+		t.Errorf("ParseFrom() = %+v, want 2 added", *result)
+	}
+	if _, err := svc.songRepo.FindByPath(ctx, "/Music/b.mp3"); err != nil {
+		t.Errorf("FindByPath() error = %v", err)
+	}
+
+	if _, _, ok := svc.ActiveDevice().TagCacheVersion(); ok {
+		t.Error("ParseFrom() should not record the TagCache version of a backup")
+	}
+	if svc.parser.GetPath() != devicePath {
+		t.Errorf("parser path = %q, want the device path back", svc.parser.GetPath())
+	}
+
+	if _, err := svc.ParseFrom(ctx, filepath.Join(tmpDir, "missing.zip"), models.DefaultDeviceName); err == nil {
+		t.Error("ParseFrom() with a missing source should return an error")
+	}
+}
+
+func TestAppService_ParseFrom_KeepsActiveDevice(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	svc, err := NewAppService(tmpDir + "/test.db")
+	if err != nil {
+		t.Fatalf("NewAppService() error = %v", err)
+	}
+	defer func() { _ = svc.Close() }()
+
+	ctx := context.Background()
+	devicePath := filepath.Join(tmpDir, "device")
+	writeTestTagCache(t, devicePath, 5, 5, []string{"/Music/a.mp3", "/Music/b.mp3", "/Music/c.mp3"})
+	if err := svc.SetRockboxPath(devicePath); err != nil {
+		t.Fatalf("SetRockboxPath() error = %v", err)
+	}
+	if _, err := svc.ParseRockboxDatabase(ctx, false); err != nil {
+		t.Fatalf("ParseRockboxDatabase() error = %v", err)
+	}
+	active := svc.ActiveDevice()
+
+	// An older backup holding fewer songs
+	backup := filepath.Join(tmpDir, "backup")
+	writeTestTagCache(t, backup, 3, 3, []string{"/Music/a.mp3"})
+
+	if _, err := svc.ParseFrom(ctx, backup, ""); !errors.Is(err, models.ErrInvalidInput) {
+		t.Fatalf("ParseFrom() without a device error = %v, want %v", err, models.ErrInvalidInput)
+	}
+	if count, _ := svc.GetSongCount(ctx); count != 3 {
+		t.Errorf("GetSongCount() = %d after a refused ParseFrom(), want 3", count)
+	}
+
+	result, err := svc.ParseFrom(ctx, backup, "ipod-backup")
+	if err != nil {
+		t.Fatalf("ParseFrom() error = %v", err)
+	}
+	if result.Added != 1 || result.Removed != 0 {
+		t.Errorf("ParseFrom() = %+v, want 1 added to the new device", *result)
+	}
+	if got := svc.ActiveDevice(); got.ID != active.ID || svc.GetConfig().RockboxPath != devicePath {
+		t.Errorf("ActiveDevice() = %q at %q, want the player to stay active", got.Name, svc.GetConfig().RockboxPath)
+	}
+
+	// The player's library is untouched
+	if count, _ := svc.GetSongCount(ctx); count != 3 {
+		t.Errorf("GetSongCount() of the player = %d, want 3", count)
+	}
+	if svc.ActiveDevice().Path != devicePath {
+		t.Errorf("player path = %q, want %q", svc.ActiveDevice().Path, devicePath)
+	}
+
+	// The saved active device is the player too
+	reopened, err := NewAppService(tmpDir + "/test.db")
+	if err != nil {
+		t.Fatalf("NewAppService() error = %v", err)
+	}
+	defer func() { _ = reopened.Close() }()
+	if got := reopened.ActiveDevice(); got.ID != active.ID {
+		t.Errorf("ActiveDevice() after a restart = %q, want %q", got.Name, active.Name)
+	}
+
+	// The backup went into its own device
+	if _, err := svc.SelectDevice(ctx, "ipod-backup"); err != nil {
+		t.Fatalf("SelectDevice() error = %v", err)
+	}
+	if count, _ := svc.GetSongCount(ctx); count != 1 {
+		t.Errorf("GetSongCount() of the backup = %d, want 1", count)
+	}
+}
+
+func TestAppService_InspectDatabase(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	svc, err := NewAppService(tmpDir + "/test.db")
+	if err != nil {
+		t.Fatalf("NewAppService() error = %v", err)
+	}
+	defer func() { _ = svc.Close() }()
+
+	ctx := context.Background()
+	rockboxPath := filepath.Join(tmpDir, "device")
+	writeTestTagCache(t, rockboxPath, 1, 1, []string{"/Music/a.mp3", "/Music/b.mp3"})
+	_ = svc.SetRockboxPath(rockboxPath)
+	_ = os.Remove(filepath.Join(rockboxPath, ".rockbox", "database_2.tcd"))
+
+	status, err := svc.InspectDatabase(ctx)
+	if err != nil {
+		t.Fatalf("InspectDatabase() error = %v", err)
+	}
+	if status.TotalSongs != 2 {
+		t.Errorf("TotalSongs = %d, want 2", status.TotalSongs)
+	}
+
+	if len(status.Diagnostics) != 1 || status.Diagnostics[0].File != "database_2.tcd" {
+		t.Errorf("Diagnostics = %+v, want one for the missing genre file", status.Diagnostics)
+	}
+
+	if count, _ := svc.GetSongCount(ctx); count != 0 {
+		t.Errorf("GetSongCount() = %d, want 0 after an inspection", count)
+	}
+}
+
+func TestAppService_MakeFixture(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	svc, err := NewAppService(tmpDir + "/test.db")
+	if err != nil {
+		t.Fatalf("NewAppService() error = %v", err)
+	}
+	defer func() { _ = svc.Close() }()
+
+	ctx := context.Background()
+	rockboxPath := filepath.Join(tmpDir, "device")
+	writeTestTagCache(t, rockboxPath, 9, 4, []string{"/Music/Secret Artist/a.mp3", "/Music/Secret Artist/b.mp3"})
+	_ = svc.SetRockboxPath(rockboxPath)
+
+	output := filepath.Join(tmpDir, "fixture")
+	count, err := svc.MakeFixture(ctx, output, false)
+	if err != nil {
+		t.Fatalf("MakeFixture() error = %v", err)
+	}
+	if count != 2 {
+		t.Errorf("MakeFixture() = %d, want 2", count)
+	}
+
+	parser := rockbox.NewParser(output, NewAppLogger(NewLogBuffer(10)))
+	songs, err := parser.Parse(ctx)
+	if err != nil {
+		t.Fatalf("Parse() of the fixture error = %v", err)
+	}
+	if len(songs) != 2 || songs[0].Path != "/Folder 1/Folder 2/File 1.mp3" {
+		t.Errorf("fixture songs = %d, first path %q, want anonymised paths", len(songs), songs[0].Path)
+	}
+	if status := parser.GetStatus(); status.Serial != 9 || status.CommitID != 4 {
+		t.Errorf("fixture serial/commit = %d/%d, want 9/4", status.Serial, status.CommitID)
+	}
+}
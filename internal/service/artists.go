@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Ardakilic/rocklist/internal/models"
+	"github.com/Ardakilic/rocklist/internal/normalize"
+)
+
+// artistResolver finds the local artist names an external artist may be
+// tagged under. Names are compared by normalize.ArtistKey, credits naming
+// several artists are split, and the user's aliases link names together.
+type artistResolver struct {
+	// names lists the local artist names by the key of each artist they credit
+	names map[string][]string
+	// groups lists the keys of all names of an artist by the key of each name
+	groups map[string][]string
+}
+
+// newArtistResolver indexes the local artist names and the user's aliases
+func newArtistResolver(names []string, aliases []*models.ArtistAlias) *artistResolver {
+	r := &artistResolver{
+		names:  make(map[string][]string),
+		groups: make(map[string][]string),
+	}
+	for _, name := range names {
+		for _, credit := range normalize.ArtistCredits(name) {
+			key := normalize.ArtistKey(credit)
+			r.names[key] = append(r.names[key], name)
+		}
+	}
+
+	// An artist and its aliases form one group; every name in it finds the others
+	members := make(map[string][]string)
+	for _, alias := range aliases {
+		artistKey := normalize.ArtistKey(alias.Artist)
+		if len(members[artistKey]) == 0 {
+			members[artistKey] = []string{artistKey}
+		}
+		members[artistKey] = append(members[artistKey], normalize.ArtistKey(alias.Alias))
+	}
+	for _, group := range members {
+		for _, key := range group {
+			r.groups[key] = append(r.groups[key], group...)
+		}
+	}
+	return r
+}
+
+// resolve returns artist followed by the local names of the artists it
+// credits, or of their aliases
+func (r *artistResolver) resolve(artist string) []string {
+	result := []string{artist}
+	seen := map[string]bool{artist: true}
+	for _, credit := range normalize.ArtistCredits(artist) {
+		key := normalize.ArtistKey(credit)
+		keys := r.groups[key]
+		if len(keys) == 0 {
+			keys = []string{key}
+		}
+		for _, key := range keys {
+			for _, name := range r.names[key] {
+				if !seen[name] {
+					seen[name] = true
+					result = append(result, name)
+				}
+			}
+		}
+	}
+	return result
+}
+
+// loadArtistResolver reads the local artist names and the user's aliases
+func (s *PlaylistService) loadArtistResolver(ctx context.Context) (*artistResolver, error) {
+	names, err := s.songRepo.GetArtistNames(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var aliases []*models.ArtistAlias
+	if s.aliasRepo != nil {
+		if aliases, err = s.aliasRepo.FindAll(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return newArtistResolver(names, aliases), nil
+}
+
+// GetArtistAliases returns the user's artist aliases ordered by artist
+func (s *AppService) GetArtistAliases(ctx context.Context) ([]*models.ArtistAlias, error) {
+	return s.aliasRepo.FindAll(ctx)
+}
+
+// AddArtistAlias makes alias another name of artist, so songs tagged with
+// either name are found for tracks credited to the other
+func (s *AppService) AddArtistAlias(ctx context.Context, artist, alias string) (*models.ArtistAlias, error) {
+	artist, alias = strings.TrimSpace(artist), strings.TrimSpace(alias)
+	if artist == "" || alias == "" {
+		return nil, fmt.Errorf("%w: artist and alias are required", models.ErrInvalidInput)
+	}
+	if normalize.ArtistKey(artist) == normalize.ArtistKey(alias) {
+		return nil, fmt.Errorf("%w: %q already matches %q", models.ErrInvalidInput, alias, artist)
+	}
+
+	saved, err := s.aliasRepo.Set(ctx, artist, alias)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save alias: %w", err)
+	}
+	NewAppLogger(s.logBuffer).Info("Added %q as an alias of %q", alias, artist)
+	return saved, nil
+}
+
+// RemoveArtistAlias removes an artist alias
+func (s *AppService) RemoveArtistAlias(ctx context.Context, alias string) error {
+	return s.aliasRepo.Delete(ctx, strings.TrimSpace(alias))
+}
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/Ardakilic/rocklist/internal/api"
+	"github.com/Ardakilic/rocklist/internal/models"
+)
+
+func TestArtistResolver_Resolve(t *testing.T) {
+	names := []string{
+		"Beatles, The",
+		"Jay-Z feat. Alicia Keys",
+		"Jay-Z",
+		"Simon & Garfunkel",
+		"Prince",
+		"The Artist Formerly Known as Prince",
+		"Motörhead",
+	}
+	aliases := []*models.ArtistAlias{
+		{Artist: "Prince", Alias: "The Artist Formerly Known as Prince"},
+		{Artist: "prince", Alias: "TAFKAP"},
+	}
+	resolver := newArtistResolver(names, aliases)
+
+	tests := []struct {
+		artist string
+		want   []string
+	}{
+		{"The Beatles", []string{"The Beatles", "Beatles, The"}},
+		{"Beatles", []string{"Beatles", "Beatles, The"}},
+		{"Jay-Z", []string{"Jay-Z", "Jay-Z feat. Alicia Keys"}},
+		{"Alicia Keys", []string{"Alicia Keys", "Jay-Z feat. Alicia Keys"}},
+		{"JAY-Z & Alicia Keys", []string{"JAY-Z & Alicia Keys", "Jay-Z feat. Alicia Keys", "Jay-Z"}},
+		{"Simon and Garfunkel", []string{"Simon and Garfunkel", "Simon & Garfunkel"}},
+		{"Motorhead", []string{"Motorhead", "Motörhead"}},
+		{"TAFKAP", []string{"TAFKAP", "Prince", "The Artist Formerly Known as Prince"}},
+		{"Prince", []string{"Prince", "The Artist Formerly Known as Prince"}},
+		{"Metallica", []string{"Metallica"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.artist, func(t *testing.T) {
+			if got := resolver.resolve(tt.artist); !slices.Equal(got, tt.want) {
+				t.Errorf("resolve(%q) = %q, want %q", tt.artist, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlaylistService_MatchTracks_ArtistVariants(t *testing.T) {
+	tmpDir := t.TempDir()
+	svc, err := NewAppService(tmpDir + "/test.db")
+	if err != nil {
+		t.Fatalf("NewAppService() error = %v", err)
+	}
+	defer func() { _ = svc.Close() }()
+	ctx := context.Background()
+
+	songs := []*models.Song{
+		{RockboxID: "1", Path: "/Music/1.mp3", Artist: "Beatles, The", Title: "Yesterday"},
+		{RockboxID: "2", Path: "/Music/2.mp3", Artist: "Jay-Z feat. Alicia Keys", Title: "Empire State of Mind"},
+		{RockboxID: "3", Path: "/Music/3.mp3", Artist: "Simon & Garfunkel", Title: "The Boxer"},
+		{RockboxID: "4", Path: "/Music/4.mp3", Artist: "Prince", Title: "Purple Rain"},
+	}
+	if err := svc.songRepo.CreateBatch(ctx, songs); err != nil {
+		t.Fatalf("CreateBatch() error = %v", err)
+	}
+	if _, err := svc.AddArtistAlias(ctx, "Prince", "The Artist Formerly Known as Prince"); err != nil {
+		t.Fatalf("AddArtistAlias() error = %v", err)
+	}
+
+	tracks := []*api.TrackInfo{
+		{Artist: "The Beatles", Title: "Yesterday"},
+		{Artist: "Jay-Z", Title: "Empire State of Mind"},
+		{Artist: "Simon and Garfunkel", Title: "The Boxer"},
+		{Artist: "The Artist Formerly Known as Prince", Title: "Purple Rain"},
+	}
+	matched, stats := svc.playlistService.matchTracks(ctx, tracks, &models.PlaylistRequest{})
+	if stats.Matched != 4 || len(matched) != 4 {
+		t.Errorf("matchTracks() matched %d of %d, want all 4", stats.Matched, stats.Total)
+	}
+}
+
+func TestAppService_ArtistAliases(t *testing.T) {
+	tmpDir := t.TempDir()
+	svc, err := NewAppService(tmpDir + "/test.db")
+	if err != nil {
+		t.Fatalf("NewAppService() error = %v", err)
+	}
+	defer func() { _ = svc.Close() }()
+	ctx := context.Background()
+
+	if _, err := svc.AddArtistAlias(ctx, " Prince ", " TAFKAP "); err != nil {
+		t.Fatalf("AddArtistAlias() error = %v", err)
+	}
+	aliases, err := svc.GetArtistAliases(ctx)
+	if err != nil {
+		t.Fatalf("GetArtistAliases() error = %v", err)
+	}
+	if len(aliases) != 1 || aliases[0].Artist != "Prince" || aliases[0].Alias != "TAFKAP" {
+		t.Errorf("GetArtistAliases() = %+v, want TAFKAP for Prince", aliases)
+	}
+
+	invalid := []struct{ artist, alias string }{
+		{"", "TAFKAP"},
+		{"Prince", " "},
+		{"The Beatles", "Beatles, The"},
+	}
+	for _, tt := range invalid {
+		if _, err := svc.AddArtistAlias(ctx, tt.artist, tt.alias); !errors.Is(err, models.ErrInvalidInput) {
+			t.Errorf("AddArtistAlias(%q, %q) error = %v, want ErrInvalidInput", tt.artist, tt.alias, err)
+		}
+	}
+
+	if err := svc.RemoveArtistAlias(ctx, "TAFKAP"); err != nil {
+		t.Errorf("RemoveArtistAlias() error = %v", err)
+	}
+	if err := svc.RemoveArtistAlias(ctx, "TAFKAP"); !errors.Is(err, models.ErrAliasNotFound) {
+		t.Errorf("RemoveArtistAlias() of a removed alias error = %v, want ErrAliasNotFound", err)
+	}
+}
@@ -0,0 +1,259 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Ardakilic/rocklist/internal/api"
+	"github.com/Ardakilic/rocklist/internal/models"
+	"github.com/Ardakilic/rocklist/internal/repository"
+)
+
+const (
+	// enrichMinConfidence is the lowest search confidence stored as a match
+	enrichMinConfidence = 0.5
+	// enrichRetries is how often a rate limited search is retried before the job stops
+	enrichRetries = 3
+	// enrichBackoff is the wait before retrying a rate limited search; it doubles with each retry
+	enrichBackoff = 30 * time.Second
+	// enrichLogEvery is how many songs are searched between progress log lines
+	enrichLogEvery = 50
+)
+
+// enrichInterval spaces the searches of an enrichment job to stay within
+// the rate limit of each source. The MusicBrainz client already waits
+// between its requests.
+var enrichInterval = map[models.DataSource]time.Duration{
+	models.DataSourceLastFM:  200 * time.Millisecond, // 5 requests per second
+	models.DataSourceSpotify: 100 * time.Millisecond,
+}
+
+// enrichSleep waits for d, returning early with the error of ctx when it is
+// done. Tests replace it to run without waiting.
+var enrichSleep = func(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// EnrichLibrary searches a data source for every song of the active device
+// that has no ID there, and stores the ID and confidence of each confident
+// match, so playlist generation finds those songs by ID instead of fuzzy
+// matching. Searches are spaced and retried to respect the rate limit of
+// the source.
+//
+// The job records the last song it searched. A job stopped by cancelling
+// ctx, by CancelEnrich or by an error resumes after that song when it is
+// run again; a job that finishes starts over the next time. Progress is
+// reported by GetEnrichStatus.
+func (s *AppService) EnrichLibrary(ctx context.Context, source models.DataSource) (*models.EnrichStatus, error) {
+	logger := NewAppLogger(s.logBuffer)
+
+	if source != models.DataSourceLastFM && source != models.DataSourceSpotify && source != models.DataSourceMusicBrainz {
+		return nil, models.ErrInvalidDataSource
+	}
+	s.mu.RLock()
+	client, ok := s.playlistService.clients[source]
+	songRepo, device := s.songRepo, s.device
+	s.mu.RUnlock()
+	if !ok || !client.IsConfigured() {
+		return nil, models.ErrDataSourceDisabled
+	}
+
+	s.enrichMu.Lock()
+	if s.enrichStatus != nil && s.enrichStatus.InProgress {
+		s.enrichMu.Unlock()
+		return nil, models.ErrEnrichInProgress
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	now := time.Now()
+	s.enrichStatus = &models.EnrichStatus{
+		InProgress: true,
+		Source:     source,
+		StartedAt:  &now,
+	}
+	s.enrichCancel = cancel
+	s.enrichMu.Unlock()
+
+	err := s.enrich(ctx, client, songRepo, enrichCursorKey(device.ID, source))
+	cancel()
+
+	s.enrichMu.Lock()
+	completedAt := time.Now()
+	s.enrichStatus.InProgress = false
+	s.enrichStatus.CompletedAt = &completedAt
+	if err != nil {
+		s.enrichStatus.LastError = err.Error()
+	}
+	s.enrichCancel = nil
+	s.enrichMu.Unlock()
+
+	status := s.GetEnrichStatus()
+	if err != nil {
+		logger.Error("Enrichment from %s stopped: %v", source.DisplayName(), err)
+		return status, err
+	}
+	logger.Info("Enrichment from %s completed: %d matched, %d unmatched, %d errors",
+		source.DisplayName(), status.MatchedSongs, status.UnmatchedSongs, status.ErrorCount)
+	return status, nil
+}
+
+// enrich searches the source of client for the unmatched songs, starting
+// after the song recorded under cursorKey
+func (s *AppService) enrich(ctx context.Context, client api.Client, songRepo repository.SongRepository, cursorKey string) error {
+	logger := NewAppLogger(s.logBuffer)
+	source := client.GetSource()
+
+	songs, err := songRepo.FindUnmatched(ctx, source)
+	if err != nil {
+		return fmt.Errorf("failed to read unmatched songs: %w", err)
+	}
+
+	cursor := s.enrichCursor(ctx, cursorKey)
+	if cursor > 0 {
+		for len(songs) > 0 && songs[0].ID <= cursor {
+			songs = songs[1:]
+		}
+		logger.Info("Resuming %s enrichment after song %d", source.DisplayName(), cursor)
+	}
+	s.updateEnrichStatus(func(status *models.EnrichStatus) {
+		status.TotalSongs = len(songs)
+		status.Resumed = cursor > 0
+	})
+	logger.Info("Searching %s for %d songs without a %s ID", source.DisplayName(), len(songs), source.DisplayName())
+
+	// A search that finished is saved even if the job was stopped meanwhile
+	saveCtx := context.WithoutCancel(ctx)
+	for i, song := range songs {
+		if i > 0 {
+			if err := enrichSleep(ctx, enrichInterval[source]); err != nil {
+				return models.ErrOperationCancelled
+			}
+		}
+
+		match, err := searchSong(ctx, client, song)
+		var id string
+		if err == nil {
+			id = externalID(source, match.ExternalID, match.URL)
+		}
+		switch {
+		case err == nil && id != "" && match.Confidence >= enrichMinConfidence:
+			song.SetExternalMatch(source, id, match.Confidence, time.Now())
+			if err := songRepo.UpdateMatch(saveCtx, song); err != nil {
+				return fmt.Errorf("failed to save match: %w", err)
+			}
+			s.updateEnrichStatus(func(status *models.EnrichStatus) { status.MatchedSongs++ })
+		case err == nil || errors.Is(err, models.ErrNoMatchFound):
+			s.updateEnrichStatus(func(status *models.EnrichStatus) { status.UnmatchedSongs++ })
+		case ctx.Err() != nil:
+			return models.ErrOperationCancelled
+		case errors.Is(err, models.ErrAPIRateLimited):
+			// The song is searched again when the job resumes
+			return fmt.Errorf("%s kept rate limiting searches: %w", source.DisplayName(), err)
+		default:
+			logger.Debug("Failed to search %s for %s: %v", source.DisplayName(), song.GetDisplayName(), err)
+			s.updateEnrichStatus(func(status *models.EnrichStatus) {
+				status.ErrorCount++
+				status.LastError = err.Error()
+			})
+		}
+
+		processed := 0
+		s.updateEnrichStatus(func(status *models.EnrichStatus) {
+			status.ProcessedSongs++
+			processed = status.ProcessedSongs
+		})
+		if err := s.configRepo.Set(saveCtx, cursorKey, strconv.FormatUint(uint64(song.ID), 10)); err != nil {
+			logger.Debug("Failed to save enrichment progress: %v", err)
+		}
+		if processed%enrichLogEvery == 0 {
+			logger.Info("Searched %d/%d songs", processed, len(songs))
+		}
+	}
+
+	// The next job starts over, searching the songs left unmatched again
+	if err := s.configRepo.Set(saveCtx, cursorKey, "0"); err != nil {
+		logger.Debug("Failed to reset enrichment progress: %v", err)
+	}
+	return nil
+}
+
+// GetEnrichStatus returns the status of the running or last enrichment job
+func (s *AppService) GetEnrichStatus() *models.EnrichStatus {
+	s.enrichMu.Lock()
+	defer s.enrichMu.Unlock()
+	if s.enrichStatus == nil {
+		return &models.EnrichStatus{}
+	}
+	status := *s.enrichStatus
+	return &status
+}
+
+// CancelEnrich stops the running enrichment job; it resumes where it
+// stopped when it is run again
+func (s *AppService) CancelEnrich() {
+	s.enrichMu.Lock()
+	defer s.enrichMu.Unlock()
+	if s.enrichCancel != nil {
+		s.enrichCancel()
+	}
+}
+
+// updateEnrichStatus changes the status of the running enrichment job
+func (s *AppService) updateEnrichStatus(update func(status *models.EnrichStatus)) {
+	s.enrichMu.Lock()
+	defer s.enrichMu.Unlock()
+	update(s.enrichStatus)
+}
+
+// enrichCursor returns the ID of the last song searched by an unfinished
+// enrichment job, or 0 to start from the first song
+func (s *AppService) enrichCursor(ctx context.Context, key string) uint {
+	value, err := s.configRepo.Get(ctx, key)
+	if err != nil {
+		return 0
+	}
+	id, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return uint(id)
+}
+
+// enrichCursorKey is the config key of the enrichment cursor of a device and source
+func enrichCursorKey(deviceID uint, source models.DataSource) string {
+	return fmt.Sprintf("%s%d_%s", repository.ConfigKeyEnrichCursorPrefix, deviceID, source)
+}
+
+// searchSong searches a data source for a song, waiting and retrying while
+// the source rate limits the searches
+func searchSong(ctx context.Context, client api.Client, song *models.Song) (*api.TrackMatch, error) {
+	artist := song.Artist
+	if artist == "" {
+		artist = song.AlbumArtist
+	}
+	if artist == "" || song.Title == "" {
+		// Nothing to search for
+		return nil, models.ErrNoMatchFound
+	}
+
+	backoff := enrichBackoff
+	for attempt := 0; ; attempt++ {
+		match, err := client.SearchTrack(ctx, artist, song.Title)
+		if !errors.Is(err, models.ErrAPIRateLimited) || attempt == enrichRetries {
+			return match, err
+		}
+		if err := enrichSleep(ctx, backoff); err != nil {
+			return nil, err
+		}
+		backoff *= 2
+	}
+}
@@ -0,0 +1,234 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Ardakilic/rocklist/internal/api"
+	"github.com/Ardakilic/rocklist/internal/models"
+)
+
+// searchClient is an api.Client whose searches are answered by search
+type searchClient struct {
+	mockAPIClient
+	search func(artist, title string) (*api.TrackMatch, error)
+}
+
+func (c *searchClient) SearchTrack(ctx context.Context, artist, title string) (*api.TrackMatch, error) {
+	return c.search(artist, title)
+}
+
+// noEnrichSleep runs enrichment jobs without waiting for the duration of the test
+func noEnrichSleep(t *testing.T) {
+	original := enrichSleep
+	enrichSleep = func(ctx context.Context, d time.Duration) error { return ctx.Err() }
+	t.Cleanup(func() { enrichSleep = original })
+}
+
+func newEnrichTestService(t *testing.T, songs []*models.Song) *AppService {
+	t.Helper()
+	svc, err := NewAppService(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("NewAppService() error = %v", err)
+	}
+	t.Cleanup(func() { _ = svc.Close() })
+	if err := svc.songRepo.CreateBatch(context.Background(), songs); err != nil {
+		t.Fatalf("CreateBatch() error = %v", err)
+	}
+	return svc
+}
+
+func TestAppService_EnrichLibrary(t *testing.T) {
+	noEnrichSleep(t)
+	ctx := context.Background()
+	svc := newEnrichTestService(t, []*models.Song{
+		{RockboxID: "1", Path: "/1.mp3", Artist: "Metallica", Title: "Battery"},
+		{RockboxID: "2", Path: "/2.mp3", Artist: "Metallica", Title: "Unknown Demo"},
+		{RockboxID: "3", Path: "/3.mp3", Artist: "Metallica", Title: "Orion"},
+		{RockboxID: "4", Path: "/4.mp3", AlbumArtist: "Slayer", Title: "Angel of Death"},
+		{RockboxID: "5", Path: "/5.mp3", Title: "Untitled"},
+		{RockboxID: "6", Path: "/6.mp3", Artist: "Slayer", Title: "Broken"},
+		{RockboxID: "7", Path: "/7.mp3", Artist: "Anthrax", Title: "Indians", MusicBrainzID: "known"},
+	})
+
+	var searched []string
+	svc.playlistService.RegisterClient(models.DataSourceMusicBrainz, &searchClient{
+		mockAPIClient: mockAPIClient{source: models.DataSourceMusicBrainz, configured: true},
+		search: func(artist, title string) (*api.TrackMatch, error) {
+			searched = append(searched, artist+" - "+title)
+			switch title {
+			case "Battery":
+				return &api.TrackMatch{ExternalID: "mb-battery", Confidence: 0.9}, nil
+			case "Orion":
+				return &api.TrackMatch{ExternalID: "mb-orion", Confidence: 0.3}, nil
+			case "Angel of Death":
+				return &api.TrackMatch{ExternalID: "mb-angel", Confidence: 1}, nil
+			case "Broken":
+				return nil, errors.New("server error")
+			}
+			return nil, models.ErrNoMatchFound
+		},
+	})
+
+	status, err := svc.EnrichLibrary(ctx, models.DataSourceMusicBrainz)
+	if err != nil {
+		t.Fatalf("EnrichLibrary() error = %v", err)
+	}
+	if status.InProgress || status.CompletedAt == nil {
+		t.Errorf("EnrichLibrary() status = %+v, want completed", status)
+	}
+	if status.TotalSongs != 6 || status.ProcessedSongs != 6 {
+		t.Errorf("EnrichLibrary() processed %d/%d, want 6/6", status.ProcessedSongs, status.TotalSongs)
+	}
+	if status.MatchedSongs != 2 || status.UnmatchedSongs != 3 || status.ErrorCount != 1 {
+		t.Errorf("EnrichLibrary() matched/unmatched/errors = %d/%d/%d, want 2/3/1",
+			status.MatchedSongs, status.UnmatchedSongs, status.ErrorCount)
+	}
+	// The song without an artist isn't searched, the one with an ID isn't read
+	if len(searched) != 5 || searched[3] != "Slayer - Angel of Death" {
+		t.Errorf("EnrichLibrary() searched %q", searched)
+	}
+
+	song, err := svc.songRepo.FindByExternalID(ctx, models.DataSourceMusicBrainz, "mb-battery")
+	if err != nil || song.Title != "Battery" || song.MatchConfidence != 0.9 || song.MatchedAt == nil {
+		t.Errorf("FindByExternalID(mb-battery) = %+v, %v, want Battery matched with 0.9", song, err)
+	}
+	if _, err := svc.songRepo.FindByExternalID(ctx, models.DataSourceMusicBrainz, "mb-orion"); !errors.Is(err, models.ErrSongNotFound) {
+		t.Errorf("FindByExternalID(mb-orion) error = %v, want low confidence match not stored", err)
+	}
+
+	if got := svc.GetEnrichStatus(); got.MatchedSongs != 2 || got.InProgress {
+		t.Errorf("GetEnrichStatus() = %+v, want the last job", got)
+	}
+}
+
+func TestAppService_EnrichLibrary_Errors(t *testing.T) {
+	ctx := context.Background()
+	svc := newEnrichTestService(t, nil)
+
+	if got := svc.GetEnrichStatus(); got.InProgress || got.StartedAt != nil {
+		t.Errorf("GetEnrichStatus() = %+v, want empty before the first job", got)
+	}
+	if _, err := svc.EnrichLibrary(ctx, "unknown"); !errors.Is(err, models.ErrInvalidDataSource) {
+		t.Errorf("EnrichLibrary(unknown) error = %v, want %v", err, models.ErrInvalidDataSource)
+	}
+	if _, err := svc.EnrichLibrary(ctx, models.DataSourceSpotify); !errors.Is(err, models.ErrDataSourceDisabled) {
+		t.Errorf("EnrichLibrary(spotify) error = %v, want %v", err, models.ErrDataSourceDisabled)
+	}
+
+	svc.enrichStatus = &models.EnrichStatus{InProgress: true}
+	svc.playlistService.RegisterClient(models.DataSourceLastFM, &mockAPIClient{source: models.DataSourceLastFM, configured: true})
+	if _, err := svc.EnrichLibrary(ctx, models.DataSourceLastFM); !errors.Is(err, models.ErrEnrichInProgress) {
+		t.Errorf("EnrichLibrary() error = %v, want %v", err, models.ErrEnrichInProgress)
+	}
+}
+
+func TestAppService_EnrichLibrary_Resume(t *testing.T) {
+	noEnrichSleep(t)
+	ctx := context.Background()
+	svc := newEnrichTestService(t, []*models.Song{
+		{RockboxID: "1", Path: "/1.mp3", Artist: "Metallica", Title: "Battery"},
+		{RockboxID: "2", Path: "/2.mp3", Artist: "Metallica", Title: "Orion"},
+		{RockboxID: "3", Path: "/3.mp3", Artist: "Metallica", Title: "Damage, Inc."},
+	})
+
+	// The first job is stopped while searching the second song
+	var searched []string
+	svc.playlistService.RegisterClient(models.DataSourceLastFM, &searchClient{
+		mockAPIClient: mockAPIClient{source: models.DataSourceLastFM, configured: true},
+		search: func(artist, title string) (*api.TrackMatch, error) {
+			searched = append(searched, title)
+			if len(searched) == 2 {
+				svc.CancelEnrich()
+			}
+			return &api.TrackMatch{URL: "https://www.last.fm/music/Metallica/_/" + title, Confidence: 1}, nil
+		},
+	})
+
+	status, err := svc.EnrichLibrary(ctx, models.DataSourceLastFM)
+	if !errors.Is(err, models.ErrOperationCancelled) {
+		t.Fatalf("EnrichLibrary() error = %v, want %v", err, models.ErrOperationCancelled)
+	}
+	if status.ProcessedSongs != 2 || status.InProgress {
+		t.Errorf("EnrichLibrary() status = %+v, want stopped after 2 songs", status)
+	}
+
+	// The second job only searches the song the first didn't reach
+	searched = nil
+	status, err = svc.EnrichLibrary(ctx, models.DataSourceLastFM)
+	if err != nil {
+		t.Fatalf("EnrichLibrary() error = %v", err)
+	}
+	if !status.Resumed || status.TotalSongs != 1 || len(searched) != 1 || searched[0] != "Damage, Inc." {
+		t.Errorf("EnrichLibrary() resumed = %v, total = %d, searched %q, want only Damage, Inc.",
+			status.Resumed, status.TotalSongs, searched)
+	}
+
+	// A finished job starts over with the songs still unmatched
+	searched = nil
+	status, err = svc.EnrichLibrary(ctx, models.DataSourceLastFM)
+	if err != nil {
+		t.Fatalf("EnrichLibrary() error = %v", err)
+	}
+	if status.Resumed || status.TotalSongs != 0 {
+		t.Errorf("EnrichLibrary() resumed = %v, total = %d, want a new job with nothing left", status.Resumed, status.TotalSongs)
+	}
+}
+
+func TestAppService_EnrichLibrary_RateLimited(t *testing.T) {
+	var waits []time.Duration
+	original := enrichSleep
+	enrichSleep = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+	defer func() { enrichSleep = original }()
+
+	ctx := context.Background()
+	svc := newEnrichTestService(t, []*models.Song{
+		{RockboxID: "1", Path: "/1.mp3", Artist: "Metallica", Title: "Battery"},
+		{RockboxID: "2", Path: "/2.mp3", Artist: "Metallica", Title: "Orion"},
+	})
+
+	rateLimited := models.NewAPIError(models.DataSourceSpotify, 429, "rate limited", models.ErrAPIRateLimited)
+	calls := 0
+	svc.playlistService.RegisterClient(models.DataSourceSpotify, &searchClient{
+		mockAPIClient: mockAPIClient{source: models.DataSourceSpotify, configured: true},
+		search: func(artist, title string) (*api.TrackMatch, error) {
+			calls++
+			// The first search succeeds on its second attempt, the second never does
+			if title == "Battery" && calls == 2 {
+				return &api.TrackMatch{ExternalID: "sp-battery", Confidence: 1}, nil
+			}
+			return nil, rateLimited
+		},
+	})
+
+	status, err := svc.EnrichLibrary(ctx, models.DataSourceSpotify)
+	if !errors.Is(err, models.ErrAPIRateLimited) {
+		t.Fatalf("EnrichLibrary() error = %v, want %v", err, models.ErrAPIRateLimited)
+	}
+	if status.MatchedSongs != 1 || status.ProcessedSongs != 1 {
+		t.Errorf("EnrichLibrary() matched/processed = %d/%d, want 1/1", status.MatchedSongs, status.ProcessedSongs)
+	}
+	if calls != 2+enrichRetries+1 {
+		t.Errorf("SearchTrack() calls = %d, want %d", calls, 2+enrichRetries+1)
+	}
+	want := []time.Duration{enrichBackoff, enrichInterval[models.DataSourceSpotify], enrichBackoff, 2 * enrichBackoff, 4 * enrichBackoff}
+	if len(waits) != len(want) {
+		t.Fatalf("waits = %v, want %v", waits, want)
+	}
+	for i := range want {
+		if waits[i] != want[i] {
+			t.Errorf("waits = %v, want %v", waits, want)
+			break
+		}
+	}
+
+	// The song stopped at is searched again when the job resumes
+	if cursor := svc.enrichCursor(ctx, enrichCursorKey(svc.ActiveDevice().ID, models.DataSourceSpotify)); cursor != 1 {
+		t.Errorf("enrichCursor() = %d, want 1", cursor)
+	}
+}
@@ -3,24 +3,35 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/Ardakilic/rocklist/internal/api"
 	"github.com/Ardakilic/rocklist/internal/models"
+	"github.com/Ardakilic/rocklist/internal/normalize"
 	"github.com/Ardakilic/rocklist/internal/repository"
+	"github.com/Ardakilic/rocklist/internal/rockbox"
 )
 
 // PlaylistService handles playlist generation and management
 type PlaylistService struct {
 	songRepo     repository.SongRepository
 	playlistRepo repository.PlaylistRepository
-	clients      map[models.DataSource]api.Client
-	playlistDir  string
-	logger       Logger
+	// aliasRepo holds the user's artist aliases; nil finds no aliases
+	aliasRepo   repository.ArtistAliasRepository
+	clients     map[models.DataSource]api.Client
+	playlistDir string
+	// volumes locates song files on the host so exports can check them;
+	// nil exports without checking
+	volumes rockbox.VolumeMap
+	// scorer builds the Scorer matching tracks for each request
+	scorer ScorerFactory
+	logger Logger
 }
 
 // Logger interface for services
@@ -43,6 +54,7 @@ func NewPlaylistService(
 		clients:      make(map[models.DataSource]api.Client),
 		playlistDir:  playlistDir,
 		logger:       logger,
+		scorer:       NewWeightedScorer,
 	}
 }
 
@@ -51,11 +63,34 @@ func (s *PlaylistService) RegisterClient(source models.DataSource, client api.Cl
 	s.clients[source] = client
 }
 
+// SetRepositories replaces the song and playlist repositories, e.g. with
+// ones scoped to another device
+func (s *PlaylistService) SetRepositories(songRepo repository.SongRepository, playlistRepo repository.PlaylistRepository) {
+	s.songRepo = songRepo
+	s.playlistRepo = playlistRepo
+}
+
+// SetAliasRepository sets the artist aliases used to find candidate songs
+func (s *PlaylistService) SetAliasRepository(aliasRepo repository.ArtistAliasRepository) {
+	s.aliasRepo = aliasRepo
+}
+
+// SetScorer replaces how tracks are scored against local songs
+func (s *PlaylistService) SetScorer(factory ScorerFactory) {
+	s.scorer = factory
+}
+
 // SetPlaylistDir sets the playlist directory
 func (s *PlaylistService) SetPlaylistDir(dir string) {
 	s.playlistDir = dir
 }
 
+// SetVolumes sets where the player's volumes are mounted on the host. The
+// main volume has the name "".
+func (s *PlaylistService) SetVolumes(volumes rockbox.VolumeMap) {
+	s.volumes = volumes
+}
+
 // GeneratePlaylist generates a playlist based on the request
 func (s *PlaylistService) GeneratePlaylist(ctx context.Context, req *models.PlaylistRequest) (*models.Playlist, error) {
 	if err := req.Validate(); err != nil {
@@ -119,12 +154,20 @@ func (s *PlaylistService) GeneratePlaylist(ctx context.Context, req *models.Play
 	if req.UseAlbumArtist {
 		s.logger.Info("Using album artist field for matching (with fallback to artist)")
 	}
+	if req.UseComposer {
+		s.logger.Info("Using composer field for matching (with fallback to artist)")
+	}
 
 	// Match external tracks to local songs
-	matchedSongs, matchStats := s.matchTracks(ctx, externalTracks, req.UseAlbumArtist)
+	matchedSongs, matchStats := s.matchTracks(ctx, externalTracks, req)
+
+	s.logger.Info("Matched %d/%d tracks (%.1f%% match rate, %d by external ID)",
+		matchStats.Matched, matchStats.Total, matchStats.MatchRate()*100, matchStats.MatchedByID)
 
-	s.logger.Info("Matched %d/%d tracks (%.1f%% match rate)",
-		matchStats.Matched, matchStats.Total, matchStats.MatchRate()*100)
+	if req.HasFilters() {
+		matchedSongs = filterSongs(matchedSongs, req)
+		s.logger.Info("%d songs left after applying composer/comment/grouping filters", len(matchedSongs))
+	}
 
 	if len(matchedSongs) == 0 {
 		return nil, models.ErrNoMatchingSongs
@@ -171,6 +214,7 @@ func (s *PlaylistService) ExportPlaylist(ctx context.Context, playlistID uint) (
 		return "", err
 	}
 
+	songs = s.presentSongs(songs)
 	if len(songs) == 0 {
 		return "", models.ErrNoMatchingSongs
 	}
@@ -230,6 +274,57 @@ func (s *PlaylistService) ExportPlaylist(ctx context.Context, playlistID uint) (
 	return filename, nil
 }
 
+// presentSongs drops songs whose file is missing from its mounted volume.
+// Rockbox paths, including volume prefixes such as /<microSD1>/, are written
+// to the playlist as they are. Songs on a volume that is not mapped or not
+// mounted, such as an unplugged device, cannot be checked and are kept: the
+// playlist only holds songs the last parse found on the device.
+func (s *PlaylistService) presentSongs(songs []*models.Song) []*models.Song {
+	if s.volumes == nil {
+		return songs
+	}
+
+	present := make([]*models.Song, 0, len(songs))
+	mounted := make(map[string]bool)
+	for _, song := range songs {
+		volume, _ := rockbox.SplitVolume(song.Path)
+		ok, checked := mounted[volume]
+		if !checked {
+			ok = s.volumeMounted(volume)
+			mounted[volume] = ok
+			if !ok {
+				s.logger.Info("Not checking songs under %s, the volume is not mounted", rockbox.VolumePath(volume, "/"))
+			}
+		}
+		if !ok {
+			present = append(present, song)
+			continue
+		}
+
+		hostPath, _ := s.volumes.HostPath(song.Path)
+		if _, err := os.Stat(hostPath); err != nil {
+			s.logger.Info("Skipping %s, file not found at %s", song.Path, hostPath)
+			continue
+		}
+		present = append(present, song)
+	}
+	return present
+}
+
+// volumeMounted reports whether the host folder of a volume is mounted: the
+// main volume must hold the device's .rockbox folder, other volumes must exist
+func (s *PlaylistService) volumeMounted(volume string) bool {
+	dir, ok := s.volumes[volume]
+	if !ok || dir == "" {
+		return false
+	}
+	if volume == "" {
+		return rockbox.IsDeviceRoot(dir)
+	}
+	info, err := os.Stat(dir)
+	return err == nil && info.IsDir()
+}
+
 // getMixedSongs gets a mix of top tracks and similar tracks for an artist
 func (s *PlaylistService) getMixedSongs(ctx context.Context, client api.Client, artist string, limit int) ([]*api.TrackInfo, error) {
 	topLimit := limit / 2
@@ -291,6 +386,8 @@ type MatchStats struct {
 	Total     int
 	Matched   int
 	Unmatched int
+	// MatchedByID counts the matches found by external ID, without fuzzy matching
+	MatchedByID int
 }
 
 // MatchRate returns the match rate as a percentage (0-1)
@@ -302,40 +399,51 @@ func (ms *MatchStats) MatchRate() float64 {
 }
 
 // matchTracks matches external tracks to local songs
-// When useAlbumArtist is true, it prioritizes matching against album artist field
-func (s *PlaylistService) matchTracks(ctx context.Context, tracks []*api.TrackInfo, useAlbumArtist bool) ([]*models.Song, *MatchStats) {
+// A track whose ID was stored on a song by an earlier match is matched by that ID.
+// Other tracks are matched by fuzzy comparison, and the ID of each match is stored.
+// Candidates are scored by the Scorer built for req.
+func (s *PlaylistService) matchTracks(ctx context.Context, tracks []*api.TrackInfo, req *models.PlaylistRequest) ([]*models.Song, *MatchStats) {
 	stats := &MatchStats{Total: len(tracks)}
 	matched := make([]*models.Song, 0, len(tracks))
 	seen := make(map[uint]bool) // Avoid duplicates
 
+	scorer := s.scorer(req)
+	resolver, err := s.loadArtistResolver(ctx)
+	if err != nil {
+		// Candidates are still found under the exact artist name
+		s.logger.Debug("Failed to load artist names: %v", err)
+	}
+
 	for _, track := range tracks {
-		// Try to find matching song in local library
-		var songs []*models.Song
-		var err error
-
-		if useAlbumArtist {
-			// First try to find by album artist
-			songs, err = s.songRepo.FindByAlbumArtist(ctx, track.Artist)
-			if err != nil || len(songs) == 0 {
-				// Fall back to regular artist search
-				songs, err = s.songRepo.FindByArtist(ctx, track.Artist)
+		externalID := trackExternalID(track, req.DataSource)
+		if song := s.findByExternalID(ctx, req.DataSource, externalID); song != nil {
+			if !seen[song.ID] {
+				seen[song.ID] = true
+				matched = append(matched, song)
+				stats.Matched++
+				stats.MatchedByID++
+				s.logger.Debug("Matched by ID: %s - %s", track.Artist, track.Title)
+			} else {
+				stats.Unmatched++
 			}
-		} else {
-			songs, err = s.songRepo.FindByArtist(ctx, track.Artist)
+			continue
 		}
 
+		// Try to find matching song in local library
+		songs, err := s.findCandidates(ctx, track.Artist, req, resolver)
+
 		if err != nil || len(songs) == 0 {
 			s.logger.Debug("No songs found for artist: %s", track.Artist)
 			stats.Unmatched++
 			continue
 		}
 
-		// Find best match
+		// Find best match; a threshold of 0 accepts even a score of 0
 		var bestMatch *models.Song
 		bestScore := 0.0
 		for _, song := range songs {
-			score := calculateMatchScore(track, song, useAlbumArtist)
-			if score > bestScore && score >= 0.5 {
+			score := scorer.Score(track, song)
+			if score >= scorer.Threshold() && (bestMatch == nil || score > bestScore) {
 				bestScore = score
 				bestMatch = song
 			}
@@ -346,6 +454,7 @@ func (s *PlaylistService) matchTracks(ctx context.Context, tracks []*api.TrackIn
 			matched = append(matched, bestMatch)
 			stats.Matched++
 			s.logger.Debug("Matched: %s - %s (score: %.2f)", track.Artist, track.Title, bestScore)
+			s.saveMatch(ctx, bestMatch, req.DataSource, externalID, bestScore)
 		} else {
 			stats.Unmatched++
 			s.logger.Debug("No match for: %s - %s", track.Artist, track.Title)
@@ -355,37 +464,123 @@ func (s *PlaylistService) matchTracks(ctx context.Context, tracks []*api.TrackIn
 	return matched, stats
 }
 
-// calculateMatchScore calculates a match score between an external track and a local song
-// When useAlbumArtist is true, it prioritizes album artist for comparison (with fallback to artist)
-func calculateMatchScore(track *api.TrackInfo, song *models.Song, useAlbumArtist bool) float64 {
-	titleScore := stringSimilarity(
-		strings.ToLower(track.Title),
-		strings.ToLower(song.Title),
-	)
-
-	// Determine which artist field to use for comparison
-	var songArtist string
-	if useAlbumArtist {
-		// Use album artist if available, otherwise fall back to artist
-		songArtist = song.AlbumArtist
-		if songArtist == "" {
-			songArtist = song.Artist
+// trackExternalID returns the ID identifying an external track at its data source
+func trackExternalID(track *api.TrackInfo, source models.DataSource) string {
+	return externalID(source, track.ExternalID, track.URL)
+}
+
+// externalID returns the ID stored for a track found at a data source.
+// Last.fm only has MusicBrainz IDs for some tracks, so its track URLs
+// identify the others.
+func externalID(source models.DataSource, id, url string) string {
+	if id == "" && source == models.DataSourceLastFM {
+		return url
+	}
+	return id
+}
+
+// findByExternalID returns the song stored with an external ID, or nil
+func (s *PlaylistService) findByExternalID(ctx context.Context, source models.DataSource, id string) *models.Song {
+	if id == "" {
+		return nil
+	}
+	song, err := s.songRepo.FindByExternalID(ctx, source, id)
+	if err != nil {
+		if !errors.Is(err, models.ErrSongNotFound) {
+			s.logger.Debug("Failed to look up %s ID %s: %v", source.DisplayName(), id, err)
+		}
+		return nil
+	}
+	return song
+}
+
+// saveMatch stores the external ID of a fuzzy match on the song, so later
+// generations match the track by ID. A song keeps the first ID it was
+// matched to at a source; other tracks matching it are other recordings.
+func (s *PlaylistService) saveMatch(ctx context.Context, song *models.Song, source models.DataSource, id string, confidence float64) {
+	if id == "" || song.ExternalID(source) != "" {
+		return
+	}
+	song.SetExternalMatch(source, id, confidence, time.Now())
+	if err := s.songRepo.UpdateMatch(ctx, song); err != nil {
+		s.logger.Debug("Failed to save match of %s: %v", song.GetDisplayName(), err)
+	}
+}
+
+// findCandidates returns the local songs that may match an external artist.
+// Songs are looked up under every local name the resolver finds for the
+// artist; without a resolver only the exact name is looked up.
+func (s *PlaylistService) findCandidates(ctx context.Context, artist string, req *models.PlaylistRequest, resolver *artistResolver) ([]*models.Song, error) {
+	if req.UseComposer {
+		songs, err := s.songRepo.FindByComposer(ctx, artist)
+		if err == nil && len(songs) > 0 {
+			return songs, nil
+		}
+	}
+
+	if req.UseAlbumArtist {
+		// First try to find by album artist
+		songs, err := s.songRepo.FindByAlbumArtist(ctx, artist)
+		if err == nil && len(songs) > 0 {
+			return songs, nil
 		}
-	} else {
-		// Use effective artist (album artist if available, else artist)
-		songArtist = song.GetEffectiveArtist()
+		// Fall back to regular artist search
 	}
 
-	artistScore := stringSimilarity(
-		strings.ToLower(track.Artist),
-		strings.ToLower(songArtist),
-	)
+	names := []string{artist}
+	if resolver != nil {
+		names = resolver.resolve(artist)
+	}
+	if len(names) == 1 {
+		return s.songRepo.FindByArtist(ctx, artist)
+	}
 
-	// Title is more important than artist
-	return titleScore*0.6 + artistScore*0.4
+	var songs []*models.Song
+	seen := make(map[uint]bool)
+	for _, name := range names {
+		found, err := s.songRepo.FindByArtist(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, song := range found {
+			if !seen[song.ID] {
+				seen[song.ID] = true
+				songs = append(songs, song)
+			}
+		}
+	}
+	return songs, nil
+}
+
+// filterSongs keeps the songs matching the composer, comment and grouping filters of a request
+func filterSongs(songs []*models.Song, req *models.PlaylistRequest) []*models.Song {
+	result := make([]*models.Song, 0, len(songs))
+	for _, song := range songs {
+		if !containsFold(song.Composer, req.Composer) ||
+			!containsFold(song.Comment, req.Comment) ||
+			!containsFold(song.Grouping, req.Grouping) {
+			continue
+		}
+		result = append(result, song)
+	}
+	return result
+}
+
+// containsFold reports whether substr is within s, ignoring case. An empty substr always matches.
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+// calculateMatchScore calculates a match score between an external track and a local song
+// with the default weights.
+// When useAlbumArtist is true, it prioritizes album artist for comparison (with fallback to artist)
+func calculateMatchScore(track *api.TrackInfo, song *models.Song, useAlbumArtist bool) float64 {
+	return NewWeightedScorer(&models.PlaylistRequest{UseAlbumArtist: useAlbumArtist}).Score(track, song)
 }
 
-// stringSimilarity calculates string similarity (0-1)
+// stringSimilarity calculates string similarity (0-1). Strings are compared
+// after normalization, so case, accents, punctuation and script do not count
+// as differences.
 func stringSimilarity(a, b string) float64 {
 	if a == b {
 		return 1.0
@@ -395,31 +590,32 @@ func stringSimilarity(a, b string) float64 {
 	}
 
 	// Normalize strings
-	a = normalizeString(a)
-	b = normalizeString(b)
+	a = normalize.Text(normalizeString(a))
+	b = normalize.Text(normalizeString(b))
 
 	if a == b {
 		return 1.0
 	}
 
 	// Check containment
+	lenA, lenB := utf8.RuneCountInString(a), utf8.RuneCountInString(b)
 	if strings.Contains(a, b) || strings.Contains(b, a) {
-		shorter := len(a)
-		if len(b) < shorter {
-			shorter = len(b)
+		shorter := lenA
+		if lenB < shorter {
+			shorter = lenB
 		}
-		longer := len(a)
-		if len(b) > longer {
-			longer = len(b)
+		longer := lenA
+		if lenB > longer {
+			longer = lenB
 		}
 		return float64(shorter) / float64(longer)
 	}
 
 	// Calculate Levenshtein distance ratio
 	distance := levenshteinDistance(a, b)
-	maxLen := len(a)
-	if len(b) > maxLen {
-		maxLen = len(b)
+	maxLen := lenA
+	if lenB > maxLen {
+		maxLen = lenB
 	}
 	return 1.0 - float64(distance)/float64(maxLen)
 }
@@ -438,8 +634,10 @@ func normalizeString(s string) string {
 	return strings.TrimSpace(s)
 }
 
-// levenshteinDistance calculates the Levenshtein distance between two strings
-func levenshteinDistance(a, b string) int {
+// levenshteinDistance calculates the Levenshtein distance between two
+// strings, counting characters rather than bytes
+func levenshteinDistance(s, t string) int {
+	a, b := []rune(s), []rune(t)
 	if len(a) == 0 {
 		return len(b)
 	}
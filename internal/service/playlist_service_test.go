@@ -3,10 +3,14 @@ package service
 import (
 	"context"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/Ardakilic/rocklist/internal/api"
 	"github.com/Ardakilic/rocklist/internal/models"
+	"github.com/Ardakilic/rocklist/internal/repository"
+	"github.com/Ardakilic/rocklist/internal/rockbox"
 	"gorm.io/gorm"
 )
 
@@ -20,8 +24,9 @@ func (m *mockSongRepository) Create(ctx context.Context, song *models.Song) erro
 func (m *mockSongRepository) CreateBatch(ctx context.Context, songs []*models.Song) error {
 	return nil
 }
-func (m *mockSongRepository) Update(ctx context.Context, song *models.Song) error { return nil }
-func (m *mockSongRepository) Delete(ctx context.Context, id uint) error           { return nil }
+func (m *mockSongRepository) Update(ctx context.Context, song *models.Song) error      { return nil }
+func (m *mockSongRepository) UpdateMatch(ctx context.Context, song *models.Song) error { return nil }
+func (m *mockSongRepository) Delete(ctx context.Context, id uint) error                { return nil }
 func (m *mockSongRepository) FindByID(ctx context.Context, id uint) (*models.Song, error) {
 	return nil, m.findError
 }
@@ -40,6 +45,12 @@ func (m *mockSongRepository) FindByAlbumArtist(ctx context.Context, albumArtist
 func (m *mockSongRepository) FindByGenre(ctx context.Context, genre string) ([]*models.Song, error) {
 	return m.songs, m.findError
 }
+func (m *mockSongRepository) FindByComposer(ctx context.Context, composer string) ([]*models.Song, error) {
+	return m.songs, m.findError
+}
+func (m *mockSongRepository) FindByExternalID(ctx context.Context, source models.DataSource, id string) (*models.Song, error) {
+	return nil, models.ErrSongNotFound
+}
 func (m *mockSongRepository) FindUnmatched(ctx context.Context, source models.DataSource) ([]*models.Song, error) {
 	return m.songs, m.findError
 }
@@ -52,10 +63,32 @@ func (m *mockSongRepository) GetUniqueArtists(ctx context.Context) ([]string, er
 func (m *mockSongRepository) GetUniqueGenres(ctx context.Context) ([]string, error) {
 	return []string{}, nil
 }
+func (m *mockSongRepository) GetArtistNames(ctx context.Context) ([]string, error) {
+	return []string{}, nil
+}
 func (m *mockSongRepository) Count(ctx context.Context) (int64, error) {
 	return int64(len(m.songs)), nil
 }
 func (m *mockSongRepository) DeleteAll(ctx context.Context) error { return nil }
+func (m *mockSongRepository) Sync(ctx context.Context, songs []*models.Song) (*models.SyncResult, error) {
+	return &models.SyncResult{Added: len(songs)}, nil
+}
+func (m *mockSongRepository) BeginSync(ctx context.Context) repository.SongSync {
+	return &mockSongSync{}
+}
+
+// mockSongSync implements repository.SongSync for testing
+type mockSongSync struct {
+	added int
+}
+
+func (m *mockSongSync) Add(ctx context.Context, song *models.Song) error {
+	m.added++
+	return nil
+}
+func (m *mockSongSync) Finish(ctx context.Context) (*models.SyncResult, error) {
+	return &models.SyncResult{Added: m.added}, nil
+}
 
 // mockPlaylistRepository implements repository.PlaylistRepository for testing
 type mockPlaylistRepository struct {
@@ -92,6 +125,9 @@ func (m *mockPlaylistRepository) RemoveSongs(ctx context.Context, playlistID uin
 func (m *mockPlaylistRepository) GetSongs(ctx context.Context, playlistID uint) ([]*models.Song, error) {
 	return nil, nil
 }
+func (m *mockPlaylistRepository) GetEntries(ctx context.Context, playlistID uint) ([]*models.PlaylistSong, error) {
+	return nil, nil
+}
 
 // mockLogger implements Logger for testing
 type mockServiceLogger struct{}
@@ -280,6 +316,13 @@ func TestStringSimilarity(t *testing.T) {
 		{"a contains b", "hello world", "hello", 0.4, 0.6},
 		{"remastered suffix", "song (remastered)", "song", 0.9, 1.0},
 		{"completely different", "abc", "xyz", 0.0, 0.5},
+		{"diacritics", "Motörhead", "Motorhead", 1.0, 1.0},
+		{"decomposed", "Sigur Ro\u0301s", "Sigur Rós", 1.0, 1.0},
+		{"ampersand", "Simon & Garfunkel", "Simon and Garfunkel", 1.0, 1.0},
+		{"punctuation", "AC/DC", "AC-DC", 1.0, 1.0},
+		{"cyrillic", "Кино", "Kino", 1.0, 1.0},
+		{"kana", "サカナクション", "Sakanakushon", 1.0, 1.0},
+		{"one accent off", "Beyoncé", "Beyonse", 0.8, 0.9},
 	}
 
 	for _, tt := range tests {
@@ -331,6 +374,8 @@ func TestLevenshteinDistance(t *testing.T) {
 		{"abc", "abd", 1},
 		{"abc", "xyz", 3},
 		{"kitten", "sitting", 3},
+		{"кино", "кило", 1},
+		{"sørensen", "sorensen", 1},
 	}
 
 	for _, tt := range tests {
@@ -854,6 +899,77 @@ func (m *mockPlaylistRepositoryWithExport) GetSongs(ctx context.Context, playlis
 	return m.songs, nil
 }
 
+func TestPlaylistService_ExportPlaylist_Volumes(t *testing.T) {
+	tmpDir := t.TempDir()
+	internal := filepath.Join(tmpDir, "ipod")
+	card := filepath.Join(tmpDir, "sd")
+	for _, name := range []string{
+		filepath.Join(internal, ".rockbox", "rockbox-info.txt"),
+		filepath.Join(internal, "Music", "a.mp3"),
+		filepath.Join(card, "Music", "b.mp3"),
+	} {
+		_ = os.MkdirAll(filepath.Dir(name), 0755)
+		_ = os.WriteFile(name, []byte("test"), 0644)
+	}
+
+	songs := []*models.Song{
+		{Model: gorm.Model{ID: 1}, Artist: "A", Title: "Internal", Path: "/Music/a.mp3"},
+		{Model: gorm.Model{ID: 2}, Artist: "B", Title: "Card", Path: "/<microSD1>/Music/b.mp3"},
+		{Model: gorm.Model{ID: 3}, Artist: "C", Title: "Removed", Path: "/<microSD1>/Music/c.mp3"},
+		{Model: gorm.Model{ID: 4}, Artist: "D", Title: "Unmounted", Path: "/<HD1>/Music/d.mp3"},
+	}
+	playlistRepo := &mockPlaylistRepositoryWithExport{
+		playlist: &models.Playlist{Model: gorm.Model{ID: 1}, Name: "Volumes"},
+		songs:    songs,
+	}
+
+	svc := NewPlaylistService(&mockSongRepository{}, playlistRepo, filepath.Join(tmpDir, "Playlists"), &mockServiceLogger{})
+	svc.SetVolumes(rockbox.VolumeMap{"": internal, "microSD1": card})
+
+	name, err := svc.ExportPlaylist(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("ExportPlaylist() error = %v", err)
+	}
+	data, _ := os.ReadFile(name)
+	content := string(data)
+
+	for _, want := range []string{"\n/Music/a.mp3\n", "\n/<microSD1>/Music/b.mp3\n", "\n/<HD1>/Music/d.mp3\n"} {
+		if !strings.Contains(content, want) {
+			t.Errorf("playlist should contain %q:\n%s", strings.TrimSpace(want), content)
+		}
+	}
+	if strings.Contains(content, "c.mp3") {
+		t.Errorf("playlist should skip the missing file:\n%s", content)
+	}
+}
+
+func TestPlaylistService_ExportPlaylist_DeviceNotMounted(t *testing.T) {
+	tmpDir := t.TempDir()
+	songs := []*models.Song{
+		{Model: gorm.Model{ID: 1}, Artist: "A", Title: "Internal", Path: "/Music/a.mp3"},
+		{Model: gorm.Model{ID: 2}, Artist: "B", Title: "Card", Path: "/<microSD1>/Music/b.mp3"},
+	}
+	playlistRepo := &mockPlaylistRepositoryWithExport{
+		playlist: &models.Playlist{Model: gorm.Model{ID: 1}, Name: "Unplugged"},
+		songs:    songs,
+	}
+
+	// The device and its card are unplugged, or a backup was parsed
+	svc := NewPlaylistService(&mockSongRepository{}, playlistRepo, filepath.Join(tmpDir, "Playlists"), &mockServiceLogger{})
+	svc.SetVolumes(rockbox.VolumeMap{"": filepath.Join(tmpDir, "ipod"), "microSD1": filepath.Join(tmpDir, "sd")})
+
+	name, err := svc.ExportPlaylist(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("ExportPlaylist() error = %v", err)
+	}
+	data, _ := os.ReadFile(name)
+	for _, want := range []string{"\n/Music/a.mp3\n", "\n/<microSD1>/Music/b.mp3\n"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("playlist should keep %q when the device is not mounted:\n%s", strings.TrimSpace(want), data)
+		}
+	}
+}
+
 func TestPlaylistService_ExportPlaylist_NoSongs(t *testing.T) {
 	tmpDir := t.TempDir()
 
@@ -1211,3 +1327,190 @@ func TestPlaylistRequest_Validate_WithUseAlbumArtist(t *testing.T) {
 		})
 	}
 }
+
+// mockSongRepositoryWithComposer returns different candidates per lookup field
+type mockSongRepositoryWithComposer struct {
+	mockSongRepository
+	composerSongs []*models.Song
+	artistSongs   []*models.Song
+}
+
+func (m *mockSongRepositoryWithComposer) FindByComposer(ctx context.Context, composer string) ([]*models.Song, error) {
+	var result []*models.Song
+	for _, s := range m.composerSongs {
+		if s.Composer == composer {
+			result = append(result, s)
+		}
+	}
+	return result, nil
+}
+
+func (m *mockSongRepositoryWithComposer) FindByArtist(ctx context.Context, artist string) ([]*models.Song, error) {
+	return m.artistSongs, nil
+}
+
+func TestPlaylistService_GeneratePlaylist_UseComposer(t *testing.T) {
+	songs := []*models.Song{
+		{Model: gorm.Model{ID: 1}, Artist: "Berliner Philharmoniker", Composer: "Ludwig van Beethoven", Title: "Symphony No. 5", Path: "/music/beethoven/5.flac"},
+		{Model: gorm.Model{ID: 2}, Artist: "Berliner Philharmoniker", Composer: "Ludwig van Beethoven", Title: "Symphony No. 9", Path: "/music/beethoven/9.flac"},
+	}
+	songRepo := &mockSongRepositoryWithComposer{composerSongs: songs}
+	playlistRepo := &mockPlaylistRepository{}
+
+	svc := NewPlaylistService(songRepo, playlistRepo, "/playlists", &mockServiceLogger{})
+	svc.RegisterClient(models.DataSourceLastFM, &mockAPIClient{
+		source:     models.DataSourceLastFM,
+		configured: true,
+		topTracks: []*api.TrackInfo{
+			{Artist: "Ludwig van Beethoven", Title: "Symphony No. 5"},
+			{Artist: "Ludwig van Beethoven", Title: "Symphony No. 9"},
+		},
+	})
+
+	req := &models.PlaylistRequest{
+		DataSource:  models.DataSourceLastFM,
+		Type:        models.PlaylistTypeTopSongs,
+		Artist:      "Ludwig van Beethoven",
+		Limit:       10,
+		UseComposer: true,
+	}
+
+	playlist, err := svc.GeneratePlaylist(context.Background(), req)
+	if err != nil {
+		t.Fatalf("GeneratePlaylist() with UseComposer error = %v", err)
+	}
+	if playlist.SongCount != 2 {
+		t.Errorf("GeneratePlaylist() with UseComposer SongCount = %d, want 2", playlist.SongCount)
+	}
+
+	// Without UseComposer the composer is never considered
+	req.UseComposer = false
+	if _, err := svc.GeneratePlaylist(context.Background(), req); err != models.ErrNoMatchingSongs {
+		t.Errorf("GeneratePlaylist() without UseComposer error = %v, want ErrNoMatchingSongs", err)
+	}
+}
+
+func TestPlaylistService_GeneratePlaylist_Filters(t *testing.T) {
+	songs := []*models.Song{
+		{Model: gorm.Model{ID: 1}, Artist: "Hans Zimmer", Title: "Time", Grouping: "Inception OST", Path: "/music/zimmer/time.mp3"},
+		{Model: gorm.Model{ID: 2}, Artist: "Hans Zimmer", Title: "Cornfield Chase", Grouping: "Interstellar OST", Path: "/music/zimmer/cornfield.mp3"},
+	}
+	songRepo := &mockSongRepositoryWithAlbumArtist{songs: songs}
+	playlistRepo := &mockPlaylistRepository{}
+
+	svc := NewPlaylistService(songRepo, playlistRepo, "/playlists", &mockServiceLogger{})
+	svc.RegisterClient(models.DataSourceLastFM, &mockAPIClient{
+		source:     models.DataSourceLastFM,
+		configured: true,
+		topTracks: []*api.TrackInfo{
+			{Artist: "Hans Zimmer", Title: "Time"},
+			{Artist: "Hans Zimmer", Title: "Cornfield Chase"},
+		},
+	})
+
+	req := &models.PlaylistRequest{
+		DataSource: models.DataSourceLastFM,
+		Type:       models.PlaylistTypeTopSongs,
+		Artist:     "Hans Zimmer",
+		Limit:      10,
+		Grouping:   "interstellar",
+	}
+
+	playlist, err := svc.GeneratePlaylist(context.Background(), req)
+	if err != nil {
+		t.Fatalf("GeneratePlaylist() with grouping filter error = %v", err)
+	}
+	if playlist.SongCount != 1 {
+		t.Errorf("GeneratePlaylist() with grouping filter SongCount = %d, want 1", playlist.SongCount)
+	}
+
+	req.Grouping = "dune"
+	if _, err := svc.GeneratePlaylist(context.Background(), req); err != models.ErrNoMatchingSongs {
+		t.Errorf("GeneratePlaylist() with unmatched filter error = %v, want ErrNoMatchingSongs", err)
+	}
+}
+
+func TestFilterSongs(t *testing.T) {
+	songs := []*models.Song{
+		{Title: "A", Composer: "John Williams", Comment: "Live", Grouping: "Star Wars"},
+		{Title: "B", Composer: "John Williams", Comment: "", Grouping: "Jurassic Park"},
+		{Title: "C", Composer: "Howard Shore", Comment: "Live", Grouping: "The Lord of the Rings"},
+	}
+
+	tests := []struct {
+		name string
+		req  *models.PlaylistRequest
+		want int
+	}{
+		{"no filters", &models.PlaylistRequest{}, 3},
+		{"composer", &models.PlaylistRequest{Composer: "john williams"}, 2},
+		{"comment", &models.PlaylistRequest{Comment: "LIVE"}, 2},
+		{"grouping", &models.PlaylistRequest{Grouping: "Star"}, 1},
+		{"combined", &models.PlaylistRequest{Composer: "Williams", Comment: "Live"}, 1},
+		{"no match", &models.PlaylistRequest{Composer: "Morricone"}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := filterSongs(songs, tt.req); len(got) != tt.want {
+				t.Errorf("filterSongs() returned %d songs, want %d", len(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestPlaylistService_MatchTracks_ExternalIDs(t *testing.T) {
+	tmpDir := t.TempDir()
+	app, err := NewAppService(tmpDir + "/test.db")
+	if err != nil {
+		t.Fatalf("NewAppService() error = %v", err)
+	}
+	defer func() { _ = app.Close() }()
+	ctx := context.Background()
+
+	songs := []*models.Song{
+		{RockboxID: "1", Path: "/Music/1.mp3", Artist: "Metallica", Title: "Battery"},
+		{RockboxID: "2", Path: "/Music/2.mp3", Artist: "Metallica", Title: "Orion"},
+	}
+	if err := app.songRepo.CreateBatch(ctx, songs); err != nil {
+		t.Fatalf("CreateBatch() error = %v", err)
+	}
+
+	svc := app.playlistService
+	req := &models.PlaylistRequest{DataSource: models.DataSourceSpotify}
+	tracks := []*api.TrackInfo{
+		{ExternalID: "sp-battery", Artist: "Metallica", Title: "Battery"},
+		{Artist: "Metallica", Title: "Orion"}, // no ID to store
+	}
+	_, stats := svc.matchTracks(ctx, tracks, req)
+	if stats.Matched != 2 || stats.MatchedByID != 0 {
+		t.Errorf("first matchTracks() = %+v, want 2 fuzzy matches", *stats)
+	}
+
+	battery, _ := app.songRepo.FindByPath(ctx, "/Music/1.mp3")
+	if battery.SpotifyID != "sp-battery" || battery.MatchedSource != "spotify" || battery.MatchConfidence < 0.99 || battery.MatchedAt == nil {
+		t.Errorf("Battery match = %q/%q/%v/%v, want sp-battery from spotify at 1.0", battery.SpotifyID, battery.MatchedSource, battery.MatchConfidence, battery.MatchedAt)
+	}
+	if orion, _ := app.songRepo.FindByPath(ctx, "/Music/2.mp3"); orion.IsMatched() || orion.MatchedSource != "" {
+		t.Errorf("Orion match = %q, want none without an external ID", orion.MatchedSource)
+	}
+
+	// The stored ID matches although the names no longer compare
+	tracks = []*api.TrackInfo{{ExternalID: "sp-battery", Artist: "メタリカ", Title: "バッテリー"}}
+	matched, stats := svc.matchTracks(ctx, tracks, req)
+	if stats.MatchedByID != 1 || len(matched) != 1 || matched[0].ID != battery.ID {
+		t.Errorf("second matchTracks() = %+v, want Battery matched by ID", *stats)
+	}
+
+	// IDs are kept per source
+	if _, stats := svc.matchTracks(ctx, tracks, &models.PlaylistRequest{DataSource: models.DataSourceMusicBrainz}); stats.Matched != 0 {
+		t.Errorf("matchTracks() with another source matched %d, want 0", stats.Matched)
+	}
+
+	// Last.fm tracks without a MusicBrainz ID are stored by URL
+	tracks = []*api.TrackInfo{{Artist: "Metallica", Title: "Orion", URL: "https://www.last.fm/music/Metallica/_/Orion"}}
+	svc.matchTracks(ctx, tracks, &models.PlaylistRequest{DataSource: models.DataSourceLastFM})
+	if orion, _ := app.songRepo.FindByPath(ctx, "/Music/2.mp3"); orion.LastFMID != tracks[0].URL {
+		t.Errorf("Orion LastFMID = %q, want %q", orion.LastFMID, tracks[0].URL)
+	}
+}
@@ -0,0 +1,196 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Ardakilic/rocklist/internal/models"
+	"github.com/Ardakilic/rocklist/internal/repository"
+	"github.com/Ardakilic/rocklist/internal/rockbox"
+)
+
+// ImportPlays imports the plays logged by the device's Last.fm scrobbler
+// plugin into the play history of the active device. path is the log to
+// read; when empty, .scrobbler.log at the root of the device is read.
+// Plays already in the history are skipped, so a log can be imported again
+// as it grows. Each new play listened to adds one to the play count of its
+// song and moves its last played time forward. The song also keeps the plays
+// it was given, so a re-parse adds them to the device's counts again and
+// PushStats leaves them out. Plays whose song is not in the library yet are
+// counted once a later parse adds it.
+func (s *AppService) ImportPlays(ctx context.Context, path string) (*models.PlayImportResult, error) {
+	logger := NewAppLogger(s.logBuffer)
+
+	if path == "" {
+		rockboxPath := s.GetConfig().RockboxPath
+		if rockboxPath == "" {
+			return nil, models.ErrRockboxPathNotSet
+		}
+		path = filepath.Join(rockboxPath, rockbox.ScrobblerLogFile)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open scrobbler log: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	log, err := rockbox.ReadScrobblerLog(file)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &models.PlayImportResult{Invalid: log.Invalid}
+	matcher := newPlayMatcher(s.songRepo)
+	played := make(map[uint]*models.Song)
+	for _, play := range log.Plays {
+		song, err := matcher.match(ctx, play)
+		if err != nil {
+			return nil, fmt.Errorf("failed to match plays: %w", err)
+		}
+		if song != nil {
+			play.SongID = &song.ID
+		}
+
+		saved, err := s.playRepo.CreateIfNew(ctx, play)
+		if err != nil {
+			return nil, fmt.Errorf("failed to save play: %w", err)
+		}
+		switch {
+		case !saved:
+			result.Duplicates++
+			continue
+		case play.Skipped:
+			result.Skipped++
+		case song == nil:
+			result.Unmatched++
+		default:
+			song.CountPlay(play.PlayedAt)
+			played[song.ID] = song
+			result.Counted++
+		}
+		result.Imported++
+	}
+
+	for _, song := range played {
+		if err := s.songRepo.Update(ctx, song); err != nil {
+			return nil, fmt.Errorf("failed to update imported plays: %w", err)
+		}
+	}
+
+	logger.Info("Imported %d plays from %s: %d counted, %d skipped, %d unmatched, %d already imported",
+		result.Imported, path, result.Counted, result.Skipped, result.Unmatched, result.Duplicates)
+	if result.Invalid > 0 {
+		logger.Info("%d unreadable lines in %s were skipped", result.Invalid, path)
+	}
+	return result, nil
+}
+
+// countUnmatchedPlays matches the listened plays that had no song when they
+// were imported against the songs now in the library, and counts the plays
+// of the songs found. It returns the number of plays counted.
+func (s *AppService) countUnmatchedPlays(ctx context.Context) (int, error) {
+	plays, err := s.playRepo.FindUnmatched(ctx)
+	if err != nil || len(plays) == 0 {
+		return 0, err
+	}
+
+	matcher := newPlayMatcher(s.songRepo)
+	played := make(map[uint]*models.Song)
+	counted := 0
+	for _, play := range plays {
+		song, err := matcher.match(ctx, play)
+		if err != nil {
+			return 0, err
+		}
+		if song == nil {
+			continue
+		}
+		if err := s.playRepo.SetSong(ctx, play.ID, song.ID); err != nil {
+			return 0, err
+		}
+		song.CountPlay(play.PlayedAt)
+		played[song.ID] = song
+		counted++
+	}
+
+	for _, song := range played {
+		if err := s.songRepo.Update(ctx, song); err != nil {
+			return 0, err
+		}
+	}
+	return counted, nil
+}
+
+// playMatcher finds the songs of logged plays. Songs are looked up by path
+// when the log has one, then by artist and title. The songs of an artist
+// are fetched once, and a song found twice is the same value, so counts
+// added to it add up.
+type playMatcher struct {
+	songs    repository.SongRepository
+	byArtist map[string][]*models.Song
+	byID     map[uint]*models.Song
+}
+
+// newPlayMatcher returns a matcher reading songs from songs
+func newPlayMatcher(songs repository.SongRepository) *playMatcher {
+	return &playMatcher{
+		songs:    songs,
+		byArtist: make(map[string][]*models.Song),
+		byID:     make(map[uint]*models.Song),
+	}
+}
+
+// match returns the song of a play, or nil when none matches. Between songs
+// with the same title the one on the logged album wins.
+func (m *playMatcher) match(ctx context.Context, play *models.PlayEvent) (*models.Song, error) {
+	if play.Path != "" {
+		song, err := m.songs.FindByPath(ctx, play.Path)
+		if err == nil {
+			return m.canonical(song), nil
+		}
+		if !errors.Is(err, models.ErrSongNotFound) {
+			return nil, err
+		}
+	}
+
+	songs, ok := m.byArtist[play.Artist]
+	if !ok {
+		found, err := m.songs.FindByArtist(ctx, play.Artist)
+		if err != nil {
+			return nil, err
+		}
+		for i, song := range found {
+			found[i] = m.canonical(song)
+		}
+		m.byArtist[play.Artist] = found
+		songs = found
+	}
+
+	var match *models.Song
+	for _, song := range songs {
+		if !strings.EqualFold(song.Title, play.Title) {
+			continue
+		}
+		if strings.EqualFold(song.Album, play.Album) {
+			return song, nil
+		}
+		if match == nil {
+			match = song
+		}
+	}
+	return match, nil
+}
+
+// canonical returns the value already handed out for song's ID, if any
+func (m *playMatcher) canonical(song *models.Song) *models.Song {
+	if existing, ok := m.byID[song.ID]; ok {
+		return existing
+	}
+	m.byID[song.ID] = song
+	return song
+}
@@ -0,0 +1,239 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Ardakilic/rocklist/internal/models"
+	"github.com/Ardakilic/rocklist/internal/rockbox/tcbuilder"
+)
+
+func TestAppService_ImportPlays(t *testing.T) {
+	tmpDir := t.TempDir()
+	device := filepath.Join(tmpDir, "IPOD")
+
+	svc, err := NewAppService(tmpDir + "/test.db")
+	if err != nil {
+		t.Fatalf("NewAppService() error = %v", err)
+	}
+	defer func() { _ = svc.Close() }()
+	ctx := context.Background()
+
+	if _, err := svc.ImportPlays(ctx, ""); !errors.Is(err, models.ErrRockboxPathNotSet) {
+		t.Errorf("ImportPlays() without a device error = %v, want ErrRockboxPathNotSet", err)
+	}
+
+	_ = svc.SetRockboxPath(device)
+	songs := []*models.Song{
+		{RockboxID: "1", Path: "/Music/Metallica/01 - Battery.mp3", Artist: "Metallica", Album: "Master of Puppets", Title: "Battery", PlayCount: 3},
+		{RockboxID: "2", Path: "/Music/Metallica/Live/Battery.mp3", Artist: "Metallica", Album: "S&M", Title: "Battery"},
+		{RockboxID: "3", Path: "/<microSD1>/Music/Burzum/01 - Dunkelheit.mp3", Artist: "Burzum", Title: "Dunkelheit (Remastered)"},
+	}
+	if err := svc.songRepo.CreateBatch(ctx, songs); err != nil {
+		t.Fatalf("CreateBatch() error = %v", err)
+	}
+
+	writeLog := func(lines string) {
+		t.Helper()
+		log := "#AUDIOSCROBBLER/1.1\n#TZ/UNKNOWN\n#CLIENT/Rockbox ipodvideo $Revision$\n" + lines
+		if err := os.WriteFile(filepath.Join(device, ".scrobbler.log"), []byte(log), 0644); err != nil {
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+	}
+	_ = os.MkdirAll(device, 0755)
+	writeLog("Metallica\tMaster of Puppets\tbattery\t1\t312\tL\t1700000000\t\n" +
+		"Metallica\tMaster of Puppets\tBattery\t1\t312\tL\t1700003600\t\n" +
+		"Metallica\tS&M\tBattery\t1\t420\tS\t1700007200\t\n" +
+		"Burzum\tFilosofem\tDunkelheit\t1\t425\tL\t1700010800\t/<microSD1>/Music/Burzum/01 - Dunkelheit.mp3\n" +
+		"Emperor\tAnthems\tAlsvartr\t2\t300\tL\t1700014400\t\n" +
+		"Truncated\tLine\n")
+
+	result, err := svc.ImportPlays(ctx, "")
+	if err != nil {
+		t.Fatalf("ImportPlays() error = %v", err)
+	}
+	want := models.PlayImportResult{Imported: 5, Counted: 3, Skipped: 1, Unmatched: 1, Invalid: 1}
+	if *result != want {
+		t.Errorf("ImportPlays() = %+v, want %+v", *result, want)
+	}
+
+	battery, _ := svc.songRepo.FindByPath(ctx, songs[0].Path)
+	if battery.PlayCount != 5 || battery.LastPlayed == nil || !battery.LastPlayed.Equal(time.Unix(1700003600, 0)) {
+		t.Errorf("Battery = %d plays, last %v, want 5 plays last at 1700003600", battery.PlayCount, battery.LastPlayed)
+	}
+	if battery.ImportedPlays != 2 || battery.LastImportedPlay == nil || !battery.LastImportedPlay.Equal(time.Unix(1700003600, 0)) {
+		t.Errorf("Battery = %d imported plays, last %v, want 2 plays last at 1700003600", battery.ImportedPlays, battery.LastImportedPlay)
+	}
+	if live, _ := svc.songRepo.FindByPath(ctx, songs[1].Path); live.PlayCount != 0 {
+		t.Errorf("skipped live Battery play count = %d, want 0", live.PlayCount)
+	}
+	// Matched by path although the title differs
+	if dunkelheit, _ := svc.songRepo.FindByPath(ctx, songs[2].Path); dunkelheit.PlayCount != 1 {
+		t.Errorf("Dunkelheit play count = %d, want 1", dunkelheit.PlayCount)
+	}
+	if plays, _ := svc.playRepo.FindBySong(ctx, battery.ID); len(plays) != 2 {
+		t.Errorf("FindBySong() = %d plays, want 2", len(plays))
+	}
+
+	// The log grows; only the new play is counted
+	writeLog("Metallica\tMaster of Puppets\tBattery\t1\t312\tL\t1700003600\t\n" +
+		"Metallica\tMaster of Puppets\tBattery\t1\t312\tL\t1700090000\t\n")
+	result, err = svc.ImportPlays(ctx, filepath.Join(device, ".scrobbler.log"))
+	if err != nil {
+		t.Fatalf("ImportPlays() error = %v", err)
+	}
+	if want := (models.PlayImportResult{Imported: 1, Duplicates: 1, Counted: 1}); *result != want {
+		t.Errorf("second ImportPlays() = %+v, want %+v", *result, want)
+	}
+	if battery, _ := svc.songRepo.FindByPath(ctx, songs[0].Path); battery.PlayCount != 6 || battery.ImportedPlays != 3 {
+		t.Errorf("Battery = %d plays, %d imported, want 6 and 3", battery.PlayCount, battery.ImportedPlays)
+	}
+
+	if _, err := svc.ImportPlays(ctx, filepath.Join(tmpDir, "missing.log")); err == nil {
+		t.Error("ImportPlays() of a missing log should return an error")
+	}
+}
+
+func TestAppService_ImportPlays_Reparse(t *testing.T) {
+	tmpDir := t.TempDir()
+	device := filepath.Join(tmpDir, "IPOD")
+
+	svc, err := NewAppService(tmpDir + "/test.db")
+	if err != nil {
+		t.Fatalf("NewAppService() error = %v", err)
+	}
+	defer func() { _ = svc.Close() }()
+	ctx := context.Background()
+
+	writeDevice := func(serial int32, playCount int) {
+		t.Helper()
+		db := tcbuilder.New([]*models.Song{
+			{Path: "/Music/Battery.mp3", Artist: "Metallica", Title: "Battery", PlayCount: playCount},
+		})
+		db.Serial, db.CommitID = serial, serial
+		if err := db.Write(device); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+	writeDevice(1, 3)
+	if err := svc.SetRockboxPath(device); err != nil {
+		t.Fatalf("SetRockboxPath() error = %v", err)
+	}
+	if _, err := svc.ParseRockboxDatabase(ctx, false); err != nil {
+		t.Fatalf("ParseRockboxDatabase() error = %v", err)
+	}
+
+	log := "#AUDIOSCROBBLER/1.1\n#TZ/UNKNOWN\n#CLIENT/Rockbox ipodvideo $Revision$\n" +
+		"Metallica\tMaster of Puppets\tBattery\t1\t312\tL\t1700000000\t\n" +
+		"Metallica\tMaster of Puppets\tBattery\t1\t312\tL\t1700003600\t\n"
+	if err := os.WriteFile(filepath.Join(device, ".scrobbler.log"), []byte(log), 0644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	if _, err := svc.ImportPlays(ctx, ""); err != nil {
+		t.Fatalf("ImportPlays() error = %v", err)
+	}
+
+	// The imported plays are counted by the device itself, so none are pushed
+	if changes, err := svc.PushStats(ctx, true); err != nil || len(changes) != 0 {
+		t.Errorf("PushStats() = %d changes, %v, want none for imported plays", len(changes), err)
+	}
+
+	// The device counted one more play and rebuilt its database
+	writeDevice(2, 4)
+	if _, err := svc.ParseRockboxDatabase(ctx, false); err != nil {
+		t.Fatalf("ParseRockboxDatabase() error = %v", err)
+	}
+	battery, err := svc.songRepo.FindByPath(ctx, "/Music/Battery.mp3")
+	if err != nil {
+		t.Fatalf("FindByPath() error = %v", err)
+	}
+	if battery.PlayCount != 6 || battery.ImportedPlays != 2 {
+		t.Errorf("Battery = %d plays, %d imported, want the 4 device plays and the 2 imported", battery.PlayCount, battery.ImportedPlays)
+	}
+	if battery.LastPlayed == nil || !battery.LastPlayed.Equal(time.Unix(1700003600, 0)) {
+		t.Errorf("Battery last played = %v, want the last imported play", battery.LastPlayed)
+	}
+
+	// Importing the log again adds nothing
+	result, err := svc.ImportPlays(ctx, "")
+	if err != nil {
+		t.Fatalf("ImportPlays() error = %v", err)
+	}
+	if result.Duplicates != 2 || result.Counted != 0 {
+		t.Errorf("ImportPlays() again = %+v, want 2 duplicates", *result)
+	}
+}
+
+func TestAppService_ImportPlays_SongAddedLater(t *testing.T) {
+	tmpDir := t.TempDir()
+	device := filepath.Join(tmpDir, "IPOD")
+
+	svc, err := NewAppService(tmpDir + "/test.db")
+	if err != nil {
+		t.Fatalf("NewAppService() error = %v", err)
+	}
+	defer func() { _ = svc.Close() }()
+	ctx := context.Background()
+
+	writeDevice := func(serial int32, songs ...*models.Song) {
+		t.Helper()
+		db := tcbuilder.New(songs)
+		db.Serial, db.CommitID = serial, serial
+		if err := db.Write(device); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+	battery := &models.Song{Path: "/Music/Battery.mp3", Artist: "Metallica", Title: "Battery"}
+	orion := &models.Song{Path: "/Music/Orion.mp3", Artist: "Metallica", Title: "Orion"}
+	writeDevice(1, battery)
+	if err := svc.SetRockboxPath(device); err != nil {
+		t.Fatalf("SetRockboxPath() error = %v", err)
+	}
+	if _, err := svc.ParseRockboxDatabase(ctx, false); err != nil {
+		t.Fatalf("ParseRockboxDatabase() error = %v", err)
+	}
+
+	log := "#AUDIOSCROBBLER/1.1\n#TZ/UNKNOWN\n#CLIENT/Rockbox ipodvideo $Revision$\n" +
+		"Metallica\tMaster of Puppets\tOrion\t7\t507\tL\t1700000000\t\n" +
+		"Metallica\tMaster of Puppets\tOrion\t7\t507\tL\t1700003600\t\n" +
+		"Metallica\tMaster of Puppets\tOrion\t7\t507\tS\t1700007200\t\n"
+	if err := os.WriteFile(filepath.Join(device, ".scrobbler.log"), []byte(log), 0644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	result, err := svc.ImportPlays(ctx, "")
+	if err != nil {
+		t.Fatalf("ImportPlays() error = %v", err)
+	}
+	if result.Unmatched != 2 || result.Counted != 0 {
+		t.Errorf("ImportPlays() = %+v, want 2 unmatched", *result)
+	}
+
+	// Orion is copied to the device; the parse that adds it counts its plays
+	writeDevice(2, battery, orion)
+	if _, err := svc.ParseRockboxDatabase(ctx, false); err != nil {
+		t.Fatalf("ParseRockboxDatabase() error = %v", err)
+	}
+	song, err := svc.songRepo.FindByPath(ctx, orion.Path)
+	if err != nil {
+		t.Fatalf("FindByPath() error = %v", err)
+	}
+	if song.PlayCount != 2 || song.ImportedPlays != 2 || song.LastPlayed == nil || !song.LastPlayed.Equal(time.Unix(1700003600, 0)) {
+		t.Errorf("Orion = %d plays, %d imported, last %v, want 2 plays last at 1700003600", song.PlayCount, song.ImportedPlays, song.LastPlayed)
+	}
+	if plays, _ := svc.playRepo.FindBySong(ctx, song.ID); len(plays) != 2 {
+		t.Errorf("FindBySong() = %d plays, want the 2 listened plays", len(plays))
+	}
+
+	// A later parse counts them only once
+	writeDevice(3, battery, orion)
+	if _, err := svc.ParseRockboxDatabase(ctx, false); err != nil {
+		t.Fatalf("ParseRockboxDatabase() error = %v", err)
+	}
+	if song, _ := svc.songRepo.FindByPath(ctx, orion.Path); song.PlayCount != 2 {
+		t.Errorf("Orion play count after another parse = %d, want 2", song.PlayCount)
+	}
+}
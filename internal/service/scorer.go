@@ -0,0 +1,135 @@
+package service
+
+import (
+	"github.com/Ardakilic/rocklist/internal/api"
+	"github.com/Ardakilic/rocklist/internal/models"
+	"github.com/Ardakilic/rocklist/internal/normalize"
+)
+
+// Scorer scores how well an external track matches a local song
+type Scorer interface {
+	// Score returns the match score of track against song (0-1)
+	Score(track *api.TrackInfo, song *models.Song) float64
+	// Threshold returns the lowest score accepted as a match
+	Threshold() float64
+}
+
+// ScorerFactory builds the Scorer for a playlist request
+type ScorerFactory func(req *models.PlaylistRequest) Scorer
+
+// DefaultMatchWeights are used for requests that set no weights. Title
+// counts more than artist; album and duration confirm a match when both
+// sides have them.
+var DefaultMatchWeights = models.MatchWeights{
+	Title:             0.6,
+	Artist:            0.4,
+	Album:             0.2,
+	Duration:          0.2,
+	Threshold:         0.5,
+	DurationTolerance: 5,
+}
+
+// weightedScorer scores the weighted mean of the similarities of title,
+// artist, album and duration
+type weightedScorer struct {
+	weights        models.MatchWeights
+	useAlbumArtist bool
+	useComposer    bool
+}
+
+// NewWeightedScorer returns the default Scorer, weighted by req.Match with
+// DefaultMatchWeights filling in what it leaves unset.
+// When req.UseAlbumArtist is true, the album artist is compared (with fallback to artist).
+// When req.UseComposer is true, the external artist is also compared against the composer.
+func NewWeightedScorer(req *models.PlaylistRequest) Scorer {
+	weights := req.Match
+	if !weights.HasWeights() {
+		weights.Title = DefaultMatchWeights.Title
+		weights.Artist = DefaultMatchWeights.Artist
+		weights.Album = DefaultMatchWeights.Album
+		weights.Duration = DefaultMatchWeights.Duration
+	}
+	if !weights.HasThreshold() {
+		weights.Threshold = DefaultMatchWeights.Threshold
+	}
+	if !weights.HasDurationTolerance() {
+		weights.DurationTolerance = DefaultMatchWeights.DurationTolerance
+	}
+	return &weightedScorer{
+		weights:        weights,
+		useAlbumArtist: req.UseAlbumArtist,
+		useComposer:    req.UseComposer,
+	}
+}
+
+// Score returns the weighted mean of the similarities. Album and duration
+// are left out when either side lacks them, so a song is not penalised for
+// missing tags.
+func (s *weightedScorer) Score(track *api.TrackInfo, song *models.Song) float64 {
+	var total, weight float64
+	add := func(w, score float64) {
+		total += w * score
+		weight += w
+	}
+
+	add(s.weights.Title, stringSimilarity(track.Title, song.Title))
+	add(s.weights.Artist, s.artistScore(track, song))
+	if track.Album != "" && song.Album != "" {
+		add(s.weights.Album, stringSimilarity(track.Album, song.Album))
+	}
+	if track.Duration > 0 && song.Duration > 0 {
+		add(s.weights.Duration, durationScore(track.Duration, song.Duration, s.weights.DurationTolerance))
+	}
+
+	if weight == 0 {
+		return 0
+	}
+	return total / weight
+}
+
+// Threshold returns the lowest score accepted as a match
+func (s *weightedScorer) Threshold() float64 {
+	return s.weights.Threshold
+}
+
+// artistScore compares the external artist with the artist of song.
+// Artists are compared by key so "Beatles, The" scores as "The Beatles".
+func (s *weightedScorer) artistScore(track *api.TrackInfo, song *models.Song) float64 {
+	// Determine which artist field to use for comparison
+	var songArtist string
+	if s.useAlbumArtist {
+		// Use album artist if available, otherwise fall back to artist
+		songArtist = song.AlbumArtist
+		if songArtist == "" {
+			songArtist = song.Artist
+		}
+	} else {
+		// Use effective artist (album artist if available, else artist)
+		songArtist = song.GetEffectiveArtist()
+	}
+
+	score := stringSimilarity(normalize.ArtistKey(track.Artist), normalize.ArtistKey(songArtist))
+	if s.useComposer && song.Composer != "" {
+		// Classical and soundtrack sources often credit the composer as the artist
+		score = max(score, stringSimilarity(normalize.ArtistKey(track.Artist), normalize.ArtistKey(song.Composer)))
+	}
+	return score
+}
+
+// durationScore is 1 for durations (in seconds) at most tolerance apart,
+// falling to 0 at three times the tolerance, where a radio edit or live
+// version is more likely than the same recording. A tolerance of 0 only
+// scores equal durations.
+func durationScore(a, b, tolerance int) float64 {
+	diff := a - b
+	if diff < 0 {
+		diff = -diff
+	}
+	if diff <= tolerance {
+		return 1
+	}
+	if tolerance == 0 {
+		return 0
+	}
+	return max(0, 1-float64(diff-tolerance)/float64(2*tolerance))
+}
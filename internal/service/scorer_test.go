@@ -0,0 +1,171 @@
+package service
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/Ardakilic/rocklist/internal/api"
+	"github.com/Ardakilic/rocklist/internal/models"
+)
+
+func TestWeightedScorer_Score(t *testing.T) {
+	song := &models.Song{Artist: "Metallica", Title: "One", Album: "...And Justice for All", Duration: 446}
+
+	tests := []struct {
+		name    string
+		track   *api.TrackInfo
+		weights models.MatchWeights
+		want    float64
+	}{
+		{
+			name:  "exact match",
+			track: &api.TrackInfo{Artist: "Metallica", Title: "One", Album: "...And Justice for All", Duration: 446},
+			want:  1,
+		},
+		{
+			name:  "no album or duration scores title and artist",
+			track: &api.TrackInfo{Artist: "Megadeth", Title: "One"},
+			want:  0.6 + 0.4*stringSimilarity("megadeth", "metallica"),
+		},
+		{
+			name:  "duration within tolerance",
+			track: &api.TrackInfo{Artist: "Metallica", Title: "One", Duration: 450},
+			want:  1,
+		},
+		{
+			name:  "radio edit duration",
+			track: &api.TrackInfo{Artist: "Metallica", Title: "One", Duration: 300},
+			want:  1.0 / 1.2,
+		},
+		{
+			name:  "other album",
+			track: &api.TrackInfo{Artist: "Metallica", Title: "One", Album: "S&M", Duration: 446},
+			want:  (1.2 + 0.2*stringSimilarity("S&M", "...And Justice for All")) / 1.4,
+		},
+		{
+			name:    "title only",
+			track:   &api.TrackInfo{Artist: "Megadeth", Title: "One", Duration: 200},
+			weights: models.MatchWeights{Title: 1},
+			want:    1,
+		},
+		{
+			name:    "duration counts as much as title",
+			track:   &api.TrackInfo{Artist: "Metallica", Title: "One", Duration: 200},
+			weights: models.MatchWeights{Title: 1, Duration: 1},
+			want:    0.5,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scorer := NewWeightedScorer(&models.PlaylistRequest{Match: tt.weights})
+			if got := scorer.Score(tt.track, song); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("Score() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWeightedScorer_Composer(t *testing.T) {
+	track := &api.TrackInfo{Artist: "Hans Zimmer", Title: "Cornfield Chase"}
+	song := &models.Song{Artist: "Various Artists", Title: "Cornfield Chase", Composer: "Hans Zimmer"}
+
+	if got := NewWeightedScorer(&models.PlaylistRequest{}).Score(track, song); got >= 0.99 {
+		t.Errorf("Score() = %v, want the artist to differ without UseComposer", got)
+	}
+	if got := NewWeightedScorer(&models.PlaylistRequest{UseComposer: true}).Score(track, song); got != 1 {
+		t.Errorf("Score() with UseComposer = %v, want 1", got)
+	}
+}
+
+func TestWeightedScorer_Threshold(t *testing.T) {
+	if got := NewWeightedScorer(&models.PlaylistRequest{}).Threshold(); got != DefaultMatchWeights.Threshold {
+		t.Errorf("Threshold() = %v, want %v", got, DefaultMatchWeights.Threshold)
+	}
+	req := &models.PlaylistRequest{Match: models.MatchWeights{Threshold: 0.9}}
+	if got := NewWeightedScorer(req).Threshold(); got != 0.9 {
+		t.Errorf("Threshold() = %v, want 0.9", got)
+	}
+	// A threshold set to 0 accepts every match
+	req = &models.PlaylistRequest{Match: models.MatchWeights{ThresholdSet: true}}
+	if got := NewWeightedScorer(req).Threshold(); got != 0 {
+		t.Errorf("Threshold() = %v, want 0", got)
+	}
+}
+
+func TestWeightedScorer_ExactDuration(t *testing.T) {
+	song := &models.Song{Artist: "Metallica", Title: "One", Duration: 446}
+	track := &api.TrackInfo{Artist: "Metallica", Title: "One", Duration: 447}
+
+	if got := NewWeightedScorer(&models.PlaylistRequest{}).Score(track, song); got != 1 {
+		t.Errorf("Score() = %v, want 1 within the default tolerance", got)
+	}
+	exact := &models.PlaylistRequest{Match: models.MatchWeights{DurationToleranceSet: true}}
+	if got := NewWeightedScorer(exact).Score(track, song); got != 1/1.2 {
+		t.Errorf("Score() with a tolerance of 0 = %v, want %v", got, 1/1.2)
+	}
+}
+
+func TestDurationScore(t *testing.T) {
+	tests := []struct {
+		a, b, tolerance int
+		want            float64
+	}{
+		{200, 200, 5, 1},
+		{200, 205, 5, 1},
+		{205, 200, 5, 1},
+		{200, 210, 5, 0.5},
+		{200, 215, 5, 0},
+		{200, 300, 5, 0},
+		{200, 200, 0, 1},
+		{200, 201, 0, 0},
+	}
+
+	for _, tt := range tests {
+		if got := durationScore(tt.a, tt.b, tt.tolerance); got != tt.want {
+			t.Errorf("durationScore(%d, %d, %d) = %v, want %v", tt.a, tt.b, tt.tolerance, got, tt.want)
+		}
+	}
+}
+
+func TestPlaylistService_MatchTracks_Scorer(t *testing.T) {
+	ctx := context.Background()
+	songRepo := &mockSongRepository{songs: []*models.Song{
+		{Artist: "Metallica", Title: "The Unforgiven II"},
+	}}
+	svc := NewPlaylistService(songRepo, &mockPlaylistRepository{}, t.TempDir(), &mockServiceLogger{})
+	tracks := []*api.TrackInfo{{Artist: "Metallica", Title: "The Unforgiven"}}
+
+	if _, stats := svc.matchTracks(ctx, tracks, &models.PlaylistRequest{}); stats.Matched != 1 {
+		t.Errorf("matchTracks() matched %d, want 1 at the default threshold", stats.Matched)
+	}
+	strict := &models.PlaylistRequest{Match: models.MatchWeights{Threshold: 0.95}}
+	if _, stats := svc.matchTracks(ctx, tracks, strict); stats.Matched != 0 {
+		t.Errorf("matchTracks() matched %d, want 0 at threshold 0.95", stats.Matched)
+	}
+
+	// A custom scorer replaces the default one
+	svc.SetScorer(func(req *models.PlaylistRequest) Scorer { return rejectingScorer{} })
+	if _, stats := svc.matchTracks(ctx, tracks, &models.PlaylistRequest{}); stats.Matched != 0 {
+		t.Errorf("matchTracks() matched %d with a scorer rejecting everything", stats.Matched)
+	}
+
+	// A threshold of 0 accepts a candidate scoring 0
+	svc.SetScorer(func(req *models.PlaylistRequest) Scorer { return zeroScorer{} })
+	if _, stats := svc.matchTracks(ctx, tracks, &models.PlaylistRequest{}); stats.Matched != 1 {
+		t.Errorf("matchTracks() matched %d at threshold 0, want 1", stats.Matched)
+	}
+}
+
+// rejectingScorer scores every track below its threshold
+type rejectingScorer struct{}
+
+func (rejectingScorer) Score(track *api.TrackInfo, song *models.Song) float64 { return 0.9 }
+func (rejectingScorer) Threshold() float64                                    { return 1 }
+
+// zeroScorer scores every track 0 and accepts it
+type zeroScorer struct{}
+
+func (zeroScorer) Score(track *api.TrackInfo, song *models.Song) float64 { return 0 }
+func (zeroScorer) Threshold() float64                                    { return 0 }
@@ -0,0 +1,283 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Ardakilic/rocklist/internal/models"
+	"github.com/Ardakilic/rocklist/internal/repository"
+	"github.com/Ardakilic/rocklist/internal/rockbox"
+)
+
+// DefaultWatchInterval is how often the watcher checks for the device
+const DefaultWatchInterval = 5 * time.Second
+
+// WatchSummary is the outcome of syncing a device that was mounted
+type WatchSummary struct {
+	// Device is the name of the synced device, mounted at Path
+	Device string
+	Path   string
+	// Sync is the parse result; Sync.Skipped is set when the TagCache was unchanged
+	Sync *models.SyncResult
+	// Playlists are the regenerated and exported playlists
+	Playlists []*models.Playlist
+	// Failures holds an error for each watch playlist that could not be
+	// generated or exported, or whose previous version could not be removed
+	Failures []error
+}
+
+// String returns a one-line summary for the log
+func (w *WatchSummary) String() string {
+	parse := "database unchanged"
+	if !w.Sync.Skipped {
+		parse = fmt.Sprintf("%d added, %d removed, %d changed", w.Sync.Added, w.Sync.Removed, w.Sync.Changed)
+	}
+	return fmt.Sprintf("%s at %s: %s; %d playlists exported, %d failed",
+		w.Device, w.Path, parse, len(w.Playlists), len(w.Failures))
+}
+
+// GetWatchPlaylists returns the playlist requests regenerated each time the
+// active device is mounted. Every device keeps its own list.
+func (s *AppService) GetWatchPlaylists(ctx context.Context) ([]*models.PlaylistRequest, error) {
+	value, err := s.configRepo.Get(ctx, s.watchPlaylistsKey())
+	if errors.Is(err, models.ErrConfigNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var requests []*models.PlaylistRequest
+	if err := json.Unmarshal([]byte(value), &requests); err != nil {
+		return nil, fmt.Errorf("invalid watch playlists: %w", err)
+	}
+	return requests, nil
+}
+
+// AddWatchPlaylist adds a playlist request to the watch list of the active
+// device. A request that is already on the list is not added twice.
+func (s *AppService) AddWatchPlaylist(ctx context.Context, req *models.PlaylistRequest) error {
+	if err := req.Validate(); err != nil {
+		return err
+	}
+
+	requests, err := s.GetWatchPlaylists(ctx)
+	if err != nil {
+		return err
+	}
+	for _, r := range requests {
+		if *r == *req {
+			return nil
+		}
+	}
+	return s.saveWatchPlaylists(ctx, append(requests, req))
+}
+
+// RemoveWatchPlaylist removes the watch playlist at index, counting from 0
+func (s *AppService) RemoveWatchPlaylist(ctx context.Context, index int) error {
+	requests, err := s.GetWatchPlaylists(ctx)
+	if err != nil {
+		return err
+	}
+	if index < 0 || index >= len(requests) {
+		return fmt.Errorf("%w: no watch playlist %d", models.ErrInvalidInput, index+1)
+	}
+	return s.saveWatchPlaylists(ctx, append(requests[:index], requests[index+1:]...))
+}
+
+// saveWatchPlaylists stores the watch list of the active device; an empty
+// list is stored as [] for the same reason as in saveVolumes
+func (s *AppService) saveWatchPlaylists(ctx context.Context, requests []*models.PlaylistRequest) error {
+	if requests == nil {
+		requests = []*models.PlaylistRequest{}
+	}
+	data, err := json.Marshal(requests)
+	if err != nil {
+		return err
+	}
+	return s.configRepo.Set(ctx, s.watchPlaylistsKey(), string(data))
+}
+
+// watchPlaylistsKey returns the config key of the active device's watch list
+func (s *AppService) watchPlaylistsKey() string {
+	return fmt.Sprintf("%s%d", repository.ConfigKeyWatchPlaylistsPrefix, s.ActiveDevice().ID)
+}
+
+// MountedDevices returns the known devices that are mounted, that is whose
+// TagCache index can be found at their path. The active device comes first,
+// then the others by name; of several devices sharing a path only the first
+// is returned.
+func (s *AppService) MountedDevices(ctx context.Context) ([]*models.Device, error) {
+	devices, err := s.deviceRepo.FindAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	active := s.ActiveDevice()
+	candidates := []*models.Device{active}
+	for _, device := range devices {
+		if device.ID != active.ID {
+			candidates = append(candidates, device)
+		}
+	}
+
+	seen := make(map[string]bool, len(candidates))
+	var mounted []*models.Device
+	for _, device := range candidates {
+		if device.Path == "" || seen[device.Path] || !tagCacheMounted(device.Path) {
+			continue
+		}
+		seen[device.Path] = true
+		mounted = append(mounted, device)
+	}
+	return mounted, nil
+}
+
+// tagCacheMounted reports whether the TagCache index can be found under root
+func tagCacheMounted(root string) bool {
+	info, err := os.Stat(filepath.Join(root, rockbox.TagCacheDir, rockbox.DatabaseFile))
+	return err == nil && info.Mode().IsRegular()
+}
+
+// SyncDevice makes the named device the active one and brings its library
+// and watch playlists up to date with it. The parse is skipped when the
+// TagCache is unchanged. Every watch playlist is then regenerated and
+// exported, replacing the playlist of the same name generated before. A
+// playlist that fails does not stop the others; it is reported in the
+// summary's Failures instead.
+func (s *AppService) SyncDevice(ctx context.Context, name string) (*WatchSummary, error) {
+	logger := NewAppLogger(s.logBuffer)
+
+	if _, err := s.SelectDevice(ctx, name); err != nil {
+		return nil, err
+	}
+	requests, err := s.GetWatchPlaylists(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := s.ParseRockboxDatabase(ctx, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse database: %w", err)
+	}
+
+	summary := &WatchSummary{Device: name, Path: s.GetConfig().RockboxPath, Sync: result}
+	for _, req := range requests {
+		fail := func(err error) {
+			summary.Failures = append(summary.Failures, fmt.Errorf("%s %s: %w", req.Type.DisplayName(), watchTarget(req), err))
+		}
+
+		playlist, err := s.playlistService.GeneratePlaylist(ctx, req)
+		if err != nil {
+			fail(err)
+			continue
+		}
+		// The previous playlist stays until the new one is on the device
+		if _, err := s.playlistService.ExportPlaylist(ctx, playlist.ID); err != nil {
+			fail(fmt.Errorf("failed to export %q: %w", playlist.Name, err))
+			continue
+		}
+		summary.Playlists = append(summary.Playlists, playlist)
+		if err := s.replacePlaylist(ctx, playlist); err != nil {
+			fail(fmt.Errorf("failed to remove the previous %q: %w", playlist.Name, err))
+		}
+	}
+
+	logger.Info("Synced %s", summary)
+	return summary, nil
+}
+
+// replacePlaylist deletes the older playlists with the name of playlist. Their
+// export was overwritten by the new one, so only the records are removed.
+func (s *AppService) replacePlaylist(ctx context.Context, playlist *models.Playlist) error {
+	playlists, err := s.playlistRepo.FindAll(ctx)
+	if err != nil {
+		return err
+	}
+	for _, p := range playlists {
+		if p.ID != playlist.ID && p.Name == playlist.Name {
+			if err := s.playlistRepo.Delete(ctx, p.ID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// watchTarget names the artist or tag of a watch playlist
+func watchTarget(req *models.PlaylistRequest) string {
+	if req.Type == models.PlaylistTypeTag {
+		return req.Tag
+	}
+	return req.Artist
+}
+
+// Watcher syncs a known device each time it is mounted. It polls for the
+// devices, since mount notifications differ on every platform.
+type Watcher struct {
+	app      *AppService
+	interval time.Duration
+	// mounted holds the names of the devices mounted at the last poll, by ID
+	mounted map[uint]string
+	// onSync is called after every sync attempt
+	onSync func(*WatchSummary, error)
+}
+
+// NewWatcher returns a watcher checking for the device every interval
+func NewWatcher(app *AppService, interval time.Duration, onSync func(*WatchSummary, error)) *Watcher {
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+	return &Watcher{app: app, interval: interval, mounted: make(map[uint]string), onSync: onSync}
+}
+
+// Run watches until ctx is cancelled. Devices that are already mounted are
+// synced right away.
+func (w *Watcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		w.poll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll syncs each device mounted since the last poll. A failed sync is not
+// retried until the device is mounted again.
+func (w *Watcher) poll(ctx context.Context) {
+	logger := NewAppLogger(w.app.logBuffer)
+
+	devices, err := w.app.MountedDevices(ctx)
+	if err != nil {
+		logger.Error("Failed to look for devices: %v", err)
+		return
+	}
+
+	mounted := make(map[uint]string, len(devices))
+	for _, device := range devices {
+		mounted[device.ID] = device.Name
+		if _, ok := w.mounted[device.ID]; ok {
+			continue
+		}
+		summary, err := w.app.SyncDevice(ctx, device.Name)
+		if w.onSync != nil {
+			w.onSync(summary, err)
+		}
+	}
+	for id, name := range w.mounted {
+		if _, ok := mounted[id]; !ok {
+			logger.Info("Device %s unmounted, waiting for it to come back", name)
+		}
+	}
+	w.mounted = mounted
+}
@@ -0,0 +1,246 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Ardakilic/rocklist/internal/api"
+	"github.com/Ardakilic/rocklist/internal/models"
+	"github.com/Ardakilic/rocklist/internal/rockbox/tcbuilder"
+)
+
+func TestAppService_WatchPlaylists(t *testing.T) {
+	svc, err := NewAppService(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("NewAppService() error = %v", err)
+	}
+	defer func() { _ = svc.Close() }()
+	ctx := context.Background()
+
+	metallica := &models.PlaylistRequest{DataSource: models.DataSourceLastFM, Type: models.PlaylistTypeTopSongs, Artist: "Metallica"}
+	doom := &models.PlaylistRequest{DataSource: models.DataSourceSpotify, Type: models.PlaylistTypeTag, Tag: "doom", Limit: 20}
+
+	for _, req := range []*models.PlaylistRequest{metallica, doom, metallica} {
+		if err := svc.AddWatchPlaylist(ctx, req); err != nil {
+			t.Fatalf("AddWatchPlaylist() error = %v", err)
+		}
+	}
+	if err := svc.AddWatchPlaylist(ctx, &models.PlaylistRequest{Type: models.PlaylistTypeTag}); err == nil {
+		t.Error("AddWatchPlaylist() should reject an invalid request")
+	}
+
+	requests, err := svc.GetWatchPlaylists(ctx)
+	if err != nil {
+		t.Fatalf("GetWatchPlaylists() error = %v", err)
+	}
+	if len(requests) != 2 || requests[0].Artist != "Metallica" || requests[0].Limit != 50 || requests[1].Tag != "doom" {
+		t.Fatalf("GetWatchPlaylists() = %+v, want Metallica with the default limit and doom", requests)
+	}
+
+	if err := svc.RemoveWatchPlaylist(ctx, 2); !errors.Is(err, models.ErrInvalidInput) {
+		t.Errorf("RemoveWatchPlaylist(2) error = %v, want ErrInvalidInput", err)
+	}
+	for range 2 {
+		if err := svc.RemoveWatchPlaylist(ctx, 0); err != nil {
+			t.Fatalf("RemoveWatchPlaylist() error = %v", err)
+		}
+	}
+	if err := svc.AddWatchPlaylist(ctx, doom); err != nil {
+		t.Fatalf("AddWatchPlaylist() error = %v", err)
+	}
+	if requests, _ := svc.GetWatchPlaylists(ctx); len(requests) != 1 || requests[0].Tag != "doom" {
+		t.Errorf("GetWatchPlaylists() = %+v, want doom only", requests)
+	}
+
+	// Another device has its own list
+	if _, err := svc.SelectDevice(ctx, "fuze"); err != nil {
+		t.Fatalf("SelectDevice() error = %v", err)
+	}
+	if requests, _ := svc.GetWatchPlaylists(ctx); len(requests) != 0 {
+		t.Errorf("GetWatchPlaylists() of another device = %+v, want none", requests)
+	}
+	if err := svc.AddWatchPlaylist(ctx, metallica); err != nil {
+		t.Fatalf("AddWatchPlaylist() error = %v", err)
+	}
+	if _, err := svc.SelectDevice(ctx, models.DefaultDeviceName); err != nil {
+		t.Fatalf("SelectDevice() error = %v", err)
+	}
+	if requests, _ := svc.GetWatchPlaylists(ctx); len(requests) != 1 || requests[0].Tag != "doom" {
+		t.Errorf("GetWatchPlaylists() back on the first device = %+v, want doom only", requests)
+	}
+}
+
+func TestWatcher_Poll(t *testing.T) {
+	tmpDir := t.TempDir()
+	device := filepath.Join(tmpDir, "IPOD")
+
+	svc, err := NewAppService(tmpDir + "/test.db")
+	if err != nil {
+		t.Fatalf("NewAppService() error = %v", err)
+	}
+	defer func() { _ = svc.Close() }()
+	ctx := context.Background()
+
+	if err := svc.SetRockboxPath(device); err != nil {
+		t.Fatalf("SetRockboxPath() error = %v", err)
+	}
+	// Last.fm has no credentials, so this playlist fails without stopping the sync
+	_ = svc.AddWatchPlaylist(ctx, &models.PlaylistRequest{
+		DataSource: models.DataSourceLastFM, Type: models.PlaylistTypeTopSongs, Artist: "Metallica",
+	})
+
+	var summaries []*WatchSummary
+	watcher := NewWatcher(svc, 0, func(summary *WatchSummary, err error) {
+		if err != nil {
+			t.Fatalf("sync error = %v", err)
+		}
+		summaries = append(summaries, summary)
+	})
+
+	watcher.poll(ctx)
+	if len(summaries) != 0 {
+		t.Fatal("poll() synced without a device")
+	}
+
+	// Plugging the device in syncs it once
+	writeTestTagCache(t, device, 1, 1, []string{"/Music/a.mp3", "/Music/b.mp3"})
+	watcher.poll(ctx)
+	watcher.poll(ctx)
+	if len(summaries) != 1 {
+		t.Fatalf("poll() synced %d times, want 1", len(summaries))
+	}
+	summary := summaries[0]
+	if summary.Path != device || summary.Sync.Added != 2 || len(summary.Failures) != 1 ||
+		!errors.Is(summary.Failures[0], models.ErrDataSourceDisabled) {
+		t.Errorf("summary = %+v, want 2 songs added and one failed playlist", summary)
+	}
+	if !strings.Contains(summary.String(), "2 added") {
+		t.Errorf("String() = %q", summary.String())
+	}
+
+	// Plugging it in again with an unchanged database skips the parse
+	_ = os.RemoveAll(device)
+	watcher.poll(ctx)
+	writeTestTagCache(t, device, 1, 1, []string{"/Music/a.mp3", "/Music/b.mp3"})
+	watcher.poll(ctx)
+	if len(summaries) != 2 || !summaries[1].Sync.Skipped {
+		t.Errorf("summaries = %+v, want a second sync with the parse skipped", summaries)
+	}
+
+	// Another known device is noticed too, and synced with its own watch list
+	fuze := filepath.Join(tmpDir, "FUZE")
+	if _, err := svc.SelectDevice(ctx, "fuze"); err != nil {
+		t.Fatalf("SelectDevice() error = %v", err)
+	}
+	if err := svc.SetRockboxPath(fuze); err != nil {
+		t.Fatalf("SetRockboxPath() error = %v", err)
+	}
+	if _, err := svc.SelectDevice(ctx, models.DefaultDeviceName); err != nil {
+		t.Fatalf("SelectDevice() error = %v", err)
+	}
+	writeTestTagCache(t, fuze, 1, 1, []string{"/Music/c.mp3"})
+	watcher.poll(ctx)
+	watcher.poll(ctx)
+	if len(summaries) != 3 {
+		t.Fatalf("poll() synced %d times, want 3", len(summaries))
+	}
+	if summary := summaries[2]; summary.Device != "fuze" || summary.Path != fuze || summary.Sync.Added != 1 || len(summary.Failures) != 0 {
+		t.Errorf("summary = %+v, want fuze synced with 1 song added and no watch playlists", summary)
+	}
+	if active := svc.ActiveDevice(); active.Name != "fuze" {
+		t.Errorf("ActiveDevice() = %s, want the synced fuze", active.Name)
+	}
+}
+
+func TestAppService_SyncDevice_ExportFailure(t *testing.T) {
+	tmpDir := t.TempDir()
+	device := filepath.Join(tmpDir, "IPOD")
+
+	svc, err := NewAppService(tmpDir + "/test.db")
+	if err != nil {
+		t.Fatalf("NewAppService() error = %v", err)
+	}
+	defer func() { _ = svc.Close() }()
+	ctx := context.Background()
+
+	db := tcbuilder.New([]*models.Song{{Path: "/Music/Battery.mp3", Artist: "Metallica", Title: "Battery"}})
+	if err := db.Write(device); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if err := svc.SetRockboxPath(device); err != nil {
+		t.Fatalf("SetRockboxPath() error = %v", err)
+	}
+	svc.playlistService.RegisterClient(models.DataSourceLastFM, &mockAPIClient{
+		source: models.DataSourceLastFM, configured: true,
+		topTracks: []*api.TrackInfo{{Artist: "Metallica", Title: "Battery"}},
+	})
+	_ = svc.AddWatchPlaylist(ctx, &models.PlaylistRequest{
+		DataSource: models.DataSourceLastFM, Type: models.PlaylistTypeTopSongs, Artist: "Metallica",
+	})
+
+	// The song's file is not on the device, so nothing can be exported
+	summary, err := svc.SyncDevice(ctx, models.DefaultDeviceName)
+	if err != nil {
+		t.Fatalf("SyncDevice() error = %v", err)
+	}
+	if len(summary.Playlists) != 0 || len(summary.Failures) != 1 || !errors.Is(summary.Failures[0], models.ErrNoMatchingSongs) {
+		t.Errorf("summary = %+v, want the playlist reported as failed", summary)
+	}
+
+	if err := os.MkdirAll(filepath.Join(device, "Music"), 0755); err != nil {
+		t.Fatalf("MkdirAll() error = %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(device, "Music", "Battery.mp3"), nil, 0644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	summary, err = svc.SyncDevice(ctx, models.DefaultDeviceName)
+	if err != nil {
+		t.Fatalf("SyncDevice() error = %v", err)
+	}
+	if len(summary.Playlists) != 1 || len(summary.Failures) != 0 {
+		t.Fatalf("summary = %+v, want the playlist exported", summary)
+	}
+	if _, err := os.Stat(filepath.Join(device, "Playlists", summary.Playlists[0].Name+".m3u8")); err != nil {
+		t.Errorf("exported playlist: %v", err)
+	}
+	// The playlist that failed to export was replaced too
+	if playlists, _ := svc.GetAllPlaylists(ctx); len(playlists) != 1 {
+		t.Errorf("GetAllPlaylists() = %d playlists, want 1", len(playlists))
+	}
+}
+
+func TestAppService_ReplacePlaylist(t *testing.T) {
+	svc, err := NewAppService(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("NewAppService() error = %v", err)
+	}
+	defer func() { _ = svc.Close() }()
+	ctx := context.Background()
+
+	old := &models.Playlist{Name: "Top Songs - Metallica (Last.fm)", Type: models.PlaylistTypeTopSongs}
+	other := &models.Playlist{Name: "Doom Radio (Last.fm)", Type: models.PlaylistTypeTag}
+	current := &models.Playlist{Name: old.Name, Type: models.PlaylistTypeTopSongs}
+	for _, p := range []*models.Playlist{old, other, current} {
+		if err := svc.playlistRepo.Create(ctx, p); err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+	}
+
+	if err := svc.replacePlaylist(ctx, current); err != nil {
+		t.Fatalf("replacePlaylist() error = %v", err)
+	}
+
+	playlists, _ := svc.GetAllPlaylists(ctx)
+	if len(playlists) != 2 {
+		t.Fatalf("GetAllPlaylists() = %d playlists, want 2", len(playlists))
+	}
+	for _, p := range playlists {
+		if p.ID == old.ID {
+			t.Error("the older playlist of the same name should be deleted")
+		}
+	}
+}